@@ -146,7 +146,7 @@ func (r *AcquisitionEras) Decode(reader io.Reader) error {
 
 // InsertAcquisitionEras DBS API
 func (a *API) InsertAcquisitionEras() error {
-	err := insertRecord(&AcquisitionEras{CREATE_BY: a.CreateBy}, a.Reader)
+	err := a.insertRecord(&AcquisitionEras{CREATE_BY: a.CreateBy}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.acquisitioneras.InsertAcquisitionEras")
 	}
@@ -199,6 +199,9 @@ func (a *API) UpdateAcquisitionEras() error {
 	}
 	defer tx.Rollback()
 
+	if err := a.updateHook(tx); err != nil {
+		return err
+	}
 	_, err = tx.Exec(stm, endDate, aera)
 	if err != nil {
 		e := Error(err, InsertErrorCode, "", "dbs.UpdateAckquisitionEras")
@@ -207,7 +210,7 @@ func (a *API) UpdateAcquisitionEras() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		e := Error(err, CommitErrorCode, "", "dbs.UpdateAckquisitionEras")
 		log.Println(e)
@@ -86,7 +86,7 @@ func (r *ApplicationExecutables) Decode(reader io.Reader) error {
 
 // InsertApplicationExecutables DBS API
 func (a *API) InsertApplicationExecutables() error {
-	err := insertRecord(&ApplicationExecutables{}, a.Reader)
+	err := a.insertRecord(&ApplicationExecutables{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.appexec.InsertApplicationExecutables")
 	}
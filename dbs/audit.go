@@ -0,0 +1,245 @@
+package dbs
+
+// audit module provides audit trail of DBS write APIs
+//
+// Every successful write API call is recorded in AUDIT_TRAIL table along
+// with the actor, API parameters and state of affected records before and
+// after the write. The update APIs (PUT) record state of updated dataset,
+// block, file or acquisition era, while insert APIs (POST) record their
+// payload (or its summary for large payloads).
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// AuditMaxPayloadSize defines max size of POST payload stored in audit trail
+// as is, larger payloads are stored as their summary
+var AuditMaxPayloadSize = 4096
+
+// Audit DBS API
+func (a *API) Audit() error {
+	var args []interface{}
+	var conds []string
+
+	conds, args = AddParam("dataset", "A.DATASET", a.Params, conds, args)
+	conds, args = AddParam("block_name", "A.BLOCK_NAME", a.Params, conds, args)
+	conds, args = AddParam("logical_file_name", "A.LOGICAL_FILE_NAME", a.Params, conds, args)
+	conds, args = AddParam("create_by", "A.CREATE_BY", a.Params, conds, args)
+	conds, args = AddParam("dn", "A.DN", a.Params, conds, args)
+	conds, args = AddParam("audit_api", "A.API", a.Params, conds, args)
+
+	minDate := getValues(a.Params, "min_cdate")
+	maxDate := getValues(a.Params, "max_cdate")
+	if len(minDate) == 1 {
+		_, minval := OperatorValue(minDate[0])
+		conds = append(conds, fmt.Sprintf(" A.CREATION_DATE >= %s", placeholder("min_cdate")))
+		args = append(args, minval)
+	}
+	if len(maxDate) == 1 {
+		_, maxval := OperatorValue(maxDate[0])
+		conds = append(conds, fmt.Sprintf(" A.CREATION_DATE <= %s", placeholder("max_cdate")))
+		args = append(args, maxval)
+	}
+
+	// get SQL statement from static area
+	stm := getSQL("audit")
+	stm = WhereClause(stm, conds)
+	stm += " ORDER BY A.AUDIT_ID"
+
+	// use generic query API to fetch the results from DB
+	err := executeAll(a.Writer, a.Separator, stm, args...)
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.audit.Audit")
+	}
+	return nil
+}
+
+// AuditRecord represents audit trail record of DBS write API
+type AuditRecord struct {
+	AUDIT_ID          int64  `json:"audit_id"`
+	API               string `json:"api" validate:"required"`
+	METHOD            string `json:"method" validate:"required"`
+	DN                string `json:"dn"`
+	DATASET           string `json:"dataset"`
+	BLOCK_NAME        string `json:"block_name"`
+	LOGICAL_FILE_NAME string `json:"logical_file_name"`
+	PARAMETERS        string `json:"parameters"`
+	OLD_VALUES        string `json:"old_values"`
+	NEW_VALUES        string `json:"new_values"`
+	CREATION_DATE     int64  `json:"creation_date" validate:"required,number"`
+	CREATE_BY         string `json:"create_by" validate:"required"`
+}
+
+// Insert implementation of AuditRecord
+func (r *AuditRecord) Insert(tx *sql.Tx) error {
+	var tid int64
+	var err error
+	if r.AUDIT_ID == 0 {
+		if DBOWNER == "sqlite" {
+			tid, err = LastInsertID(tx, "AUDIT_TRAIL", "audit_id")
+			r.AUDIT_ID = tid + 1
+		} else {
+			tid, err = IncrementSequence(tx, "SEQ_AT")
+			r.AUDIT_ID = tid
+		}
+		if err != nil {
+			return Error(err, LastInsertErrorCode, "", "dbs.audit.Insert")
+		}
+	}
+	// set defaults and validate the record
+	r.SetDefaults()
+	err = r.Validate()
+	if err != nil {
+		log.Println("unable to validate record", err)
+		return Error(err, ValidateErrorCode, "", "dbs.audit.Insert")
+	}
+
+	// get SQL statement from static area
+	stm := getSQL("insert_audit")
+	if utils.VERBOSE > 0 {
+		log.Printf("Insert AuditTrail\n%s\n%+v", stm, r)
+	}
+	_, err = tx.Exec(stm,
+		r.AUDIT_ID, r.API, r.METHOD, r.DN,
+		r.DATASET, r.BLOCK_NAME, r.LOGICAL_FILE_NAME,
+		r.PARAMETERS, r.OLD_VALUES, r.NEW_VALUES,
+		r.CREATION_DATE, r.CREATE_BY)
+	if err != nil {
+		return Error(err, InsertErrorCode, "", "dbs.audit.Insert")
+	}
+	return nil
+}
+
+// Validate implementation of AuditRecord
+func (r *AuditRecord) Validate() error {
+	if err := RecordValidator.Struct(*r); err != nil {
+		return DecodeValidatorError(r, err)
+	}
+	return nil
+}
+
+// SetDefaults implements set defaults for AuditRecord
+func (r *AuditRecord) SetDefaults() {
+	if r.CREATION_DATE == 0 {
+		r.CREATION_DATE = Date()
+	}
+	if r.DATASET == "" && r.BLOCK_NAME != "" {
+		r.DATASET = strings.Split(r.BLOCK_NAME, "#")[0]
+	}
+}
+
+// InsertAudit inserts audit trail record into DBS database
+func InsertAudit(r *AuditRecord) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.audit.InsertAudit")
+	}
+	defer tx.Rollback()
+	err = r.Insert(tx)
+	if err != nil {
+		return Error(err, InsertErrorCode, "", "dbs.audit.InsertAudit")
+	}
+	err = tx.Commit()
+	if err != nil {
+		return Error(err, CommitErrorCode, "", "dbs.audit.InsertAudit")
+	}
+	return nil
+}
+
+// AuditState returns current state of records affected by given update
+// API and its parameters within given transaction. It returns nil for APIs
+// which are not audited by their state.
+func AuditState(tx *sql.Tx, api string, params Record) ([]Record, error) {
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	var arg string
+	switch api {
+	case "datasets":
+		tmpl["Datasets"] = true
+		arg = firstValue(params, "dataset")
+	case "blocks":
+		tmpl["Blocks"] = true
+		arg = firstValue(params, "block_name")
+	case "files":
+		if lfns := getValues(params, "logical_file_name"); len(lfns) == 1 {
+			tmpl["Files"] = true
+			arg = lfns[0]
+		} else {
+			tmpl["DatasetFiles"] = true
+			arg = firstValue(params, "dataset")
+		}
+	case "acquisitioneras":
+		tmpl["AcquisitionEras"] = true
+		arg = firstValue(params, "acquisition_era_name")
+	default:
+		return nil, nil
+	}
+	if arg == "" {
+		return nil, nil
+	}
+	stm, err := LoadTemplateSQL("audit_state", tmpl)
+	if err != nil {
+		return nil, Error(err, LoadErrorCode, "", "dbs.audit.AuditState")
+	}
+	var buf bytes.Buffer
+	err = executeAllTx(tx, &buf, ",", stm, arg)
+	if err != nil {
+		return nil, Error(err, QueryErrorCode, "", "dbs.audit.AuditState")
+	}
+	var records []Record
+	err = json.Unmarshal(buf.Bytes(), &records)
+	if err != nil {
+		return nil, Error(err, UnmarshalErrorCode, "", "dbs.audit.AuditState")
+	}
+	return records, nil
+}
+
+// AuditPayload returns dataset, block and file names of given POST API
+// payload along with payload itself or its summary if payload is too large
+func AuditPayload(data []byte) (string, string, string, string) {
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return "", "", "", ""
+	}
+	dataset := nestedValue(rec, "dataset", "dataset")
+	block := nestedValue(rec, "block", "block_name")
+	lfn := nestedValue(rec, "", "logical_file_name")
+	if len(data) <= AuditMaxPayloadSize {
+		return dataset, block, lfn, string(data)
+	}
+	summary := Record{"size": len(data), "hash": utils.GetHash(data)}
+	if files, ok := rec["files"].([]interface{}); ok {
+		summary["nfiles"] = len(files)
+	}
+	out, _ := json.Marshal(summary)
+	return dataset, block, lfn, string(out)
+}
+
+// helper function to get string value of given key from record itself
+// or from its nested record, e.g. {"dataset": {"dataset": "/a/b/c"}}
+func nestedValue(rec Record, nested, key string) string {
+	if v, ok := rec[key].(string); ok {
+		return v
+	}
+	if r, ok := rec[nested].(map[string]interface{}); ok {
+		if v, ok := r[key].(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// helper function to get first value of given parameter
+func firstValue(params Record, key string) string {
+	if vals := getValues(params, key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
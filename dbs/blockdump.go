@@ -11,18 +11,36 @@ import (
 	"github.com/dmwm/dbs2go/utils"
 )
 
+// dumpDB represents database queried by block dump functions along with DBS
+// SQL statements of its owner and driver
+type dumpDB struct {
+	*sql.DB
+	dbsql Record // DBS SQL statements of database
+	owner string // database owner
+}
+
+// helper function to get dumpDB of DBS database
+func dbsDumpDB() dumpDB {
+	return dumpDB{DB: DB, dbsql: DBSQL, owner: DBOWNER}
+}
+
+// helper function to get SQL statement of dump database for a given key
+func (db dumpDB) sql(key string) string {
+	return sqlStatement(db.dbsql, db.owner, key)
+}
+
 // helper function to get block information
-func getBlock(blk string, wg *sync.WaitGroup, block *Block) {
+func getBlock(db dumpDB, blk string, wg *sync.WaitGroup, block *Block) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, blk)
-	stm := getSQL("blockdump_block")
+	stm := db.sql("blockdump_block")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	err := DB.QueryRow(stm, args...).Scan(
+	err := db.QueryRow(stm, args...).Scan(
 		&block.BlockID,
 		&block.DatasetID,
 		&block.CreateBy,
@@ -42,11 +60,11 @@ func getBlock(blk string, wg *sync.WaitGroup, block *Block) {
 }
 
 // helper function to get dataset information
-func getDataset(blk string, wg *sync.WaitGroup, dataset *Dataset) {
+func getDataset(db dumpDB, blk string, wg *sync.WaitGroup, dataset *Dataset) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, strings.Split(blk, "#")[0])
-	stm := getSQL("blockdump_dataset")
+	stm := db.sql("blockdump_dataset")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
@@ -54,7 +72,7 @@ func getDataset(blk string, wg *sync.WaitGroup, dataset *Dataset) {
 
 	var xt sql.NullFloat64
 	var pid sql.NullString
-	err := DB.QueryRow(stm, args...).Scan(
+	err := db.QueryRow(stm, args...).Scan(
 		&dataset.DatasetID,
 		&dataset.CreateBy,
 		&dataset.CreationDate,
@@ -81,18 +99,18 @@ func getDataset(blk string, wg *sync.WaitGroup, dataset *Dataset) {
 }
 
 // helper function to get primary dataset information
-func getPrimaryDataset(blk string, wg *sync.WaitGroup, primaryDataset *PrimaryDataset) {
+func getPrimaryDataset(db dumpDB, blk string, wg *sync.WaitGroup, primaryDataset *PrimaryDataset) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, strings.Split(blk, "#")[0])
-	stm := getSQL("blockdump_primds")
+	stm := db.sql("blockdump_primds")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
 	var cby sql.NullString
-	err := DB.QueryRow(stm, args...).Scan(
+	err := db.QueryRow(stm, args...).Scan(
 		&primaryDataset.PrimaryDSId,
 		&cby,
 		&primaryDataset.PrimaryDSType,
@@ -109,18 +127,18 @@ func getPrimaryDataset(blk string, wg *sync.WaitGroup, primaryDataset *PrimaryDa
 }
 
 // helper function to get procesing era information
-func getProcessingEra(blk string, wg *sync.WaitGroup, processingEra *ProcessingEra) {
+func getProcessingEra(db dumpDB, blk string, wg *sync.WaitGroup, processingEra *ProcessingEra) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, strings.Split(blk, "#")[0])
-	stm := getSQL("blockdump_procera")
+	stm := db.sql("blockdump_procera")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
 	var cby, desc sql.NullString
-	err := DB.QueryRow(stm, args...).Scan(
+	err := db.QueryRow(stm, args...).Scan(
 		&cby,
 		&processingEra.ProcessingVersion,
 		&desc,
@@ -138,11 +156,11 @@ func getProcessingEra(blk string, wg *sync.WaitGroup, processingEra *ProcessingE
 }
 
 // helper function to get acquisition era information
-func getAcquisitionEra(blk string, wg *sync.WaitGroup, acquisitionEra *AcquisitionEra) {
+func getAcquisitionEra(db dumpDB, blk string, wg *sync.WaitGroup, acquisitionEra *AcquisitionEra) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, strings.Split(blk, "#")[0])
-	stm := getSQL("blockdump_acqera")
+	stm := db.sql("blockdump_acqera")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
@@ -150,7 +168,7 @@ func getAcquisitionEra(blk string, wg *sync.WaitGroup, acquisitionEra *Acquisiti
 
 	var cby, desc sql.NullString
 	var cdate sql.NullInt64
-	err := DB.QueryRow(stm, args...).Scan(
+	err := db.QueryRow(stm, args...).Scan(
 		&acquisitionEra.AcquisitionEraName,
 		&acquisitionEra.StartDate,
 		&cdate,
@@ -176,17 +194,17 @@ func getAcquisitionEra(blk string, wg *sync.WaitGroup, acquisitionEra *Acquisiti
 type FileList []File
 
 // helper function to get file list information
-func getFileList(blk string, wg *sync.WaitGroup, files *FileList) {
+func getFileList(db dumpDB, blk string, wg *sync.WaitGroup, files *FileList) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, blk)
-	stm := getSQL("blockdump_files")
+	stm := db.sql("blockdump_files")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	rows, err := DB.Query(stm, args...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
 		return
@@ -223,12 +241,12 @@ func getFileList(blk string, wg *sync.WaitGroup, files *FileList) {
 		// get file lumis for given LFN
 		var fargs []interface{}
 		fargs = append(fargs, file.LogicalFileName)
-		fstm := getSQL("blockdump_filelumis")
+		fstm := db.sql("blockdump_filelumis")
 		fstm = CleanStatement(fstm)
 		if utils.VERBOSE > 1 {
 			utils.PrintSQL(fstm, fargs, "execute")
 		}
-		frows, err := DB.Query(fstm, fargs...)
+		frows, err := db.Query(fstm, fargs...)
 		if err != nil {
 			log.Printf("query='%s' args='%v' error=%v", fstm, fargs, err)
 			return
@@ -268,17 +286,17 @@ func getFileList(blk string, wg *sync.WaitGroup, files *FileList) {
 type BlockParentList []BlockParent
 
 // helper function to get block parents information
-func getBlockParentList(blk string, wg *sync.WaitGroup, blockParentList *BlockParentList) {
+func getBlockParentList(db dumpDB, blk string, wg *sync.WaitGroup, blockParentList *BlockParentList) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, blk)
-	stm := getSQL("blockdump_blockparents")
+	stm := db.sql("blockdump_blockparents")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	rows, err := DB.Query(stm, args...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
 		return
@@ -305,17 +323,17 @@ func getBlockParentList(blk string, wg *sync.WaitGroup, blockParentList *BlockPa
 type DatasetParentList []string
 
 // helper function to get dataset parents information
-func getDatasetParentList(blk string, wg *sync.WaitGroup, datasetParentList *DatasetParentList) {
+func getDatasetParentList(db dumpDB, blk string, wg *sync.WaitGroup, datasetParentList *DatasetParentList) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, strings.Split(blk, "#")[0])
-	stm := getSQL("blockdump_datasetparents")
+	stm := db.sql("blockdump_datasetparents")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	rows, err := DB.Query(stm, args...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
 		return
@@ -338,17 +356,17 @@ func getDatasetParentList(blk string, wg *sync.WaitGroup, datasetParentList *Dat
 // FileConfigList represents FileConfig records
 type FileConfigList []FileConfig
 
-func getFileConfigList(blk string, wg *sync.WaitGroup, fileConfigList *FileConfigList) {
+func getFileConfigList(db dumpDB, blk string, wg *sync.WaitGroup, fileConfigList *FileConfigList) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, blk)
-	stm := getSQL("blockdump_fileconfigs")
+	stm := db.sql("blockdump_fileconfigs")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	rows, err := DB.Query(stm, args...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
 		return
@@ -385,17 +403,17 @@ func getFileConfigList(blk string, wg *sync.WaitGroup, fileConfigList *FileConfi
 // FileParentList represents FileParent records
 type FileParentList []FileParentRecord
 
-func getFileParentList(blk string, wg *sync.WaitGroup, fileParentList *FileParentList) {
+func getFileParentList(db dumpDB, blk string, wg *sync.WaitGroup, fileParentList *FileParentList) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, blk)
-	stm := getSQL("blockdump_fileparents")
+	stm := db.sql("blockdump_fileparents")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	rows, err := DB.Query(stm, args...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
 		return
@@ -436,17 +454,17 @@ func getFileParentList(blk string, wg *sync.WaitGroup, fileParentList *FileParen
 // DatasetConfigList represents DatasetConfig records
 type DatasetConfigList []DatasetConfig
 
-func getDatasetConfigList(blk string, wg *sync.WaitGroup, datasetConfigList *DatasetConfigList) {
+func getDatasetConfigList(db dumpDB, blk string, wg *sync.WaitGroup, datasetConfigList *DatasetConfigList) {
 	defer wg.Done()
 	var args []interface{}
 	args = append(args, strings.Split(blk, "#")[0])
-	stm := getSQL("blockdump_datasetconfigs")
+	stm := db.sql("blockdump_datasetconfigs")
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
 
-	rows, err := DB.Query(stm, args...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
 		return
@@ -501,7 +519,19 @@ func (a *API) BlockDump() error {
 	if err != nil {
 		return Error(err, ParametersErrorCode, "", "dbs.blockdump.BlockDump")
 	}
+	rec := blockDump(dbsDumpDB(), blk)
 
+	// write BulkBlocks record
+	data, err := json.Marshal(rec)
+	if err == nil {
+		a.Writer.Write(data)
+		return nil
+	}
+	return Error(err, MarshalErrorCode, "", "dbs.blockdump.BlockDump")
+}
+
+// helper function to get BulkBlocks record of given block from given database
+func blockDump(db dumpDB, blk string) BulkBlocks {
 	// fill out BulkBlock record via async calls
 	var datasetConfigList DatasetConfigList
 	var fileConfigList FileConfigList
@@ -521,17 +551,17 @@ func (a *API) BlockDump() error {
 	// get concurrently all necessary information required for block dump
 	var wg sync.WaitGroup
 	wg.Add(11) // wait for 11 goroutines below
-	go getBlock(blk, &wg, &block)
-	go getDataset(blk, &wg, &dataset)
-	go getPrimaryDataset(blk, &wg, &primaryDataset)
-	go getProcessingEra(blk, &wg, &processingEra)
-	go getAcquisitionEra(blk, &wg, &acquisitionEra)
-	go getFileList(blk, &wg, &files)
-	go getBlockParentList(blk, &wg, &blockParentList)
-	go getDatasetParentList(blk, &wg, &datasetParentList)
-	go getFileConfigList(blk, &wg, &fileConfigList)
-	go getFileParentList(blk, &wg, &fileParentList)
-	go getDatasetConfigList(blk, &wg, &datasetConfigList)
+	go getBlock(db, blk, &wg, &block)
+	go getDataset(db, blk, &wg, &dataset)
+	go getPrimaryDataset(db, blk, &wg, &primaryDataset)
+	go getProcessingEra(db, blk, &wg, &processingEra)
+	go getAcquisitionEra(db, blk, &wg, &acquisitionEra)
+	go getFileList(db, blk, &wg, &files)
+	go getBlockParentList(db, blk, &wg, &blockParentList)
+	go getDatasetParentList(db, blk, &wg, &datasetParentList)
+	go getFileConfigList(db, blk, &wg, &fileConfigList)
+	go getFileParentList(db, blk, &wg, &fileParentList)
+	go getDatasetConfigList(db, blk, &wg, &datasetConfigList)
 	wg.Wait()
 
 	if utils.VERBOSE > 1 {
@@ -558,14 +588,7 @@ func (a *API) BlockDump() error {
 		FileParentList:    fileParentList,
 		DatasetConfigList: datasetConfigList,
 	}
-
-	// write BulkBlocks record
-	data, err := json.Marshal(rec)
-	if err == nil {
-		a.Writer.Write(data)
-		return nil
-	}
-	return Error(err, MarshalErrorCode, "", "dbs.blockdump.BlockDump")
+	return rec
 }
 
 // InsertBlockDump insert block dump record into DBS
@@ -39,6 +39,14 @@ func (a *API) Blocks() error {
 		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.blocks.Blocks")
 	}
 
+	// client may ask for state of blocks at given time
+	if asOf, ok, err := asOfDate(a.Params); ok {
+		if err != nil {
+			return Error(err, ParametersErrorCode, "", "dbs.blocks.Blocks")
+		}
+		return a.BlocksAsOf(asOf)
+	}
+
 	// parse detail argument
 	detail, _ := getSingleValue(a.Params, "detail")
 	if detail == "1" { // for backward compatibility with Python detail=1 and detail=True
@@ -348,7 +356,7 @@ func (a *API) InsertBlocks() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("fail to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.blocks.InsertBlocks")
@@ -433,6 +441,9 @@ func (a *API) UpdateBlocks() error {
 	}
 	defer tx.Rollback()
 
+	if err := a.updateHook(tx); err != nil {
+		return err
+	}
 	if site {
 		_, err = tx.Exec(stm, origSiteName, createBy, date, blockName)
 	} else {
@@ -446,11 +457,21 @@ func (a *API) UpdateBlocks() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("unable to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.blocks.UpdateBlocks")
 	}
+	event := Event{Type: BlockUpdatedEvent, Block: blockName, CreateBy: createBy}
+	if site {
+		event.Values = Record{"origin_site_name": origSiteName}
+	} else {
+		event.Values = Record{"open_for_writing": openForWriting}
+		if openForWriting == 0 {
+			event.Type = BlockClosedEvent
+		}
+	}
+	publishEvent(event)
 	if a.Writer != nil {
 		a.Writer.Write([]byte(`[]`))
 	}
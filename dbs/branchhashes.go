@@ -87,7 +87,7 @@ func (r *BranchHashes) Decode(reader io.Reader) error {
 
 // InsertBranchHashes DBS API
 func (a *API) InsertBranchHashes() error {
-	err := insertRecord(&BranchHashes{}, a.Reader)
+	err := a.insertRecord(&BranchHashes{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.branchhashes.InsertBranchHashes")
 	}
@@ -565,10 +565,7 @@ func (a *API) InsertBulkBlocks() error {
 	if utils.VERBOSE > 1 {
 		log.Println("insert files")
 	}
-	tempTable := fmt.Sprintf("ORA$PTT_TEMP_FILE_LUMIS_%d", time.Now().UnixMicro())
-	if DBOWNER == "sqlite" {
-		tempTable = "FILE_LUMIS"
-	}
+	tempTable := tempFileLumisTable()
 	filesMap := make(map[string]int64)
 	for _, rrr := range rec.Files {
 		// get fileTypeID and insert record if it does not exists
@@ -762,13 +759,14 @@ func (a *API) InsertBulkBlocks() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		if utils.VERBOSE > 1 {
 			log.Println("fail to commit transaction", err)
 		}
 		return Error(err, CommitErrorCode, "", "dbs.bulkblocks.InsertBulkBlocks")
 	}
+	publishBulkBlockEvent(rec, len(rec.Files), a.CreateBy)
 
 	if a.Writer != nil {
 		a.Writer.Write([]byte(`[]`))
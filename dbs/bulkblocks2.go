@@ -35,15 +35,10 @@ type TempFileRecord struct {
 }
 
 // helper function to insert dataset configurations
-func insertDatasetConfigurations(api *API, datasetConfigList DatasetConfigList, hash string) error {
+func insertDatasetConfigurations(tx *sql.Tx, api *API, datasetConfigList DatasetConfigList, hash string) error {
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "insert output configs")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.insertDatasetConfigurations")
-	}
-	defer tx.Rollback()
 	for _, rrr := range datasetConfigList {
 		data, err := json.Marshal(rrr)
 		if err != nil {
@@ -56,24 +51,14 @@ func insertDatasetConfigurations(api *API, datasetConfigList DatasetConfigList,
 			return Error(err, InsertErrorCode, hash, "dbs.bulkblocks.insertDatasetConfigurations")
 		}
 	}
-	err = tx.Commit()
-	if err != nil {
-		log.Println(hash, "fail to commit transaction", err)
-		return Error(err, CommitErrorCode, hash, "dbs.bulkblocks.insertDatasetConfigurations")
-	}
 	return nil
 }
 
 // helper function to get primary dataset type ID
-func getPrimaryDatasetTypeID(primaryDSType, hash string) (int64, error) {
+func getPrimaryDatasetTypeID(tx *sql.Tx, primaryDSType, hash string) (int64, error) {
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get primary dataset type ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getPrimaryDatasetTypeID")
-	}
-	defer tx.Rollback()
 	pdstDS := PrimaryDSTypes{
 		PRIMARY_DS_TYPE: primaryDSType,
 	}
@@ -90,28 +75,18 @@ func getPrimaryDatasetTypeID(primaryDSType, hash string) (int64, error) {
 		log.Println(msg)
 		return 0, Error(err, PrimaryDatasetTypeDoesNotExist, msg, "dbs.bulkblocks.getPrimaryDatasetTypeID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getPrimaryDatasetTypeID")
-	}
 	return primaryDatasetTypeID, nil
 }
 
 // helper function to get primary dataset id
 func getPrimaryDatasetID(
+	tx *sql.Tx,
 	primaryDSName string,
 	primaryDatasetTypeID, cDate int64,
 	cBy, hash string) (int64, error) {
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get primary dataset ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getPrimaryDatasetTypeID")
-	}
-	defer tx.Rollback()
 	primDS := PrimaryDatasets{
 		PRIMARY_DS_NAME:    primaryDSName,
 		PRIMARY_DS_TYPE_ID: primaryDatasetTypeID,
@@ -131,27 +106,17 @@ func getPrimaryDatasetID(
 		log.Println(msg)
 		return 0, Error(err, PrimaryDatasetDoesNotExist, msg, "dbs.bulkblocks.getPrimaryDatasetID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getPrimaryDatasetID")
-	}
 	return primaryDatasetID, nil
 }
 
 // helper function to get processing Era ID
 func getProcessingEraID(
+	tx *sql.Tx,
 	processingVersion, cDate int64,
 	cBy, description, hash string) (int64, error) {
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get processing era ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getProcessingEraID")
-	}
-	defer tx.Rollback()
 	pera := ProcessingEras{
 		PROCESSING_VERSION: processingVersion,
 		CREATION_DATE:      cDate,
@@ -171,17 +136,12 @@ func getProcessingEraID(
 		log.Println(msg)
 		return 0, Error(err, ProcessingEraDoesNotExist, msg, "dbs.bulkblocks.getProcessingEraID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getProcessingEraID")
-	}
 	return processingEraID, nil
 }
 
 // helper function to get acquisition era ID
 func getAcquisitionEraID(
+	tx *sql.Tx,
 	acquisitionEraName string,
 	startDate, endDate, creationDate int64,
 	cBy, description, hash string) (int64, error) {
@@ -189,11 +149,6 @@ func getAcquisitionEraID(
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get acquisition era ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getAcquisitionEraID")
-	}
-	defer tx.Rollback()
 	aera := AcquisitionEras{
 		ACQUISITION_ERA_NAME: acquisitionEraName,
 		START_DATE:           startDate,
@@ -215,17 +170,12 @@ func getAcquisitionEraID(
 		log.Println(msg)
 		return 0, Error(err, AcquisitionEraDoesNotExist, msg, "dbs.bulkblocks.getAcquisitionEraID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getAcquisitionEraID")
-	}
 	return acquisitionEraID, nil
 }
 
 // helper function to get data tier ID
 func getDataTierID(
+	tx *sql.Tx,
 	tierName string,
 	cDate int64,
 	cBy, hash string) (int64, error) {
@@ -233,11 +183,6 @@ func getDataTierID(
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get data tier ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getDataTierID")
-	}
-	defer tx.Rollback()
 	tier := DataTiers{
 		DATA_TIER_NAME: tierName,
 		CREATION_DATE:  cDate,
@@ -256,25 +201,14 @@ func getDataTierID(
 		log.Println(msg)
 		return 0, Error(err, DataTierDoesNotExist, msg, "dbs.bulkblocks.getDataTierID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getDataTierID")
-	}
 	return dataTierID, nil
 }
 
 // helper function to get physics group ID
-func getPhysicsGroupID(physName, hash string) (int64, error) {
+func getPhysicsGroupID(tx *sql.Tx, physName, hash string) (int64, error) {
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get physics group ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getPhysicsGroupID")
-	}
-	defer tx.Rollback()
 	pgrp := PhysicsGroups{
 		PHYSICS_GROUP_NAME: physName,
 	}
@@ -291,27 +225,17 @@ func getPhysicsGroupID(physName, hash string) (int64, error) {
 		log.Println(msg)
 		return 0, Error(err, PhysicsGroupDoesNotExist, msg, "dbs.bulkblocks.getPhysicsGroupID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getPhysicsGroupID")
-	}
 	return physicsGroupID, nil
 }
 
 // helper function to get dataset access type ID
 func getDatasetAccessTypeID(
+	tx *sql.Tx,
 	datasetAccessType, hash string) (int64, error) {
 
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get dataset access type ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getDatasetAccessTypeID")
-	}
-	defer tx.Rollback()
 	dat := DatasetAccessTypes{
 		DATASET_ACCESS_TYPE: datasetAccessType,
 	}
@@ -328,27 +252,17 @@ func getDatasetAccessTypeID(
 		log.Println(msg)
 		return 0, Error(err, DatasetAccessTypeDoesNotExist, msg, "dbs.bulkblocks.getDatasetAccesssTypeID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getDatasetAccessTypeID")
-	}
 	return datasetAccessTypeID, nil
 }
 
 // helper function to get processed dataset ID
 func getProcessedDatasetID(
+	tx *sql.Tx,
 	processedDSName, hash string) (int64, error) {
 
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "get processed dataset ID")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getProcessedDatasetID")
-	}
-	defer tx.Rollback()
 	procDS := ProcessedDatasets{
 		PROCESSED_DS_NAME: processedDSName,
 	}
@@ -365,17 +279,12 @@ func getProcessedDatasetID(
 		log.Println(msg)
 		return 0, Error(err, ProcessedDatasetDoesNotExist, msg, "dbs.bulkblocks.getProcessedDSName")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getProcessedDatasetID")
-	}
 	return processedDatasetID, nil
 }
 
 // helper function to get dataset ID
 func getDatasetID(
+	tx *sql.Tx,
 	datasetName string,
 	isDatasetValid int,
 	primaryDatasetID int64,
@@ -397,11 +306,6 @@ func getDatasetID(
 	if utils.VERBOSE > 1 {
 		log.Println(hash, "insert dataset")
 	}
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.getDatasetID")
-	}
-	defer tx.Rollback()
 	dataset := Datasets{
 		DATASET:                datasetName,
 		IS_DATASET_VALID:       isDatasetValid,
@@ -436,22 +340,21 @@ func getDatasetID(
 		log.Println(msg)
 		return 0, Error(err, DatasetDoesNotExist, msg, "dbs.bulkblocks.getDatasetID")
 	}
-	err = tx.Commit()
-	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
-		log.Println(msg)
-		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.getDatasetID")
-	}
 	return datasetID, nil
 }
 
-// helper function to check if block exist in DBS database
-func checkBlockExist(bName, hash string) error {
-	tx, err := DB.Begin()
-	if err != nil {
-		return Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.checkBlockExist")
+// helper function to check if block exist in DBS database within given
+// transaction, e.g. to find block inserted earlier by the same atomic batch,
+// if it is nil the check is done within its own transaction
+func checkBlockExist(tx *sql.Tx, bName, hash string) error {
+	if tx == nil {
+		var err error
+		tx, err = DB.Begin()
+		if err != nil {
+			return Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.checkBlockExist")
+		}
+		defer tx.Rollback()
 	}
-	defer tx.Rollback()
 	if rid, err := GetID(tx, "BLOCKS", "block_id", "block_name", bName); err == nil && rid != 0 {
 		msg := fmt.Sprintf("Block %s already exists", bName)
 		return Error(err, BlockAlreadyExists, msg, "dbs.bulkblocks.checkBlockExist")
@@ -498,142 +401,329 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 	}
 
 	// prepare file parentage map, i.e. find out file ids we need for FileParentList
+	parentFilesMap, err := getParentFilesMap(rec.FileParentList)
+	if err != nil {
+		return err
+	}
+
+	// check if is_file_valid was present in request, if not set it to 1
+	var isFileValid int64
+	if !strings.Contains(string(data), "is_file_valid") {
+		isFileValid = 1
+	}
+
+	insertFiles := bulkBlockFiles(&rec, parentFilesMap, hash)
+	if err = a.insertBulkBlock(nil, &rec, isFileValid, hash, nil, insertFiles); err != nil {
+		return err
+	}
+	if utils.VERBOSE > 1 {
+		log.Println(hash, "successfully finished bulkblocks.InsertBulkBlocksConcurrently")
+	}
+	publishBulkBlockEvent(rec, len(rec.Files), a.CreateBy)
+
+	if a.Writer != nil {
+		a.Writer.Write([]byte(`[]`))
+	}
+	return nil
+}
+
+// helper function to find out file ids of parent files of bulk block
+func getParentFilesMap(fileParentList []FileParentRecord) (map[string]int64, error) {
 	parentFilesMap := make(map[string]int64)
-	for _, r := range rec.FileParentList {
+	for _, r := range fileParentList {
 		// parent lfn should be already in DB
 		plfn := r.ParentLogicalFileName
 		pfid, err := QueryRow("FILES", "file_id", "logical_file_name", plfn)
 		if err != nil {
 			msg := fmt.Sprintf("unable to find parent lfn %s", plfn)
-			return Error(err, DatabaseErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+			return nil, Error(err, DatabaseErrorCode, msg, "dbs.bulkblocks.getParentFilesMap")
 		}
 		parentFilesMap[plfn] = pfid
 	}
+	return parentFilesMap, nil
+}
+
+// helper function to provide insertFiles function of insertBulkBlock which
+// inserts files, file configurations and file parents of given bulk block
+func bulkBlockFiles(
+	rec *BulkBlocks,
+	parentFilesMap map[string]int64,
+	hash string) func(tx *sql.Tx, trec *TempFileRecord) error {
+	return func(tx *sql.Tx, trec *TempFileRecord) error {
+		if err := insertBulkFiles(tx, rec.Files, trec, hash); err != nil {
+			return err
+		}
+		for _, r := range rec.FileConfigList {
+			if err := insertFileConfig(tx, r, hash); err != nil {
+				return err
+			}
+		}
+		for _, r := range rec.FileParentList {
+			if err := insertFileParent(tx, r, trec, parentFilesMap, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// helper function to insert bulk block look-up records, dataset and block
+// records, the files of the block are inserted by given insertFiles function
+// within the same transaction. The IDs of look-up records are reused from
+// given ids map, see bulkBlockIDs. If transaction is given all records are
+// inserted within it and the caller should commit or rollback it, otherwise
+// the look-up records are inserted in their own transactions and the rest
+// of records is committed within new transaction
+func (a *API) insertBulkBlock(
+	tx *sql.Tx,
+	rec *BulkBlocks,
+	isFileValid int64,
+	hash string,
+	ids bulkBlockIDs,
+	insertFiles func(tx *sql.Tx, trec *TempFileRecord) error) error {
+	creationDate := time.Now().Unix()
+	datasetID, err := a.getBulkBlockDatasetID(tx, rec, creationDate, hash, ids)
+	if err != nil {
+		return err
+	}
+	if tx != nil {
+		return a.insertBulkBlockTx(tx, rec, datasetID, isFileValid, creationDate, hash, insertFiles)
+	}
+
+	// start transaction for the rest of the injection process
+	tx, err = DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.bulkblocks.insertBulkBlock")
+	}
+	defer tx.Rollback()
+	if err = a.insertBulkBlockTx(tx, rec, datasetID, isFileValid, creationDate, hash, insertFiles); err != nil {
+		return err
+	}
+
+	// commit transaction
+	err = a.commit(tx, []byte(`[]`))
+	if err != nil {
+		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
+		log.Println(msg)
+		return Error(err, CommitErrorCode, msg, "dbs.bulkblocks.insertBulkBlock")
+	}
+	return nil
+}
+
+// bulkBlockIDs keeps IDs of look-up records resolved by bulkblocks API,
+// it allows to reuse them across blocks of the same batch
+type bulkBlockIDs map[string]int64
+
+// helper function to get ID of look-up record with given key, the ID is
+// resolved only once via given function, nil map resolves it every time.
+// The function is called within given transaction, if it is nil the
+// look-up record is resolved within its own transaction
+func (ids bulkBlockIDs) get(
+	tx *sql.Tx,
+	key, hash string,
+	resolve func(tx *sql.Tx) (int64, error)) (int64, error) {
+	if rid, ok := ids[key]; ok {
+		return rid, nil
+	}
+	rid, err := lookupTx(tx, hash, resolve)
+	if err != nil {
+		return 0, err
+	}
+	if ids != nil {
+		ids[key] = rid
+	}
+	return rid, nil
+}
+
+// helper function to call given look-up function within given transaction
+// or within its own transaction if given one is nil
+func lookupTx(tx *sql.Tx, hash string, resolve func(tx *sql.Tx) (int64, error)) (int64, error) {
+	if tx != nil {
+		return resolve(tx)
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, Error(err, TransactionErrorCode, hash, "dbs.bulkblocks.lookupTx")
+	}
+	defer tx.Rollback()
+	rid, err := resolve(tx)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
+		log.Println(msg)
+		return 0, Error(err, CommitErrorCode, msg, "dbs.bulkblocks.lookupTx")
+	}
+	return rid, nil
+}
 
+// helper function to insert bulk block look-up records and dataset within
+// given transaction, if it is nil each look-up record is inserted in its own
+// transaction, it returns dataset ID
+//
+//gocyclo:ignore
+func (a *API) getBulkBlockDatasetID(
+	tx *sql.Tx,
+	rec *BulkBlocks,
+	creationDate int64,
+	hash string,
+	ids bulkBlockIDs) (int64, error) {
+	var err error
 	var reader *bytes.Reader
 	api := &API{
 		Reader:   reader,
 		CreateBy: a.CreateBy,
 		Params:   make(Record),
 	}
-	var isFileValid, datasetID, blockID int64
+	var datasetID int64
 	var primaryDatasetTypeID, primaryDatasetID, acquisitionEraID, processingEraID int64
 	var dataTierID, physicsGroupID, processedDatasetID, datasetAccessTypeID int64
-	creationDate := time.Now().Unix()
 
 	// check if give block name exist in DBS, if it does, we
 	// abort the entire process
-	if err = checkBlockExist(rec.Block.BlockName, hash); err != nil {
-		return err
-	}
-
-	// check if is_file_valid was present in request, if not set it to 1
-	if !strings.Contains(string(data), "is_file_valid") {
-		isFileValid = 1
+	if err = checkBlockExist(tx, rec.Block.BlockName, hash); err != nil {
+		return 0, err
 	}
 
 	// insert dataset configuration
-	if err = insertDatasetConfigurations(api, rec.DatasetConfigList, hash); err != nil {
-		return err
+	configs, err := json.Marshal(rec.DatasetConfigList)
+	if err != nil {
+		return 0, Error(err, MarshalErrorCode, hash, "dbs.bulkblocks.getBulkBlockDatasetID")
+	}
+	if _, err = ids.get(tx, "OUTPUT_MODULE_CONFIGS:"+string(configs), hash, func(tx *sql.Tx) (int64, error) {
+		return 0, insertDatasetConfigurations(tx, api, rec.DatasetConfigList, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get primaryDatasetTypeID and insert record if it does not exists
-	if primaryDatasetTypeID, err = getPrimaryDatasetTypeID(rec.PrimaryDataset.PrimaryDSType, hash); err != nil {
-		return err
+	if primaryDatasetTypeID, err = ids.get(tx, "PRIMARY_DS_TYPES:"+rec.PrimaryDataset.PrimaryDSType, hash, func(tx *sql.Tx) (int64, error) {
+		return getPrimaryDatasetTypeID(tx, rec.PrimaryDataset.PrimaryDSType, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get primarayDatasetID and insert record if it does not exists
 	if rec.PrimaryDataset.CreateBy == "" {
 		rec.PrimaryDataset.CreateBy = a.CreateBy
 	}
-	if primaryDatasetID, err = getPrimaryDatasetID(
-		rec.PrimaryDataset.PrimaryDSName,
-		primaryDatasetTypeID,
-		rec.PrimaryDataset.CreationDate,
-		rec.PrimaryDataset.CreateBy, hash); err != nil {
-		return err
+	if primaryDatasetID, err = ids.get(tx, "PRIMARY_DATASETS:"+rec.PrimaryDataset.PrimaryDSName, hash, func(tx *sql.Tx) (int64, error) {
+		return getPrimaryDatasetID(
+			tx,
+			rec.PrimaryDataset.PrimaryDSName,
+			primaryDatasetTypeID,
+			rec.PrimaryDataset.CreationDate,
+			rec.PrimaryDataset.CreateBy, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get processing era ID and insert record if it does not exists
 	if rec.ProcessingEra.CreateBy == "" {
 		rec.ProcessingEra.CreateBy = a.CreateBy
 	}
-	if processingEraID, err = getProcessingEraID(
-		rec.ProcessingEra.ProcessingVersion,
-		creationDate,
-		rec.ProcessingEra.CreateBy,
-		rec.ProcessingEra.Description, hash); err != nil {
-		return err
+	if processingEraID, err = ids.get(tx, fmt.Sprintf("PROCESSING_ERAS:%v", rec.ProcessingEra.ProcessingVersion), hash, func(tx *sql.Tx) (int64, error) {
+		return getProcessingEraID(
+			tx,
+			rec.ProcessingEra.ProcessingVersion,
+			creationDate,
+			rec.ProcessingEra.CreateBy,
+			rec.ProcessingEra.Description, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// insert acquisition era if it does not exists
 	if rec.AcquisitionEra.CreateBy == "" {
 		rec.AcquisitionEra.CreateBy = a.CreateBy
 	}
-	if acquisitionEraID, err = getAcquisitionEraID(
-		rec.AcquisitionEra.AcquisitionEraName,
-		rec.AcquisitionEra.StartDate,
-		0,
-		creationDate,
-		rec.AcquisitionEra.CreateBy,
-		rec.AcquisitionEra.Description, hash); err != nil {
-		return err
+	if acquisitionEraID, err = ids.get(tx, "ACQUISITION_ERAS:"+rec.AcquisitionEra.AcquisitionEraName, hash, func(tx *sql.Tx) (int64, error) {
+		return getAcquisitionEraID(
+			tx,
+			rec.AcquisitionEra.AcquisitionEraName,
+			rec.AcquisitionEra.StartDate,
+			0,
+			creationDate,
+			rec.AcquisitionEra.CreateBy,
+			rec.AcquisitionEra.Description, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get dataTierID
-	if dataTierID, err = getDataTierID(
-		rec.Dataset.DataTierName, creationDate, a.CreateBy, hash); err != nil {
-		return err
+	if dataTierID, err = ids.get(tx, "DATA_TIERS:"+rec.Dataset.DataTierName, hash, func(tx *sql.Tx) (int64, error) {
+		return getDataTierID(tx, rec.Dataset.DataTierName, creationDate, a.CreateBy, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get physicsGroupID
-	if physicsGroupID, err = getPhysicsGroupID(
-		rec.Dataset.PhysicsGroupName, hash); err != nil {
-		return err
+	if physicsGroupID, err = ids.get(tx, "PHYSICS_GROUPS:"+rec.Dataset.PhysicsGroupName, hash, func(tx *sql.Tx) (int64, error) {
+		return getPhysicsGroupID(tx, rec.Dataset.PhysicsGroupName, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get datasetAccessTypeID
-	if datasetAccessTypeID, err = getDatasetAccessTypeID(
-		rec.Dataset.DatasetAccessType, hash); err != nil {
-		return err
+	if datasetAccessTypeID, err = ids.get(tx, "DATASET_ACCESS_TYPES:"+rec.Dataset.DatasetAccessType, hash, func(tx *sql.Tx) (int64, error) {
+		return getDatasetAccessTypeID(tx, rec.Dataset.DatasetAccessType, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get processedDatasetID
-	if processedDatasetID, err = getProcessedDatasetID(
-		rec.Dataset.ProcessedDSName, hash); err != nil {
-		return err
+	if processedDatasetID, err = ids.get(tx, "PROCESSED_DATASETS:"+rec.Dataset.ProcessedDSName, hash, func(tx *sql.Tx) (int64, error) {
+		return getProcessedDatasetID(tx, rec.Dataset.ProcessedDSName, hash)
+	}); err != nil {
+		return 0, err
 	}
 
 	// get datasetID and insert dataset if necessary
 	if rec.Dataset.CreateBy == "" {
 		rec.Dataset.CreateBy = a.CreateBy
 	}
-	if datasetID, err = getDatasetID(
-		rec.Dataset.Dataset,
-		1,
-		primaryDatasetID,
-		processedDatasetID,
-		dataTierID,
-		datasetAccessTypeID,
-		acquisitionEraID,
-		processingEraID,
-		physicsGroupID,
-		rec.Dataset.Xtcrosssection,
-		rec.Dataset.PrepID,
-		rec.Dataset.CreationDate,
-		rec.Dataset.CreateBy,
-		creationDate,
-		rec.Dataset.CreateBy,
-		hash); err != nil {
-		return err
+	if datasetID, err = ids.get(tx, "DATASETS:"+rec.Dataset.Dataset, hash, func(tx *sql.Tx) (int64, error) {
+		return getDatasetID(
+			tx,
+			rec.Dataset.Dataset,
+			1,
+			primaryDatasetID,
+			processedDatasetID,
+			dataTierID,
+			datasetAccessTypeID,
+			acquisitionEraID,
+			processingEraID,
+			physicsGroupID,
+			rec.Dataset.Xtcrosssection,
+			rec.Dataset.PrepID,
+			rec.Dataset.CreationDate,
+			rec.Dataset.CreateBy,
+			creationDate,
+			rec.Dataset.CreateBy,
+			hash)
+	}); err != nil {
+		return 0, err
 	}
+	return datasetID, nil
+}
 
-	// start transaction for the rest of the injection process
-	tx, err := DB.Begin()
-	if err != nil {
-		return Error(err, TransactionErrorCode, "", "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-	}
-	defer tx.Rollback()
+// helper function to insert block records of bulk block and its files
+// within given transaction, the dataset and its look-up records should be
+// already inserted
+//
+//gocyclo:ignore
+func (a *API) insertBulkBlockTx(
+	tx *sql.Tx,
+	rec *BulkBlocks,
+	datasetID int64,
+	isFileValid int64,
+	creationDate int64,
+	hash string,
+	insertFiles func(tx *sql.Tx, trec *TempFileRecord) error) error {
+	var err error
+	var blockID int64
 
 	// get outputModConfigID using datasetID
 	// since we already inserted records from DatasetConfigList
@@ -661,7 +751,7 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 		if err != nil {
 			msg := fmt.Sprintf("%s unable to insert dataset output mod configs record, error %v", hash, err)
 			log.Println(msg)
-			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertBulkBlockTx")
 		}
 	}
 
@@ -686,7 +776,7 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 	}
 	// check if give block name exist in DBS, if it does, we
 	// abort the entire process
-	if err = checkBlockExist(rec.Block.BlockName, hash); err != nil {
+	if err = checkBlockExist(tx, rec.Block.BlockName, hash); err != nil {
 		return err
 	}
 
@@ -702,11 +792,61 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 	if err != nil {
 		msg := fmt.Sprintf("%s unable to find block_id for %s, error %v", hash, rec.Block.BlockName, err)
 		log.Println(msg)
-		return Error(err, GetIDErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+		return Error(err, GetIDErrorCode, msg, "dbs.bulkblocks.insertBulkBlockTx")
 	}
 
+	// insert files
+	if utils.VERBOSE > 1 {
+		log.Println(hash, "insert files")
+	}
+	trec := TempFileRecord{
+		IsFileValid:  isFileValid,
+		DatasetID:    datasetID,
+		BlockID:      blockID,
+		CreationDate: creationDate,
+		CreateBy:     a.CreateBy,
+		FilesMap:     sync.Map{},
+		NErrors:      0,
+	}
+	if err = insertFiles(tx, &trec); err != nil {
+		return err
+	}
+
+	// insert dataset parent list
+	datasetParentList := rec.DatasetParentList
+	// use both DatasetParentList and DsParentList (for backward compatibility)
+	// and compose unique set of dataset parents
+	for _, d := range rec.DsParentList {
+		datasetParentList = append(datasetParentList, d.ParentDataset)
+	}
+	datasetParentList = utils.Set(datasetParentList)
+	for _, ds := range datasetParentList {
+		// get file id for parent dataset
+		pid, err := GetID(tx, "DATASETS", "dataset_id", "dataset", ds)
+		if err != nil {
+			msg := fmt.Sprintf("%s unable to find dataset_id for %s, error %v", hash, ds, err)
+			log.Println(msg)
+			return Error(err, DatasetParentDoesNotExist, msg, "dbs.bulkblocks.insertBulkBlockTx")
+		}
+		r := DatasetParents{THIS_DATASET_ID: datasetID, PARENT_DATASET_ID: pid}
+		err = r.Insert(tx)
+		if err != nil {
+			msg := fmt.Sprintf("%s unable to insert parent dataset record, error %v", hash, err)
+			log.Println(msg)
+			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertBulkBlockTx")
+		}
+	}
+	return nil
+}
+
+// helper function to insert files of bulk block along with their data
+// types and lumis, the inserted file ids are kept in FilesMap of trec
+func insertBulkFiles(tx *sql.Tx, files []File, trec *TempFileRecord, hash string) error {
+	var err error
+	var data []byte
+	api := &API{CreateBy: trec.CreateBy, Params: make(Record)}
 	// insert all FileDataTypes fow all lfns
-	for _, rrr := range rec.Files {
+	for _, rrr := range files {
 		ftype := FileDataTypes{FILE_TYPE: rrr.FileType}
 		//         err = ftype.Insert(tx)
 		_, err = GetRecID(
@@ -720,50 +860,33 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 		if err != nil {
 			msg := fmt.Sprintf("%s unable to find file_type_id for %v, error %v", hash, ftype, err)
 			log.Println(msg)
-			return Error(err, FileDataTypesDoesNotExist, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+			return Error(err, FileDataTypesDoesNotExist, msg, "dbs.bulkblocks.insertBulkFiles")
 		}
 	}
-	// insert files
-	if utils.VERBOSE > 1 {
-		log.Println(hash, "insert files")
-	}
-	trec := TempFileRecord{
-		IsFileValid:  isFileValid,
-		DatasetID:    datasetID,
-		BlockID:      blockID,
-		CreationDate: creationDate,
-		CreateBy:     a.CreateBy,
-		FilesMap:     sync.Map{},
-		NErrors:      0,
-	}
-	err = insertFilesViaChunks(tx, rec.Files, &trec)
+	err = insertFilesViaChunks(tx, files, trec)
 	if err != nil {
 		msg := fmt.Sprintf("%s unable to insert files, error %v", hash, err)
 		log.Println(msg)
-		return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+		return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertBulkFiles")
 	}
 	if utils.VERBOSE > 1 {
 		log.Printf("trec %+v", trec)
 	}
-	tempTable := fmt.Sprintf("ORA$PTT_TEMP_FILE_LUMIS_%d", time.Now().UnixMicro())
+	tempTable := tempFileLumisTable()
 
 	// if we use chunks method we don't use tempTable
-	if FileLumiInsertMethod == "chunks" {
+	if FileLumiInsertMethod == "chunks" && DBOWNER != "sqlite" {
 		tempTable = fmt.Sprintf("%s.FILE_LUMIS", DBOWNER)
 	}
-	// for sqlite we simply use table name
-	if DBOWNER == "sqlite" {
-		tempTable = "FILE_LUMIS"
-	}
 
-	for _, rrr := range rec.Files {
+	for _, rrr := range files {
 		lfn := rrr.LogicalFileName
 		//         fileID, ok := trec.FilesMap[lfn]
 		fileID, ok := trec.FilesMap.Load(lfn)
 		if !ok {
 			msg := fmt.Sprintf("%s unable to find fileID in FilesMap for %s", hash, lfn)
 			log.Println(msg)
-			return Error(RecordErr, QueryErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+			return Error(RecordErr, QueryErrorCode, msg, "dbs.bulkblocks.insertBulkFiles")
 		}
 		// there are three methods to insert FileLumi list
 		// - via temp table
@@ -799,7 +922,7 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 					"%s unable to insert FileLumis records for %s, fileID %d, error %v",
 					hash, lfn, fileID, err)
 				log.Println(msg)
-				return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+				return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertBulkFiles")
 			}
 
 		} else {
@@ -828,133 +951,83 @@ func (a *API) InsertBulkBlocksConcurrently() error {
 				if err != nil {
 					msg := fmt.Sprintf("%s unable to marshal dataset file lumi list, error %v", hash, err)
 					log.Println(msg)
-					return Error(err, MarshalErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+					return Error(err, MarshalErrorCode, msg, "dbs.bulkblocks.insertBulkFiles")
 				}
 				api.Reader = bytes.NewReader(data)
 				err = api.InsertFileLumisTx(tx)
 				if err != nil {
 					msg := fmt.Sprintf("%s unable to insert FileLumis record, error %v", hash, err)
 					log.Println(msg)
-					return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+					return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertBulkFiles")
 				}
 			}
 		}
 	}
 
-	// insert file configuration
-	for _, rrr := range rec.FileConfigList {
-		data, err = json.Marshal(rrr)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to marshal file config list, error %v", hash, err)
-			log.Println(msg)
-			return Error(err, MarshalErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-		api.Reader = bytes.NewReader(data)
-		err = api.InsertFileOutputModConfigs(tx)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to insert file output mod config, error %v", hash, err)
-			log.Println(msg)
-			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-	}
-
-	// find out file ids we need for FileParentList
-	for _, r := range rec.FileParentList {
-		rrr := FileParents{}
-		lfn := r.LogicalFileName
-		if lfn == "" {
-			lfn = r.ThisLogicalFileName
-		}
-		if lfn == "" {
-			err := errors.New("mailformed file parent record")
-			msg := fmt.Sprintf("file parent record %+v does not contain LFN", r)
-			log.Println(msg)
-			return Error(err, NotImplementedApiCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-		if fileID, ok := trec.FilesMap.Load(lfn); ok {
-			rrr.THIS_FILE_ID = fileID.(int64)
-			log.Println("### this_logical_file_name", lfn, fileID)
-		} else {
-			err := errors.New("unable to locate LFN file id")
-			msg := fmt.Sprintf("no file id found for '%s'", lfn)
-			log.Println(msg)
-			return Error(err, SessionErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-		// parent lfn should be already in DB
-		plfn := r.ParentLogicalFileName
-		if pfid, ok := parentFilesMap[plfn]; ok {
-			rrr.PARENT_FILE_ID = pfid
-			//             log.Println("### parent_logical_file_name", plfn, pfid)
-		} else {
-			err := errors.New("unable to locate parent file id")
-			msg := fmt.Sprintf("no file id found for parent '%s'", lfn)
-			log.Println(msg)
-			return Error(err, FileParentDoesNotExist, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-		err = rrr.Insert(tx)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to insert file parents record %+v, error %v", hash, rrr, err)
-			log.Println(msg)
-			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-	}
-
-	/*
-		// insert file parent list
-		data, err = json.Marshal(rec.FileParentList)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to marshal file parent list, error %v", hash, err)
-			log.Println(msg)
-			return Error(err, MarshalErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-		api.Reader = bytes.NewReader(data)
-		api.Params = make(Record)
-		err = api.InsertFileParentsTxt(tx)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to insert file parents record %+v, error %v", hash, rec, err)
-			log.Println(msg)
-			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-	*/
-
-	// insert dataset parent list
-	datasetParentList := rec.DatasetParentList
-	// use both DatasetParentList and DsParentList (for backward compatibility)
-	// and compose unique set of dataset parents
-	for _, d := range rec.DsParentList {
-		datasetParentList = append(datasetParentList, d.ParentDataset)
-	}
-	datasetParentList = utils.Set(datasetParentList)
-	for _, ds := range datasetParentList {
-		// get file id for parent dataset
-		pid, err := GetID(tx, "DATASETS", "dataset_id", "dataset", ds)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to find dataset_id for %s, error %v", hash, ds, err)
-			log.Println(msg)
-			return Error(err, DatasetParentDoesNotExist, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-		r := DatasetParents{THIS_DATASET_ID: datasetID, PARENT_DATASET_ID: pid}
-		err = r.Insert(tx)
-		if err != nil {
-			msg := fmt.Sprintf("%s unable to insert parent dataset record, error %v", hash, err)
-			log.Println(msg)
-			return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
-		}
-	}
+	return nil
+}
 
-	// commit transaction
-	err = tx.Commit()
+// helper function to insert file configuration of bulk block
+func insertFileConfig(tx *sql.Tx, rrr FileConfig, hash string) error {
+	data, err := json.Marshal(rrr)
 	if err != nil {
-		msg := fmt.Sprintf("%s fail to commit transaction, error %v", hash, err)
+		msg := fmt.Sprintf("%s unable to marshal file config list, error %v", hash, err)
 		log.Println(msg)
-		return Error(err, CommitErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksConcurrently")
+		return Error(err, MarshalErrorCode, msg, "dbs.bulkblocks.insertFileConfig")
 	}
-	if utils.VERBOSE > 1 {
-		log.Println(hash, "successfully finished bulkblocks.InsertBulkBlocksConcurrently")
+	api := &API{Reader: bytes.NewReader(data), Params: make(Record)}
+	err = api.InsertFileOutputModConfigs(tx)
+	if err != nil {
+		msg := fmt.Sprintf("%s unable to insert file output mod config, error %v", hash, err)
+		log.Println(msg)
+		return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertFileConfig")
 	}
+	return nil
+}
 
-	if a.Writer != nil {
-		a.Writer.Write([]byte(`[]`))
+// helper function to insert file parent record of bulk block, the file ids
+// are taken from FilesMap of trec and parent file ids from given map
+func insertFileParent(
+	tx *sql.Tx,
+	r FileParentRecord,
+	trec *TempFileRecord,
+	parentFilesMap map[string]int64,
+	hash string) error {
+	rrr := FileParents{}
+	lfn := r.LogicalFileName
+	if lfn == "" {
+		lfn = r.ThisLogicalFileName
+	}
+	if lfn == "" {
+		err := errors.New("mailformed file parent record")
+		msg := fmt.Sprintf("file parent record %+v does not contain LFN", r)
+		log.Println(msg)
+		return Error(err, NotImplementedApiCode, msg, "dbs.bulkblocks.insertFileParent")
+	}
+	if fileID, ok := trec.FilesMap.Load(lfn); ok {
+		rrr.THIS_FILE_ID = fileID.(int64)
+		log.Println("### this_logical_file_name", lfn, fileID)
+	} else {
+		err := errors.New("unable to locate LFN file id")
+		msg := fmt.Sprintf("no file id found for '%s'", lfn)
+		log.Println(msg)
+		return Error(err, SessionErrorCode, msg, "dbs.bulkblocks.insertFileParent")
+	}
+	// parent lfn should be already in DB
+	plfn := r.ParentLogicalFileName
+	if pfid, ok := parentFilesMap[plfn]; ok {
+		rrr.PARENT_FILE_ID = pfid
+	} else {
+		err := errors.New("unable to locate parent file id")
+		msg := fmt.Sprintf("no file id found for parent '%s'", lfn)
+		log.Println(msg)
+		return Error(err, FileParentDoesNotExist, msg, "dbs.bulkblocks.insertFileParent")
+	}
+	err := rrr.Insert(tx)
+	if err != nil {
+		msg := fmt.Sprintf("%s unable to insert file parents record %+v, error %v", hash, rrr, err)
+		log.Println(msg)
+		return Error(err, InsertErrorCode, msg, "dbs.bulkblocks.insertFileParent")
 	}
 	return nil
 }
@@ -0,0 +1,276 @@
+package dbs
+
+// bulkblocks batch module provides insertion of many bulk blocks within
+// single request
+//
+// The payload is either JSON array or NDJSON stream of BulkBlocks records.
+// The records are decoded one by one and the IDs of their look-up records
+// (primary dataset, eras, data tier, dataset, etc.) are resolved only once
+// per batch. By default every block is inserted within its own transaction,
+// while in atomic mode all blocks are inserted within single transaction
+// and the batch is inserted either entirely or not at all. In both modes
+// the API writes report with status of every block of the batch.
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// statuses of blocks in bulkblocks batch report
+const (
+	BlockInserted   = "inserted"    // block is inserted
+	BlockFailed     = "failed"      // block is not inserted due to its error
+	BlockRolledBack = "rolled_back" // block is not inserted due to error of other block of atomic batch
+	BlockSkipped    = "skipped"     // block is not processed due to error of other block of atomic batch
+)
+
+// BulkBlocksResult represents status of single block of bulkblocks batch
+type BulkBlocksResult struct {
+	Block   string `json:"block_name"`
+	Dataset string `json:"dataset"`
+	NFiles  int    `json:"nfiles"`
+	Status  string `json:"status"`
+	Code    int    `json:"code,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// helper function to set error of the block
+func (r *BulkBlocksResult) fail(status string, err error) {
+	r.Status = status
+	r.Code = GenericErrorCode
+	if e, ok := err.(*DBSError); ok {
+		r.Code = e.Code
+	}
+	r.Reason = err.Error()
+}
+
+// InsertBulkBlocksBatch DBS API inserts many bulk blocks provided either as
+// JSON array or NDJSON stream of BulkBlocks records. The atomic API
+// parameter defines if all blocks are inserted within single transaction.
+// The API writes list of BulkBlocksResult records and upon completion sets
+// API parameters to inserted blocks and number of their files. The API hook
+// is executed only within transaction of atomic batch, the blocks of
+// non-atomic batch are committed on their own.
+//
+//gocyclo:ignore
+func (a *API) InsertBulkBlocksBatch() error {
+	atomic := batchAtomic(a.Params)
+	ids := make(bulkBlockIDs)
+	var tx *sql.Tx
+	var err error
+	if atomic {
+		tx, err = DB.Begin()
+		if err != nil {
+			return Error(err, TransactionErrorCode, "", "dbs.bulkblocks.InsertBulkBlocksBatch")
+		}
+		defer tx.Rollback()
+	} else if a.Hook != nil {
+		hook := a.Hook
+		a.Hook = nil
+		defer func() {
+			a.Hook = hook
+		}()
+	}
+
+	// records of the batch are kept without their files to publish events
+	// of inserted blocks
+	var results []BulkBlocksResult
+	var records []BulkBlocks
+	var failed bool
+	// malformed record is reported as failed block
+	decodeFailed := func(err error) {
+		log.Printf("unable to unmarshal bulkblock record, error %v", err)
+		res := BulkBlocksResult{}
+		res.fail(BlockFailed, Error(err, UnmarshalErrorCode, "", "dbs.bulkblocks.InsertBulkBlocksBatch"))
+		results = append(results, res)
+		records = append(records, BulkBlocks{})
+		failed = true
+	}
+	insertBlock := func(data json.RawMessage) error {
+		var rec BulkBlocks
+		if err := json.Unmarshal(data, &rec); err != nil {
+			decodeFailed(err)
+			return nil
+		}
+		res := BulkBlocksResult{
+			Block:   rec.Block.BlockName,
+			Dataset: rec.Dataset.Dataset,
+			NFiles:  len(rec.Files),
+		}
+		if atomic && failed {
+			res.Status = BlockSkipped
+			results = append(results, res)
+			records = append(records, BulkBlocks{})
+			return nil
+		}
+		hash := utils.GetHash(data)
+		if utils.VERBOSE > 1 {
+			log.Println(hash, "start bulkblocks.InsertBulkBlocksBatch of", rec.Block.BlockName)
+		}
+		// check if is_file_valid was present in request, if not set it to 1
+		var isFileValid int64
+		if !strings.Contains(string(data), "is_file_valid") {
+			isFileValid = 1
+		}
+		parentFilesMap, err := getParentFilesMap(rec.FileParentList)
+		if err == nil {
+			insertFiles := bulkBlockFiles(&rec, parentFilesMap, hash)
+			// in atomic mode tx is used for all records including look-up ones
+			err = a.insertBulkBlock(tx, &rec, isFileValid, hash, ids, insertFiles)
+		}
+		if err != nil {
+			res.fail(BlockFailed, err)
+			failed = true
+		} else {
+			res.Status = BlockInserted
+		}
+		results = append(results, res)
+		rec.Files = nil
+		records = append(records, rec)
+		return nil
+	}
+	// the rest of the payload can not be decoded after malformed record,
+	// while blocks processed so far are reported as usual
+	if err := decodeBatch(a.Reader, insertBlock); err != nil {
+		decodeFailed(err)
+	}
+
+	if atomic {
+		if !failed {
+			// all blocks are inserted unless commit fails
+			a.Params = batchParams(atomic, results)
+			var response []byte
+			response, err = batchResponse(results)
+			if err == nil {
+				err = a.commit(tx, response)
+			}
+		}
+		if failed || err != nil {
+			if err != nil {
+				log.Println("fail to commit transaction of bulkblocks batch", err)
+				err = Error(err, CommitErrorCode, "", "dbs.bulkblocks.InsertBulkBlocksBatch")
+			}
+			for i := range results {
+				if results[i].Status != BlockInserted {
+					continue
+				}
+				if err != nil {
+					results[i].fail(BlockFailed, err)
+				} else {
+					results[i].Status = BlockRolledBack
+				}
+			}
+		}
+	}
+
+	for i, r := range results {
+		if r.Status == BlockInserted {
+			publishBulkBlockEvent(records[i], r.NFiles, a.CreateBy)
+		}
+	}
+	a.Params = batchParams(atomic, results)
+	if utils.VERBOSE > 0 {
+		blocks, _ := a.Params["block_names"].([]string)
+		log.Printf("bulkblocks batch inserted %d out of %d blocks", len(blocks), len(results))
+	}
+	if a.Writer != nil {
+		data, err := batchResponse(results)
+		if err != nil {
+			return err
+		}
+		a.Writer.Write(data)
+	}
+	return nil
+}
+
+// helper function to get API parameters of bulkblocks batch with inserted
+// blocks and number of their files
+func batchParams(atomic bool, results []BulkBlocksResult) Record {
+	blocks := []string{}
+	var nfiles int
+	for _, r := range results {
+		if r.Status != BlockInserted {
+			continue
+		}
+		blocks = append(blocks, r.Block)
+		nfiles += r.NFiles
+	}
+	return Record{
+		"atomic":      atomic,
+		"block_names": blocks,
+		"nfiles":      nfiles,
+	}
+}
+
+// helper function to encode response of bulkblocks batch API
+func batchResponse(results []BulkBlocksResult) ([]byte, error) {
+	if results == nil {
+		results = []BulkBlocksResult{}
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(results); err != nil {
+		return nil, Error(err, EncodeErrorCode, "", "dbs.bulkblocks.batchResponse")
+	}
+	return buf.Bytes(), nil
+}
+
+// helper function to get atomic parameter of bulkblocks batch API
+func batchAtomic(params Record) bool {
+	switch v := params["atomic"].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.ToLower(v) == "true"
+	case []string:
+		return len(v) == 1 && strings.ToLower(v[0]) == "true"
+	}
+	return false
+}
+
+// helper function to decode bulkblocks batch payload, it passes every
+// record of JSON array or NDJSON stream to given function
+func decodeBatch(r io.Reader, decodeRecord func(data json.RawMessage) error) error {
+	reader := bufio.NewReader(r)
+	// skip leading white spaces to find out if payload is JSON array
+	var isArray bool
+	for {
+		b, err := reader.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if unicode.IsSpace(rune(b[0])) {
+			reader.ReadByte()
+			continue
+		}
+		isArray = b[0] == '['
+		break
+	}
+	dec := json.NewDecoder(reader)
+	next := func() error {
+		var data json.RawMessage
+		if err := dec.Decode(&data); err != nil {
+			return err
+		}
+		return decodeRecord(data)
+	}
+	if isArray {
+		return decodeArray(dec, next)
+	}
+	for dec.More() {
+		if err := next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package dbs
+
+// bulkblocks dry-run module provides validation of bulkblocks payload
+//
+// The dry-run first performs independent checks of the payload and reports
+// every problem found: lexicon validation of dataset, block and files,
+// missing look-up values, missing parent files and datasets, and already
+// existing block and files. If none is found it performs the same insertion
+// as bulkblocks API, i.e. it inserts look-up records, dataset, block and its
+// files via insertBulkBlock, but within transaction which is always rolled
+// back. The outcome of the checks and insertion is written as report.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// BulkBlocksProblem represents problem found by bulkblocks dry-run
+type BulkBlocksProblem struct {
+	Function string `json:"function"`
+	Code     int    `json:"code"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+}
+
+// BulkBlocksReport represents report of bulkblocks dry-run
+type BulkBlocksReport struct {
+	Block      string              `json:"block_name"`
+	Dataset    string              `json:"dataset"`
+	NFiles     int                 `json:"nfiles"`
+	Valid      bool                `json:"valid"`
+	NewRecords []string            `json:"new_records"`
+	Problems   []BulkBlocksProblem `json:"problems"`
+}
+
+// helper function to add problem of given error to the report
+func (r *BulkBlocksReport) add(err error) {
+	var dbsErr *DBSError
+	if errors.As(err, &dbsErr) {
+		r.Problems = append(r.Problems, BulkBlocksProblem{
+			Function: dbsErr.Function,
+			Code:     dbsErr.Code,
+			Reason:   dbsErr.Reason,
+			Message:  dbsErr.Message,
+		})
+		return
+	}
+	r.Problems = append(r.Problems, BulkBlocksProblem{Code: GenericErrorCode, Reason: err.Error()})
+}
+
+// DryRunBulkBlocks DBS API checks bulkblocks payload, inserts it within
+// transaction which is always rolled back and writes report of all problems
+func (a *API) DryRunBulkBlocks() error {
+	data, err := io.ReadAll(a.Reader)
+	if err != nil {
+		log.Println("unable to read bulkblock input", err)
+		return Error(err, ReaderErrorCode, "", "dbs.bulkblocks.DryRunBulkBlocks")
+	}
+	hash := utils.GetHash(data)
+	var rec BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Printf("unable to unmarshal bulkblock record %s, error %v", string(data), err)
+		return Error(err, UnmarshalErrorCode, "", "dbs.bulkblocks.DryRunBulkBlocks")
+	}
+
+	// nothing inserted by the dry-run is committed
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.bulkblocks.DryRunBulkBlocks")
+	}
+	defer tx.Rollback()
+
+	report := BulkBlocksReport{
+		Block:      rec.Block.BlockName,
+		Dataset:    rec.Dataset.Dataset,
+		NFiles:     len(rec.Files),
+		NewRecords: []string{},
+		Problems:   []BulkBlocksProblem{},
+	}
+
+	// look-up records which bulkblocks API would insert, the look-up value
+	// of all records but physics group is required
+	lookups := []struct {
+		table, id, attr string
+		val             interface{}
+		code            int
+	}{
+		{"PRIMARY_DS_TYPES", "primary_ds_type_id", "primary_ds_type", rec.PrimaryDataset.PrimaryDSType, PrimaryDatasetTypeDoesNotExist},
+		{"PRIMARY_DATASETS", "primary_ds_id", "primary_ds_name", rec.PrimaryDataset.PrimaryDSName, PrimaryDatasetDoesNotExist},
+		{"PROCESSING_ERAS", "processing_era_id", "processing_version", rec.ProcessingEra.ProcessingVersion, ProcessingEraDoesNotExist},
+		{"ACQUISITION_ERAS", "acquisition_era_id", "acquisition_era_name", rec.AcquisitionEra.AcquisitionEraName, AcquisitionEraDoesNotExist},
+		{"DATA_TIERS", "data_tier_id", "data_tier_name", rec.Dataset.DataTierName, DataTierDoesNotExist},
+		{"PHYSICS_GROUPS", "physics_group_id", "physics_group_name", rec.Dataset.PhysicsGroupName, 0},
+		{"DATASET_ACCESS_TYPES", "dataset_access_type_id", "dataset_access_type", rec.Dataset.DatasetAccessType, DatasetAccessTypeDoesNotExist},
+		{"PROCESSED_DATASETS", "processed_ds_id", "processed_ds_name", rec.Dataset.ProcessedDSName, ProcessedDatasetDoesNotExist},
+		{"DATASETS", "dataset_id", "dataset", rec.Dataset.Dataset, DatasetDoesNotExist},
+	}
+	for _, r := range lookups {
+		if v := fmt.Sprintf("%v", r.val); v == "" || v == "0" {
+			if r.code != 0 {
+				msg := fmt.Sprintf("missing %s of %s record", r.attr, r.table)
+				report.add(Error(InvalidParamErr, r.code, msg, "dbs.bulkblocks.DryRunBulkBlocks"))
+			}
+			continue
+		}
+		if rid, err := GetID(tx, r.table, r.id, r.attr, r.val); err != nil || rid == 0 {
+			report.NewRecords = append(report.NewRecords, fmt.Sprintf("%s %s=%v", r.table, r.attr, r.val))
+		}
+	}
+	dryRunChecks(tx, &rec, &report)
+
+	// perform the same insertion as InsertBulkBlocksConcurrently API as
+	// final check of the payload without problems
+	if len(report.Problems) == 0 {
+		var isFileValid int64
+		if !strings.Contains(string(data), "is_file_valid") {
+			isFileValid = 1
+		}
+		parentFilesMap, err := getParentFilesMap(rec.FileParentList)
+		if err == nil {
+			insertFiles := bulkBlockFiles(&rec, parentFilesMap, hash)
+			err = a.insertBulkBlock(tx, &rec, isFileValid, hash, nil, insertFiles)
+		}
+		if err != nil {
+			report.add(err)
+		}
+	}
+
+	report.Valid = len(report.Problems) == 0
+	if utils.VERBOSE > 0 {
+		log.Printf("bulkblocks dry-run of %s found %d problems", report.Block, len(report.Problems))
+	}
+	if a.Writer != nil {
+		if err := json.NewEncoder(a.Writer).Encode(report); err != nil {
+			return Error(err, EncodeErrorCode, "", "dbs.bulkblocks.DryRunBulkBlocks")
+		}
+	}
+	return nil
+}
+
+// helper function to check bulkblocks payload within given transaction, it
+// adds every problem found to the report
+func dryRunChecks(tx *sql.Tx, rec *BulkBlocks, report *BulkBlocksReport) {
+	fname := "dbs.bulkblocks.dryRunChecks"
+	exists := func(table, id, attr string, val interface{}) bool {
+		rid, err := GetID(tx, table, id, attr, val)
+		return err == nil && rid != 0
+	}
+
+	// lexicon validation of dataset, block and files
+	if err := CheckPattern("dataset", rec.Dataset.Dataset); err != nil {
+		report.add(Error(err, PatternErrorCode, fmt.Sprintf("invalid dataset %s", rec.Dataset.Dataset), fname))
+	}
+	if err := CheckPattern("block_name", rec.Block.BlockName); err != nil {
+		report.add(Error(err, PatternErrorCode, fmt.Sprintf("invalid block %s", rec.Block.BlockName), fname))
+	}
+	for _, f := range rec.Files {
+		if err := CheckPattern("logical_file_name", f.LogicalFileName); err != nil {
+			report.add(Error(err, PatternErrorCode, fmt.Sprintf("invalid file %s", f.LogicalFileName), fname))
+		}
+	}
+
+	// parent files and datasets should be already in DBS
+	for _, lfn := range utils.Set(fileParentLfns(rec.FileParentList)) {
+		if !exists("FILES", "file_id", "logical_file_name", lfn) {
+			msg := fmt.Sprintf("parent file %s does not exist", lfn)
+			report.add(Error(RecordErr, FileParentDoesNotExist, msg, fname))
+		}
+	}
+	parents := rec.DatasetParentList
+	for _, d := range rec.DsParentList {
+		parents = append(parents, d.ParentDataset)
+	}
+	for _, ds := range utils.Set(parents) {
+		if !exists("DATASETS", "dataset_id", "dataset", ds) {
+			msg := fmt.Sprintf("parent dataset %s does not exist", ds)
+			report.add(Error(RecordErr, DatasetParentDoesNotExist, msg, fname))
+		}
+	}
+
+	// block and files should not exist in DBS
+	if exists("BLOCKS", "block_id", "block_name", rec.Block.BlockName) {
+		msg := fmt.Sprintf("Block %s already exists", rec.Block.BlockName)
+		report.add(Error(RecordErr, BlockAlreadyExists, msg, fname))
+	}
+	for _, f := range rec.Files {
+		if exists("FILES", "file_id", "logical_file_name", f.LogicalFileName) {
+			msg := fmt.Sprintf("file %s already exists", f.LogicalFileName)
+			report.add(Error(RecordErr, InsertErrorCode, msg, fname))
+		}
+	}
+}
+
+// helper function to get parent files of file parent list
+func fileParentLfns(records []FileParentRecord) []string {
+	var lfns []string
+	for _, r := range records {
+		lfns = append(lfns, r.ParentLogicalFileName)
+	}
+	return lfns
+}
@@ -0,0 +1,311 @@
+package dbs
+
+// bulkblocks stream module provides bulk blocks insertion with streaming
+// decoding of its payload
+//
+// The payload of large blocks may contain tens of thousands of files with
+// millions of lumis. Instead of loading it into memory the payload is
+// spooled to temporary file and decoded token by token: the first pass
+// decodes block meta-data and resolves parent files, the second pass
+// inserts files in batches of StreamFilesBatch records and the last pass
+// inserts file configurations and file parents. Therefore, the memory
+// footprint does not depend on number of files and lumis in a block.
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// StreamFilesBatch defines number of files inserted at once by streaming
+// bulkblocks API
+var StreamFilesBatch = 100
+
+// InsertBulkBlocksStream DBS API provides bulk blocks insertion with
+// streaming decoding of its payload. It follows the logic of
+// InsertBulkBlocksConcurrently API but keeps in memory only block
+// meta-data and a batch of files. The API parameters are set to inserted
+// dataset, block name and number of files.
+func (a *API) InsertBulkBlocksStream() error {
+	fname, hash, err := SpoolPayload(a.Reader)
+	if err != nil {
+		log.Println("unable to read bulkblock input", err)
+		return Error(err, ReaderErrorCode, "", "dbs.bulkblocks.InsertBulkBlocksStream")
+	}
+	defer os.Remove(fname)
+	if utils.VERBOSE > 1 {
+		log.Println(hash, "start bulkblocks.InsertBulkBlocksStream")
+	}
+
+	// first pass: decode block meta-data, count files and find out file
+	// ids of parent files
+	var rec BulkBlocks
+	var nfiles int
+	var hasFileValid bool
+	parentFilesMap := make(map[string]int64)
+	handlers := map[string]func(dec *json.Decoder) error{
+		"dataset_conf_list":   decodeValue(&rec.DatasetConfigList),
+		"processing_era":      decodeValue(&rec.ProcessingEra),
+		"primds":              decodeValue(&rec.PrimaryDataset),
+		"dataset":             decodeValue(&rec.Dataset),
+		"acquisition_era":     decodeValue(&rec.AcquisitionEra),
+		"block":               decodeValue(&rec.Block),
+		"block_parent_list":   decodeValue(&rec.BlockParentList),
+		"dataset_parent_list": decodeValue(&rec.DatasetParentList),
+		"ds_parent_list":      decodeValue(&rec.DsParentList),
+		"files": func(dec *json.Decoder) error {
+			return decodeArray(dec, func() error {
+				var f struct {
+					IsFileValid *int64 `json:"is_file_valid"`
+				}
+				if err := dec.Decode(&f); err != nil {
+					return err
+				}
+				if f.IsFileValid != nil {
+					hasFileValid = true
+				}
+				nfiles++
+				return nil
+			})
+		},
+		"file_parent_list": func(dec *json.Decoder) error {
+			return decodeArray(dec, func() error {
+				var r FileParentRecord
+				if err := dec.Decode(&r); err != nil {
+					return err
+				}
+				// parent lfn should be already in DB
+				plfn := r.ParentLogicalFileName
+				if _, ok := parentFilesMap[plfn]; ok {
+					return nil
+				}
+				pfid, err := QueryRow("FILES", "file_id", "logical_file_name", plfn)
+				if err != nil {
+					msg := fmt.Sprintf("unable to find parent lfn %s", plfn)
+					return Error(err, DatabaseErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksStream")
+				}
+				parentFilesMap[plfn] = pfid
+				return nil
+			})
+		},
+	}
+	if err := decodeFile(fname, handlers); err != nil {
+		return streamError(err, hash)
+	}
+
+	// check if is_file_valid was present in request, if not set it to 1
+	var isFileValid int64
+	if !hasFileValid {
+		isFileValid = 1
+	}
+
+	insertFiles := func(tx *sql.Tx, trec *TempFileRecord) error {
+		// second pass: insert files in batches
+		batchSize := StreamFilesBatch
+		if batchSize <= 0 {
+			batchSize = 100
+		}
+		var batch []File
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := insertBulkFiles(tx, batch, trec, hash)
+			batch = batch[:0]
+			return err
+		}
+		handlers := map[string]func(dec *json.Decoder) error{
+			"files": func(dec *json.Decoder) error {
+				return decodeArray(dec, func() error {
+					var f File
+					if err := dec.Decode(&f); err != nil {
+						return err
+					}
+					batch = append(batch, f)
+					if len(batch) >= batchSize {
+						return flush()
+					}
+					return nil
+				})
+			},
+		}
+		if err := decodeFile(fname, handlers); err != nil {
+			return streamError(err, hash)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		// last pass: insert file configurations and file parents
+		handlers = map[string]func(dec *json.Decoder) error{
+			"file_conf_list": func(dec *json.Decoder) error {
+				return decodeArray(dec, func() error {
+					var r FileConfig
+					if err := dec.Decode(&r); err != nil {
+						return err
+					}
+					return insertFileConfig(tx, r, hash)
+				})
+			},
+			"file_parent_list": func(dec *json.Decoder) error {
+				return decodeArray(dec, func() error {
+					var r FileParentRecord
+					if err := dec.Decode(&r); err != nil {
+						return err
+					}
+					return insertFileParent(tx, r, trec, parentFilesMap, hash)
+				})
+			},
+		}
+		if err := decodeFile(fname, handlers); err != nil {
+			return streamError(err, hash)
+		}
+		return nil
+	}
+	// API parameters are used by API hook executed within the transaction
+	a.Params = Record{
+		"dataset":    rec.Dataset.Dataset,
+		"block_name": rec.Block.BlockName,
+		"nfiles":     nfiles,
+	}
+	if err = a.insertBulkBlock(nil, &rec, isFileValid, hash, nil, insertFiles); err != nil {
+		return err
+	}
+	if utils.VERBOSE > 1 {
+		log.Println(hash, "successfully finished bulkblocks.InsertBulkBlocksStream")
+	}
+	publishBulkBlockEvent(rec, nfiles, a.CreateBy)
+
+	if a.Writer != nil {
+		a.Writer.Write([]byte(`[]`))
+	}
+	return nil
+}
+
+// helper function to convert errors of streaming decoder to DBS error
+func streamError(err error, hash string) error {
+	if _, ok := err.(*DBSError); ok {
+		return err
+	}
+	msg := fmt.Sprintf("%s unable to decode bulkblock record, error %v", hash, err)
+	log.Println(msg)
+	return Error(err, UnmarshalErrorCode, msg, "dbs.bulkblocks.InsertBulkBlocksStream")
+}
+
+// SpoolPayload spools payload into temporary file, it returns name of the
+// file and hash of the payload. The caller should remove the file.
+func SpoolPayload(r io.Reader) (string, string, error) {
+	file, err := os.CreateTemp("", "bulkblocks-*.json")
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), r); err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	return file.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// helper function to decode JSON object stored in given file, see decodeObject
+func decodeFile(fname string, handlers map[string]func(dec *json.Decoder) error) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return decodeObject(json.NewDecoder(bufio.NewReader(file)), handlers)
+}
+
+// helper function to decode JSON object token by token, the values of
+// keys with handlers are passed to them while other values are skipped
+func decodeObject(dec *json.Decoder, handlers map[string]func(dec *json.Decoder) error) error {
+	if err := expectDelim(dec, json.Delim('{')); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if h, ok := handlers[key]; ok {
+			err = h(dec)
+		} else {
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, json.Delim('}'))
+}
+
+// helper function to decode elements of JSON array via given function,
+// the null value is treated as an empty array
+func decodeArray(dec *json.Decoder, decodeElement func() error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expected JSON array, got %v", tok)
+	}
+	for dec.More() {
+		if err := decodeElement(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, json.Delim(']'))
+}
+
+// helper function to provide handler which decodes JSON value into given value
+func decodeValue(v interface{}) func(dec *json.Decoder) error {
+	return func(dec *json.Decoder) error {
+		return dec.Decode(v)
+	}
+}
+
+// helper function to skip JSON value without decoding it
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// helper function to read expected JSON delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected JSON delimiter %v, got %v", delim, tok)
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package dbs
+
+// columnar module provides Apache Arrow, Parquet and CSV/TSV output of DBS reader APIs
+//
+// The reader APIs stream their results via executeAll/execute functions.
+// When client asks for columnar output the scanned rows are accumulated
+// into typed record batches, whose schema is derived from SQL column types,
+// and written out as Arrow IPC stream or Parquet file. The CSV/TSV output
+// is written row by row after a header row built from the query columns.
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+	"github.com/apache/arrow/go/v15/parquet"
+	"github.com/apache/arrow/go/v15/parquet/compress"
+	"github.com/apache/arrow/go/v15/parquet/pqarrow"
+)
+
+// ArrowContentType represents content type of Apache Arrow IPC stream
+const ArrowContentType = "application/vnd.apache.arrow.stream"
+
+// ParquetContentType represents content type of Apache Parquet file
+const ParquetContentType = "application/parquet"
+
+// CSVContentType represents content type of comma separated values
+const CSVContentType = "text/csv"
+
+// TSVContentType represents content type of tab separated values
+const TSVContentType = "text/tab-separated-values"
+
+// ColumnarBatchSize defines number of rows in single columnar record batch
+var ColumnarBatchSize = 65536
+
+// ColumnarWriter represents writer of columnar (Arrow, Parquet, CSV or TSV) output
+type ColumnarWriter struct {
+	http.ResponseWriter
+	ContentType string
+}
+
+// ColumnarContentType returns columnar content type acceptable by client
+// or empty string if client did not ask for columnar output
+func ColumnarContentType(accept string) string {
+	for _, v := range strings.Split(accept, ",") {
+		ctype := strings.TrimSpace(strings.Split(v, ";")[0])
+		switch ctype {
+		case ArrowContentType, ParquetContentType, CSVContentType, TSVContentType:
+			return ctype
+		}
+	}
+	return ""
+}
+
+// helper function to get columnar writer from given writer
+func writerColumnar(w io.Writer) *ColumnarWriter {
+	if pw, ok := w.(*PageWriter); ok {
+		w = pw.ResponseWriter
+	}
+	if cw, ok := w.(*ColumnarWriter); ok {
+		return cw
+	}
+	return nil
+}
+
+// columnar represents columnar output of single SQL query
+type columnar struct {
+	w           io.Writer
+	contentType string
+	names       []string
+	types       []arrow.DataType // column types, nil type is inferred from the data
+	rows        [][]interface{}
+	schema      *arrow.Schema
+	ipcWriter   *ipc.Writer
+	pqWriter    *pqarrow.FileWriter
+	csvWriter   *csv.Writer
+}
+
+// helper function to create columnar output for given columns and their types
+func newColumnar(w io.Writer, contentType string, names []string, types []arrow.DataType) *columnar {
+	return &columnar{w: w, contentType: contentType, names: names, types: types}
+}
+
+// helper function to get arrow data types of SQL result set columns
+func columnTypes(cols []*sql.ColumnType) []arrow.DataType {
+	var out []arrow.DataType
+	for _, col := range cols {
+		out = append(out, columnType(col))
+	}
+	return out
+}
+
+// helper function to get arrow data type of SQL result set column
+func columnType(col *sql.ColumnType) arrow.DataType {
+	dbType := strings.ToUpper(col.DatabaseTypeName())
+	switch {
+	case strings.Contains(dbType, "INT"):
+		return arrow.PrimitiveTypes.Int64
+	case strings.Contains(dbType, "NUMBER"), strings.Contains(dbType, "NUMERIC"), strings.Contains(dbType, "DECIMAL"):
+		if _, scale, ok := col.DecimalSize(); ok && scale == 0 {
+			return arrow.PrimitiveTypes.Int64
+		}
+		return arrow.PrimitiveTypes.Float64
+	case strings.Contains(dbType, "REAL"), strings.Contains(dbType, "FLOAT"), strings.Contains(dbType, "DOUBLE"):
+		return arrow.PrimitiveTypes.Float64
+	case strings.Contains(dbType, "CHAR"), strings.Contains(dbType, "TEXT"), strings.Contains(dbType, "CLOB"):
+		return arrow.BinaryTypes.String
+	case strings.Contains(dbType, "BOOL"):
+		return arrow.FixedWidthTypes.Boolean
+	}
+	if t := col.ScanType(); t != nil {
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return arrow.PrimitiveTypes.Int64
+		case reflect.Float32, reflect.Float64:
+			return arrow.PrimitiveTypes.Float64
+		case reflect.Bool:
+			return arrow.FixedWidthTypes.Boolean
+		case reflect.String:
+			return arrow.BinaryTypes.String
+		}
+	}
+	// column type is unknown, e.g. SQL expression, it will be inferred from the data
+	return nil
+}
+
+// helper function to get arrow data types of explicit scan values
+func valueTypes(vals []interface{}) []arrow.DataType {
+	var out []arrow.DataType
+	for _, val := range vals {
+		switch val.(type) {
+		case *sql.NullInt64, *sql.NullInt32, *sql.NullInt16, *int64, *int:
+			out = append(out, arrow.PrimitiveTypes.Int64)
+		case *sql.NullFloat64, *float64:
+			out = append(out, arrow.PrimitiveTypes.Float64)
+		case *sql.NullBool, *bool:
+			out = append(out, arrow.FixedWidthTypes.Boolean)
+		case *sql.NullString, *string:
+			out = append(out, arrow.BinaryTypes.String)
+		default:
+			out = append(out, nil)
+		}
+	}
+	return out
+}
+
+// helper function to get plain value of scanned value
+func scannedValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case driver.Valuer:
+		if rv, err := v.Value(); err == nil {
+			return rv
+		}
+		return nil
+	case *int64:
+		return *v
+	case *int:
+		return int64(*v)
+	case *float64:
+		return *v
+	case *bool:
+		return *v
+	case *string:
+		return *v
+	case *interface{}:
+		return *v
+	}
+	return val
+}
+
+// helper function to infer arrow data type of given value
+func inferType(val interface{}) arrow.DataType {
+	switch val.(type) {
+	case int64, int32, int:
+		return arrow.PrimitiveTypes.Int64
+	case float64, float32:
+		return arrow.PrimitiveTypes.Float64
+	case bool:
+		return arrow.FixedWidthTypes.Boolean
+	}
+	return arrow.BinaryTypes.String
+}
+
+// helper function to append row to columnar output, the row values are
+// copied since SQL scan buffers are reused between rows
+func (c *columnar) append(vals []interface{}) error {
+	row := make([]interface{}, len(vals))
+	for i, val := range vals {
+		v := scannedValue(val)
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		row[i] = v
+	}
+	if c.delimited() {
+		return c.writeText(row)
+	}
+	c.rows = append(c.rows, row)
+	if len(c.rows) >= ColumnarBatchSize {
+		return c.flush()
+	}
+	return nil
+}
+
+// helper function to check if columnar output is delimited text, i.e. CSV or TSV
+func (c *columnar) delimited() bool {
+	return c.contentType == CSVContentType || c.contentType == TSVContentType
+}
+
+// helper function to write single row of delimited text output
+func (c *columnar) writeText(row []interface{}) error {
+	if c.csvWriter == nil {
+		if err := c.init(); err != nil {
+			return err
+		}
+	}
+	var out []string
+	for _, val := range row {
+		out = append(out, textValue(val))
+	}
+	if err := c.csvWriter.Write(out); err != nil {
+		return Error(err, WriterErrorCode, "unable to write row", "dbs.columnar.writeText")
+	}
+	return nil
+}
+
+// helper function to initialize schema and writer of columnar output
+func (c *columnar) init() error {
+	if c.delimited() {
+		c.csvWriter = csv.NewWriter(c.w)
+		if c.contentType == TSVContentType {
+			c.csvWriter.Comma = '\t'
+		}
+		// header row is written even if query has no results
+		if err := c.csvWriter.Write(c.names); err != nil {
+			return Error(err, WriterErrorCode, "unable to write header", "dbs.columnar.init")
+		}
+		return nil
+	}
+	var fields []arrow.Field
+	for i, name := range c.names {
+		var dtype arrow.DataType
+		if i < len(c.types) {
+			dtype = c.types[i]
+		}
+		if dtype == nil {
+			// infer type from the first non null value of the column
+			dtype = arrow.BinaryTypes.String
+			for _, row := range c.rows {
+				if row[i] != nil {
+					dtype = inferType(row[i])
+					break
+				}
+			}
+		}
+		fields = append(fields, arrow.Field{Name: name, Type: dtype, Nullable: true})
+	}
+	c.schema = arrow.NewSchema(fields, nil)
+	if c.contentType == ParquetContentType {
+		props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+		writer, err := pqarrow.NewFileWriter(c.schema, c.w, props, pqarrow.DefaultWriterProps())
+		if err != nil {
+			return Error(err, WriterErrorCode, "unable to create parquet writer", "dbs.columnar.init")
+		}
+		c.pqWriter = writer
+	} else {
+		c.ipcWriter = ipc.NewWriter(c.w, ipc.WithSchema(c.schema), ipc.WithAllocator(memory.DefaultAllocator))
+	}
+	return nil
+}
+
+// helper function to write accumulated rows as single record batch
+func (c *columnar) flush() error {
+	if c.delimited() {
+		if c.csvWriter == nil {
+			if err := c.init(); err != nil {
+				return err
+			}
+		}
+		c.csvWriter.Flush()
+		if err := c.csvWriter.Error(); err != nil {
+			return Error(err, WriterErrorCode, "unable to flush rows", "dbs.columnar.flush")
+		}
+		return nil
+	}
+	if c.schema == nil {
+		if err := c.init(); err != nil {
+			return err
+		}
+	}
+	if len(c.rows) == 0 {
+		return nil
+	}
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, c.schema)
+	defer builder.Release()
+	for _, row := range c.rows {
+		for i, val := range row {
+			appendValue(builder.Field(i), val)
+		}
+	}
+	rec := builder.NewRecord()
+	defer rec.Release()
+	c.rows = c.rows[:0]
+	var err error
+	if c.pqWriter != nil {
+		err = c.pqWriter.Write(rec)
+	} else {
+		err = c.ipcWriter.Write(rec)
+	}
+	if err != nil {
+		return Error(err, WriterErrorCode, "unable to write record batch", "dbs.columnar.flush")
+	}
+	return nil
+}
+
+// helper function to write remaining rows and finalize columnar output
+func (c *columnar) close() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	if c.delimited() {
+		return nil
+	}
+	var err error
+	if c.pqWriter != nil {
+		err = c.pqWriter.Close()
+	} else {
+		err = c.ipcWriter.Close()
+	}
+	if err != nil {
+		return Error(err, WriterErrorCode, "unable to close columnar writer", "dbs.columnar.close")
+	}
+	return nil
+}
+
+// helper function to append value to arrow array builder, the value is
+// converted to builder type and values which can't be converted are nulls
+func appendValue(b array.Builder, val interface{}) {
+	if val == nil {
+		b.AppendNull()
+		return
+	}
+	switch bldr := b.(type) {
+	case *array.Int64Builder:
+		if v, ok := toInt64(val); ok {
+			bldr.Append(v)
+			return
+		}
+	case *array.Float64Builder:
+		if v, ok := toFloat64(val); ok {
+			bldr.Append(v)
+			return
+		}
+	case *array.BooleanBuilder:
+		if v, ok := toFloat64(val); ok {
+			bldr.Append(v != 0)
+			return
+		}
+		if v, ok := val.(bool); ok {
+			bldr.Append(v)
+			return
+		}
+	case *array.StringBuilder:
+		bldr.Append(textValue(val))
+		return
+	}
+	b.AppendNull()
+}
+
+// helper function to convert value to its text representation
+func textValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// helper function to convert value to int64
+func toInt64(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), v == float64(int64(v))
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// helper function to convert value to float64
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -110,7 +110,7 @@ func (r *DatasetOutputModConfigs) Decode(reader io.Reader) error {
 
 // InsertDatasetOutputModConfigs DBS API
 func (a *API) InsertDatasetOutputModConfigs() error {
-	err := insertRecord(&DatasetOutputModConfigs{}, a.Reader)
+	err := a.insertRecord(&DatasetOutputModConfigs{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.dataset_output_configs.InsertDatasetOutputModConfigs")
 	}
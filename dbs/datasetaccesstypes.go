@@ -115,7 +115,7 @@ func (r *DatasetAccessTypes) Decode(reader io.Reader) error {
 
 // InsertDatasetAccessTypes DBS API
 func (a *API) InsertDatasetAccessTypes() error {
-	err := insertRecord(&DatasetAccessTypes{}, a.Reader)
+	err := a.insertRecord(&DatasetAccessTypes{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.datasetaccesstypes.InsertDatasetAccessTypes")
 	}
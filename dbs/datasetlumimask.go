@@ -0,0 +1,126 @@
+package dbs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// DatasetLumiMask DBS API provides lumi mask of dataset or block, i.e.
+// lumi section ranges of its runs. The optional lumi_mask parameter along
+// with operation parameter (intersection or difference) defines lumi mask
+// the result is compared with.
+//
+//gocyclo:ignore
+func (a *API) DatasetLumiMask() error {
+	var args []interface{}
+	var conds []string
+
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["Dataset"] = false
+	tmpl["BlockName"] = false
+	tmpl["ValidFileOnly"] = false
+
+	datasets := getValues(a.Params, "dataset")
+	blocks := getValues(a.Params, "block_name")
+	if len(datasets) > 1 || len(blocks) > 1 {
+		msg := "datasetlumimask API does not support list of datasets or blocks"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	if len(datasets) == len(blocks) {
+		msg := "datasetlumimask API requires either dataset or block_name parameter"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	for _, v := range append(datasets, blocks...) {
+		if strings.Contains(v, "*") {
+			msg := "wild-card dataset or block_name value is not allowed"
+			return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.datasetlumimask.DatasetLumiMask")
+		}
+	}
+	if len(datasets) == 1 {
+		tmpl["Dataset"] = true
+		conds, args = AddParam("dataset", "D.DATASET", a.Params, conds, args)
+	} else {
+		tmpl["BlockName"] = true
+		conds, args = AddParam("block_name", "B.BLOCK_NAME", a.Params, conds, args)
+	}
+
+	validFileOnly := getValues(a.Params, "validFileOnly")
+	if len(validFileOnly) == 1 && validFileOnly[0] == "1" {
+		tmpl["ValidFileOnly"] = true
+		conds = append(conds, "F.IS_FILE_VALID = 1")
+		conds = append(conds, "DT.DATASET_ACCESS_TYPE in ('VALID', 'PRODUCTION')")
+	}
+
+	// lumi mask to compare with
+	mask, err := getLumiMask(a.Params)
+	if err != nil {
+		return Error(err, ParametersErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	operation, _ := getSingleValue(a.Params, "operation")
+	if mask == nil && operation != "" {
+		msg := "operation parameter requires lumi_mask"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	if mask != nil && operation == "" {
+		operation = "intersection"
+	}
+	if operation != "" && operation != "intersection" && operation != "difference" {
+		msg := fmt.Sprintf("unsupported operation '%s', use intersection or difference", operation)
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.datasetlumimask.DatasetLumiMask")
+	}
+
+	stm, err := LoadTemplateSQL("datasetlumis", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	tmpl["Statement"] = WhereClause(stm, conds)
+	stm, err = LoadTemplateSQL("datasetlumimask", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	stm = CleanStatement(stm)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+
+	// aggregate lumi ranges of the runs
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return Error(err, QueryErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+	}
+	defer rows.Close()
+	lumiMask := make(LumiMask)
+	for rows.Next() {
+		var run, minLumi, maxLumi int64
+		if err := rows.Scan(&run, &minLumi, &maxLumi); err != nil {
+			return Error(err, RowsScanErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+		}
+		lumiMask[run] = append(lumiMask[run], []int64{minLumi, maxLumi})
+	}
+	if err := rows.Err(); err != nil {
+		return Error(err, RowsScanErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+	}
+
+	if operation == "intersection" {
+		lumiMask = lumiMask.intersect(mask)
+	} else if operation == "difference" {
+		lumiMask = lumiMask.subtract(mask)
+	}
+	if a.Writer != nil {
+		if err := json.NewEncoder(a.Writer).Encode(lumiMask); err != nil {
+			return Error(err, EncodeErrorCode, "", "dbs.datasetlumimask.DatasetLumiMask")
+		}
+	}
+	return nil
+}
@@ -19,6 +19,13 @@ func (a *API) Datasets() error {
 	if utils.VERBOSE > 1 {
 		log.Printf("datasets params %+v", a.Params)
 	}
+	// client may ask for state of datasets at given time
+	if asOf, ok, err := asOfDate(a.Params); ok {
+		if err != nil {
+			return Error(err, ParametersErrorCode, "", "dbs.datasets.Datasets")
+		}
+		return a.DatasetsAsOf(asOf)
+	}
 	var args []interface{}
 	var conds []string
 	tmpl := make(Record)
@@ -653,7 +660,7 @@ func (a *API) InsertDatasets() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("fail to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.datasets.InsertDatasets")
@@ -802,6 +809,9 @@ func (a *API) UpdateDatasets() error {
 
 	args = append(args, dataset)
 
+	if err := a.updateHook(tx); err != nil {
+		return err
+	}
 	// perform update
 	// _, err = tx.Exec(stm, createBy, date, accessTypeID, isValidDataset, physicsGroupID, dataset)
 	_, err = tx.Exec(stm, args...)
@@ -813,11 +823,19 @@ func (a *API) UpdateDatasets() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("unable to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.datasets.UpdateDatasets")
 	}
+	values := make(Record)
+	if tmpl["DatasetAccessType"].(bool) {
+		values["dataset_access_type"] = datasetAccessType
+	}
+	if tmpl["PhysicsGroup"].(bool) {
+		values["physics_group_name"] = physicsGroupName
+	}
+	publishEvent(Event{Type: DatasetUpdatedEvent, Dataset: dataset, Values: values, CreateBy: createBy})
 	if a.Writer != nil {
 		a.Writer.Write([]byte(`[]`))
 	}
@@ -36,6 +36,59 @@ type API struct {
 	Separator string              // string separator for ndjson format
 	CreateBy  string              // create by value from run-time
 	Api       string              // api name
+	Hook      TxHook              // hook executed within transaction of write API
+	committed bool                // hook is committed along with API changes
+}
+
+// TxHook represents functions executed within transaction of DBS write API,
+// e.g. to record audit trail of the API, such that their records are
+// committed along with API changes or not at all
+type TxHook interface {
+	// Update is executed by update APIs before they modify DBS records
+	Update(tx *sql.Tx) error
+	// Commit is executed before transaction commit with the API response
+	Commit(tx *sql.Tx, response []byte) error
+}
+
+// HookCommitted reports if API hook is committed. Write APIs which do not
+// use single transaction, e.g. non-atomic bulkblocks batch, do not execute
+// the hook and the caller should execute it via CommitHook.
+func (a *API) HookCommitted() bool {
+	return a.committed
+}
+
+// helper function to execute API hook before update API modifies DBS records
+func (a *API) updateHook(tx *sql.Tx) error {
+	if a.Hook == nil {
+		return nil
+	}
+	return a.Hook.Update(tx)
+}
+
+// helper function to commit transaction of write API along with records of
+// API hook, the response is API output written after the commit
+func (a *API) commit(tx *sql.Tx, response []byte) error {
+	if a.Hook != nil {
+		if err := a.Hook.Commit(tx, response); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	a.committed = a.Hook != nil
+	return nil
+}
+
+// CommitHook executes API hook within its own transaction with given API
+// response
+func (a *API) CommitHook(response []byte) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.CommitHook")
+	}
+	defer tx.Rollback()
+	return a.commit(tx, response)
 }
 
 // String provides string representation of API struct
@@ -54,7 +107,7 @@ type Record map[string]interface{}
 // DB represents sql DB pointer
 var DB *sql.DB
 
-// DBTYPE represents DBS DB type, e.g. ORACLE or SQLite
+// DBTYPE represents DBS DB type, e.g. ORACLE, PostgreSQL or SQLite
 var DBTYPE string
 
 // DBSQL represents DBS SQL record
@@ -78,6 +131,9 @@ var FileLumiInsertMethod string
 // ConcurrentBulkBlocks defines if code should use concurrent bulkblocks API
 var ConcurrentBulkBlocks bool
 
+// StreamBulkBlocks defines if code should use streaming bulkblocks API
+var StreamBulkBlocks bool
+
 // DBRecord interface represents general DB record used by DBS APIs.
 // Each DBS API represents specific Table in back-end DB. And, each individual
 // DBS API implements logic for its own DB records
@@ -115,8 +171,9 @@ func Date() int64 {
 	return time.Now().Unix()
 }
 
-// helper function to insert DB record with given reader
-func insertRecord(rec DBRecord, r io.Reader) error {
+// helper function to insert DB record with given reader, the response of
+// insert APIs is empty list
+func (a *API) insertRecord(rec DBRecord, r io.Reader) error {
 	err := rec.Decode(r)
 	if err != nil {
 		msg := fmt.Sprintf("fail to decode record")
@@ -149,7 +206,7 @@ func insertRecord(rec DBRecord, r io.Reader) error {
 	if utils.VERBOSE > 2 {
 		log.Printf("record %+v tx.Commit", rec)
 	}
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		return Error(err, CommitErrorCode, "", "dbs.insertRecord")
 	}
@@ -158,6 +215,11 @@ func insertRecord(rec DBRecord, r io.Reader) error {
 
 // LoadTemplateSQL function loads DBS SQL templated statements
 func LoadTemplateSQL(tmpl string, tmplData Record) (string, error) {
+	return loadTemplateSQL(tmpl, tmplData, DBTYPE, DBOWNER)
+}
+
+// helper function to load SQL template for database of given driver and owner
+func loadTemplateSQL(tmpl string, tmplData Record, dbtype, dbowner string) (string, error) {
 	sdir := fmt.Sprintf("%s/sql", utils.STATICDIR)
 	if !strings.HasSuffix(tmpl, ".sql") {
 		tmpl += ".sql"
@@ -165,6 +227,7 @@ func LoadTemplateSQL(tmpl string, tmplData Record) (string, error) {
 	if utils.VERBOSE > 1 {
 		log.Println("load template", tmpl)
 	}
+	tmplData["PostgreSQL"] = isPostgresDriver(dbtype)
 	stm, err := utils.ParseTmpl(sdir, tmpl, tmplData)
 	if err != nil {
 		return "", Error(err, LoadErrorCode, "", "dbs.LoadTemplateSQL")
@@ -172,7 +235,7 @@ func LoadTemplateSQL(tmpl string, tmplData Record) (string, error) {
 	if owner, ok := tmplData["Owner"]; ok && owner == "sqlite" {
 		stm = strings.Replace(stm, "sqlite.", "", -1)
 	}
-	if DBOWNER == "sqlite" {
+	if dbowner == "sqlite" {
 		stm = utils.ReplaceBinds(stm)
 	}
 	return stm, nil
@@ -180,8 +243,15 @@ func LoadTemplateSQL(tmpl string, tmplData Record) (string, error) {
 
 // LoadSQL function loads DBS SQL statements with Owner
 func LoadSQL(owner string) Record {
+	return loadSQL(owner, DBTYPE)
+}
+
+// helper function to load DBS SQL statements for database of given owner
+// and driver
+func loadSQL(owner, dbtype string) Record {
 	tmplData := make(Record)
 	tmplData["Owner"] = owner
+	tmplData["PostgreSQL"] = isPostgresDriver(dbtype)
 	sdir := fmt.Sprintf("%s/sql", utils.STATICDIR)
 	if utils.VERBOSE > 1 {
 		log.Println("sql area", sdir)
@@ -240,14 +310,19 @@ func GetTestData() error {
 
 // helper function to get SQL statement from DBSQL dict for a given key
 func getSQL(key string) string {
+	return sqlStatement(DBSQL, DBOWNER, key)
+}
+
+// helper function to get SQL statement of given owner from dbsql dict for a given key
+func sqlStatement(dbsql Record, owner, key string) string {
 	// use generic query API to fetch the results from DB
-	val, ok := DBSQL[key]
+	val, ok := dbsql[key]
 	if !ok {
 		msg := fmt.Sprintf("Unable to load %s SQL", key)
 		log.Fatal(msg)
 	}
 	stm := val.(string)
-	if DBOWNER == "sqlite" {
+	if owner == "sqlite" {
 		stm = utils.ReplaceBinds(stm)
 	}
 	return stm
@@ -310,10 +385,9 @@ func ParseDBFile(dbfile string) (string, string, string) {
 }
 
 func placeholder(pholder string) string {
-	if DBTYPE == "ora" || DBTYPE == "oci8" {
+	// PostgreSQL binds are converted to positional ones by the DB connection
+	if DBTYPE == "ora" || DBTYPE == "oci8" || IsPostgres() {
 		return fmt.Sprintf(":%s", pholder)
-	} else if DBTYPE == "PostgreSQL" {
-		return fmt.Sprintf("$%s", pholder)
 	} else {
 		return "?"
 	}
@@ -359,10 +433,6 @@ func executeAll(w io.Writer, sep, stm string, args ...interface{}) error {
 	if utils.VERBOSE > 1 {
 		utils.PrintSQL(stm, args, "execute")
 	}
-	var enc *json.Encoder
-	if w != nil {
-		enc = json.NewEncoder(w)
-	}
 
 	// execute transaction
 	tx, err := DB.Begin()
@@ -370,6 +440,27 @@ func executeAll(w io.Writer, sep, stm string, args ...interface{}) error {
 		return Error(err, TransactionErrorCode, "", "dbs.executeAll")
 	}
 	defer tx.Rollback()
+	return executeAllTx(tx, w, sep, stm, args...)
+}
+
+// similar to executeAll function but it executes given statement within
+// provided transaction, e.g. to use temp tables created by the transaction
+//
+//gocyclo:ignore
+func executeAllTx(tx *sql.Tx, w io.Writer, sep, stm string, args ...interface{}) error {
+	var enc *json.Encoder
+	if w != nil {
+		enc = json.NewEncoder(w)
+	}
+	var err error
+	// wrap statement into pagination one if client requested it
+	page := writerPage(w)
+	if page != nil {
+		stm, args, err = page.statement(tx, stm, args)
+		if err != nil {
+			return Error(err, QueryErrorCode, "", "dbs.executeAll")
+		}
+	}
 	rows, err := tx.Query(stm, args...)
 	if err != nil {
 		msg := fmt.Sprintf("unable to query statement: %v", stm)
@@ -386,7 +477,25 @@ func executeAll(w io.Writer, sep, stm string, args ...interface{}) error {
 	valuePtrs := make([]interface{}, count)
 	rowCount := 0
 	writtenResults := false
+	// client may ask for columnar output instead of JSON one
+	var cout *columnar
+	if cw := writerColumnar(w); cw != nil {
+		var names []string
+		for _, col := range columns {
+			names = append(names, strings.ToLower(col))
+		}
+		ctypes, err := rows.ColumnTypes()
+		if err != nil {
+			return Error(err, QueryErrorCode, "", "dbs.executeAll")
+		}
+		cout = newColumnar(w, cw.ContentType, names, columnTypes(ctypes))
+	}
 	for rows.Next() {
+		if page != nil && int64(rowCount) == page.Limit {
+			// we got extra record, i.e. more records are available
+			page.More = true
+			break
+		}
 		if rowCount == 0 {
 			// initialize value pointers
 			for i := range columns {
@@ -397,6 +506,16 @@ func executeAll(w io.Writer, sep, stm string, args ...interface{}) error {
 		if err != nil {
 			return Error(err, RowsScanErrorCode, "", "dbs.executeAll")
 		}
+		if page != nil {
+			page.keep(values)
+		}
+		if cout != nil {
+			if err := cout.append(values); err != nil {
+				return Error(err, WriterErrorCode, "", "dbs.executeAll")
+			}
+			rowCount += 1
+			continue
+		}
 		if rowCount != 0 && w != nil {
 			// add separator line to our output
 			w.Write([]byte(sep))
@@ -451,6 +570,12 @@ func executeAll(w io.Writer, sep, stm string, args ...interface{}) error {
 	if err = rows.Err(); err != nil {
 		return Error(err, RowsScanErrorCode, "", "dbs.executeAll")
 	}
+	if page != nil {
+		page.setNextCursor(w)
+	}
+	if cout != nil {
+		return cout.close()
+	}
 	// make sure we write proper response if no result written
 	if sep != "" && !writtenResults {
 		w.Write([]byte("[]"))
@@ -486,6 +611,14 @@ func execute(
 		return Error(err, TransactionErrorCode, "", "dbs.execute")
 	}
 	defer tx.Rollback()
+	// wrap statement into pagination one if client requested it
+	page := writerPage(w)
+	if page != nil {
+		stm, args, err = page.statement(tx, stm, args)
+		if err != nil {
+			return Error(err, QueryErrorCode, "", "dbs.execute")
+		}
+	}
 	rows, err := tx.Query(stm, args...)
 	if err != nil {
 		msg := fmt.Sprintf("DB.Query, query='%s' args='%v'", stm, args)
@@ -497,13 +630,33 @@ func execute(
 	// loop over rows
 	rowCount := 0
 	writtenResults := false
+	// client may ask for columnar output instead of JSON one
+	var cout *columnar
+	if cw := writerColumnar(w); cw != nil {
+		cout = newColumnar(w, cw.ContentType, cols, valueTypes(vals))
+	}
 	for rows.Next() {
+		if page != nil && int64(rowCount) == page.Limit {
+			// we got extra record, i.e. more records are available
+			page.More = true
+			break
+		}
 		err := rows.Scan(vals...)
 		if err != nil {
 			msg := fmt.Sprintf("rows.Scan, vals='%v'", vals)
 			log.Println(msg)
 			return Error(err, RowsScanErrorCode, "", "dbs.execute")
 		}
+		if page != nil {
+			page.keep(vals)
+		}
+		if cout != nil {
+			if err := cout.append(vals); err != nil {
+				return Error(err, WriterErrorCode, "", "dbs.execute")
+			}
+			rowCount += 1
+			continue
+		}
 		if rowCount != 0 && w != nil {
 			// add separator line to our output
 			w.Write([]byte(sep))
@@ -554,6 +707,12 @@ func execute(
 	if err = rows.Err(); err != nil {
 		return Error(err, RowsScanErrorCode, "", "dbs.execute")
 	}
+	if page != nil {
+		page.setNextCursor(w)
+	}
+	if cout != nil {
+		return cout.close()
+	}
 	// make sure we write proper response if no result written
 	if sep != "" && !writtenResults {
 		w.Write([]byte("[]"))
@@ -758,6 +917,9 @@ func TokenGenerator(runs []string, limit int, name string) (string, []string) {
 	if DBOWNER == "sqlite" {
 		return TokenGeneratorSQLite(runs, name)
 	}
+	if IsPostgres() {
+		return TokenGeneratorPostgres(runs, name)
+	}
 	return TokenGeneratorORACLE(runs, limit, name)
 }
 
@@ -801,6 +963,25 @@ func TokenGeneratorSQLite(runs []string, name string) (string, []string) {
 	return stm, []string{vals}
 }
 
+// TokenGeneratorPostgres creates a SQL token generator statement using PostgreSQL syntax.
+// PostgreSQL does not compare text with numbers implicitly, therefore tokens
+// are converted to integers when all given values are integers.
+func TokenGeneratorPostgres(runs []string, name string) (string, []string) {
+	token := "CAST(T.TOKEN AS BIGINT) AS TOKEN"
+	for _, v := range runs {
+		if !intPattern.MatchString(v) {
+			token = "T.TOKEN"
+			break
+		}
+	}
+	stm := fmt.Sprintf(`WITH TOKEN_GENERATOR AS (
+  SELECT %s FROM UNNEST(STRING_TO_ARRAY(:%s, ',')) AS T(TOKEN)
+)
+`, token, name)
+	vals := strings.Join(runs, ",")
+	return stm, []string{vals}
+}
+
 // TokenCondition provides proper condition statement for TokenGenerator
 func TokenCondition() string {
 	if DBOWNER == "sqlite" {
@@ -915,6 +1096,9 @@ func IncrementSequences(tx *sql.Tx, seq string, n int) ([]int64, error) {
 		}
 		return out, nil
 	}
+	if IsPostgres() {
+		return incrementPostgresSequences(tx, seq, n)
+	}
 	var pid float64
 	for i := 0; i < n; i++ {
 		stm := fmt.Sprintf("select %s.%s.nextval as val from dual", DBOWNER, seq)
@@ -929,6 +1113,30 @@ func IncrementSequences(tx *sql.Tx, seq string, n int) ([]int64, error) {
 	return out, nil
 }
 
+// helper function to get N unique IDs for given PostgreSQL sequence
+func incrementPostgresSequences(tx *sql.Tx, seq string, n int) ([]int64, error) {
+	var out []int64
+	stm := fmt.Sprintf("select nextval('%s.%s') as val from generate_series(1, %d)", DBOWNER, seq, n)
+	rows, err := tx.Query(stm)
+	if err != nil {
+		msg := fmt.Sprintf("fail to increment sequence, query='%s'", stm)
+		log.Println(msg)
+		return out, Error(err, QueryErrorCode, "", "dbs.IncrementSequences")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pid int64
+		if err := rows.Scan(&pid); err != nil {
+			return out, Error(err, RowsScanErrorCode, "", "dbs.IncrementSequences")
+		}
+		out = append(out, pid)
+	}
+	if err := rows.Err(); err != nil {
+		return out, Error(err, RowsScanErrorCode, "", "dbs.IncrementSequences")
+	}
+	return out, nil
+}
+
 // IncrementSequence API returns single unique ID for a given sequence
 func IncrementSequence(tx *sql.Tx, seq string) (int64, error) {
 	ids, err := IncrementSequences(tx, seq, 1)
@@ -944,10 +1152,20 @@ func LastInsertID(tx *sql.Tx, table, idName string) (int64, error) {
 	if DBOWNER == "sqlite" {
 		stm = fmt.Sprintf("select MAX(%s) from %s", idName, table)
 	}
-	var pid sql.NullFloat64
 	if utils.VERBOSE > 1 {
 		log.Println("execute", stm)
 	}
+	// sqlite IDs provided by IncrementSequences are based on nanoseconds
+	// and do not fit into float64 precision
+	if DBOWNER == "sqlite" {
+		var pid sql.NullInt64
+		if err := tx.QueryRow(stm).Scan(&pid); err != nil {
+			log.Printf("fail to process query='%s'", stm)
+			return 0, Error(err, QueryErrorCode, "", "dbs.LastInsertID")
+		}
+		return pid.Int64, nil
+	}
+	var pid sql.NullFloat64
 	err := tx.QueryRow(stm).Scan(&pid)
 	if err != nil {
 		msg := fmt.Sprintf("fail to process query='%s'", stm)
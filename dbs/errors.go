@@ -34,6 +34,9 @@ var NotImplementedApiErr = errors.New("not implemented api error")
 // InvalidRequestErr represents generic invalid request error
 var InvalidRequestErr = errors.New("invalid request error")
 
+// IdempotencyErr represents generic idempotency key error
+var IdempotencyErr = errors.New("idempotency key error")
+
 // DBS Error codes provides static representation of DBS errors, they cover 1xx range
 const (
 	GenericErrorCode               = iota + 100 // generic DBS error
@@ -77,6 +80,7 @@ const (
 	PhysicsGroupDoesNotExist                    // 138 PhysicsGroup does not exist in DBS
 	DatasetAccessTypeDoesNotExist               // 139 DatasetAccessType does not exist in DBS
 	DatasetDoesNotExist                         // 140 Dataset does not exist in DBS
+	IdempotencyConflict                         // 141 idempotency key is used by another request
 	LastAvailableErrorCode                      // last available DBS error code
 )
 
@@ -169,6 +173,8 @@ func (e *DBSError) Explain() string {
 		return "Unable to remove record from DB"
 	case InvalidRequestErrorCode:
 		return "Invalid HTTP request"
+	case IdempotencyConflict:
+		return "Idempotency key is used by another request"
 	default:
 		return "Not defined"
 	}
@@ -0,0 +1,94 @@
+package dbs
+
+// events module provides change notifications of DBS writer APIs
+//
+// The writer APIs publish typed events about inserted and updated datasets,
+// blocks and files once their transaction is committed. The events are
+// passed to EventPublisher function, e.g. DBS web server delivers them to
+// server-sent events clients and webhooks.
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// change event types
+const (
+	BlockInsertedEvent  = "block_inserted"  // new block is inserted via bulkblocks API
+	BlockClosedEvent    = "block_closed"    // block is closed, i.e. open_for_writing=0
+	BlockUpdatedEvent   = "block_updated"   // block is re-opened or its origin site is changed
+	DatasetUpdatedEvent = "dataset_updated" // dataset access type or physics group is changed
+	FilesUpdatedEvent   = "files_updated"   // file validity is changed
+)
+
+// EventsGapEvent is sent to clients which may have missed change events,
+// e.g. after server restart or when they do not keep up with events. It is
+// not filtered by event type and clients should re-read the state they
+// track from reader APIs when they receive it.
+const EventsGapEvent = "events_gap"
+
+// EventTypes lists all change event types
+var EventTypes = []string{
+	BlockInsertedEvent, BlockClosedEvent, BlockUpdatedEvent, DatasetUpdatedEvent, FilesUpdatedEvent,
+}
+
+// Event represents change event of DBS writer API
+type Event struct {
+	ID        uint64 `json:"id"`
+	Type      string `json:"type"`
+	Dataset   string `json:"dataset,omitempty"`
+	Block     string `json:"block_name,omitempty"`
+	Lfn       string `json:"logical_file_name,omitempty"`
+	Values    Record `json:"values,omitempty"`
+	CreateBy  string `json:"create_by,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// EventPublisher receives all change events, nil value disables events.
+// It is called from writer APIs and therefore should not block.
+var EventPublisher func(e Event)
+
+// eventCounter provides sequential IDs of change events. It starts from
+// server start time in microseconds, such that IDs of events published
+// after server restart are greater than IDs of events published before
+// it and clients reconnecting with Last-Event-ID get all new events.
+var eventCounter = uint64(time.Now().UnixMicro())
+
+// LastEventID returns ID of last published change event or initial value
+// of event IDs if no events are published yet
+func LastEventID() uint64 {
+	return atomic.LoadUint64(&eventCounter)
+}
+
+// helper function to publish change event
+func publishEvent(e Event) {
+	if EventPublisher == nil {
+		return
+	}
+	e.ID = atomic.AddUint64(&eventCounter, 1)
+	if e.Timestamp == 0 {
+		e.Timestamp = time.Now().Unix()
+	}
+	if e.Dataset == "" && e.Block != "" {
+		e.Dataset = strings.Split(e.Block, "#")[0]
+	}
+	EventPublisher(e)
+}
+
+// helper function to publish event of inserted bulk block with given
+// number of files
+func publishBulkBlockEvent(rec BulkBlocks, nfiles int, createBy string) {
+	publishEvent(Event{
+		Type:    BlockInsertedEvent,
+		Dataset: rec.Dataset.Dataset,
+		Block:   rec.Block.BlockName,
+		Values: Record{
+			"open_for_writing":    rec.Block.OpenForWriting,
+			"origin_site_name":    rec.Block.OriginSiteName,
+			"dataset_access_type": rec.Dataset.DatasetAccessType,
+			"nfiles":              nfiles,
+		},
+		CreateBy: createBy,
+	})
+}
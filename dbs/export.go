@@ -0,0 +1,281 @@
+package dbs
+
+// export module provides offline export of DBS datasets
+//
+// ExportDatasets writes every block of datasets matching given pattern as
+// BulkBlocks JSON record, i.e. the output of /blockdump API, which can be
+// later inserted into DBS via ImportBlocks or /bulkblocks API. The blocks
+// are written in parentage order, i.e. blocks of parent datasets and parent
+// blocks go first, such that they can be inserted in the same order.
+// Two output formats are supported:
+// - json: file per block named by its position in parentage order, e.g.
+// 000001.json, such directory can be used as file:// migration source
+// - ndjson: single blocks.ndjson file with one block per line
+// and the output can be gzip'ed (.gz extension).
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// ExportOptions represents options of datasets export
+type ExportOptions struct {
+	Dir      string // output directory
+	Format   string // output format: json or ndjson
+	Compress bool   // gzip output files
+}
+
+// ExportReport represents summary report of datasets export
+type ExportReport struct {
+	Datasets []string `json:"datasets"` // exported datasets
+	Blocks   int      `json:"blocks"`   // number of exported blocks
+	Files    int      `json:"files"`    // number of exported files
+	Bytes    int64    `json:"bytes"`    // size of exported block dumps
+	Output   []string `json:"output"`   // written files
+	Elapsed  string   `json:"elapsed"`  // elapsed time of export
+}
+
+// helper function to get blocks of datasets matching given pattern, it
+// returns map of block names and their datasets
+func exportBlocks(pattern string) (map[string]string, error) {
+	blocks := make(map[string]string)
+	var args []interface{}
+	var conds []string
+	conds, args = AddParam("dataset", "D.DATASET", Record{"dataset": pattern}, conds, args)
+	stm := WhereClause(getSQL("export_blocks"), conds)
+	stm = CleanStatement(stm)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	rows, err := DB.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return blocks, Error(err, QueryErrorCode, "", "dbs.export.exportBlocks")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dataset, block string
+		if err := rows.Scan(&dataset, &block); err != nil {
+			return blocks, Error(err, RowsScanErrorCode, "", "dbs.export.exportBlocks")
+		}
+		blocks[block] = dataset
+	}
+	if err := rows.Err(); err != nil {
+		return blocks, Error(err, RowsScanErrorCode, "", "dbs.export.exportBlocks")
+	}
+	return blocks, nil
+}
+
+// helper function to order blocks such that their parents, either parent
+// blocks or blocks of parent datasets, go first
+func exportOrder(blocks map[string]string) ([]string, error) {
+	src := &DBMigrationSource{
+		MigrationSourceDB: &MigrationSourceDB{DB: DB, Type: DBTYPE, Owner: DBOWNER, dbsql: DBSQL},
+	}
+	datasets := make(map[string][]string)
+	for blk, dataset := range blocks {
+		datasets[dataset] = append(datasets[dataset], blk)
+	}
+
+	// dependencies of every block within exported blocks
+	deps := make(map[string]map[string]bool)
+	for blk := range blocks {
+		deps[blk] = make(map[string]bool)
+	}
+	for dataset, dblocks := range datasets {
+		parents, err := src.Parents(dataset)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			for _, blk := range dblocks {
+				for _, pblk := range datasets[p] {
+					deps[blk][pblk] = true
+				}
+			}
+		}
+	}
+	for blk := range blocks {
+		parents, err := src.Parents(blk)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			if _, ok := blocks[p]; ok {
+				deps[blk][p] = true
+			}
+		}
+	}
+
+	// topological sort which picks ready blocks in alphabetical order
+	var out []string
+	for len(deps) > 0 {
+		var ready []string
+		for blk, d := range deps {
+			if len(d) == 0 {
+				ready = append(ready, blk)
+			}
+		}
+		if len(ready) == 0 {
+			msg := fmt.Sprintf("found parentage cycle among %d blocks", len(deps))
+			return out, Error(RecordErr, GenericErrorCode, msg, "dbs.export.exportOrder")
+		}
+		sort.Strings(ready)
+		for _, blk := range ready {
+			delete(deps, blk)
+		}
+		for _, d := range deps {
+			for _, blk := range ready {
+				delete(d, blk)
+			}
+		}
+		out = append(out, ready...)
+	}
+	return out, nil
+}
+
+// exportWriter writes block dumps to output file
+type exportWriter struct {
+	file *os.File
+	gz   *gzip.Writer
+	buf  *bufio.Writer
+}
+
+// helper function to create new export writer
+func newExportWriter(fname string, compress bool) (*exportWriter, error) {
+	file, err := os.Create(fname)
+	if err != nil {
+		return nil, err
+	}
+	w := &exportWriter{file: file}
+	var writer io.Writer = file
+	if compress {
+		w.gz = gzip.NewWriter(file)
+		writer = w.gz
+	}
+	w.buf = bufio.NewWriter(writer)
+	return w, nil
+}
+
+// Write implements io.Writer interface
+func (w *exportWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+// Close flushes and closes output file
+func (w *exportWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	return w.file.Close()
+}
+
+// ExportDatasets writes all blocks of datasets matching given pattern as
+// BulkBlocks JSON records in parentage order
+func ExportDatasets(pattern string, opts ExportOptions) (ExportReport, error) {
+	time0 := time.Now()
+	var report ExportReport
+	if opts.Format == "" {
+		opts.Format = "json"
+	}
+	if opts.Format != "json" && opts.Format != "ndjson" {
+		msg := fmt.Sprintf("unsupported export format %s", opts.Format)
+		return report, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.export.ExportDatasets")
+	}
+	ext := "." + opts.Format
+	if opts.Compress {
+		ext += ".gz"
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return report, Error(err, GenericErrorCode, "", "dbs.export.ExportDatasets")
+	}
+
+	blocks, err := exportBlocks(pattern)
+	if err != nil {
+		return report, err
+	}
+	if len(blocks) == 0 {
+		msg := fmt.Sprintf("no blocks found for dataset %s", pattern)
+		return report, Error(RecordErr, ParametersErrorCode, msg, "dbs.export.ExportDatasets")
+	}
+	order, err := exportOrder(blocks)
+	if err != nil {
+		return report, err
+	}
+
+	var writer *exportWriter
+	if opts.Format == "ndjson" {
+		fname := filepath.Join(opts.Dir, "blocks"+ext)
+		writer, err = newExportWriter(fname, opts.Compress)
+		if err != nil {
+			return report, Error(err, GenericErrorCode, "", "dbs.export.ExportDatasets")
+		}
+		defer func() {
+			if writer != nil {
+				writer.Close()
+			}
+		}()
+		report.Output = append(report.Output, fname)
+	}
+	for idx, blk := range order {
+		rec := blockDump(dbsDumpDB(), blk)
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return report, Error(err, MarshalErrorCode, blk, "dbs.export.ExportDatasets")
+		}
+		if opts.Format == "json" {
+			fname := filepath.Join(opts.Dir, fmt.Sprintf("%06d%s", idx+1, ext))
+			w, err := newExportWriter(fname, opts.Compress)
+			if err != nil {
+				return report, Error(err, GenericErrorCode, "", "dbs.export.ExportDatasets")
+			}
+			if _, err := w.Write(data); err != nil {
+				w.Close()
+				return report, Error(err, GenericErrorCode, fname, "dbs.export.ExportDatasets")
+			}
+			if err := w.Close(); err != nil {
+				return report, Error(err, GenericErrorCode, fname, "dbs.export.ExportDatasets")
+			}
+			report.Output = append(report.Output, fname)
+		} else {
+			data = append(data, '\n')
+			if _, err := writer.Write(data); err != nil {
+				return report, Error(err, GenericErrorCode, blk, "dbs.export.ExportDatasets")
+			}
+		}
+		if !utils.InList(blocks[blk], report.Datasets) {
+			report.Datasets = append(report.Datasets, blocks[blk])
+		}
+		report.Blocks++
+		report.Files += len(rec.Files)
+		report.Bytes += int64(len(data))
+		if utils.VERBOSE > 0 {
+			log.Printf("exported block %s with %d files", blk, len(rec.Files))
+		}
+	}
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return report, Error(err, GenericErrorCode, "", "dbs.export.ExportDatasets")
+		}
+		writer = nil
+	}
+	report.Elapsed = time.Since(time0).String()
+	return report, nil
+}
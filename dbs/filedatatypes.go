@@ -98,7 +98,7 @@ func (r *FileDataTypes) Decode(reader io.Reader) error {
 
 // InsertFileDataTypes DBS API
 func (a *API) InsertFileDataTypes() error {
-	err := insertRecord(&FileDataTypes{}, a.Reader)
+	err := a.insertRecord(&FileDataTypes{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.filedatatypes.InsertFileDataTypes")
 	}
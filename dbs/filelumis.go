@@ -63,6 +63,21 @@ func (a *API) FileLumis() error {
 		conds, args = AddParam("block_name", "B.BLOCK_NAME", a.Params, conds, args)
 	}
 
+	// lumi mask is joined with file lumis via temp table
+	mask, err := getLumiMask(a.Params)
+	if err != nil {
+		return Error(err, ParametersErrorCode, "", "dbs.filelumis.FileLumis")
+	}
+	maskTable := ""
+	if mask != nil {
+		if len(lfns) == 0 && len(blocks) != 1 {
+			msg := "filelumis API requires logical_file_name or block_name along with lumi_mask"
+			return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.filelumis.FileLumis")
+		}
+		maskTable = tempLumiMaskTable()
+		tmpl["LumiMask"] = maskTable
+	}
+
 	stm, err := LoadTemplateSQL("filelumis", tmpl)
 	if utils.VERBOSE > 0 {
 		log.Println("### stm", stm)
@@ -112,7 +127,11 @@ func (a *API) FileLumis() error {
 	}
 
 	// use generic query API to fetch the results from DB
-	err = executeAll(a.Writer, a.Separator, stm, args...)
+	if mask != nil {
+		err = executeLumiMask(a.Writer, a.Separator, stm, maskTable, mask, args...)
+	} else {
+		err = executeAll(a.Writer, a.Separator, stm, args...)
+	}
 	if err != nil {
 		return Error(err, QueryErrorCode, "", "dbs.filelumis.FileLumis")
 	}
@@ -361,6 +380,14 @@ func insertFLChunk(tx *sql.Tx, wg *sync.WaitGroup, table string, records []FileL
 		stm = fmt.Sprintf(
 			"INSERT OR IGNORE\nINTO %s (%s) VALUES %s",
 			table, names, strings.Join(valueStrings, ","))
+	} else if IsPostgres() {
+		var rows []string
+		for range records {
+			rows = append(rows, fmt.Sprintf("(%s)", vals))
+		}
+		stm = fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES %s\nON CONFLICT DO NOTHING",
+			table, names, strings.Join(rows, ","))
 	}
 	stm = CleanStatement(stm)
 	if utils.VERBOSE > 3 {
@@ -389,6 +416,19 @@ func insertFLChunk(tx *sql.Tx, wg *sync.WaitGroup, table string, records []FileL
 	return nil
 }
 
+// helper function to get name of the table used to insert FileLumi list,
+// ORACLE and PostgreSQL use unique temp table while SQLite inserts
+// records directly into FILE_LUMIS table
+func tempFileLumisTable() string {
+	if DBOWNER == "sqlite" {
+		return "FILE_LUMIS"
+	}
+	if IsPostgres() {
+		return fmt.Sprintf("TEMP_FILE_LUMIS_%d", time.Now().UnixMicro())
+	}
+	return fmt.Sprintf("ORA$PTT_TEMP_FILE_LUMIS_%d", time.Now().UnixMicro())
+}
+
 // SelectFileLumiListInsert determines which of the three methods to insert the FileLumi list
 func (a *API) SelectFileLumiListInsert(tx *sql.Tx, fll []FileLumi, tempTable string, fileID int64, function string) error {
 	// there are three methods to insert FileLumi list
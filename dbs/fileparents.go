@@ -266,7 +266,7 @@ func (a *API) InsertFileParents() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("fail to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.fileparents.InsertFileParents")
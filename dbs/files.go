@@ -68,6 +68,18 @@ func (a *API) Files() error {
 		tmpl["LumiList"] = true
 	}
 
+	// lumi mask is joined with file lumis via temp table
+	mask, err := getLumiMask(a.Params)
+	if err != nil {
+		return Error(err, ParametersErrorCode, "", "dbs.files.Files")
+	}
+	maskTable := ""
+	if mask != nil {
+		maskTable = tempLumiMaskTable()
+		tmpl["RunNumber"] = true
+		tmpl["LumiMask"] = maskTable
+	}
+
 	validFileOnly := getValues(a.Params, "validFileOnly")
 	if len(validFileOnly) == 1 {
 		_, val := OperatorValue(validFileOnly[0])
@@ -221,7 +233,11 @@ func (a *API) Files() error {
 	}
 
 	// use generic query API to fetch the results from DB
-	err = executeAll(a.Writer, a.Separator, stm, args...)
+	if mask != nil {
+		err = executeLumiMask(a.Writer, a.Separator, stm, maskTable, mask, args...)
+	} else {
+		err = executeAll(a.Writer, a.Separator, stm, args...)
+	}
 	if err != nil {
 		return Error(err, QueryErrorCode, "", "dbs.files.Files")
 	}
@@ -532,10 +548,7 @@ func (a *API) InsertFiles() error {
 		}
 
 		// * from dbs/bulkblocks.go line 546
-		tempTable := fmt.Sprintf("ORA$PTT_TEMP_FILE_LUMIS_%d", time.Now().UnixMicro())
-		if DBOWNER == "sqlite" {
-			tempTable = "FILE_LUMIS"
-		}
+		tempTable := tempFileLumisTable()
 
 		// insert fileLumiList, depending on method
 		err = a.SelectFileLumiListInsert(tx, rec.FILE_LUMI_LIST, tempTable, fid, "dbs.files.InsertFiles")
@@ -677,6 +690,9 @@ func (a *API) UpdateFiles() error {
 		return Error(err, TransactionErrorCode, "", "dbs.files.UpdateFiles")
 	}
 	defer tx.Rollback()
+	if err := a.updateHook(tx); err != nil {
+		return err
+	}
 	_, err = tx.Exec(stm, args...)
 	if err != nil {
 		if utils.VERBOSE > 0 {
@@ -686,11 +702,23 @@ func (a *API) UpdateFiles() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("unable to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.files.UpdateFiles")
 	}
+	event := Event{
+		Type:     FilesUpdatedEvent,
+		Values:   Record{"is_file_valid": isFileValid},
+		CreateBy: createBy,
+	}
+	if datasets := getValues(a.Params, "dataset"); len(datasets) == 1 {
+		event.Dataset = datasets[0]
+	}
+	if len(lfns) == 1 {
+		event.Lfn = lfns[0]
+	}
+	publishEvent(event)
 	if a.Writer != nil {
 		a.Writer.Write([]byte(`[]`))
 	}
@@ -0,0 +1,294 @@
+package dbs
+
+// history module provides time-travel queries of datasets and blocks
+//
+// The state of dataset or block at given moment is reconstructed from its
+// current state and audit trail of update APIs: the old values recorded by
+// the first update made after given moment represent the state at that
+// moment. The updates made while audit trail was disabled are not visible.
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// helper function to get as_of parameter, it returns false if parameter
+// is not provided
+func asOfDate(params Record) (int64, bool, error) {
+	vals := getValues(params, "as_of")
+	if len(vals) == 0 {
+		return 0, false, nil
+	}
+	if len(vals) > 1 {
+		msg := "as_of parameter should have single value"
+		return 0, true, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.history.asOfDate")
+	}
+	asOf, err := strconv.ParseInt(vals[0], 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid as_of value %s", vals[0])
+		return 0, true, Error(err, ParametersErrorCode, msg, "dbs.history.asOfDate")
+	}
+	return asOf, true, nil
+}
+
+// helper function to check that as_of request has only parameters supported
+// by time-travel queries, the other parameters of the API are rejected
+// rather than silently ignored
+func asOfParams(api string, params Record, w io.Writer, supported []string) error {
+	for key := range params {
+		if key != "as_of" && !utils.InList(key, supported) {
+			msg := fmt.Sprintf("%s parameter is not supported by %s API along with as_of, supported parameters: %v", key, api, supported)
+			return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.history.asOfParams")
+		}
+	}
+	if writerPage(w) != nil {
+		msg := fmt.Sprintf("pagination of %s API is not supported along with as_of", api)
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.history.asOfParams")
+	}
+	return nil
+}
+
+// DatasetsAsOf provides dataset access type and physics group of datasets
+// as they were at given time
+func (a *API) DatasetsAsOf(asOf int64) error {
+	if err := asOfParams("datasets", a.Params, a.Writer, []string{"dataset", "dataset_access_type"}); err != nil {
+		return err
+	}
+	var args []interface{}
+	var conds []string
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["Datasets"] = true
+	tmpl["Blocks"] = false
+
+	conds, args = AddParam("dataset", "D.DATASET", a.Params, conds, args)
+	conds = append(conds, fmt.Sprintf(" D.CREATION_DATE <= %s", placeholder("as_of")))
+	args = append(args, asOf)
+
+	stm, err := LoadTemplateSQL("history", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.history.DatasetsAsOf")
+	}
+	stm = WhereClause(stm, conds)
+	stm += " ORDER BY D.DATASET"
+
+	var dataset string
+	var accessType, physicsGroup sql.NullString
+	var cdate sql.NullInt64
+	cols := []string{"dataset", "dataset_access_type", "physics_group_name", "creation_date"}
+	vals := []interface{}{&dataset, &accessType, &physicsGroup, &cdate}
+	var records [][]interface{}
+	err = queryRows(stm, args, vals, func() {
+		records = append(records, []interface{}{
+			dataset, nullValue(accessType), nullValue(physicsGroup), nullValue(cdate),
+		})
+	})
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.history.DatasetsAsOf")
+	}
+
+	changes, err := auditChanges("datasets", "dataset", a.Params, asOf)
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.history.DatasetsAsOf")
+	}
+	accessTypes := getValues(a.Params, "dataset_access_type")
+	var out [][]interface{}
+	for _, row := range records {
+		if old, ok := changes[row[0].(string)]; ok {
+			row[1] = old["dataset_access_type"]
+			row[2] = old["physics_group_name"]
+		}
+		// dataset access type is matched against historical value
+		if len(accessTypes) == 1 && accessTypes[0] != "*" && row[1] != accessTypes[0] {
+			continue
+		}
+		out = append(out, row)
+	}
+	return writeRows(a.Writer, a.Separator, cols, out)
+}
+
+// BlocksAsOf provides open for writing flag and origin site of blocks
+// as they were at given time
+func (a *API) BlocksAsOf(asOf int64) error {
+	if err := asOfParams("blocks", a.Params, a.Writer, []string{"dataset", "block_name"}); err != nil {
+		return err
+	}
+	var args []interface{}
+	var conds []string
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["Datasets"] = false
+	tmpl["Blocks"] = true
+
+	conds, args = AddParam("block_name", "B.BLOCK_NAME", a.Params, conds, args)
+	conds, args = AddParam("dataset", "DS.DATASET", a.Params, conds, args)
+	conds = append(conds, fmt.Sprintf(" B.CREATION_DATE <= %s", placeholder("as_of")))
+	args = append(args, asOf)
+
+	stm, err := LoadTemplateSQL("history", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.history.BlocksAsOf")
+	}
+	stm = WhereClause(stm, conds)
+	stm += " ORDER BY B.BLOCK_NAME"
+
+	var block, dataset string
+	var openForWriting, cdate sql.NullInt64
+	var originSite sql.NullString
+	cols := []string{"block_name", "dataset", "open_for_writing", "origin_site_name", "creation_date"}
+	vals := []interface{}{&block, &dataset, &openForWriting, &originSite, &cdate}
+	var records [][]interface{}
+	err = queryRows(stm, args, vals, func() {
+		records = append(records, []interface{}{
+			block, dataset, nullValue(openForWriting), nullValue(originSite), nullValue(cdate),
+		})
+	})
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.history.BlocksAsOf")
+	}
+
+	changes, err := auditChanges("blocks", "block_name", a.Params, asOf)
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.history.BlocksAsOf")
+	}
+	for _, row := range records {
+		if old, ok := changes[row[0].(string)]; ok {
+			// JSON numbers are decoded as floats
+			if v, ok := old["open_for_writing"].(float64); ok {
+				row[2] = int64(v)
+			} else {
+				row[2] = nil
+			}
+			row[3] = old["origin_site_name"]
+		}
+	}
+	return writeRows(a.Writer, a.Separator, cols, records)
+}
+
+// auditChangesApis lists POST APIs which update records of given PUT API
+// and record their audit trail in the same format
+var auditChangesApis = map[string][]string{
+	"datasets": {"invalidatedataset"},
+}
+
+// helper function to get old values of the first update of given API made
+// after given time. It returns map of dataset or block names (given by key
+// column of audit trail) to their old values.
+func auditChanges(api, key string, params Record, asOf int64) (map[string]Record, error) {
+	var args []interface{}
+	cond := fmt.Sprintf(" ((A.API = %s AND A.METHOD = %s)", placeholder("audit_api"), placeholder("method"))
+	args = append(args, api, "PUT")
+	for i, a := range auditChangesApis[api] {
+		cond += fmt.Sprintf(" OR (A.API = %s AND A.METHOD = 'POST')", placeholder(fmt.Sprintf("audit_api_%d", i)))
+		args = append(args, a)
+	}
+	cond += ")"
+	conds := []string{cond, fmt.Sprintf(" A.CREATION_DATE > %s", placeholder("as_of"))}
+	args = append(args, asOf)
+	conds, args = AddParam("dataset", "A.DATASET", params, conds, args)
+	conds, args = AddParam("block_name", "A.BLOCK_NAME", params, conds, args)
+
+	stm := getSQL("audit")
+	stm = WhereClause(stm, conds)
+	stm += " ORDER BY A.AUDIT_ID"
+
+	var buf bytes.Buffer
+	if err := executeAll(&buf, ",", stm, args...); err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		return nil, err
+	}
+	changes := make(map[string]Record)
+	for _, rec := range records {
+		name, ok := rec[key].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := changes[name]; ok {
+			continue
+		}
+		oldValues, _ := rec["old_values"].(string)
+		var states []Record
+		if err := json.Unmarshal([]byte(oldValues), &states); err != nil || len(states) == 0 {
+			log.Printf("audit record %v of %s has no old values", rec["audit_id"], name)
+			continue
+		}
+		changes[name] = states[0]
+	}
+	return changes, nil
+}
+
+// helper function to execute given statement and scan its rows into
+// given values, the callback function is called for every row
+func queryRows(stm string, args []interface{}, vals []interface{}, callback func()) error {
+	stm = CleanStatement(stm)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	rows, err := DB.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v, error %v", stm, err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(vals...); err != nil {
+			return err
+		}
+		callback()
+	}
+	return rows.Err()
+}
+
+// helper function to get plain value of nullable SQL value
+func nullValue(val driver.Valuer) interface{} {
+	v, err := val.Value()
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// helper function to write rows of given columns either as JSON records
+// or as columnar output if client asked for it
+func writeRows(w io.Writer, sep string, cols []string, rows [][]interface{}) error {
+	if cw := writerColumnar(w); cw != nil {
+		cout := newColumnar(w, cw.ContentType, cols, nil)
+		for _, row := range rows {
+			if err := cout.append(row); err != nil {
+				return Error(err, WriterErrorCode, "", "dbs.history.writeRows")
+			}
+		}
+		return cout.close()
+	}
+	enc := json.NewEncoder(w)
+	if sep != "" {
+		w.Write([]byte("[\n"))
+	}
+	for i, row := range rows {
+		if i != 0 {
+			w.Write([]byte(sep))
+		}
+		rec := make(Record)
+		for j, col := range cols {
+			rec[col] = row[j]
+		}
+		if err := enc.Encode(rec); err != nil {
+			return Error(err, EncodeErrorCode, "", "dbs.history.writeRows")
+		}
+	}
+	if sep != "" {
+		w.Write([]byte("]\n"))
+	}
+	return nil
+}
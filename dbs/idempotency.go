@@ -0,0 +1,215 @@
+package dbs
+
+// idempotency module provides idempotent execution of DBS write APIs
+//
+// The client may supply idempotency key along with write API request. The
+// key is reserved with API name and hash of the request payload before the
+// API execution and upon its success the API response is stored with the
+// key. The replay of the request with the same key and payload returns the
+// stored response, while request with the same key and different payload
+// is rejected with IdempotencyConflict error. The key of failed request is
+// released, i.e. the client may retry it. The key of request which never
+// completed, e.g. due to server crash, stays pending only for
+// IdempotencyLease and afterwards the retry takes it over.
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// IdempotencyKeyTTL defines how long (in seconds) idempotency keys are kept
+var IdempotencyKeyTTL int64 = 86400
+
+// IdempotencyLease defines how long (in seconds) idempotency key of
+// request in progress is reserved, afterwards it can be taken over by retry
+var IdempotencyLease int64 = 3600
+
+// statuses of idempotency keys
+const (
+	IdempotencyPending = "pending" // request with the key is in progress
+	IdempotencyDone    = "done"    // request with the key is completed
+)
+
+// IdempotencyRecord represents idempotency key of DBS write API request
+type IdempotencyRecord struct {
+	IDEMPOTENCY_KEY string `json:"idempotency_key" validate:"required"`
+	API             string `json:"api" validate:"required"`
+	REQUEST_HASH    string `json:"request_hash" validate:"required"`
+	STATUS          string `json:"status" validate:"required"`
+	RESPONSE        string `json:"response"`
+	CREATION_DATE   int64  `json:"creation_date" validate:"required,number"`
+	CREATE_BY       string `json:"create_by" validate:"required"`
+}
+
+// Insert implementation of IdempotencyRecord
+func (r *IdempotencyRecord) Insert(tx *sql.Tx) error {
+	// set defaults and validate the record
+	r.SetDefaults()
+	err := r.Validate()
+	if err != nil {
+		log.Println("unable to validate record", err)
+		return Error(err, ValidateErrorCode, "", "dbs.idempotency.Insert")
+	}
+
+	// get SQL statement from static area
+	stm := getSQL("insert_idempotency_key")
+	if utils.VERBOSE > 0 {
+		log.Printf("Insert IdempotencyKeys\n%s\n%+v", stm, r)
+	}
+	_, err = tx.Exec(stm,
+		r.IDEMPOTENCY_KEY, r.API, r.REQUEST_HASH, r.STATUS,
+		r.RESPONSE, r.CREATION_DATE, r.CREATE_BY)
+	if err != nil {
+		return Error(err, InsertErrorCode, "", "dbs.idempotency.Insert")
+	}
+	return nil
+}
+
+// Validate implementation of IdempotencyRecord
+func (r *IdempotencyRecord) Validate() error {
+	if err := RecordValidator.Struct(*r); err != nil {
+		return DecodeValidatorError(r, err)
+	}
+	return nil
+}
+
+// SetDefaults implements set defaults for IdempotencyRecord
+func (r *IdempotencyRecord) SetDefaults() {
+	if r.CREATION_DATE == 0 {
+		r.CREATION_DATE = Date()
+	}
+	if r.STATUS == "" {
+		r.STATUS = IdempotencyPending
+	}
+}
+
+// helper function to check if idempotency key is expired
+func (r *IdempotencyRecord) expired() bool {
+	return IdempotencyKeyTTL > 0 && Date()-r.CREATION_DATE > IdempotencyKeyTTL
+}
+
+// helper function to check if idempotency key of request in progress is
+// stale, i.e. the request is not completed within IdempotencyLease
+func (r *IdempotencyRecord) stale() bool {
+	return r.STATUS == IdempotencyPending &&
+		IdempotencyLease > 0 && Date()-r.CREATION_DATE > IdempotencyLease
+}
+
+// helper function to get idempotency key record, it returns sql.ErrNoRows
+// error if key does not exist
+func getIdempotencyRecord(tx *sql.Tx, key string) (*IdempotencyRecord, error) {
+	var r IdempotencyRecord
+	var response sql.NullString
+	stm := getSQL("idempotency_key")
+	err := tx.QueryRow(stm, key).Scan(
+		&r.IDEMPOTENCY_KEY, &r.API, &r.REQUEST_HASH, &r.STATUS,
+		&response, &r.CREATION_DATE, &r.CREATE_BY)
+	if err != nil {
+		return nil, err
+	}
+	r.RESPONSE = response.String
+	return &r, nil
+}
+
+// helper function to execute update or delete statement of idempotency key
+func execIdempotencyKey(tmpl string, args ...interface{}) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.idempotency.execIdempotencyKey")
+	}
+	defer tx.Rollback()
+	stm := getSQL(tmpl)
+	if utils.VERBOSE > 0 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	if _, err = tx.Exec(stm, args...); err != nil {
+		return Error(err, UpdateErrorCode, "", "dbs.idempotency.execIdempotencyKey")
+	}
+	if err = tx.Commit(); err != nil {
+		return Error(err, CommitErrorCode, "", "dbs.idempotency.execIdempotencyKey")
+	}
+	return nil
+}
+
+// ReserveIdempotencyKey reserves idempotency key of given record. It returns
+// nil if the key is reserved for the request, or completed record of the
+// same request. The request with the same key and different API, payload
+// or user, as well as request whose key is still in progress, gets
+// IdempotencyConflict error.
+func ReserveIdempotencyKey(r *IdempotencyRecord) (*IdempotencyRecord, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, Error(err, TransactionErrorCode, "", "dbs.idempotency.ReserveIdempotencyKey")
+	}
+	defer tx.Rollback()
+
+	rec, err := getIdempotencyRecord(tx, r.IDEMPOTENCY_KEY)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, Error(err, QueryErrorCode, "", "dbs.idempotency.ReserveIdempotencyKey")
+	}
+	if rec != nil && (rec.expired() || rec.stale()) {
+		if rec.stale() {
+			log.Printf("take over stale idempotency key '%s' of %s request", r.IDEMPOTENCY_KEY, rec.API)
+		}
+		stm := getSQL("delete_idempotency_key")
+		if _, err := tx.Exec(stm, r.IDEMPOTENCY_KEY); err != nil {
+			return nil, Error(err, RemoveErrorCode, "", "dbs.idempotency.ReserveIdempotencyKey")
+		}
+		rec = nil
+	}
+	if rec != nil {
+		if rec.API != r.API || rec.REQUEST_HASH != r.REQUEST_HASH || rec.CREATE_BY != r.CREATE_BY {
+			msg := fmt.Sprintf("idempotency key '%s' is already used by another %s request", r.IDEMPOTENCY_KEY, rec.API)
+			return nil, Error(IdempotencyErr, IdempotencyConflict, msg, "dbs.idempotency.ReserveIdempotencyKey")
+		}
+		if rec.STATUS != IdempotencyDone {
+			msg := fmt.Sprintf("request with idempotency key '%s' is in progress", r.IDEMPOTENCY_KEY)
+			return nil, Error(IdempotencyErr, IdempotencyConflict, msg, "dbs.idempotency.ReserveIdempotencyKey")
+		}
+		return rec, nil
+	}
+
+	r.STATUS = IdempotencyPending
+	if err = r.Insert(tx); err != nil {
+		// concurrent request may reserve the same key
+		msg := fmt.Sprintf("unable to reserve idempotency key '%s'", r.IDEMPOTENCY_KEY)
+		return nil, Error(err, IdempotencyConflict, msg, "dbs.idempotency.ReserveIdempotencyKey")
+	}
+	if err = tx.Commit(); err != nil {
+		msg := fmt.Sprintf("unable to reserve idempotency key '%s'", r.IDEMPOTENCY_KEY)
+		return nil, Error(err, IdempotencyConflict, msg, "dbs.idempotency.ReserveIdempotencyKey")
+	}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores response of successful request with given
+// idempotency key within transaction of the request, i.e. the key is
+// completed along with changes of the request. It fails if the key is not
+// reserved by the request anymore, e.g. it is taken over by retry.
+func CompleteIdempotencyKey(tx *sql.Tx, r *IdempotencyRecord, response string) error {
+	stm := getSQL("update_idempotency_key")
+	args := []interface{}{IdempotencyDone, response, r.IDEMPOTENCY_KEY, IdempotencyPending, r.CREATION_DATE}
+	if utils.VERBOSE > 0 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	res, err := tx.Exec(stm, args...)
+	if err != nil {
+		return Error(err, UpdateErrorCode, "", "dbs.idempotency.CompleteIdempotencyKey")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		msg := fmt.Sprintf("idempotency key '%s' is not reserved by the request anymore", r.IDEMPOTENCY_KEY)
+		return Error(IdempotencyErr, IdempotencyConflict, msg, "dbs.idempotency.CompleteIdempotencyKey")
+	}
+	r.STATUS = IdempotencyDone
+	r.RESPONSE = response
+	return nil
+}
+
+// ReleaseIdempotencyKey removes idempotency key of failed request unless
+// the key is taken over by retry
+func ReleaseIdempotencyKey(r *IdempotencyRecord) error {
+	return execIdempotencyKey("release_idempotency_key", r.IDEMPOTENCY_KEY, IdempotencyPending, r.CREATION_DATE)
+}
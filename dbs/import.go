@@ -0,0 +1,203 @@
+package dbs
+
+// import module provides offline import of DBS datasets
+//
+// ImportBlocks inserts block dumps produced by ExportDatasets, or any other
+// BulkBlocks JSON records, into DBS via InsertBulkBlocksConcurrently. The
+// input can be either single file or directory whose files are processed
+// in alphabetical order, and every file can hold single JSON record
+// (.json) or one record per line (.ndjson), optionally gzip'ed (.gz).
+// Names of inserted blocks are appended to the state file, and blocks
+// listed in it are skipped, such that interrupted import can be resumed.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// ImportOptions represents options of blocks import
+type ImportOptions struct {
+	StateFile string // file with names of already imported blocks
+	CreateBy  string // user name used for records without create_by
+}
+
+// ImportReport represents summary report of blocks import
+type ImportReport struct {
+	Blocks   int               `json:"blocks"`   // number of processed blocks
+	Imported int               `json:"imported"` // number of inserted blocks
+	Skipped  int               `json:"skipped"`  // number of blocks skipped as listed in state file
+	Existing int               `json:"existing"` // number of blocks which already exist in DBS
+	Failed   int               `json:"failed"`   // number of blocks failed to insert
+	Files    int64             `json:"files"`    // number of inserted files
+	Errors   map[string]string `json:"errors"`   // errors of failed blocks
+	Elapsed  string            `json:"elapsed"`  // elapsed time of import
+}
+
+// helper function to get list of import files
+func importFiles(input string) ([]string, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{input}, nil
+	}
+	entries, err := os.ReadDir(input)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		if e.IsDir() || !(strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".ndjson")) {
+			continue
+		}
+		files = append(files, filepath.Join(input, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// helper function to read block records of import file, it calls given
+// function for every record
+func readImportFile(fname string, fn func(data []byte)) error {
+	if !strings.HasSuffix(strings.TrimSuffix(fname, ".gz"), ".ndjson") {
+		data, err := readBlockDump(fname)
+		if err != nil {
+			return err
+		}
+		fn(data)
+		return nil
+	}
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(fname, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	// block records can be larger than bufio.Scanner buffer, therefore we
+	// read them line by line
+	buf := bufio.NewReader(reader)
+	for {
+		line, err := buf.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// helper function to load names of imported blocks from state file
+func importState(fname string) (map[string]bool, error) {
+	state := make(map[string]bool)
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	for _, blk := range strings.Split(string(data), "\n") {
+		if blk = strings.TrimSpace(blk); blk != "" {
+			state[blk] = true
+		}
+	}
+	return state, nil
+}
+
+// ImportBlocks inserts BulkBlocks JSON records of given file or directory
+// into DBS
+func ImportBlocks(input string, opts ImportOptions) (ImportReport, error) {
+	time0 := time.Now()
+	report := ImportReport{Errors: make(map[string]string)}
+	files, err := importFiles(input)
+	if err != nil {
+		return report, Error(err, ReaderErrorCode, "", "dbs.import.ImportBlocks")
+	}
+	var state map[string]bool
+	var stateFile *os.File
+	if opts.StateFile != "" {
+		state, err = importState(opts.StateFile)
+		if err != nil {
+			return report, Error(err, ReaderErrorCode, "", "dbs.import.ImportBlocks")
+		}
+		stateFile, err = os.OpenFile(opts.StateFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return report, Error(err, GenericErrorCode, "", "dbs.import.ImportBlocks")
+		}
+		defer stateFile.Close()
+	}
+
+	api := &API{CreateBy: opts.CreateBy}
+	var serr error
+	for _, fname := range files {
+		err := readImportFile(fname, func(data []byte) {
+			report.Blocks++
+			var rec BulkBlocks
+			if err := json.Unmarshal(data, &rec); err != nil {
+				report.Failed++
+				report.Errors[fmt.Sprintf("%s:%d", fname, report.Blocks)] = err.Error()
+				return
+			}
+			blk := rec.Block.BlockName
+			if state[blk] {
+				report.Skipped++
+				return
+			}
+			nfiles, err := api.insertBlockDump(data, true)
+			if err != nil {
+				if !strings.Contains(err.Error(), fmt.Sprintf("Block %s already exists", blk)) {
+					log.Printf("unable to import block %s, error %v", blk, err)
+					report.Failed++
+					report.Errors[blk] = err.Error()
+					return
+				}
+				report.Existing++
+			} else {
+				report.Imported++
+				report.Files += nfiles
+			}
+			if utils.VERBOSE > 0 {
+				log.Printf("imported block %s with %d files", blk, nfiles)
+			}
+			if stateFile != nil {
+				if _, err := stateFile.WriteString(blk + "\n"); err != nil && serr == nil {
+					serr = err
+				}
+			}
+		})
+		if err != nil {
+			return report, Error(err, ReaderErrorCode, fname, "dbs.import.ImportBlocks")
+		}
+		if serr != nil {
+			return report, Error(serr, GenericErrorCode, opts.StateFile, "dbs.import.ImportBlocks")
+		}
+	}
+	report.Elapsed = time.Since(time0).String()
+	return report, nil
+}
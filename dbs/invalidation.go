@@ -0,0 +1,397 @@
+package dbs
+
+// invalidation module provides invalidation of dataset with its files and
+// children
+//
+// The dataset access type is changed to INVALID and optionally all its
+// valid files are invalidated. The invalidation may cascade to child
+// datasets (found via DATASET_PARENTS table) and child files (found via
+// FILE_PARENTS table) recursively. All changes are written in one
+// transaction along with audit trail records containing the reason of the
+// invalidation. The audit trail records keep old and new state of datasets
+// in the same format as datasets PUT API, therefore they are taken into
+// account by as_of queries. The dry-run mode only reports what would change.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// InvalidationChunkSize defines number of records updated by single
+// statement of dataset invalidation
+var InvalidationChunkSize = 500
+
+// DatasetInvalidation represents input of dataset invalidation API
+type DatasetInvalidation struct {
+	Dataset  string `json:"dataset"`  // dataset to invalidate
+	Reason   string `json:"reason"`   // reason of invalidation recorded in audit trail
+	Files    bool   `json:"files"`    // invalidate files of invalidated datasets
+	Children bool   `json:"children"` // invalidate child datasets and files recursively
+}
+
+// InvalidatedDataset represents dataset changed by invalidation
+type InvalidatedDataset struct {
+	Dataset           string `json:"dataset"`
+	DatasetAccessType string `json:"dataset_access_type"` // access type before invalidation
+	Files             int    `json:"nfiles"`              // number of invalidated files of the dataset
+}
+
+// InvalidationReport represents datasets and files changed by invalidation
+type InvalidationReport struct {
+	Dataset  string               `json:"dataset"`
+	Reason   string               `json:"reason"`
+	DryRun   bool                 `json:"dry_run"`
+	Datasets []InvalidatedDataset `json:"datasets"`
+	Files    []string             `json:"files"`
+}
+
+// InvalidateDataset DBS API invalidates dataset and optionally its files,
+// child datasets and child files. It accepts DatasetInvalidation record.
+//
+//gocyclo:ignore
+func (a *API) InvalidateDataset(dryRun bool) error {
+	data, err := io.ReadAll(a.Reader)
+	if err != nil {
+		log.Println("fail to read data", err)
+		return Error(err, ReaderErrorCode, "", "dbs.invalidation.InvalidateDataset")
+	}
+	var rec DatasetInvalidation
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Println("fail to decode data as DatasetInvalidation", err)
+		return Error(err, UnmarshalErrorCode, "", "dbs.invalidation.InvalidateDataset")
+	}
+	if rec.Dataset == "" || strings.Contains(rec.Dataset, "*") {
+		msg := "dataset invalidation requires dataset without wild-cards"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.invalidation.InvalidateDataset")
+	}
+	if strings.TrimSpace(rec.Reason) == "" {
+		msg := "dataset invalidation requires reason"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.invalidation.InvalidateDataset")
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.invalidation.InvalidateDataset")
+	}
+	defer tx.Rollback()
+	datasetID, err := GetID(tx, "DATASETS", "DATASET_ID", "DATASET", rec.Dataset)
+	if err != nil {
+		msg := fmt.Sprintf("unable to find dataset %s", rec.Dataset)
+		return Error(err, QueryErrorCode, msg, "dbs.invalidation.InvalidateDataset")
+	}
+	accessTypeID, err := GetID(tx, "DATASET_ACCESS_TYPES", "dataset_access_type_id", "dataset_access_type", "INVALID")
+	if err != nil {
+		msg := "unable to find INVALID dataset access type"
+		return Error(err, GetIDErrorCode, msg, "dbs.invalidation.InvalidateDataset")
+	}
+
+	// datasets to invalidate
+	datasetIDs := []int64{datasetID}
+	if rec.Children {
+		datasetIDs, err = invalidationChildren(tx, "provenance_datasets", datasetIDs)
+		if err != nil {
+			return err
+		}
+	}
+	report := InvalidationReport{
+		Dataset:  rec.Dataset,
+		Reason:   rec.Reason,
+		DryRun:   dryRun,
+		Datasets: []InvalidatedDataset{},
+		Files:    []string{},
+	}
+	var updateIDs []int64
+	tmpl := Record{"Owner": DBOWNER, "TokenCondition": TokenCondition()}
+	err = invalidationQuery(tx, "invalidation_datasets", tmpl, datasetIDs, func(rows *sql.Rows) error {
+		var did int64
+		var d InvalidatedDataset
+		if err := rows.Scan(&did, &d.Dataset, &d.DatasetAccessType); err != nil {
+			return err
+		}
+		if d.DatasetAccessType != "INVALID" {
+			updateIDs = append(updateIDs, did)
+		}
+		report.Datasets = append(report.Datasets, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// files to invalidate: valid files of invalidated datasets and their
+	// valid children
+	var fileIDs []int64
+	datasetFiles := make(map[string][]int64)
+	scanFile := func(rows *sql.Rows) error {
+		var fid int64
+		var lfn, dataset string
+		if err := rows.Scan(&fid, &lfn, &dataset); err != nil {
+			return err
+		}
+		fileIDs = append(fileIDs, fid)
+		datasetFiles[dataset] = append(datasetFiles[dataset], fid)
+		report.Files = append(report.Files, lfn)
+		return nil
+	}
+	if rec.Files {
+		tmpl["FileIDs"] = false
+		if err := invalidationQuery(tx, "invalidation_files", tmpl, datasetIDs, scanFile); err != nil {
+			return err
+		}
+		if rec.Children && len(fileIDs) > 0 {
+			childIDs, err := invalidationChildren(tx, "provenance_files", fileIDs)
+			if err != nil {
+				return err
+			}
+			// children of files of invalidated datasets are already known
+			visited := make(map[int64]bool)
+			for _, fid := range fileIDs {
+				visited[fid] = true
+			}
+			var ids []int64
+			for _, fid := range childIDs {
+				if !visited[fid] {
+					ids = append(ids, fid)
+				}
+			}
+			if len(ids) > 0 {
+				tmpl["FileIDs"] = true
+				if err := invalidationQuery(tx, "invalidation_files", tmpl, ids, scanFile); err != nil {
+					return err
+				}
+			}
+		}
+		sort.Strings(report.Files)
+	}
+	// child files may belong to datasets which are not invalidated
+	datasets := make(map[string]bool)
+	for i, d := range report.Datasets {
+		datasets[d.Dataset] = true
+		report.Datasets[i].Files = len(datasetFiles[d.Dataset])
+	}
+	for dataset, ids := range datasetFiles {
+		if !datasets[dataset] {
+			report.Datasets = append(report.Datasets, InvalidatedDataset{Dataset: dataset, Files: len(ids)})
+		}
+	}
+	sort.Slice(report.Datasets, func(i, j int) bool { return report.Datasets[i].Dataset < report.Datasets[j].Dataset })
+
+	if !dryRun {
+		date := Date()
+		if err := invalidateRecords(tx, rec, report, updateIDs, accessTypeID, datasetFiles, a.CreateBy, date); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			log.Println("fail to commit transaction", err)
+			return Error(err, CommitErrorCode, "", "dbs.invalidation.InvalidateDataset")
+		}
+		for _, d := range report.Datasets {
+			if d.DatasetAccessType != "" && d.DatasetAccessType != "INVALID" {
+				values := Record{"dataset_access_type": "INVALID"}
+				publishEvent(Event{Type: DatasetUpdatedEvent, Dataset: d.Dataset, Values: values, CreateBy: a.CreateBy})
+			}
+			if d.Files > 0 {
+				values := Record{"is_file_valid": 0, "nfiles": d.Files}
+				publishEvent(Event{Type: FilesUpdatedEvent, Dataset: d.Dataset, Values: values, CreateBy: a.CreateBy})
+			}
+		}
+	}
+	if utils.VERBOSE > 0 {
+		log.Printf("invalidate dataset %s (dry-run %v): %d datasets, %d files",
+			rec.Dataset, dryRun, len(report.Datasets), len(report.Files))
+	}
+	if a.Writer != nil {
+		if err := json.NewEncoder(a.Writer).Encode(report); err != nil {
+			return Error(err, EncodeErrorCode, "", "dbs.invalidation.InvalidateDataset")
+		}
+	}
+	return nil
+}
+
+// helper function to update invalidated datasets and files and record
+// audit trail of every changed dataset within given transaction
+//
+//gocyclo:ignore
+func invalidateRecords(
+	tx *sql.Tx,
+	rec DatasetInvalidation,
+	report InvalidationReport,
+	datasetIDs []int64,
+	accessTypeID int64,
+	datasetFiles map[string][]int64,
+	createBy string,
+	date int64) error {
+
+	// state of changed datasets before invalidation, it is recorded in the
+	// same format as audit trail of datasets PUT API
+	states := make(map[string][]Record)
+	for _, d := range report.Datasets {
+		if d.Files == 0 && (d.DatasetAccessType == "" || d.DatasetAccessType == "INVALID") {
+			continue
+		}
+		records, err := AuditState(tx, "datasets", Record{"dataset": d.Dataset})
+		if err != nil {
+			return err
+		}
+		states[d.Dataset] = records
+	}
+
+	if err := invalidationUpdate(tx, "invalidate_dataset", []interface{}{createBy, date, accessTypeID}, datasetIDs); err != nil {
+		return err
+	}
+	var fileIDs []int64
+	for _, ids := range datasetFiles {
+		fileIDs = append(fileIDs, ids...)
+	}
+	if err := invalidationUpdate(tx, "invalidate_files", []interface{}{createBy, date}, fileIDs); err != nil {
+		return err
+	}
+
+	// audit trail record of every changed dataset
+	params, _ := json.Marshal(rec)
+	for _, d := range report.Datasets {
+		records, ok := states[d.Dataset]
+		if !ok {
+			continue
+		}
+		var oldValues, newValues []Record
+		for _, r := range records {
+			r["nfiles_valid"] = d.Files
+			oldValues = append(oldValues, r)
+			n := make(Record)
+			for k, v := range r {
+				n[k] = v
+			}
+			n["nfiles_valid"] = 0
+			if d.DatasetAccessType != "" {
+				n["dataset_access_type"] = "INVALID"
+				n["is_dataset_valid"] = 0
+			}
+			n["last_modified_by"] = createBy
+			n["last_modification_date"] = date
+			newValues = append(newValues, n)
+		}
+		oldData, _ := json.Marshal(oldValues)
+		newData, _ := json.Marshal(newValues)
+		r := AuditRecord{
+			API:        "invalidatedataset",
+			METHOD:     "POST",
+			DATASET:    d.Dataset,
+			PARAMETERS: string(params),
+			OLD_VALUES: string(oldData),
+			NEW_VALUES: string(newData),
+			CREATE_BY:  createBy,
+		}
+		if err := r.Insert(tx); err != nil {
+			return Error(err, InsertErrorCode, "", "dbs.invalidation.invalidateRecords")
+		}
+	}
+	return nil
+}
+
+// helper function to execute update statement of given template for given
+// ids in chunks, the ids are bound after given arguments
+func invalidationUpdate(tx *sql.Tx, tmplName string, args []interface{}, ids []int64) error {
+	for k := 0; k < len(ids); k += InvalidationChunkSize {
+		size := k + InvalidationChunkSize
+		if size > len(ids) {
+			size = len(ids)
+		}
+		vals := append([]interface{}{}, args...)
+		var binds []string
+		for i, id := range ids[k:size] {
+			binds = append(binds, fmt.Sprintf(":id_%d", i))
+			vals = append(vals, id)
+		}
+		tmpl := Record{"Owner": DBOWNER, "IDs": strings.Join(binds, ", ")}
+		stm, err := LoadTemplateSQL(tmplName, tmpl)
+		if err != nil {
+			return Error(err, LoadErrorCode, "", "dbs.invalidation.invalidationUpdate")
+		}
+		if utils.VERBOSE > 1 {
+			utils.PrintSQL(stm, vals, "execute")
+		}
+		if _, err := tx.Exec(stm, vals...); err != nil {
+			log.Printf("unable to execute %s, error %v", tmplName, err)
+			return Error(err, UpdateErrorCode, "", "dbs.invalidation.invalidationUpdate")
+		}
+	}
+	return nil
+}
+
+// helper function to find given ids along with ids of all their children
+// using given parentage template, e.g. provenance_datasets
+func invalidationChildren(tx *sql.Tx, tmplName string, ids []int64) ([]int64, error) {
+	tmpl := Record{"Owner": DBOWNER, "Up": false, "TokenCondition": TokenCondition()}
+	visited := make(map[int64]bool)
+	for _, id := range ids {
+		visited[id] = true
+	}
+	all := ids
+	frontier := ids
+	for len(frontier) > 0 {
+		var next []int64
+		err := invalidationQuery(tx, tmplName, tmpl, frontier, func(rows *sql.Rows) error {
+			var childID, parentID int64
+			var name string
+			if err := rows.Scan(&childID, &parentID, &name); err != nil {
+				return err
+			}
+			if !visited[childID] {
+				visited[childID] = true
+				next = append(next, childID)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, next...)
+		frontier = next
+	}
+	return all, nil
+}
+
+// helper function to execute query of given template for given ids and
+// scan its rows with given function
+func invalidationQuery(tx *sql.Tx, tmplName string, tmpl Record, ids []int64, scan func(rows *sql.Rows) error) error {
+	stm, err := LoadTemplateSQL(tmplName, tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.invalidation.invalidationQuery")
+	}
+	var vals []string
+	for _, id := range ids {
+		vals = append(vals, fmt.Sprintf("%d", id))
+	}
+	token, binds := TokenGenerator(vals, 300, "ids_token")
+	stm = CleanStatement(fmt.Sprintf("%s %s", token, stm))
+	var args []interface{}
+	for _, v := range binds {
+		args = append(args, v)
+	}
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	rows, err := tx.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return Error(err, QueryErrorCode, "", "dbs.invalidation.invalidationQuery")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return Error(err, RowsScanErrorCode, "", "dbs.invalidation.invalidationQuery")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Error(err, RowsScanErrorCode, "", "dbs.invalidation.invalidationQuery")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package dbs
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// LastModified returns last modification date of given dataset or block,
+// i.e. the latest modification date of the dataset, its blocks and files.
+// If block name is provided the blocks and files are limited to this block.
+func LastModified(dataset, block string) (int64, error) {
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["Block"] = block != ""
+	var args []interface{}
+	if block != "" {
+		dataset = strings.Split(block, "#")[0]
+		args = append(args, dataset, block, block)
+	} else {
+		args = append(args, dataset, dataset, dataset)
+	}
+	stm, err := LoadTemplateSQL("last_modified", tmpl)
+	if err != nil {
+		return 0, Error(err, LoadErrorCode, "", "dbs.lastmodified.LastModified")
+	}
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "LastModified")
+	}
+	var lmd sql.NullInt64
+	err = DB.QueryRow(stm, args...).Scan(&lmd)
+	if err != nil {
+		log.Printf("unable to get last modification date of dataset=%s block=%s, error %v", dataset, block, err)
+		return 0, Error(err, QueryErrorCode, "", "dbs.lastmodified.LastModified")
+	}
+	return lmd.Int64, nil
+}
@@ -0,0 +1,269 @@
+package dbs
+
+// lumimask module provides filtering of DBS APIs by lumi mask
+//
+// The lumi mask is a CMS certification JSON, i.e. map of run numbers and
+// list of their lumi section ranges like {"1": [[1, 10], [20, 30]]}. The
+// mask is inserted into temp table which is joined with FILE_LUMIS table
+// of API query, therefore large masks do not hit bind variables limits.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// LumiMask represents lumi mask, i.e. lumi section ranges of runs
+type LumiMask map[int64][][]int64
+
+// Validate implementation of LumiMask
+func (m LumiMask) Validate() error {
+	if len(m) == 0 {
+		msg := "empty lumi_mask"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.lumimask.Validate")
+	}
+	for run, ranges := range m {
+		if run <= 0 {
+			msg := fmt.Sprintf("invalid run number %d in lumi_mask", run)
+			return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.lumimask.Validate")
+		}
+		for _, r := range ranges {
+			if len(r) != 2 || r[0] <= 0 || r[0] > r[1] {
+				msg := fmt.Sprintf("invalid lumi range %v of run %d in lumi_mask", r, run)
+				return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.lumimask.Validate")
+			}
+		}
+	}
+	return nil
+}
+
+// helper function to get lumi mask from API parameters, it returns nil
+// if lumi_mask parameter is not provided
+func getLumiMask(params Record) (LumiMask, error) {
+	val, ok := params["lumi_mask"]
+	if !ok {
+		return nil, nil
+	}
+	var data []byte
+	var err error
+	switch v := val.(type) {
+	case string:
+		data = []byte(v)
+	case []string:
+		data = []byte(strings.Join(v, ""))
+	default:
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, Error(err, MarshalErrorCode, "", "dbs.lumimask.getLumiMask")
+		}
+	}
+	var mask LumiMask
+	if err := json.Unmarshal(data, &mask); err != nil {
+		msg := "unable to parse lumi_mask"
+		return nil, Error(err, UnmarshalErrorCode, msg, "dbs.lumimask.getLumiMask")
+	}
+	if err := mask.Validate(); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// helper function to get name of temp table used by lumi mask query
+func tempLumiMaskTable() string {
+	if DBOWNER == "sqlite" || IsPostgres() {
+		return fmt.Sprintf("TEMP_LUMI_MASK_%d", time.Now().UnixMicro())
+	}
+	return fmt.Sprintf("ORA$PTT_TEMP_LUMI_MASK_%d", time.Now().UnixMicro())
+}
+
+// helper function to create temp table with given lumi mask
+func createLumiMaskTable(tx *sql.Tx, table string, mask LumiMask) error {
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["TempTable"] = table
+	stm, err := LoadTemplateSQL("temp_lumimask", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.lumimask.createLumiMaskTable")
+	}
+	stm = CleanStatement(stm)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, []interface{}{}, "execute")
+	}
+	if _, err = tx.Exec(stm); err != nil {
+		log.Printf("unable to create temp lumi mask table %s, error %v", table, err)
+		return Error(err, InsertErrorCode, "", "dbs.lumimask.createLumiMaskTable")
+	}
+
+	// insert lumi ranges in run order via chunks
+	var runs []int64
+	for run := range mask {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i] < runs[j] })
+	var args []interface{}
+	for _, run := range runs {
+		for _, r := range mask[run] {
+			args = append(args, run, r[0], r[1])
+		}
+	}
+	nranges := FileLumiChunkSize
+	if nranges <= 0 {
+		nranges = 500
+	}
+	chunkSize := 3 * nranges // every range has three values
+	for k := 0; k < len(args); k = k + chunkSize {
+		size := k + chunkSize
+		if size > len(args) {
+			size = len(args)
+		}
+		if err := insertLumiMaskChunk(tx, table, args[k:size]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function to insert chunk of lumi mask ranges into temp table
+func insertLumiMaskChunk(tx *sql.Tx, table string, args []interface{}) error {
+	names := "RUN_NUM,MIN_LUMI,MAX_LUMI"
+	vals := ":r,:mn,:mx"
+	if DBOWNER == "sqlite" {
+		vals = "?,?,?"
+	}
+	var stm string
+	if DBOWNER == "sqlite" || IsPostgres() {
+		var rows []string
+		for i := 0; i < len(args); i = i + 3 {
+			rows = append(rows, fmt.Sprintf("(%s)", vals))
+		}
+		stm = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, names, strings.Join(rows, ","))
+	} else {
+		stm = "INSERT ALL"
+		for i := 0; i < len(args); i = i + 3 {
+			stm = fmt.Sprintf("%s\nINTO %s (%s) VALUES (%s)", stm, table, names, vals)
+		}
+		stm = fmt.Sprintf("%s\nSELECT * FROM dual", stm)
+	}
+	if utils.VERBOSE > 1 {
+		log.Printf("insert %d lumi mask ranges into %s", len(args)/3, table)
+	}
+	if _, err := tx.Exec(stm, args...); err != nil {
+		log.Printf("unable to insert lumi mask ranges into %s, error %v", table, err)
+		return Error(err, InsertErrorCode, "", "dbs.lumimask.insertLumiMaskChunk")
+	}
+	return nil
+}
+
+// helper function to execute given statement joined with temp table of
+// lumi mask, the temp table is created within the same transaction
+func executeLumiMask(w io.Writer, sep, stm, table string, mask LumiMask, args ...interface{}) error {
+	stm = CleanStatement(stm)
+	if DRYRUN {
+		utils.PrintSQL(stm, args, "")
+		return nil
+	}
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.lumimask.executeLumiMask")
+	}
+	// the temp table is dropped along with transaction rollback
+	defer tx.Rollback()
+	if err := createLumiMaskTable(tx, table, mask); err != nil {
+		return err
+	}
+	return executeAllTx(tx, w, sep, stm, args...)
+}
+
+// helper function to get sorted and merged lumi ranges of every run of
+// lumi mask, e.g. [[5, 8], [1, 4], [7, 10]] becomes [[1, 10]]
+func (m LumiMask) normalize() LumiMask {
+	out := make(LumiMask)
+	for run, ranges := range m {
+		var rngs [][]int64
+		for _, r := range ranges {
+			rngs = append(rngs, []int64{r[0], r[1]})
+		}
+		sort.Slice(rngs, func(i, j int) bool { return rngs[i][0] < rngs[j][0] })
+		var merged [][]int64
+		for _, r := range rngs {
+			last := len(merged) - 1
+			if last >= 0 && r[0] <= merged[last][1]+1 {
+				if r[1] > merged[last][1] {
+					merged[last][1] = r[1]
+				}
+				continue
+			}
+			merged = append(merged, r)
+		}
+		if len(merged) > 0 {
+			out[run] = merged
+		}
+	}
+	return out
+}
+
+// helper function to get lumi ranges present in both lumi masks
+func (m LumiMask) intersect(mask LumiMask) LumiMask {
+	m, mask = m.normalize(), mask.normalize()
+	out := make(LumiMask)
+	for run, ranges := range m {
+		others := mask[run]
+		i, j := 0, 0
+		for i < len(ranges) && j < len(others) {
+			lo, hi := ranges[i][0], ranges[i][1]
+			if others[j][0] > lo {
+				lo = others[j][0]
+			}
+			if others[j][1] < hi {
+				hi = others[j][1]
+			}
+			if lo <= hi {
+				out[run] = append(out[run], []int64{lo, hi})
+			}
+			if ranges[i][1] < others[j][1] {
+				i++
+			} else {
+				j++
+			}
+		}
+	}
+	return out
+}
+
+// helper function to get lumi ranges of lumi mask which are not present
+// in given one
+func (m LumiMask) subtract(mask LumiMask) LumiMask {
+	m, mask = m.normalize(), mask.normalize()
+	out := make(LumiMask)
+	for run, ranges := range m {
+		others := mask[run]
+		j := 0
+		for _, r := range ranges {
+			lo, hi := r[0], r[1]
+			// skip ranges of other mask preceding the current one
+			for j < len(others) && others[j][1] < lo {
+				j++
+			}
+			for k := j; k < len(others) && others[k][0] <= hi; k++ {
+				if others[k][0] > lo {
+					out[run] = append(out[run], []int64{lo, others[k][0] - 1})
+				}
+				lo = others[k][1] + 1
+			}
+			if lo <= hi {
+				out[run] = append(out[run], []int64{lo, hi})
+			}
+		}
+	}
+	return out
+}
@@ -10,11 +10,11 @@ package dbs
 // - Process to process migration request explicitly
 // - Remove to remove migration request
 // - Status to obtain status of migration request
+// - Priority to change priority of migration request
 // Internally the migration process injects all request details into
 // MigrationRequest table. The request details resides in MigrationBlocks table.
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -22,7 +22,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/url"
 	"os"
 	"os/exec"
 	"sort"
@@ -104,70 +103,29 @@ var MigrateURL string
 
 // MigrationReport represents migration report returned by the migration API
 type MigrationReport struct {
-	MigrationRequest MigrationRequest `json:"migration_details"`
-	Report           string           `json:"migration_report"`
-	Status           string           `json:"status"`
-	Error            error            `json:"error"`
+	MigrationRequest MigrationRequest       `json:"migration_details"`
+	Report           string                 `json:"migration_report"`
+	Status           string                 `json:"status"`
+	Error            error                  `json:"error"`
+	Blocks           []MigrationBlockStatus `json:"migration_blocks,omitempty"`
 }
 
 // GetBlocks returns list of blocks for a given url and block/dataset input
 func GetBlocks(rurl, val string) ([]string, error) {
-	var out []string
-	open := "&open_for_writing=0"
-	if strings.Contains(val, "#") {
-		rurl = fmt.Sprintf("%s/blocks?block_name=%s%s", rurl, url.QueryEscape(val), open)
-	} else {
-		rurl = fmt.Sprintf("%s/blocks?dataset=%s%s", rurl, val, open)
-	}
-	data, err := getData(rurl)
-	if utils.VERBOSE > 0 {
-		log.Println("GetBlocks", rurl, string(data))
-	}
-	if err != nil {
-		if utils.VERBOSE > 0 {
-			log.Printf("unable to get data for %s, error %v", rurl, err)
-		}
-		return out, Error(err, HttpRequestErrorCode, "", "dbs.migrate.GetBlocks")
-	}
-	var rec []Blocks
-	err = json.Unmarshal(data, &rec)
+	src, err := NewMigrationSource(rurl)
 	if err != nil {
-		return out, Error(err, UnmarshalErrorCode, "", "dbs.migrate.GetBlocks")
+		return nil, err
 	}
-	for _, v := range rec {
-		out = append(out, v.BLOCK_NAME)
-	}
-	return out, nil
+	return src.Blocks(val)
 }
 
 // GetParents returns list of parents for given block or dataset
 func GetParents(rurl, val string) ([]string, error) {
-	var out []string
-	if strings.Contains(val, "#") {
-		rurl = fmt.Sprintf("%s/blockparents?block_name=%s", rurl, url.QueryEscape(val))
-	} else {
-		rurl = fmt.Sprintf("%s/datasetparents?dataset=%s", rurl, val)
-	}
-	data, err := getData(rurl)
+	src, err := NewMigrationSource(rurl)
 	if err != nil {
-		return out, Error(err, HttpRequestErrorCode, "", "dbs.migrate.GetParents")
+		return nil, err
 	}
-	var rec []map[string]interface{}
-	err = json.Unmarshal(data, &rec)
-	if err != nil {
-		log.Printf("unable to unmarshal data url=%s data=%s error=%v", rurl, string(data), err)
-		return out, Error(err, UnmarshalErrorCode, "", "dbs.migrate.GetParents")
-	}
-	for _, v := range rec {
-		if strings.Contains(val, "#") {
-			block := fmt.Sprintf("%v", v["parent_block_name"])
-			out = append(out, block)
-		} else {
-			dataset := fmt.Sprintf("%v", v["parent_dataset"])
-			out = append(out, dataset)
-		}
-	}
-	return out, nil
+	return src.Parents(val)
 }
 
 // get list of migration blocks in order of processing (first parents then children)
@@ -594,27 +552,17 @@ type DatasetShortRecord struct {
 func validInput(rurl, input string) error {
 	arr := strings.Split(input, "#")
 	dataset := arr[0]
-	rurl = fmt.Sprintf("%s/datasets?dataset=%s&detail=true&dataset_access_type=*", rurl, dataset)
-	data, err := getData(rurl)
-	if utils.VERBOSE > 0 {
-		log.Println("validInput", rurl, string(data))
+	src, err := NewMigrationSource(rurl)
+	if err != nil {
+		return err
 	}
+	dtype, err := src.DatasetAccessType(dataset)
 	if err != nil {
 		if utils.VERBOSE > 0 {
-			log.Printf("unable to get data for %s, error %v", rurl, err)
+			log.Printf("unable to get access type of %s from %s, error %v", dataset, rurl, err)
 		}
-		return Error(err, HttpRequestErrorCode, "", "dbs.migrate.validInput")
-	}
-	var records []Dataset
-	err = json.Unmarshal(data, &records)
-	if err != nil {
-		return Error(err, UnmarshalErrorCode, "", "dbs.migrate.validInput")
-	}
-	if len(records) != 1 {
-		return Error(err, DatabaseErrorCode, "", "dbs.migrate.validInput")
+		return err
 	}
-	rec := records[0]
-	dtype := rec.DatasetAccessType
 	if dtype == "VALID" {
 		return nil
 	}
@@ -671,6 +619,15 @@ func (a *API) SubmitMigration() error {
 	input := rec.MIGRATION_INPUT
 	mid := rec.MIGRATION_REQUEST_ID
 	mstr := fmt.Sprintf("Migration request %s, id=%d", input, mid)
+	// only migration admins may raise priority of migration request
+	if rec.MIGRATION_PRIORITY > 0 && !migrationAdmin(a.CreateBy) {
+		msg := fmt.Sprintf("user %s is not allowed to set migration priority", a.CreateBy)
+		return Error(InvalidRequestErr, InvalidRequestErrorCode, msg, "dbs.migrate.SubmitMigration")
+	}
+	// check if user does not exceed its quota of queued migration requests
+	if err := checkMigrationQuota(rec.CREATE_BY); err != nil {
+		return err
+	}
 	if err := alreadyQueued(input); err != nil {
 		msg := fmt.Sprintf("%s already queued error %v", mstr, err)
 		if utils.VERBOSE > 1 {
@@ -852,6 +809,15 @@ func startMigrationRequest(req MigrationRequest) ([]MigrationReport, error) {
 		}
 	}
 
+	// id of migration request which keeps all migration blocks, see migrateRequest
+	reqID, err := GetID(tx, "MIGRATION_REQUESTS", "MIGRATION_REQUEST_ID", "MIGRATION_INPUT", input)
+	if err != nil {
+		msg = fmt.Sprintf("unable to get MIGRATION_REQUESTS id of %s, error %v", input, err)
+		log.Println(msg)
+		return []MigrationReport{migrationReport(req, msg, status, err)},
+			Error(err, GetIDErrorCode, "", "dbs.migrate.SubmitMigration")
+	}
+
 	// loop over migBlocks
 	// and insert every chunk of blocks as MigrationBlocks objects
 	var ids []int64
@@ -867,6 +833,23 @@ func startMigrationRequest(req MigrationRequest) ([]MigrationReport, error) {
 		}
 		// we skip insert for migration request input since it is inserted upstream
 		if blk != input {
+			// add block to migration blocks of migration request
+			brec := MigrationBlocks{
+				MIGRATION_REQUEST_ID:   reqID,
+				MIGRATION_BLOCK_NAME:   blk,
+				MIGRATION_ORDER:        int64(idx),
+				MIGRATION_STATUS:       int64(PENDING),
+				CREATE_BY:              rec.CREATE_BY,
+				CREATION_DATE:          rec.CREATION_DATE,
+				LAST_MODIFICATION_DATE: rec.LAST_MODIFICATION_DATE,
+				LAST_MODIFIED_BY:       rec.LAST_MODIFIED_BY}
+			err = brec.Insert(tx)
+			if err != nil {
+				msg = fmt.Sprintf("%s unable to insert MigrationBlocks record %+v, error %v", mstr, brec, err)
+				log.Println(msg)
+				return []MigrationReport{migrationReport(req, msg, status, err)},
+					Error(err, InsertErrorCode, "", "dbs.migrate.SubmitMigration")
+			}
 			updateMigrationStatusMetrics(rec, PENDING)
 			err = rec.Insert(tx)
 			if err != nil {
@@ -1002,131 +985,8 @@ func (a *API) ProcessMigration() {
 	// update migration status
 	updateMigrationStatus(mrec, IN_PROGRESS)
 
-	// find block name for our migration id
-	stm := getSQL("migration_block")
-	stm = CleanStatement(stm)
-	var args []interface{}
-	args = append(args, mid)
-	if utils.VERBOSE > 0 {
-		utils.PrintSQL(stm, args, "execute")
-	}
-	var bid, bOrder, bStatus int64
-	var migInput string
-	err = DB.QueryRow(stm, args...).Scan(
-		&bid, &migInput, &bOrder, &bStatus,
-	)
-	if err != nil {
-		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
-		return
-	}
-	// if status of migration block is completed then we update status of migration request
-	if bid != 0 && bStatus == int64(COMPLETED) && migInput == mrec.MIGRATION_INPUT {
-		log.Printf("migration request %+v has block id=%d, status=%d input=%s is marked as completed", mrec, bid, bStatus, migInput)
-		status = COMPLETED
-		updateMigrationStatus(mrec, COMPLETED)
-		return
-	}
-
-	// check if our migration input is block name or dataset
-	if !strings.Contains(migInput, "#") {
-		// if we got dataset name we simply check its presence and update the status
-		localhost := fmt.Sprintf("%s%s", utils.Localhost, utils.BASE)
-		blocks, err := GetBlocks(localhost, migInput)
-		if err == nil {
-			for _, blk := range blocks {
-				if strings.Contains(migInput, blk) {
-					status = COMPLETED
-					updateMigrationStatus(mrec, COMPLETED)
-					return
-				}
-			}
-		} else {
-			if utils.VERBOSE > 0 {
-				log.Printf("unable to get blocks from %s for migration input %s, error %v", localhost, migInput, err)
-			}
-		}
-		status = FAILED
-		updateMigrationStatus(mrec, FAILED)
-		return
-	}
-
-	// we will proceed with block name as migration input
-	block := migInput
-
-	// obtain block details from destination DBS
-	rurl := fmt.Sprintf("%s/blockdump?block_name=%s", mrec.MIGRATION_URL, url.QueryEscape(block))
-	data, err := getData(rurl)
-	if utils.VERBOSE > 1 {
-		log.Println("place call", rurl)
-		if utils.VERBOSE > 3 {
-			log.Println("receive data", string(data))
-		}
-	}
-	if err != nil {
-		if utils.VERBOSE > 1 {
-			log.Printf("unable to query %s/blockdump, error %v", rurl, err)
-		}
-		return
-	}
-	// NOTE: /blockdump API returns BulkBlocks record used in /bulkblocks API
-	//     var rec BlockDumpRecord
-	var brec BulkBlocks
-	err = json.Unmarshal(data, &brec)
-	if err != nil {
-		if utils.VERBOSE > 2 {
-			log.Println("blockdump data", string(data))
-		}
-		log.Printf("unable to unmarshal BulkBlocks, error %v", err)
-		return
-	}
-	cby := a.CreateBy
-	if brec.Dataset.CreateBy != "" {
-		cby = brec.Dataset.CreateBy
-	}
-	var rec Record
-	err = json.Unmarshal(data, &rec)
-	if err != nil {
-		if utils.VERBOSE > 2 {
-			log.Println("blockdump data", string(data))
-		}
-		log.Printf("unable to unmarshal Record, error %v", err)
-		return
-	}
-	reader := bytes.NewReader(data)
-	writer := utils.StdoutWriter("")
-
-	// insert block dump record into source DBS
-	//     err = rec.InsertBlockDump()
-	api := &API{
-		Params:    rec,
-		Api:       "bulkblocks",
-		Writer:    writer,
-		Reader:    reader,
-		CreateBy:  cby,
-		Separator: a.Separator,
-	}
-	if utils.VERBOSE > 2 {
-		log.Printf("Insert bulkblocks %+v, data %+v", api, string(data))
-	}
-	if ConcurrentBulkBlocks {
-		err = api.InsertBulkBlocksConcurrently()
-	} else {
-		err = api.InsertBulkBlocks()
-	}
-	log.Printf("insert bulkblocks for mid %v error %v", mid, err)
-	if err != nil {
-		if utils.VERBOSE > 0 {
-			log.Println("insert block dump record failed with", err)
-		}
-		serr := fmt.Sprintf("%v", err)
-		if strings.Contains(serr, "Data already exist in DBS") {
-			status = EXIST_IN_DB
-		} else {
-			status = FAILED
-		}
-	} else {
-		status = COMPLETED
-	}
+	// migrate all blocks of migration request
+	status, _ = a.migrateRequest(mrec)
 	updateMigrationStatus(mrec, status)
 	log.Printf("updated migration request %v with status %v", mid, status)
 }
@@ -1191,7 +1051,8 @@ func (a *API) ProcessMigrationCtx(timeout int) error {
 	mrec := records[0]
 
 	// execute slow operation in background
-	go a.processMigration(ch, &status, mrec)
+	var blocks []MigrationBlockStatus
+	go a.processMigration(ch, &status, &blocks, mrec)
 
 	// the slow operation will either finish or timeout
 	select {
@@ -1203,6 +1064,9 @@ func (a *API) ProcessMigrationCtx(timeout int) error {
 		log.Println(msg)
 	}
 	reports := []MigrationReport{migrationReport(mrec, msg, status, err)}
+	if err == nil {
+		reports[0].Blocks = blocks
+	}
 	if a.Writer != nil {
 		data, err := json.Marshal(reports)
 		if err == nil {
@@ -1222,7 +1086,7 @@ func (a *API) ProcessMigrationCtx(timeout int) error {
 
 // processMigration will process given migration report
 // and inject data to source DBS
-func (a *API) processMigration(ch chan<- bool, status *int64, mrec MigrationRequest) {
+func (a *API) processMigration(ch chan<- bool, status *int64, blocks *[]MigrationBlockStatus, mrec MigrationRequest) {
 	// report on channel that we are done with this workflow
 	defer func() {
 		ch <- true
@@ -1233,87 +1097,9 @@ func (a *API) processMigration(ch chan<- bool, status *int64, mrec MigrationRequ
 	// update migration status
 	updateMigrationStatus(mrec, IN_PROGRESS)
 
-	// find block name for our migration id
-	stm := getSQL("migration_block")
-	stm = CleanStatement(stm)
-	var args []interface{}
-	args = append(args, mid)
-	if utils.VERBOSE > 0 {
-		utils.PrintSQL(stm, args, "execute")
-	}
-	var bid, bOrder, bStatus int64
-	var block string
-	err := DB.QueryRow(stm, args...).Scan(
-		&bid, &block, &bOrder, &bStatus,
-	)
-	if err != nil {
-		log.Printf("query='%s' args='%v' error=%v", stm, args, err)
-		return
-	}
-
-	// obtain block details from destination DBS
-	rurl := fmt.Sprintf("%s/blockdump?block_name=%s", mrec.MIGRATION_URL, url.QueryEscape(block))
-	data, err := getData(rurl)
-	if err != nil {
-		if utils.VERBOSE > 1 {
-			log.Printf("unable to query %s/blockdump, error %v", rurl, err)
-		}
-	}
-	// NOTE: /blockdump API returns BulkBlocks record used in /bulkblocks API
-	var brec BulkBlocks
-	err = json.Unmarshal(data, &brec)
-	if err != nil {
-		if utils.VERBOSE > 2 {
-			log.Println("blockdump data", string(data))
-		}
-		log.Printf("unable to unmarshal BulkBlocks, error %v", err)
-		return
-	}
-	cby := a.CreateBy
-	if brec.Dataset.CreateBy != "" {
-		cby = brec.Dataset.CreateBy
-	}
-	var rec Record
-	err = json.Unmarshal(data, &rec)
-	if err != nil {
-		if utils.VERBOSE > 2 {
-			log.Println("blockdump data", string(data))
-		}
-		log.Printf("unable to unmarshal Record, error %v", err)
-		return
-	}
-	reader := bytes.NewReader(data)
-	writer := utils.StdoutWriter("")
-
-	// insert block dump record into source DBS
-	//     err = rec.InsertBlockDump()
-	api := &API{
-		Params:    rec,
-		Api:       "bulkblocks",
-		Writer:    writer,
-		Reader:    reader,
-		CreateBy:  cby,
-		Separator: a.Separator,
-	}
-	if utils.VERBOSE > 2 {
-		log.Printf("Insert bulkblocks %+v, data %+v", api, string(data))
-	}
-	if ConcurrentBulkBlocks {
-		err = api.InsertBulkBlocksConcurrently()
-	} else {
-		err = api.InsertBulkBlocks()
-	}
-	log.Printf("insert bulk blocks for mid %v error %v", mid, err)
-	if err != nil {
-		if utils.VERBOSE > 0 {
-			log.Println("insert block dump record failed with", err)
-		}
-		*status = FAILED
-		updateMigrationStatus(mrec, FAILED)
-	} else {
-		*status = COMPLETED
-		updateMigrationStatus(mrec, COMPLETED)
-	}
+	// migrate all blocks of migration request
+	*status, *blocks = a.migrateRequest(mrec)
+	updateMigrationStatus(mrec, *status)
 	log.Printf("updated migration request %v with status %v", mid, *status)
 }
 
@@ -1505,13 +1291,13 @@ func (a *API) RemoveMigration() error {
 			}
 			return Error(err, RemoveErrorCode, "", "dbs.migrate.RemoveMigration")
 		}
-		err = tx.Commit()
+		data := fmt.Sprintf("[{\"status\":\"success\",\"migration_request_id\":%d}]", mid)
+		err = a.commit(tx, []byte(data))
 		if err != nil {
 			msg := "unable to commit transaction"
 			log.Println(msg, err)
 			return Error(err, CommitErrorCode, "", "dbs.migrate.RemoveMigration")
 		}
-		data := fmt.Sprintf("[{\"status\":\"success\",\"migration_request_id\":%d}]", mid)
 		a.Writer.Write([]byte(data))
 		return nil
 	}
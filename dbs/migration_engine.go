@@ -0,0 +1,424 @@
+package dbs
+
+// migration engine module provides parallel migration of blocks of
+// migration request
+//
+// Every migration request keeps all blocks required for its migration in
+// MIGRATION_BLOCKS table, i.e. its input along with all parent blocks which
+// are not yet present in DBS. The engine builds the dependency graph of
+// these blocks from their parents at migration source (see MigrationSource),
+// and if parents of the block can not be obtained it depends on all blocks
+// of lower migration order (see GetMigrationBlocksInOrder). Then blocks
+// whose parents are already migrated are fetched as block dumps from
+// migration source and inserted concurrently by a pool of MigrationWorkers
+// workers. The status of every block is kept
+// in MIGRATION_BLOCKS table, such that the failed request is resumed from
+// its pending blocks. Along with the status the table keeps number of
+// retries, last error, start and end time of block migration and size of
+// block dump and number of files transferred, which are provided by
+// MigrationDetail API.
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// MigrationWorkers defines number of blocks of migration request which are
+// migrated concurrently
+var MigrationWorkers = 1
+
+// sqlite supports single writer, therefore blocks are inserted and their
+// status is updated one at a time
+var sqliteMigrationMutex sync.Mutex
+
+// MigrationBlockStatus represents migration progress of block of migration
+// request
+type MigrationBlockStatus struct {
+	Block  string `json:"migration_block_name"`
+	Order  int64  `json:"migration_order"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// migrationResult represents result of block migration
+type migrationResult struct {
+	mid    int64 // migration request id
+	block  string
+	status int64
+	err    error
+	bytes  int64 // size of block dump
+	files  int64 // number of files of block
+}
+
+// MaxMigrationErrorLength defines max length of migration error kept in
+// MIGRATION_BLOCKS table
+var MaxMigrationErrorLength = 4000
+
+// helper function to migrate blocks of given migration request, it returns
+// final status of migration request along with status of its blocks
+//
+//gocyclo:ignore
+func (a *API) migrateRequest(mrec MigrationRequest) (int64, []MigrationBlockStatus) {
+	mid := mrec.MIGRATION_REQUEST_ID
+	blocks, err := migrationRequestBlocks(mid)
+	if err != nil || len(blocks) == 0 {
+		log.Printf("unable to find blocks of migration request %d, error %v", mid, err)
+		return FAILED, nil
+	}
+	var progress []MigrationBlockStatus
+	index := make(map[string]int)
+	for i, b := range blocks {
+		index[b.MIGRATION_BLOCK_NAME] = i
+		progress = append(progress, MigrationBlockStatus{
+			Block:  b.MIGRATION_BLOCK_NAME,
+			Order:  b.MIGRATION_ORDER,
+			Status: statusString(b.MIGRATION_STATUS),
+		})
+	}
+	workers := MigrationWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	parents := migrationDAG(mrec.MIGRATION_URL, blocks, workers)
+
+	// blocks which are already migrated
+	done := make(map[string]bool)
+	var pending []string
+	for _, b := range blocks {
+		if b.MIGRATION_STATUS == COMPLETED || b.MIGRATION_STATUS == EXIST_IN_DB {
+			done[b.MIGRATION_BLOCK_NAME] = true
+		} else {
+			pending = append(pending, b.MIGRATION_BLOCK_NAME)
+		}
+	}
+
+	// start pool of workers
+	jobs := make(chan string, workers)
+	results := make(chan migrationResult, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for blk := range jobs {
+				results <- a.migrateBlock(mid, mrec.MIGRATION_URL, blk)
+			}
+		}()
+	}
+
+	// dispatch blocks whose parents are migrated until no block can proceed
+	migrated := 0
+	existed := 0
+	failed := false
+	running := 0
+	for {
+		var rest []string
+		for _, blk := range pending {
+			ready := true
+			for _, p := range parents[blk] {
+				if !done[p] {
+					ready = false
+					break
+				}
+			}
+			if ready && !strings.Contains(blk, "#") {
+				// dataset input is migrated along with all its blocks
+				done[blk] = true
+				progress[index[blk]].Status = statusString(COMPLETED)
+				updateMigrationBlock(migrationResult{mid: mid, block: blk, status: COMPLETED})
+				continue
+			}
+			if !ready || running >= workers {
+				rest = append(rest, blk)
+				continue
+			}
+			startMigrationBlock(mid, blk)
+			progress[index[blk]].Status = statusString(IN_PROGRESS)
+			jobs <- blk
+			running++
+		}
+		pending = rest
+		if running == 0 {
+			break
+		}
+		r := <-results
+		running--
+		migrated++
+		progress[index[r.block]].Status = statusString(r.status)
+		if r.err != nil {
+			progress[index[r.block]].Error = r.err.Error()
+		}
+		if r.status == COMPLETED || r.status == EXIST_IN_DB {
+			done[r.block] = true
+			if r.status == EXIST_IN_DB {
+				existed++
+			}
+		} else {
+			failed = true
+		}
+		updateMigrationBlock(r)
+		log.Printf("migration request %d block %s status %s, %d/%d blocks done",
+			mid, r.block, statusString(r.status), len(done), len(blocks))
+	}
+	close(jobs)
+	wg.Wait()
+
+	// blocks whose parents failed are left pending and migrated on retry
+	if failed || len(pending) > 0 {
+		return FAILED, progress
+	}
+	if migrated > 0 && existed == migrated {
+		return EXIST_IN_DB, progress
+	}
+	return COMPLETED, progress
+}
+
+// helper function to build dependency graph of migration blocks, i.e. map
+// of block to its parents among given blocks
+func migrationDAG(rurl string, blocks []MigrationBlocks, workers int) map[string][]string {
+	names := make(map[string]bool)
+	for _, b := range blocks {
+		names[b.MIGRATION_BLOCK_NAME] = true
+	}
+	parents := make(map[string][]string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for _, b := range blocks {
+		blk := b.MIGRATION_BLOCK_NAME
+		if !strings.Contains(blk, "#") {
+			// dataset depends on all blocks of migration request
+			for _, p := range blocks {
+				if strings.Contains(p.MIGRATION_BLOCK_NAME, "#") {
+					parents[blk] = append(parents[blk], p.MIGRATION_BLOCK_NAME)
+				}
+			}
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(b MigrationBlocks) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var deps []string
+			pblocks, err := GetParents(rurl, b.MIGRATION_BLOCK_NAME)
+			if err != nil {
+				// fall back to migration order of blocks
+				log.Printf("unable to get parents of %s, error %v", b.MIGRATION_BLOCK_NAME, err)
+				for _, p := range blocks {
+					if p.MIGRATION_ORDER < b.MIGRATION_ORDER && strings.Contains(p.MIGRATION_BLOCK_NAME, "#") {
+						deps = append(deps, p.MIGRATION_BLOCK_NAME)
+					}
+				}
+			}
+			for _, p := range pblocks {
+				if names[p] && p != b.MIGRATION_BLOCK_NAME {
+					deps = append(deps, p)
+				}
+			}
+			mutex.Lock()
+			parents[b.MIGRATION_BLOCK_NAME] = deps
+			mutex.Unlock()
+		}(b)
+	}
+	wg.Wait()
+	return parents
+}
+
+// helper function to migrate single block of given migration request from
+// given migration source, the size of block dump and number of inserted
+// files are reported in migration result
+func (a *API) migrateBlock(mid int64, rurl, block string) migrationResult {
+	res := migrationResult{mid: mid, block: block, status: FAILED}
+	time0 := time.Now()
+	// obtain block details from migration source
+	src, err := NewMigrationSource(rurl)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	data, err := src.BlockDump(block)
+	if err != nil {
+		log.Printf("unable to get block dump of %s from %s, error %v", block, rurl, err)
+		res.err = err
+		return res
+	}
+	res.bytes = int64(len(data))
+
+	// insert block dump record into source DBS
+	if DBOWNER == "sqlite" {
+		sqliteMigrationMutex.Lock()
+		defer sqliteMigrationMutex.Unlock()
+	}
+	nfiles, err := a.insertBlockDump(data, ConcurrentBulkBlocks)
+	if utils.VERBOSE > 0 {
+		log.Printf("insert bulkblocks of %s in %v, error %v", block, time.Since(time0), err)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "Data already exist in DBS") {
+			res.status = EXIST_IN_DB
+			return res
+		}
+		res.err = err
+		return res
+	}
+	res.status = COMPLETED
+	res.files = nfiles
+	return res
+}
+
+// helper function to insert block dump, i.e. BulkBlocks JSON record, into
+// DBS, it returns number of inserted files
+func (a *API) insertBlockDump(data []byte, concurrent bool) (int64, error) {
+	// NOTE: /blockdump API returns BulkBlocks record used in /bulkblocks API
+	var brec BulkBlocks
+	if err := json.Unmarshal(data, &brec); err != nil {
+		if utils.VERBOSE > 2 {
+			log.Println("blockdump data", string(data))
+		}
+		log.Printf("unable to unmarshal BulkBlocks, error %v", err)
+		return 0, Error(err, UnmarshalErrorCode, "", "dbs.migration_engine.insertBlockDump")
+	}
+	cby := a.CreateBy
+	if brec.Dataset.CreateBy != "" {
+		cby = brec.Dataset.CreateBy
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Printf("unable to unmarshal Record, error %v", err)
+		return 0, Error(err, UnmarshalErrorCode, "", "dbs.migration_engine.insertBlockDump")
+	}
+	api := &API{
+		Params:    rec,
+		Api:       "bulkblocks",
+		Writer:    utils.StdoutWriter(""),
+		Reader:    bytes.NewReader(data),
+		CreateBy:  cby,
+		Separator: a.Separator,
+	}
+	var err error
+	if concurrent {
+		err = api.InsertBulkBlocksConcurrently()
+	} else {
+		err = api.InsertBulkBlocks()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(brec.Files)), nil
+}
+
+// helper function to get blocks of migration request
+func migrationRequestBlocks(mid int64) ([]MigrationBlocks, error) {
+	var blocks []MigrationBlocks
+	stm := CleanStatement(getSQL("migration_request_blocks"))
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, []interface{}{mid}, "execute")
+	}
+	rows, err := DB.Query(stm, mid)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return blocks, Error(err, QueryErrorCode, "", "dbs.migration_engine.migrationRequestBlocks")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := MigrationBlocks{MIGRATION_REQUEST_ID: mid}
+		if err := rows.Scan(&b.MIGRATION_BLOCK_ID, &b.MIGRATION_BLOCK_NAME, &b.MIGRATION_ORDER, &b.MIGRATION_STATUS); err != nil {
+			return blocks, Error(err, RowsScanErrorCode, "", "dbs.migration_engine.migrationRequestBlocks")
+		}
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return blocks, Error(err, RowsScanErrorCode, "", "dbs.migration_engine.migrationRequestBlocks")
+	}
+	return blocks, nil
+}
+
+// helper function to mark start of migration of block of given migration
+// request, the retry count is increased for failed blocks
+func startMigrationBlock(mid int64, block string) error {
+	tstamp := time.Now().Unix()
+	args := []interface{}{IN_PROGRESS, tstamp, tstamp, mid, block}
+	return execMigrationBlock("start_migration_block", args)
+}
+
+// helper function to update migration block of migration request with given
+// migration result
+func updateMigrationBlock(r migrationResult) error {
+	var merr interface{}
+	if r.err != nil {
+		msg := r.err.Error()
+		if len(msg) > MaxMigrationErrorLength {
+			msg = msg[:MaxMigrationErrorLength]
+		}
+		merr = msg
+	}
+	tstamp := time.Now().Unix()
+	args := []interface{}{r.status, merr, tstamp, r.bytes, r.files, tstamp, r.mid, r.block}
+	return execMigrationBlock("update_migration_block", args)
+}
+
+// helper function to execute update statement of migration block
+func execMigrationBlock(tmpl string, args []interface{}) error {
+	if DBOWNER == "sqlite" {
+		sqliteMigrationMutex.Lock()
+		defer sqliteMigrationMutex.Unlock()
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Println("unable to get DB transaction", err)
+		return Error(err, TransactionErrorCode, "", "dbs.migration_engine.execMigrationBlock")
+	}
+	defer tx.Rollback()
+	stm := CleanStatement(getSQL(tmpl))
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	if _, err := tx.Exec(stm, args...); err != nil {
+		log.Printf("unable to execute %s, error %v", stm, err)
+		return Error(err, UpdateErrorCode, "", "dbs.migration_engine.execMigrationBlock")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("unable to commit transaction", err)
+		return Error(err, CommitErrorCode, "", "dbs.migration_engine.execMigrationBlock")
+	}
+	return nil
+}
+
+// MigrationDetail DBS API provides migration blocks of migration request
+// along with their status, retry count, last error, timing and size of
+// transferred data
+func (a *API) MigrationDetail() error {
+	// backward compatibility with DBS migration server which uses migration_rqst_id
+	if v, ok := a.Params["migration_rqst_id"]; ok {
+		a.Params["migration_request_id"] = v
+	}
+	val, err := getSingleValue(a.Params, "migration_request_id")
+	if err != nil || val == "" {
+		msg := "migration_request_id parameter is required"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.migration_engine.MigrationDetail")
+	}
+	mid, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return Error(err, ParseErrorCode, "", "dbs.migration_engine.MigrationDetail")
+	}
+	tmpl := Record{"Owner": DBOWNER}
+	stm, err := LoadTemplateSQL("migration_detail", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.migration_engine.MigrationDetail")
+	}
+	err = executeAll(a.Writer, a.Separator, stm, mid)
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.migration_engine.MigrationDetail")
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ type MigrationRequest struct {
 	LAST_MODIFIED_BY       string `json:"last_modified_by" validate:"required"`
 	LAST_MODIFICATION_DATE int64  `json:"last_modification_date" validate:"required,number,gt=0"`
 	RETRY_COUNT            int64  `json:"retry_count"`
+	MIGRATION_PRIORITY     int64  `json:"migration_priority"`
 }
 
 // Copy creates a new copy of migration request
@@ -39,6 +40,7 @@ func (r *MigrationRequest) Copy() MigrationRequest {
 		LAST_MODIFIED_BY:       r.LAST_MODIFIED_BY,
 		LAST_MODIFICATION_DATE: r.LAST_MODIFICATION_DATE,
 		RETRY_COUNT:            r.RETRY_COUNT,
+		MIGRATION_PRIORITY:     r.MIGRATION_PRIORITY,
 	}
 	return req
 }
@@ -81,7 +83,8 @@ func (r *MigrationRequest) Insert(tx *sql.Tx) error {
 		r.CREATE_BY,
 		r.LAST_MODIFICATION_DATE,
 		r.LAST_MODIFIED_BY,
-		r.RETRY_COUNT)
+		r.RETRY_COUNT,
+		r.MIGRATION_PRIORITY)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "unique") {
 			// if we try to insert the same migration input we'll continue
@@ -201,6 +204,7 @@ func MigrationRequests(mid int64) ([]MigrationRequest, error) {
 		var mid, migRetryCount, migCreationDate, migLastModificationDate, migStatus int64
 		var migURL, migInput, migCreateBy, migLastModifiedBy string
 		var msrv sql.NullString
+		var migPriority sql.NullInt64
 		err := rows.Scan(
 			&mid,
 			&migURL,
@@ -212,6 +216,7 @@ func MigrationRequests(mid int64) ([]MigrationRequest, error) {
 			&migLastModifiedBy,
 			&migLastModificationDate,
 			&migRetryCount,
+			&migPriority,
 		)
 		if err != nil {
 			return records, Error(err, RowsScanErrorCode, "", "dbs.migration_requests.MigrationRequests")
@@ -227,6 +232,7 @@ func MigrationRequests(mid int64) ([]MigrationRequest, error) {
 			LAST_MODIFIED_BY:       migLastModifiedBy,
 			LAST_MODIFICATION_DATE: migLastModificationDate,
 			RETRY_COUNT:            migRetryCount,
+			MIGRATION_PRIORITY:     migPriority.Int64,
 		}
 		records = append(records, rec)
 	}
@@ -0,0 +1,272 @@
+package dbs
+
+// migration scheduler module provides priorities, quotas and fair-share
+// scheduling of migration requests
+//
+// Every migration request has a priority (default 0) which is inherited by
+// requests of its blocks. The migration server processes requests in the
+// order provided by MigrationSchedule: requests with higher priority go
+// first, while requests of the same priority are picked in round-robin
+// fashion across submitters, such that single user submitting large
+// dataset does not starve everyone else. Within a submitter the requests
+// keep their submission order.
+//
+// The quotas limit number of queued (QUEUED and PENDING) requests of user
+// or group, which is checked at submission, and number of concurrent (IN
+// PROGRESS) requests, which is checked by scheduler before starting any
+// queued, pending or failed request of user or group.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// MigrationQuota represents limits of migration requests of user or
+// group, zero value means no limit
+type MigrationQuota struct {
+	MaxQueued     int64 `json:"max_queued"`     // max number of queued and pending requests
+	MaxConcurrent int64 `json:"max_concurrent"` // max number of requests in progress
+}
+
+// MigrationGroup represents group of users sharing migration quota
+type MigrationGroup struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+	MigrationQuota
+}
+
+// MigrationUserQuota defines default quota of every user
+var MigrationUserQuota MigrationQuota
+
+// MigrationUserQuotas defines quotas of specific users
+var MigrationUserQuotas map[string]MigrationQuota
+
+// MigrationGroups defines groups of users and their quotas
+var MigrationGroups []MigrationGroup
+
+// MigrationAdmins defines users allowed to change priority of migration
+// requests, empty list allows it to nobody
+var MigrationAdmins []string
+
+// MigrationPriorityRequest represents request to change migration priority
+type MigrationPriorityRequest struct {
+	MIGRATION_REQUEST_ID int64 `json:"migration_rqst_id"`
+	MIGRATION_PRIORITY   int64 `json:"migration_priority"`
+}
+
+// helper function to get quota of given user
+func migrationUserQuota(user string) MigrationQuota {
+	if q, ok := MigrationUserQuotas[user]; ok {
+		return q
+	}
+	return MigrationUserQuota
+}
+
+// helper function to get groups of given user
+func migrationUserGroups(user string) []MigrationGroup {
+	var groups []MigrationGroup
+	for _, g := range MigrationGroups {
+		if utils.InList(user, g.Users) {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// helper function to check if migration admin is allowed to change priority
+func migrationAdmin(user string) bool {
+	return utils.InList(user, MigrationAdmins)
+}
+
+// helper function to check if number of given requests of user and its
+// groups is within their quotas, the limit function provides quota value
+func migrationQuotaAllows(user string, counts map[string]int64, limit func(q MigrationQuota) int64) bool {
+	if max := limit(migrationUserQuota(user)); max > 0 && counts[user] >= max {
+		return false
+	}
+	for _, g := range migrationUserGroups(user) {
+		total := int64(0)
+		for _, u := range g.Users {
+			total += counts[u]
+		}
+		if max := limit(g.MigrationQuota); max > 0 && total >= max {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function to check queued quota of user submitting migration request
+func checkMigrationQuota(user string) error {
+	if MigrationUserQuota.MaxQueued == 0 && len(MigrationUserQuotas) == 0 && len(MigrationGroups) == 0 {
+		return nil
+	}
+	tmpl := Record{"Owner": DBOWNER}
+	stm, err := LoadTemplateSQL("migration_user_requests", tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.migration_scheduler.checkMigrationQuota")
+	}
+	stm = CleanStatement(stm)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, nil, "execute")
+	}
+	rows, err := DB.Query(stm)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return Error(err, QueryErrorCode, "", "dbs.migration_scheduler.checkMigrationQuota")
+	}
+	defer rows.Close()
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var cby string
+		var count int64
+		if err := rows.Scan(&cby, &count); err != nil {
+			return Error(err, RowsScanErrorCode, "", "dbs.migration_scheduler.checkMigrationQuota")
+		}
+		counts[cby] = count
+	}
+	if err := rows.Err(); err != nil {
+		return Error(err, RowsScanErrorCode, "", "dbs.migration_scheduler.checkMigrationQuota")
+	}
+	if !migrationQuotaAllows(user, counts, func(q MigrationQuota) int64 { return q.MaxQueued }) {
+		msg := fmt.Sprintf("user %s exceeds quota of queued migration requests", user)
+		return Error(InvalidRequestErr, MigrationErrorCode, msg, "dbs.migration_scheduler.checkMigrationQuota")
+	}
+	return nil
+}
+
+// MigrationSchedule provides order in which migration server processes
+// given migration requests. Requests with higher priority go first, and
+// requests of the same priority are picked across submitters in
+// round-robin fashion. Queued, pending and failed requests of submitters
+// exceeding their concurrent quota are not scheduled as all of them would
+// be started.
+func MigrationSchedule(records []MigrationRequest) []MigrationRequest {
+	// queues of submitters ordered by priority and submission order
+	queues := make(map[string][]MigrationRequest)
+	// number of requests in progress per submitter
+	active := make(map[string]int64)
+	var users []string
+	for _, r := range records {
+		if _, ok := queues[r.CREATE_BY]; !ok {
+			users = append(users, r.CREATE_BY)
+		}
+		queues[r.CREATE_BY] = append(queues[r.CREATE_BY], r)
+		if r.MIGRATION_STATUS == IN_PROGRESS {
+			active[r.CREATE_BY]++
+		}
+	}
+	sort.Strings(users)
+	for _, q := range queues {
+		sort.SliceStable(q, func(i, j int) bool {
+			if q[i].MIGRATION_PRIORITY != q[j].MIGRATION_PRIORITY {
+				return q[i].MIGRATION_PRIORITY > q[j].MIGRATION_PRIORITY
+			}
+			return q[i].MIGRATION_REQUEST_ID < q[j].MIGRATION_REQUEST_ID
+		})
+	}
+
+	// number of scheduled requests per submitter
+	served := make(map[string]int)
+	var out []MigrationRequest
+	for {
+		next := ""
+		for _, u := range users {
+			if len(queues[u]) == 0 {
+				continue
+			}
+			if next == "" {
+				next = u
+				continue
+			}
+			r, n := queues[u][0], queues[next][0]
+			if r.MIGRATION_PRIORITY != n.MIGRATION_PRIORITY {
+				if r.MIGRATION_PRIORITY > n.MIGRATION_PRIORITY {
+					next = u
+				}
+			} else if served[u] != served[next] {
+				if served[u] < served[next] {
+					next = u
+				}
+			} else if r.MIGRATION_REQUEST_ID < n.MIGRATION_REQUEST_ID {
+				next = u
+			}
+		}
+		if next == "" {
+			break
+		}
+		r := queues[next][0]
+		queues[next] = queues[next][1:]
+		if r.MIGRATION_STATUS != IN_PROGRESS {
+			if !migrationQuotaAllows(next, active, func(q MigrationQuota) int64 { return q.MaxConcurrent }) {
+				if utils.VERBOSE > 0 {
+					log.Printf("migration request %d of %s exceeds concurrent quota", r.MIGRATION_REQUEST_ID, next)
+				}
+				continue
+			}
+			active[next]++
+		}
+		served[next]++
+		out = append(out, r)
+	}
+	return out
+}
+
+// MigrationPriority DBS API changes priority of migration request which
+// is not yet completed, it accepts MigrationPriorityRequest record
+func (a *API) MigrationPriority() error {
+	data, err := io.ReadAll(a.Reader)
+	if err != nil {
+		log.Println("fail to read data", err)
+		return Error(err, ReaderErrorCode, "", "dbs.migration_scheduler.MigrationPriority")
+	}
+	var rec MigrationPriorityRequest
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Println("fail to decode data as MigrationPriorityRequest", err)
+		return Error(err, UnmarshalErrorCode, "", "dbs.migration_scheduler.MigrationPriority")
+	}
+	if !migrationAdmin(a.CreateBy) {
+		msg := fmt.Sprintf("user %s is not allowed to change migration priority", a.CreateBy)
+		return Error(InvalidRequestErr, InvalidRequestErrorCode, msg, "dbs.migration_scheduler.MigrationPriority")
+	}
+	mid := rec.MIGRATION_REQUEST_ID
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.migration_scheduler.MigrationPriority")
+	}
+	defer tx.Rollback()
+	stm := CleanStatement(getSQL("update_migration_priority"))
+	args := []interface{}{rec.MIGRATION_PRIORITY, a.CreateBy, time.Now().Unix(), mid}
+	if utils.VERBOSE > 0 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	res, err := tx.Exec(stm, args...)
+	if err != nil {
+		log.Printf("unable to execute %s, error %v", stm, err)
+		return Error(err, UpdateErrorCode, "", "dbs.migration_scheduler.MigrationPriority")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		msg := fmt.Sprintf(
+			"unable to change priority of %v as it is either does not exists or it is already completed", mid)
+		return Error(InvalidRequestErr, InvalidRequestErrorCode, msg, "dbs.migration_scheduler.MigrationPriority")
+	}
+	response := fmt.Sprintf(
+		"[{\"status\":\"success\",\"migration_request_id\":%d,\"migration_priority\":%d}]",
+		mid, rec.MIGRATION_PRIORITY)
+	if err := a.commit(tx, []byte(response)); err != nil {
+		log.Println("unable to commit transaction", err)
+		return Error(err, CommitErrorCode, "", "dbs.migration_scheduler.MigrationPriority")
+	}
+	log.Printf("migration request %d priority is changed to %d by %s", mid, rec.MIGRATION_PRIORITY, a.CreateBy)
+	if a.Writer != nil {
+		a.Writer.Write([]byte(response))
+	}
+	return nil
+}
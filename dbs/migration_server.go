@@ -67,7 +67,8 @@ func MigrationServer(interval, timeout int, ch <-chan bool) {
 			if utils.VERBOSE > 0 {
 				log.Printf("found %d migration requests", len(records))
 			}
-			for _, r := range records {
+			// process requests in order of their priorities and fair share of submitters
+			for _, r := range MigrationSchedule(records) {
 				if utils.VERBOSE > 0 {
 					log.Printf("process %+v", r)
 				}
@@ -0,0 +1,502 @@
+package dbs
+
+// migration source module provides sources of data for DBS migration
+//
+// The migration request pulls blocks from the source given by its
+// migration_url which can be either
+// - URL of remote DBS server, e.g. https://cmsweb.cern.ch/dbs/prod/global/DBSReader
+// - directory with block dumps registered in MigrationSourceDirs, e.g.
+// file://archive, where every file holds output of /blockdump API for
+// single block, i.e. BulkBlocks JSON record, and it may be gzip'ed
+// (.json.gz extension)
+// - local database registered in MigrationSourceDBs, e.g. db://archive,
+// the database should use DBS schema and it may use different backend
+// and owner than DBS server
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// MigrationSource represents source of DBS migration
+type MigrationSource interface {
+	Blocks(input string) ([]string, error)            // closed blocks of given dataset or block
+	Parents(input string) ([]string, error)           // parent blocks of given block or parent datasets of given dataset
+	BlockDump(block string) ([]byte, error)           // BulkBlocks JSON record of given block
+	DatasetAccessType(dataset string) (string, error) // access type of given dataset
+}
+
+// MigrationSourceDB represents local database which can be used as
+// migration source
+type MigrationSourceDB struct {
+	DB    *sql.DB // database handle
+	Type  string  // database driver name, e.g. sqlite3 or pgx
+	Owner string  // database owner
+	dbsql Record  // DBS SQL statements of database owner and driver
+}
+
+// NewMigrationSourceDB creates new migration source database of given
+// driver and owner
+func NewMigrationSourceDB(db *sql.DB, dbtype, owner string) *MigrationSourceDB {
+	return &MigrationSourceDB{DB: db, Type: dbtype, Owner: owner, dbsql: loadSQL(owner, dbtype)}
+}
+
+// MigrationSourceDBs holds local databases which can be used as migration
+// source via db://<name> migration url
+var MigrationSourceDBs = make(map[string]*MigrationSourceDB)
+
+// MigrationSourceDirs holds directories of block dumps which can be used as
+// migration source via file://<name> migration url, other directories are
+// not allowed
+var MigrationSourceDirs map[string]string
+
+// dump migration sources are cached and their block dump files are re-read
+// when they change
+var dumpMigrationSources = make(map[string]*DumpMigrationSource)
+var dumpMigrationMutex sync.Mutex
+
+// NewMigrationSource returns migration source for given migration url
+func NewMigrationSource(rurl string) (MigrationSource, error) {
+	if strings.HasPrefix(rurl, "file://") {
+		name := strings.TrimPrefix(rurl, "file://")
+		dir, ok := MigrationSourceDirs[name]
+		if !ok {
+			msg := fmt.Sprintf("unknown migration source directory %s", name)
+			return nil, Error(InvalidParamErr, MigrationErrorCode, msg, "dbs.migration_source.NewMigrationSource")
+		}
+		return dumpMigrationSource(dir)
+	}
+	if strings.HasPrefix(rurl, "db://") {
+		name := strings.TrimPrefix(rurl, "db://")
+		db, ok := MigrationSourceDBs[name]
+		if !ok {
+			msg := fmt.Sprintf("unknown migration source database %s", name)
+			return nil, Error(InvalidParamErr, MigrationErrorCode, msg, "dbs.migration_source.NewMigrationSource")
+		}
+		return &DBMigrationSource{MigrationSourceDB: db}, nil
+	}
+	return &RemoteMigrationSource{URL: rurl}, nil
+}
+
+// RemoteMigrationSource represents remote DBS server
+type RemoteMigrationSource struct {
+	URL string // DBS server URL
+}
+
+// Blocks implements MigrationSource Blocks API
+func (s *RemoteMigrationSource) Blocks(val string) ([]string, error) {
+	var out []string
+	open := "&open_for_writing=0"
+	rurl := s.URL
+	if strings.Contains(val, "#") {
+		rurl = fmt.Sprintf("%s/blocks?block_name=%s%s", rurl, url.QueryEscape(val), open)
+	} else {
+		rurl = fmt.Sprintf("%s/blocks?dataset=%s%s", rurl, val, open)
+	}
+	data, err := getData(rurl)
+	if utils.VERBOSE > 0 {
+		log.Println("GetBlocks", rurl, string(data))
+	}
+	if err != nil {
+		if utils.VERBOSE > 0 {
+			log.Printf("unable to get data for %s, error %v", rurl, err)
+		}
+		return out, Error(err, HttpRequestErrorCode, "", "dbs.migration_source.Blocks")
+	}
+	var rec []Blocks
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		return out, Error(err, UnmarshalErrorCode, "", "dbs.migration_source.Blocks")
+	}
+	for _, v := range rec {
+		out = append(out, v.BLOCK_NAME)
+	}
+	return out, nil
+}
+
+// Parents implements MigrationSource Parents API
+func (s *RemoteMigrationSource) Parents(val string) ([]string, error) {
+	var out []string
+	var rurl string
+	if strings.Contains(val, "#") {
+		rurl = fmt.Sprintf("%s/blockparents?block_name=%s", s.URL, url.QueryEscape(val))
+	} else {
+		rurl = fmt.Sprintf("%s/datasetparents?dataset=%s", s.URL, val)
+	}
+	data, err := getData(rurl)
+	if err != nil {
+		return out, Error(err, HttpRequestErrorCode, "", "dbs.migration_source.Parents")
+	}
+	var rec []map[string]interface{}
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		log.Printf("unable to unmarshal data url=%s data=%s error=%v", rurl, string(data), err)
+		return out, Error(err, UnmarshalErrorCode, "", "dbs.migration_source.Parents")
+	}
+	for _, v := range rec {
+		if strings.Contains(val, "#") {
+			block := fmt.Sprintf("%v", v["parent_block_name"])
+			out = append(out, block)
+		} else {
+			dataset := fmt.Sprintf("%v", v["parent_dataset"])
+			out = append(out, dataset)
+		}
+	}
+	return out, nil
+}
+
+// BlockDump implements MigrationSource BlockDump API
+func (s *RemoteMigrationSource) BlockDump(block string) ([]byte, error) {
+	rurl := fmt.Sprintf("%s/blockdump?block_name=%s", s.URL, url.QueryEscape(block))
+	data, err := getData(rurl)
+	if err != nil {
+		log.Printf("unable to query %s, error %v", rurl, err)
+		return data, Error(err, HttpRequestErrorCode, "", "dbs.migration_source.BlockDump")
+	}
+	return data, nil
+}
+
+// DatasetAccessType implements MigrationSource DatasetAccessType API
+func (s *RemoteMigrationSource) DatasetAccessType(dataset string) (string, error) {
+	rurl := fmt.Sprintf("%s/datasets?dataset=%s&detail=true&dataset_access_type=*", s.URL, dataset)
+	data, err := getData(rurl)
+	if utils.VERBOSE > 0 {
+		log.Println("validInput", rurl, string(data))
+	}
+	if err != nil {
+		if utils.VERBOSE > 0 {
+			log.Printf("unable to get data for %s, error %v", rurl, err)
+		}
+		return "", Error(err, HttpRequestErrorCode, "", "dbs.migration_source.DatasetAccessType")
+	}
+	var records []Dataset
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return "", Error(err, UnmarshalErrorCode, "", "dbs.migration_source.DatasetAccessType")
+	}
+	if len(records) != 1 {
+		msg := fmt.Sprintf("found %d records of dataset %s", len(records), dataset)
+		return "", Error(RecordErr, DatabaseErrorCode, msg, "dbs.migration_source.DatasetAccessType")
+	}
+	return records[0].DatasetAccessType, nil
+}
+
+// dumpBlock represents block found in directory of block dumps
+type dumpBlock struct {
+	name           string    // block name, empty for invalid block dump
+	file           string    // file name of block dump
+	modTime        time.Time // modification time of block dump file when it was read
+	size           int64     // size of block dump file when it was read
+	dataset        string    // dataset of the block
+	accessType     string    // dataset access type
+	open           bool      // block is open for writing
+	parents        []string  // parent blocks
+	datasetParents []string  // parent datasets
+}
+
+// DumpMigrationSource represents directory of block dumps, it is not
+// modified once it is scanned
+type DumpMigrationSource struct {
+	Dir    string               // directory of block dumps
+	files  map[string]dumpBlock // blocks of block dump files
+	blocks map[string]dumpBlock // blocks found in directory
+}
+
+// helper function to get dump migration source of given directory, only
+// block dump files which changed since previous scan are read
+func dumpMigrationSource(dir string) (*DumpMigrationSource, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, Error(err, ReaderErrorCode, "", "dbs.migration_source.dumpMigrationSource")
+	}
+	if !info.IsDir() {
+		msg := fmt.Sprintf("%s is not a directory", dir)
+		return nil, Error(InvalidParamErr, MigrationErrorCode, msg, "dbs.migration_source.dumpMigrationSource")
+	}
+	dumpMigrationMutex.Lock()
+	prev := dumpMigrationSources[dir]
+	dumpMigrationMutex.Unlock()
+
+	s := &DumpMigrationSource{Dir: dir}
+	if err := s.scan(prev); err != nil {
+		return nil, err
+	}
+	dumpMigrationMutex.Lock()
+	dumpMigrationSources[dir] = s
+	dumpMigrationMutex.Unlock()
+	return s, nil
+}
+
+// helper function to read block dump file
+func readBlockDump(fname string) ([]byte, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(fname, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return io.ReadAll(reader)
+}
+
+// helper function to read block of block dump file
+func readDumpBlock(fname string) (dumpBlock, error) {
+	blk := dumpBlock{file: fname}
+	data, err := readBlockDump(fname)
+	if err != nil {
+		return blk, err
+	}
+	var rec BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return blk, err
+	}
+	if rec.Block.BlockName == "" {
+		return blk, errors.New("block dump without block name")
+	}
+	blk.name = rec.Block.BlockName
+	blk.dataset = rec.Dataset.Dataset
+	blk.accessType = rec.Dataset.DatasetAccessType
+	blk.open = rec.Block.OpenForWriting != 0
+	blk.datasetParents = rec.DatasetParentList
+	for _, p := range rec.BlockParentList {
+		blk.parents = append(blk.parents, p.ParentBlockName)
+	}
+	for _, p := range rec.DsParentList {
+		if !utils.InList(p.ParentDataset, blk.datasetParents) {
+			blk.datasetParents = append(blk.datasetParents, p.ParentDataset)
+		}
+	}
+	return blk, nil
+}
+
+// helper function to scan directory of block dumps and build index of
+// blocks, the blocks of files with the same modification time and size as
+// in previous scan are reused and unreadable files are skipped
+func (s *DumpMigrationSource) scan(prev *DumpMigrationSource) error {
+	time0 := time.Now()
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return Error(err, ReaderErrorCode, "", "dbs.migration_source.scan")
+	}
+	s.files = make(map[string]dumpBlock)
+	s.blocks = make(map[string]dumpBlock)
+	var nread int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")) {
+			continue
+		}
+		fname := filepath.Join(s.Dir, name)
+		info, err := e.Info()
+		if err != nil {
+			// file is removed since directory was read
+			continue
+		}
+		blk, ok := dumpBlock{}, false
+		if prev != nil {
+			blk, ok = prev.files[fname]
+		}
+		if !ok || !blk.modTime.Equal(info.ModTime()) || blk.size != info.Size() {
+			nread++
+			blk, err = readDumpBlock(fname)
+			if err != nil {
+				log.Printf("skip block dump %s, error %v", fname, err)
+			}
+			blk.modTime = info.ModTime()
+			blk.size = info.Size()
+		}
+		// invalid files are kept in files index to not read them again
+		s.files[fname] = blk
+		if blk.name == "" {
+			continue
+		}
+		if b, ok := s.blocks[blk.name]; ok {
+			log.Printf("block %s is found in block dumps %s and %s, use %s", blk.name, b.file, fname, fname)
+		}
+		s.blocks[blk.name] = blk
+	}
+	if utils.VERBOSE > 0 {
+		log.Printf("found %d block dumps in %s, read %d files in %v", len(s.blocks), s.Dir, nread, time.Since(time0))
+	}
+	return nil
+}
+
+// Blocks implements MigrationSource Blocks API
+func (s *DumpMigrationSource) Blocks(val string) ([]string, error) {
+	var out []string
+	for name, b := range s.blocks {
+		if b.open {
+			continue
+		}
+		if name == val || b.dataset == val {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Parents implements MigrationSource Parents API
+func (s *DumpMigrationSource) Parents(val string) ([]string, error) {
+	if b, ok := s.blocks[val]; ok {
+		return b.parents, nil
+	}
+	var out []string
+	for _, b := range s.blocks {
+		if b.dataset != val {
+			continue
+		}
+		for _, p := range b.datasetParents {
+			if !utils.InList(p, out) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// BlockDump implements MigrationSource BlockDump API
+func (s *DumpMigrationSource) BlockDump(block string) ([]byte, error) {
+	b, ok := s.blocks[block]
+	if !ok {
+		msg := fmt.Sprintf("block %s is not found in %s", block, s.Dir)
+		return nil, Error(RecordErr, ReaderErrorCode, msg, "dbs.migration_source.BlockDump")
+	}
+	data, err := readBlockDump(b.file)
+	if err != nil {
+		return nil, Error(err, ReaderErrorCode, "", "dbs.migration_source.BlockDump")
+	}
+	return data, nil
+}
+
+// DatasetAccessType implements MigrationSource DatasetAccessType API
+func (s *DumpMigrationSource) DatasetAccessType(dataset string) (string, error) {
+	for _, b := range s.blocks {
+		if b.dataset == dataset {
+			return b.accessType, nil
+		}
+	}
+	msg := fmt.Sprintf("dataset %s is not found in %s", dataset, s.Dir)
+	return "", Error(RecordErr, DatabaseErrorCode, msg, "dbs.migration_source.DatasetAccessType")
+}
+
+// DBMigrationSource represents local database
+type DBMigrationSource struct {
+	*MigrationSourceDB
+}
+
+// helper function to load SQL template for migration source database
+func (s *DBMigrationSource) loadTemplateSQL(tmpl string, tmplData Record) (string, error) {
+	tmplData["Owner"] = s.Owner
+	return loadTemplateSQL(tmpl, tmplData, s.Type, s.Owner)
+}
+
+// helper function to get dumpDB of migration source database
+func (s *DBMigrationSource) dumpDB() dumpDB {
+	return dumpDB{DB: s.DB, dbsql: s.dbsql, owner: s.Owner}
+}
+
+// helper function to query list of names from migration source database
+func (s *DBMigrationSource) query(stm string, col int, args ...interface{}) ([]string, error) {
+	var out []string
+	stm = CleanStatement(stm)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	rows, err := s.DB.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return out, Error(err, QueryErrorCode, "", "dbs.migration_source.query")
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return out, Error(err, QueryErrorCode, "", "dbs.migration_source.query")
+	}
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return out, Error(err, RowsScanErrorCode, "", "dbs.migration_source.query")
+		}
+		out = append(out, vals[col].String)
+	}
+	if err := rows.Err(); err != nil {
+		return out, Error(err, RowsScanErrorCode, "", "dbs.migration_source.query")
+	}
+	return out, nil
+}
+
+// Blocks implements MigrationSource Blocks API
+func (s *DBMigrationSource) Blocks(val string) ([]string, error) {
+	tmpl := Record{"Dataset": !strings.Contains(val, "#")}
+	stm, err := s.loadTemplateSQL("migration_source_blocks", tmpl)
+	if err != nil {
+		return nil, Error(err, LoadErrorCode, "", "dbs.migration_source.Blocks")
+	}
+	return s.query(stm, 0, val)
+}
+
+// Parents implements MigrationSource Parents API
+func (s *DBMigrationSource) Parents(val string) ([]string, error) {
+	if strings.Contains(val, "#") {
+		// blockdump_blockparents provides pairs of block and its parent
+		return s.query(s.dumpDB().sql("blockdump_blockparents"), 1, val)
+	}
+	return s.query(s.dumpDB().sql("blockdump_datasetparents"), 0, val)
+}
+
+// BlockDump implements MigrationSource BlockDump API
+func (s *DBMigrationSource) BlockDump(block string) ([]byte, error) {
+	rec := blockDump(s.dumpDB(), block)
+	if rec.Block.BlockName == "" {
+		msg := fmt.Sprintf("block %s is not found", block)
+		return nil, Error(RecordErr, QueryErrorCode, msg, "dbs.migration_source.BlockDump")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, Error(err, MarshalErrorCode, "", "dbs.migration_source.BlockDump")
+	}
+	return data, nil
+}
+
+// DatasetAccessType implements MigrationSource DatasetAccessType API
+func (s *DBMigrationSource) DatasetAccessType(dataset string) (string, error) {
+	stm, err := s.loadTemplateSQL("migration_source_dataset", make(Record))
+	if err != nil {
+		return "", Error(err, LoadErrorCode, "", "dbs.migration_source.DatasetAccessType")
+	}
+	out, err := s.query(stm, 0, dataset)
+	if err != nil {
+		return "", err
+	}
+	if len(out) != 1 {
+		msg := fmt.Sprintf("found %d records of dataset %s", len(out), dataset)
+		return "", Error(RecordErr, DatabaseErrorCode, msg, "dbs.migration_source.DatasetAccessType")
+	}
+	return out[0], nil
+}
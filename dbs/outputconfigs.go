@@ -331,7 +331,7 @@ func (a *API) InsertOutputConfigs() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("unable to commit transaction", err)
 		return Error(err, CommitErrorCode, "", "dbs.outputconfigs.InsertOutputConfigs")
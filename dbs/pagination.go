@@ -0,0 +1,323 @@
+package dbs
+
+// pagination module provides cursor-based pagination of DBS reader APIs
+//
+// Clients pass limit and cursor query parameters to any reader API.
+// The server fetches at most limit records and, if more records are
+// available, returns an opaque cursor via NextCursorHeader HTTP trailer.
+// The cursor encodes API name, hash of API parameters, page size and
+// key of the last record delivered to the client. The results are ordered
+// by the API key (see pageKeys) and the next page starts right after the
+// last record (keyset pagination), such that the database does not need to
+// skip already delivered records and concurrent inserts do not shift pages.
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// NextCursorHeader represents HTTP header (trailer) used to return next cursor
+const NextCursorHeader = "X-Dbs-Next-Cursor"
+
+// MaxPageLimit represents maximum number of records allowed per page
+var MaxPageLimit int64 = 100000
+
+// pageKeys defines output columns of reader APIs which uniquely identify
+// API records and which are used to order and continue paginated results.
+// Only key columns present in API output are used, e.g. run_num is part of
+// the key only if API is called with run_num parameter. APIs which are not
+// listed here do not support pagination.
+var pageKeys = map[string][]string{
+	"acquisitioneras":    {"acquisition_era_name"},
+	"acquisitioneras_ci": {"acquisition_era_name"},
+	"audit":              {"audit_id"},
+	"blockchildren":      {"block_name"},
+	"blockorigin":        {"block_name"},
+	"blockparents":       {"this_block_name", "parent_block_name"},
+	"blocks":             {"block_name", "run_num"},
+	"datasetaccesstypes": {"dataset_access_type"},
+	"datasetchildren":    {"dataset", "child_dataset"},
+	"datasetparents":     {"this_dataset", "parent_dataset"},
+	"datasets": {"dataset", "parent_dataset", "output_module_label", "global_tag",
+		"release_version", "pset_hash", "app_name", "run_num"},
+	"datatiers":       {"data_tier_name"},
+	"datatypes":       {"primary_ds_type_id"},
+	"filechildren":    {"logical_file_name", "child_logical_file_name"},
+	"filelumis":       {"logical_file_name", "run_num", "lumi_section_num", "event_count"},
+	"fileparents":     {"logical_file_name", "parent_logical_file_name"},
+	"files":           {"logical_file_name", "run_num"},
+	"outputconfigs":   {"dataset", "app_name", "release_version", "pset_hash", "output_module_label", "global_tag"},
+	"physicsgroups":   {"physics_group_name"},
+	"primarydatasets": {"primary_ds_name"},
+	"primarydstypes":  {"primary_ds_type_id"},
+	"processingeras":  {"processing_version"},
+	"releaseversions": {"release_version"},
+	"runs":            {"run_num", "dataset"},
+}
+
+// Pagination represents limit/cursor parameters of DBS reader API
+type Pagination struct {
+	Api   string        `json:"api"`            // api name the cursor was issued for
+	Hash  string        `json:"hash"`           // hash of API parameters
+	Limit int64         `json:"limit"`          // max number of records per page
+	Last  []interface{} `json:"last,omitempty"` // key of the last delivered record
+	More  bool          `json:"-"`              // flag which indicates that more records are available
+
+	keys []int         // positions of key columns in API output
+	last []interface{} // key of the last record of current page
+}
+
+// PageWriter wraps http.ResponseWriter and carries pagination of HTTP request
+type PageWriter struct {
+	http.ResponseWriter
+	Page *Pagination
+}
+
+// helper function to compute hash of API parameters
+func paramsHash(api string, params Record) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, getValues(params, k)))
+	}
+	data := fmt.Sprintf("%s?%s", api, strings.Join(parts, "&"))
+	return utils.GetHash([]byte(data))
+}
+
+// NewPagination creates pagination object from limit and cursor parameters
+// of given API. Both parameters are removed from the API parameters.
+// It returns nil if client did not request pagination.
+func NewPagination(api string, params Record) (*Pagination, error) {
+	limits := getValues(params, "limit")
+	cursors := getValues(params, "cursor")
+	delete(params, "limit")
+	delete(params, "cursor")
+	if len(limits) == 0 && len(cursors) == 0 {
+		return nil, nil
+	}
+	if len(limits) > 1 || len(cursors) > 1 {
+		msg := "list is not allowed for limit and cursor parameters"
+		return nil, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.NewPagination")
+	}
+	if _, ok := pageKeys[api]; !ok {
+		msg := fmt.Sprintf("pagination is not supported by %s API", api)
+		return nil, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.NewPagination")
+	}
+	page := &Pagination{Api: api, Hash: paramsHash(api, params)}
+	if len(cursors) == 1 {
+		cursor, err := decodeCursor(cursors[0])
+		if err != nil {
+			return nil, Error(err, ParametersErrorCode, "invalid cursor", "dbs.NewPagination")
+		}
+		if cursor.Api != page.Api || cursor.Hash != page.Hash {
+			msg := "cursor does not match API parameters"
+			return nil, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.NewPagination")
+		}
+		page = cursor
+	}
+	if len(limits) == 1 {
+		limit, err := strconv.ParseInt(limits[0], 10, 64)
+		if err != nil {
+			return nil, Error(err, ParametersErrorCode, "invalid limit", "dbs.NewPagination")
+		}
+		page.Limit = limit
+	}
+	if page.Limit <= 0 || page.Limit > MaxPageLimit {
+		msg := fmt.Sprintf("limit should be in range [1, %d]", MaxPageLimit)
+		return nil, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.NewPagination")
+	}
+	return page, nil
+}
+
+// NextCursor returns cursor of the next page or empty string if no more records are available
+func (p *Pagination) NextCursor() string {
+	if !p.More {
+		return ""
+	}
+	next := Pagination{Api: p.Api, Hash: p.Hash, Limit: p.Limit, Last: p.last}
+	return encodeCursor(next)
+}
+
+// helper function to encode pagination cursor
+func encodeCursor(p Pagination) string {
+	data, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// helper function to decode pagination cursor
+func decodeCursor(cursor string) (*Pagination, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var p Pagination
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+	// restore integer keys which JSON represents as numbers
+	for i, v := range p.Last {
+		if num, ok := v.(json.Number); ok {
+			if val, err := num.Int64(); err == nil {
+				p.Last[i] = val
+			} else if val, err := num.Float64(); err == nil {
+				p.Last[i] = val
+			} else {
+				return nil, err
+			}
+		}
+	}
+	return &p, nil
+}
+
+// helper function to convert scanned column value into cursor key value
+func keyValue(v interface{}) interface{} {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		if val, ok := v.(driver.Valuer); ok {
+			v, _ = val.Value()
+		} else {
+			v = rv.Elem().Interface()
+		}
+	}
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case int:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case float32:
+		return float64(val)
+	}
+	return v
+}
+
+// helper function to keep key of the record delivered to the client
+func (p *Pagination) keep(vals []interface{}) {
+	p.last = make([]interface{}, len(p.keys))
+	for i, idx := range p.keys {
+		p.last[i] = keyValue(vals[idx])
+	}
+}
+
+// helper function to get pagination from given writer
+func writerPage(w io.Writer) *Pagination {
+	if pw, ok := w.(*PageWriter); ok {
+		return pw.Page
+	}
+	return nil
+}
+
+// helper function to wrap given statement into pagination statement.
+// It probes the statement to obtain positions of API key columns which
+// are used to order the results and to select records which follow the
+// last record of the previous page. The page asks for one extra record
+// to find out if more records are available. Key columns can be NULL
+// (e.g. parent_dataset of datasets without parents), therefore NULLs are
+// ordered first and compared explicitly.
+func (p *Pagination) statement(tx *sql.Tx, stm string, args []interface{}) (string, []interface{}, error) {
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["Statement"] = stm
+	tmpl["Probe"] = true
+	probe, err := LoadTemplateSQL("paginate", tmpl)
+	if err != nil {
+		return "", nil, Error(err, LoadErrorCode, "", "dbs.pagination.statement")
+	}
+	rows, err := tx.Query(probe, args...)
+	if err != nil {
+		return "", nil, Error(err, QueryErrorCode, "", "dbs.pagination.statement")
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return "", nil, Error(err, QueryErrorCode, "", "dbs.pagination.statement")
+	}
+	var keys []string
+	p.keys = nil
+	for _, key := range pageKeys[p.Api] {
+		for i, col := range columns {
+			if strings.ToLower(col) == key {
+				p.keys = append(p.keys, i)
+				keys = append(keys, "PAGE."+col)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		msg := fmt.Sprintf("%s API output does not contain key columns", p.Api)
+		return "", nil, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.pagination.statement")
+	}
+	if len(p.Last) != 0 && len(p.Last) != len(keys) {
+		msg := "cursor does not match API output"
+		return "", nil, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.pagination.statement")
+	}
+
+	var pargs []interface{}
+	pargs = append(pargs, args...)
+	// build condition (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+	var conds, orderBy []string
+	for i, key := range keys {
+		orderBy = append(orderBy, key+" NULLS FIRST")
+		if len(p.Last) == 0 {
+			continue
+		}
+		var cond []string
+		for j := 0; j <= i; j++ {
+			op := "="
+			if j == i {
+				op = ">"
+			}
+			if p.Last[j] == nil {
+				if op == "=" {
+					cond = append(cond, keys[j]+" IS NULL")
+				} else {
+					cond = append(cond, keys[j]+" IS NOT NULL")
+				}
+				continue
+			}
+			cond = append(cond, fmt.Sprintf("%s %s :page_key%d", keys[j], op, len(pargs)))
+			pargs = append(pargs, p.Last[j])
+		}
+		conds = append(conds, "("+strings.Join(cond, " AND ")+")")
+	}
+	tmpl["Probe"] = false
+	tmpl["Keyset"] = strings.Join(conds, " OR ")
+	tmpl["OrderBy"] = strings.Join(orderBy, ", ")
+	stm, err = LoadTemplateSQL("paginate", tmpl)
+	if err != nil {
+		return "", nil, Error(err, LoadErrorCode, "", "dbs.pagination.statement")
+	}
+	pargs = append(pargs, p.Limit+1)
+	return stm, pargs, nil
+}
+
+// helper function to set next cursor header on given writer
+func (p *Pagination) setNextCursor(w io.Writer) {
+	if pw, ok := w.(*PageWriter); ok {
+		if cursor := p.NextCursor(); cursor != "" {
+			pw.Header().Set(NextCursorHeader, cursor)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package dbs
+
+// parentagecheck module provides consistency check of dataset parentage
+//
+// The file parentage (FILE_PARENTS table) is the source of truth, block and
+// dataset parentage (BLOCK_PARENTS and DATASET_PARENTS tables) are derived
+// from it. The check reports block and dataset parents missing for existing
+// file parents, dataset parents without any file parents and file parents
+// pointing to invalid files. The repair inserts missing block and dataset
+// parents derived from file parents.
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// ParentageCheck represents report of parentage consistency check of dataset
+type ParentageCheck struct {
+	Dataset                    string             `json:"dataset"`
+	MissingDatasetParents      []string           `json:"missing_dataset_parents"`
+	DatasetParentsWithoutFiles []string           `json:"dataset_parents_without_files"`
+	MissingBlockParents        []BlockParent      `json:"missing_block_parents"`
+	InvalidFileParents         []FileParentRecord `json:"invalid_file_parents"`
+	Consistent                 bool               `json:"consistent"`
+}
+
+// ParentageRepairRecord represents input of parentage repair API. Along with
+// dataset it may contain file parents of the dataset block which are
+// inserted before the repair, see FileParentBlockRecord.
+type ParentageRepairRecord struct {
+	Dataset string `json:"dataset"`
+	FileParentBlockRecord
+}
+
+// ParentageRepair represents block and dataset parents inserted by
+// parentage repair API
+type ParentageRepair struct {
+	Dataset        string        `json:"dataset"`
+	BlockParents   []BlockParent `json:"block_parents"`
+	DatasetParents []string      `json:"dataset_parents"`
+}
+
+// parentage represents parentage of dataset along with ids of missing
+// block and dataset parents
+type parentage struct {
+	check          ParentageCheck
+	datasetID      int64
+	blockParents   [][2]int64
+	datasetParents []int64
+}
+
+// ParentageCheck DBS API checks consistency of file, block and dataset
+// parentage of given dataset
+func (a *API) ParentageCheck() error {
+	datasets := getValues(a.Params, "dataset")
+	if len(datasets) != 1 || strings.Contains(datasets[0], "*") {
+		msg := "parentagecheck API requires single dataset parameter without wild-cards"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagecheck.ParentageCheck")
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.parentagecheck.ParentageCheck")
+	}
+	defer tx.Rollback()
+	p, err := checkParentage(tx, datasets[0])
+	if err != nil {
+		return err
+	}
+	if a.Writer != nil {
+		if err := json.NewEncoder(a.Writer).Encode(p.check); err != nil {
+			return Error(err, EncodeErrorCode, "", "dbs.parentagecheck.ParentageCheck")
+		}
+	}
+	return nil
+}
+
+// RepairParentage DBS API inserts missing block and dataset parents of
+// dataset derived from its file parents. It accepts ParentageRepairRecord
+// and if it contains child_parent_id_list the file parents are inserted
+// first within the same transaction.
+func (a *API) RepairParentage() error {
+	data, err := io.ReadAll(a.Reader)
+	if err != nil {
+		log.Println("fail to read data", err)
+		return Error(err, ReaderErrorCode, "", "dbs.parentagecheck.RepairParentage")
+	}
+	var rec ParentageRepairRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Println("fail to decode data as ParentageRepairRecord", err)
+		return Error(err, UnmarshalErrorCode, "", "dbs.parentagecheck.RepairParentage")
+	}
+	if rec.Dataset == "" && rec.BlockName != "" {
+		rec.Dataset = strings.Split(rec.BlockName, "#")[0]
+	}
+	if rec.Dataset == "" || strings.Contains(rec.Dataset, "*") {
+		msg := "parentage repair requires dataset without wild-cards"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagecheck.RepairParentage")
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.parentagecheck.RepairParentage")
+	}
+	defer tx.Rollback()
+	if len(rec.ChildParentIDList) > 0 {
+		a.Reader = bytes.NewReader(data)
+		if err := a.InsertFileParentsBlockTxt(tx); err != nil {
+			return Error(err, InsertErrorCode, "", "dbs.parentagecheck.RepairParentage")
+		}
+	}
+	repair, err := repairParentage(tx, rec.Dataset)
+	if err != nil {
+		return err
+	}
+	var response bytes.Buffer
+	if err := json.NewEncoder(&response).Encode(repair); err != nil {
+		return Error(err, EncodeErrorCode, "", "dbs.parentagecheck.RepairParentage")
+	}
+	if err := a.commit(tx, response.Bytes()); err != nil {
+		log.Println("fail to commit transaction", err)
+		return Error(err, CommitErrorCode, "", "dbs.parentagecheck.RepairParentage")
+	}
+	if utils.VERBOSE > 0 {
+		log.Printf("repair parentage of %s: %d block parents, %d dataset parents",
+			rec.Dataset, len(repair.BlockParents), len(repair.DatasetParents))
+	}
+	if a.Writer != nil {
+		a.Writer.Write(response.Bytes())
+	}
+	return nil
+}
+
+// helper function to insert missing block and dataset parents of given
+// dataset derived from its file parents within given transaction
+func repairParentage(tx *sql.Tx, dataset string) (ParentageRepair, error) {
+	p, err := checkParentage(tx, dataset)
+	if err != nil {
+		return ParentageRepair{}, err
+	}
+	repair := ParentageRepair{
+		Dataset:        dataset,
+		BlockParents:   p.check.MissingBlockParents,
+		DatasetParents: p.check.MissingDatasetParents,
+	}
+	stm := getSQL("insert_block_parents")
+	for _, ids := range p.blockParents {
+		if utils.VERBOSE > 1 {
+			utils.PrintSQL(stm, []interface{}{ids[0], ids[1]}, "execute")
+		}
+		if _, err := tx.Exec(stm, ids[0], ids[1]); err != nil {
+			log.Printf("unable to insert block parents %v, error %v", ids, err)
+			return repair, Error(err, InsertErrorCode, "", "dbs.parentagecheck.repairParentage")
+		}
+	}
+	stm = getSQL("insert_dataset_parents")
+	for _, pid := range p.datasetParents {
+		if utils.VERBOSE > 1 {
+			utils.PrintSQL(stm, []interface{}{p.datasetID, pid}, "execute")
+		}
+		if _, err := tx.Exec(stm, p.datasetID, pid); err != nil {
+			log.Printf("unable to insert dataset parent %d of %s, error %v", pid, dataset, err)
+			return repair, Error(err, InsertErrorCode, "", "dbs.parentagecheck.repairParentage")
+		}
+	}
+	return repair, nil
+}
+
+// helper function to check parentage of given dataset
+//
+//gocyclo:ignore
+func checkParentage(tx *sql.Tx, dataset string) (parentage, error) {
+	p := parentage{check: ParentageCheck{
+		Dataset:                    dataset,
+		MissingDatasetParents:      []string{},
+		DatasetParentsWithoutFiles: []string{},
+		MissingBlockParents:        []BlockParent{},
+		InvalidFileParents:         []FileParentRecord{},
+	}}
+	datasetID, err := GetID(tx, "DATASETS", "DATASET_ID", "DATASET", dataset)
+	if err != nil {
+		msg := fmt.Sprintf("unable to find dataset %s", dataset)
+		return p, Error(err, QueryErrorCode, msg, "dbs.parentagecheck.checkParentage")
+	}
+	p.datasetID = datasetID
+
+	// existing block and dataset parents
+	blockParents := make(map[[2]int64]bool)
+	err = queryParentage(tx, "parentage_blockparents", datasetID, func(rows *sql.Rows) error {
+		var ids [2]int64
+		if err := rows.Scan(&ids[0], &ids[1]); err != nil {
+			return err
+		}
+		blockParents[ids] = true
+		return nil
+	})
+	if err != nil {
+		return p, err
+	}
+	datasetParents := make(map[int64]string)
+	err = queryParentage(tx, "parentage_datasetparents", datasetID, func(rows *sql.Rows) error {
+		var pid int64
+		var name string
+		if err := rows.Scan(&pid, &name); err != nil {
+			return err
+		}
+		datasetParents[pid] = name
+		return nil
+	})
+	if err != nil {
+		return p, err
+	}
+
+	// block and dataset parents derived from file parents
+	fileDatasetParents := make(map[int64]string)
+	err = queryParentage(tx, "parentage_derived", datasetID, func(rows *sql.Rows) error {
+		var bid, pbid, pdid int64
+		var block, parentBlock, parentDataset string
+		if err := rows.Scan(&bid, &block, &pbid, &parentBlock, &pdid, &parentDataset); err != nil {
+			return err
+		}
+		if pdid != datasetID {
+			fileDatasetParents[pdid] = parentDataset
+		}
+		ids := [2]int64{bid, pbid}
+		if !blockParents[ids] {
+			blockParents[ids] = true
+			p.blockParents = append(p.blockParents, ids)
+			p.check.MissingBlockParents = append(p.check.MissingBlockParents,
+				BlockParent{ThisBlockName: block, ParentBlockName: parentBlock})
+		}
+		return nil
+	})
+	if err != nil {
+		return p, err
+	}
+	for pid, name := range fileDatasetParents {
+		if _, ok := datasetParents[pid]; !ok {
+			p.datasetParents = append(p.datasetParents, pid)
+			p.check.MissingDatasetParents = append(p.check.MissingDatasetParents, name)
+		}
+	}
+	for pid, name := range datasetParents {
+		if _, ok := fileDatasetParents[pid]; !ok {
+			p.check.DatasetParentsWithoutFiles = append(p.check.DatasetParentsWithoutFiles, name)
+		}
+	}
+	sort.Slice(p.datasetParents, func(i, j int) bool { return p.datasetParents[i] < p.datasetParents[j] })
+	sort.Strings(p.check.MissingDatasetParents)
+	sort.Strings(p.check.DatasetParentsWithoutFiles)
+
+	// file parents pointing to invalid files
+	err = queryParentage(tx, "parentage_invalidfiles", datasetID, func(rows *sql.Rows) error {
+		var r FileParentRecord
+		if err := rows.Scan(&r.ThisLogicalFileName, &r.ParentLogicalFileName); err != nil {
+			return err
+		}
+		p.check.InvalidFileParents = append(p.check.InvalidFileParents, r)
+		return nil
+	})
+	if err != nil {
+		return p, err
+	}
+	p.check.Consistent = len(p.check.MissingDatasetParents) == 0 &&
+		len(p.check.DatasetParentsWithoutFiles) == 0 &&
+		len(p.check.MissingBlockParents) == 0 &&
+		len(p.check.InvalidFileParents) == 0
+	return p, nil
+}
+
+// helper function to execute parentage query of given dataset and scan
+// its rows with given function
+func queryParentage(tx *sql.Tx, key string, datasetID int64, scan func(rows *sql.Rows) error) error {
+	stm := CleanStatement(getSQL(key))
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, []interface{}{datasetID}, "execute")
+	}
+	rows, err := tx.Query(stm, datasetID)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return Error(err, QueryErrorCode, "", "dbs.parentagecheck.queryParentage")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return Error(err, RowsScanErrorCode, "", "dbs.parentagecheck.queryParentage")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Error(err, RowsScanErrorCode, "", "dbs.parentagecheck.queryParentage")
+	}
+	return nil
+}
@@ -0,0 +1,537 @@
+package dbs
+
+// parentagejobs module provides server side derivation of file parentage
+//
+// The parentage job takes child dataset and its parent datasets and finds
+// parents of every child file by overlap of their run and lumi sections.
+// The job runs in background and processes child blocks in order of their
+// names. The file parents are inserted in chunks and the name of the last
+// processed block is stored along with the job progress in PARENTAGE_JOBS
+// table, therefore failed or interrupted job can be resumed from it. Once
+// all blocks are processed the block and dataset parents are derived from
+// inserted file parents. The job is claimed in PARENTAGE_JOBS table such
+// that it runs only once across all servers, the running job whose progress
+// is not updated within ParentageJobLease is considered as interrupted and
+// can be resumed.
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// ParentageChunkSize defines number of file parents inserted by parentage
+// job within single transaction
+var ParentageChunkSize = 1000
+
+// statuses of parentage jobs
+const (
+	ParentageJobRunning = "running" // job is in progress
+	ParentageJobDone    = "done"    // job is completed
+	ParentageJobFailed  = "failed"  // job is failed and can be resumed
+)
+
+// ParentageJobLease defines how long (in seconds) running parentage job is
+// claimed without update of its progress, afterwards it can be resumed
+var ParentageJobLease int64 = 600
+
+// ParentageJobRecord represents parentage job
+type ParentageJobRecord struct {
+	JOB_ID                 int64  `json:"job_id"`
+	DATASET                string `json:"dataset" validate:"required"`
+	PARENT_DATASETS        string `json:"parent_datasets" validate:"required"`
+	STATUS                 string `json:"status" validate:"required"`
+	LAST_BLOCK_NAME        string `json:"last_block_name"`
+	NBLOCKS                int64  `json:"nblocks"`
+	NBLOCKS_DONE           int64  `json:"nblocks_done"`
+	NFILE_PARENTS          int64  `json:"nfile_parents"`
+	ERROR_MESSAGE          string `json:"error_message"`
+	CREATION_DATE          int64  `json:"creation_date" validate:"required,number"`
+	LAST_MODIFICATION_DATE int64  `json:"last_modification_date" validate:"required,number"`
+	CREATE_BY              string `json:"create_by" validate:"required"`
+}
+
+// ParentageJobInput represents input of parentage job API, the job_id
+// resumes existing job while dataset and parent_datasets submit new job
+type ParentageJobInput struct {
+	JobID          int64    `json:"job_id"`
+	Dataset        string   `json:"dataset"`
+	ParentDatasets []string `json:"parent_datasets"`
+}
+
+// Insert implementation of ParentageJobRecord
+func (r *ParentageJobRecord) Insert(tx *sql.Tx) error {
+	var tid int64
+	var err error
+	if r.JOB_ID == 0 {
+		if DBOWNER == "sqlite" {
+			tid, err = LastInsertID(tx, "PARENTAGE_JOBS", "job_id")
+			r.JOB_ID = tid + 1
+		} else {
+			tid, err = IncrementSequence(tx, "SEQ_PJ")
+			r.JOB_ID = tid
+		}
+		if err != nil {
+			return Error(err, LastInsertErrorCode, "", "dbs.parentagejobs.Insert")
+		}
+	}
+	// set defaults and validate the record
+	r.SetDefaults()
+	err = r.Validate()
+	if err != nil {
+		log.Println("unable to validate record", err)
+		return Error(err, ValidateErrorCode, "", "dbs.parentagejobs.Insert")
+	}
+
+	// get SQL statement from static area
+	stm := getSQL("insert_parentage_job")
+	if utils.VERBOSE > 0 {
+		log.Printf("Insert ParentageJobs\n%s\n%+v", stm, r)
+	}
+	_, err = tx.Exec(stm,
+		r.JOB_ID, r.DATASET, r.PARENT_DATASETS, r.STATUS, r.LAST_BLOCK_NAME,
+		r.NBLOCKS, r.NBLOCKS_DONE, r.NFILE_PARENTS, r.ERROR_MESSAGE,
+		r.CREATION_DATE, r.LAST_MODIFICATION_DATE, r.CREATE_BY)
+	if err != nil {
+		return Error(err, InsertErrorCode, "", "dbs.parentagejobs.Insert")
+	}
+	return nil
+}
+
+// Update updates status and progress of parentage job
+func (r *ParentageJobRecord) Update(tx *sql.Tx) error {
+	r.LAST_MODIFICATION_DATE = Date()
+	stm := getSQL("update_parentage_job")
+	if utils.VERBOSE > 1 {
+		log.Printf("Update ParentageJobs\n%s\n%+v", stm, r)
+	}
+	_, err := tx.Exec(stm,
+		r.STATUS, r.LAST_BLOCK_NAME, r.NBLOCKS_DONE, r.NFILE_PARENTS,
+		r.ERROR_MESSAGE, r.LAST_MODIFICATION_DATE, r.JOB_ID)
+	if err != nil {
+		return Error(err, UpdateErrorCode, "", "dbs.parentagejobs.Update")
+	}
+	return nil
+}
+
+// Validate implementation of ParentageJobRecord
+func (r *ParentageJobRecord) Validate() error {
+	if err := RecordValidator.Struct(*r); err != nil {
+		return DecodeValidatorError(r, err)
+	}
+	return nil
+}
+
+// SetDefaults implements set defaults for ParentageJobRecord
+func (r *ParentageJobRecord) SetDefaults() {
+	if r.CREATION_DATE == 0 {
+		r.CREATION_DATE = Date()
+	}
+	if r.LAST_MODIFICATION_DATE == 0 {
+		r.LAST_MODIFICATION_DATE = r.CREATION_DATE
+	}
+	if r.STATUS == "" {
+		r.STATUS = ParentageJobRunning
+	}
+}
+
+// ParentageJobs DBS API provides status and progress of parentage jobs
+func (a *API) ParentageJobs() error {
+	var args []interface{}
+	var conds []string
+
+	conds, args = AddParam("job_id", "J.JOB_ID", a.Params, conds, args)
+	conds, args = AddParam("dataset", "J.DATASET", a.Params, conds, args)
+	conds, args = AddParam("status", "J.STATUS", a.Params, conds, args)
+
+	// get SQL statement from static area
+	stm := getSQL("parentage_jobs")
+	stm = WhereClause(stm, conds)
+	stm += " ORDER BY J.JOB_ID"
+
+	// use generic query API to fetch the results from DB
+	err := executeAll(a.Writer, a.Separator, stm, args...)
+	if err != nil {
+		return Error(err, QueryErrorCode, "", "dbs.parentagejobs.ParentageJobs")
+	}
+	return nil
+}
+
+// SubmitParentageJob DBS API submits new parentage job for given child
+// dataset and its parent datasets or resumes existing job with given id.
+// The job runs in background and API returns its record.
+//
+//gocyclo:ignore
+func (a *API) SubmitParentageJob() error {
+	data, err := io.ReadAll(a.Reader)
+	if err != nil {
+		log.Println("fail to read data", err)
+		return Error(err, ReaderErrorCode, "", "dbs.parentagejobs.SubmitParentageJob")
+	}
+	var rec ParentageJobInput
+	if err := json.Unmarshal(data, &rec); err != nil {
+		log.Println("fail to decode data as ParentageJobInput", err)
+		return Error(err, UnmarshalErrorCode, "", "dbs.parentagejobs.SubmitParentageJob")
+	}
+
+	var job ParentageJobRecord
+	if rec.JobID > 0 {
+		job, err = resumeParentageJob(rec.JobID)
+	} else {
+		job, err = a.newParentageJob(rec)
+	}
+	if err != nil {
+		return err
+	}
+	go runParentageJob(job)
+
+	if a.Writer != nil {
+		data, err := parentageJobResponse(job)
+		if err != nil {
+			return err
+		}
+		a.Writer.Write(data)
+	}
+	return nil
+}
+
+// helper function to encode response of parentage job API
+func parentageJobResponse(job ParentageJobRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(job); err != nil {
+		return nil, Error(err, EncodeErrorCode, "", "dbs.parentagejobs.parentageJobResponse")
+	}
+	return buf.Bytes(), nil
+}
+
+// helper function to create new parentage job, the job is committed along
+// with API hook
+func (a *API) newParentageJob(rec ParentageJobInput) (ParentageJobRecord, error) {
+	var job ParentageJobRecord
+	if rec.Dataset == "" || len(rec.ParentDatasets) == 0 {
+		msg := "parentage job requires dataset and parent_datasets"
+		return job, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagejobs.newParentageJob")
+	}
+	for _, d := range append(rec.ParentDatasets, rec.Dataset) {
+		if strings.Contains(d, "*") || strings.Contains(d, ",") {
+			msg := fmt.Sprintf("invalid dataset %s of parentage job", d)
+			return job, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagejobs.newParentageJob")
+		}
+	}
+	for _, d := range rec.ParentDatasets {
+		if d == rec.Dataset {
+			msg := "dataset can not be parent of itself"
+			return job, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagejobs.newParentageJob")
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return job, Error(err, TransactionErrorCode, "", "dbs.parentagejobs.newParentageJob")
+	}
+	defer tx.Rollback()
+	for _, d := range append(rec.ParentDatasets, rec.Dataset) {
+		if _, err := GetID(tx, "DATASETS", "DATASET_ID", "DATASET", d); err != nil {
+			msg := fmt.Sprintf("unable to find dataset %s", d)
+			return job, Error(err, QueryErrorCode, msg, "dbs.parentagejobs.newParentageJob")
+		}
+	}
+	blocks, err := parentageJobBlocks(tx, rec.Dataset, "")
+	if err != nil {
+		return job, err
+	}
+	job = ParentageJobRecord{
+		DATASET:         rec.Dataset,
+		PARENT_DATASETS: strings.Join(utils.Set(rec.ParentDatasets), ","),
+		STATUS:          ParentageJobRunning,
+		NBLOCKS:         int64(len(blocks)),
+		CREATE_BY:       a.CreateBy,
+	}
+	if err := job.Insert(tx); err != nil {
+		return job, err
+	}
+	response, err := parentageJobResponse(job)
+	if err != nil {
+		return job, err
+	}
+	if err := a.commit(tx, response); err != nil {
+		return job, Error(err, CommitErrorCode, "", "dbs.parentagejobs.newParentageJob")
+	}
+	return job, nil
+}
+
+// helper function to resume parentage job with given id, the job is claimed
+// unless it is completed or it is running and its progress is updated
+// within ParentageJobLease
+func resumeParentageJob(jobID int64) (ParentageJobRecord, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return ParentageJobRecord{}, Error(err, TransactionErrorCode, "", "dbs.parentagejobs.resumeParentageJob")
+	}
+	defer tx.Rollback()
+	job, err := getParentageJob(tx, jobID)
+	if err != nil {
+		return job, err
+	}
+	if job.STATUS == ParentageJobDone {
+		msg := fmt.Sprintf("parentage job %d is already completed", jobID)
+		return job, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagejobs.resumeParentageJob")
+	}
+	// the job in running status may be interrupted, e.g. by server restart,
+	// the conditional update claims it only if it does not run elsewhere
+	job.STATUS = ParentageJobRunning
+	job.ERROR_MESSAGE = ""
+	job.LAST_MODIFICATION_DATE = Date()
+	stm := getSQL("claim_parentage_job")
+	args := []interface{}{
+		job.STATUS, job.ERROR_MESSAGE, job.LAST_MODIFICATION_DATE, jobID,
+		ParentageJobDone, ParentageJobRunning, job.LAST_MODIFICATION_DATE - ParentageJobLease}
+	if utils.VERBOSE > 0 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	res, err := tx.Exec(stm, args...)
+	if err != nil {
+		return job, Error(err, UpdateErrorCode, "", "dbs.parentagejobs.resumeParentageJob")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		msg := fmt.Sprintf("parentage job %d is already running", jobID)
+		return job, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.parentagejobs.resumeParentageJob")
+	}
+	if err := tx.Commit(); err != nil {
+		return job, Error(err, CommitErrorCode, "", "dbs.parentagejobs.resumeParentageJob")
+	}
+	return job, nil
+}
+
+// helper function to get parentage job with given id
+func getParentageJob(tx *sql.Tx, jobID int64) (ParentageJobRecord, error) {
+	var job ParentageJobRecord
+	stm := getSQL("parentage_jobs")
+	stm = WhereClause(stm, []string{fmt.Sprintf("J.JOB_ID = %s", placeholder("job_id"))})
+	var lastBlock, parents, errMsg sql.NullString
+	err := tx.QueryRow(stm, jobID).Scan(
+		&job.JOB_ID, &job.DATASET, &parents, &job.STATUS, &lastBlock,
+		&job.NBLOCKS, &job.NBLOCKS_DONE, &job.NFILE_PARENTS, &errMsg,
+		&job.CREATION_DATE, &job.LAST_MODIFICATION_DATE, &job.CREATE_BY)
+	if err != nil {
+		msg := fmt.Sprintf("unable to find parentage job %d", jobID)
+		return job, Error(err, QueryErrorCode, msg, "dbs.parentagejobs.getParentageJob")
+	}
+	job.PARENT_DATASETS = parents.String
+	job.LAST_BLOCK_NAME = lastBlock.String
+	job.ERROR_MESSAGE = errMsg.String
+	return job, nil
+}
+
+// helper function to run parentage job and record its failure
+func runParentageJob(job ParentageJobRecord) {
+	err := processParentageJob(&job)
+	if err == nil {
+		return
+	}
+	log.Printf("parentage job %d of %s failed, error %v", job.JOB_ID, job.DATASET, err)
+	job.STATUS = ParentageJobFailed
+	job.ERROR_MESSAGE = err.Error()
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Println("unable to begin transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	if err := job.Update(tx); err != nil {
+		log.Printf("unable to update parentage job %d, error %v", job.JOB_ID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("unable to update parentage job %d, error %v", job.JOB_ID, err)
+	}
+}
+
+// helper function to process child blocks of parentage job starting from
+// its last processed block
+//
+//gocyclo:ignore
+func processParentageJob(job *ParentageJobRecord) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.parentagejobs.processParentageJob")
+	}
+	var pids []string
+	for _, d := range strings.Split(job.PARENT_DATASETS, ",") {
+		pid, err := GetID(tx, "DATASETS", "DATASET_ID", "DATASET", d)
+		if err != nil {
+			tx.Rollback()
+			msg := fmt.Sprintf("unable to find dataset %s", d)
+			return Error(err, QueryErrorCode, msg, "dbs.parentagejobs.processParentageJob")
+		}
+		pids = append(pids, fmt.Sprintf("%d", pid))
+	}
+	blocks, err := parentageJobBlocks(tx, job.DATASET, job.LAST_BLOCK_NAME)
+	tx.Rollback()
+	if err != nil {
+		return err
+	}
+
+	chunkSize := ParentageChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+	insertStm := getSQL("insert_fileparents")
+	args := []string{"this_file_id", "parent_file_id"}
+	for _, blk := range blocks {
+		pairs, err := parentageJobLumis(blk.id, pids)
+		if err != nil {
+			return err
+		}
+		// insert file parents in chunks, the last chunk of the block
+		// updates job progress, therefore the block is either completed
+		// or it is processed again when job is resumed
+		for k := 0; k == 0 || k < len(pairs); k = k + chunkSize {
+			size := k + chunkSize
+			if size > len(pairs) {
+				size = len(pairs)
+			}
+			tx, err := DB.Begin()
+			if err != nil {
+				return Error(err, TransactionErrorCode, "", "dbs.parentagejobs.processParentageJob")
+			}
+			var nparents int64
+			for _, ids := range pairs[k:size] {
+				if IfExistMulti(tx, "FILE_PARENTS", "this_file_id", args, ids[0], ids[1]) {
+					continue
+				}
+				if _, err := tx.Exec(insertStm, ids[0], ids[1]); err != nil {
+					tx.Rollback()
+					log.Printf("unable to insert file parents %v, error %v", ids, err)
+					return Error(err, InsertErrorCode, "", "dbs.parentagejobs.processParentageJob")
+				}
+				nparents++
+			}
+			job.NFILE_PARENTS += nparents
+			if size == len(pairs) {
+				job.LAST_BLOCK_NAME = blk.name
+				job.NBLOCKS_DONE++
+			}
+			if err := job.Update(tx); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				tx.Rollback()
+				return Error(err, CommitErrorCode, "", "dbs.parentagejobs.processParentageJob")
+			}
+		}
+		if utils.VERBOSE > 0 {
+			log.Printf("parentage job %d: block %s, %d/%d blocks, %d file parents",
+				job.JOB_ID, blk.name, job.NBLOCKS_DONE, job.NBLOCKS, job.NFILE_PARENTS)
+		}
+	}
+
+	// derive block and dataset parents from file parents
+	tx, err = DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.parentagejobs.processParentageJob")
+	}
+	defer tx.Rollback()
+	if _, err := repairParentage(tx, job.DATASET); err != nil {
+		return err
+	}
+	job.STATUS = ParentageJobDone
+	if err := job.Update(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return Error(err, CommitErrorCode, "", "dbs.parentagejobs.processParentageJob")
+	}
+	return nil
+}
+
+// parentageBlock represents child block of parentage job
+type parentageBlock struct {
+	id   int64
+	name string
+}
+
+// helper function to get blocks of dataset following given block name
+func parentageJobBlocks(tx *sql.Tx, dataset, lastBlock string) ([]parentageBlock, error) {
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["LastBlockName"] = lastBlock != ""
+	stm, err := LoadTemplateSQL("parentage_job_blocks", tmpl)
+	if err != nil {
+		return nil, Error(err, LoadErrorCode, "", "dbs.parentagejobs.parentageJobBlocks")
+	}
+	stm = CleanStatement(stm)
+	args := []interface{}{dataset}
+	if lastBlock != "" {
+		args = append(args, lastBlock)
+	}
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	rows, err := tx.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return nil, Error(err, QueryErrorCode, "", "dbs.parentagejobs.parentageJobBlocks")
+	}
+	defer rows.Close()
+	var blocks []parentageBlock
+	for rows.Next() {
+		var b parentageBlock
+		if err := rows.Scan(&b.id, &b.name); err != nil {
+			return nil, Error(err, RowsScanErrorCode, "", "dbs.parentagejobs.parentageJobBlocks")
+		}
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error(err, RowsScanErrorCode, "", "dbs.parentagejobs.parentageJobBlocks")
+	}
+	return blocks, nil
+}
+
+// helper function to get pairs of child file of given block and its parent
+// files of given parent datasets which share run and lumi section
+func parentageJobLumis(blockID int64, pids []string) ([][2]int64, error) {
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["TokenCondition"] = TokenCondition()
+	token, binds := TokenGenerator(pids, 100, "pds_token")
+	tmpl["TokenGenerator"] = token
+	stm, err := LoadTemplateSQL("parentage_job_lumis", tmpl)
+	if err != nil {
+		return nil, Error(err, LoadErrorCode, "", "dbs.parentagejobs.parentageJobLumis")
+	}
+	stm = CleanStatement(stm)
+	var args []interface{}
+	for _, v := range binds {
+		args = append(args, v)
+	}
+	args = append(args, blockID)
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "execute")
+	}
+	rows, err := DB.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return nil, Error(err, QueryErrorCode, "", "dbs.parentagejobs.parentageJobLumis")
+	}
+	defer rows.Close()
+	var pairs [][2]int64
+	for rows.Next() {
+		var ids [2]int64
+		if err := rows.Scan(&ids[0], &ids[1]); err != nil {
+			return nil, Error(err, RowsScanErrorCode, "", "dbs.parentagejobs.parentageJobLumis")
+		}
+		pairs = append(pairs, ids)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error(err, RowsScanErrorCode, "", "dbs.parentagejobs.parentageJobLumis")
+	}
+	return pairs, nil
+}
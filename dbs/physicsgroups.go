@@ -112,7 +112,7 @@ func (r *PhysicsGroups) Decode(reader io.Reader) error {
 
 // InsertPhysicsGroups DBS API
 func (a *API) InsertPhysicsGroups() error {
-	err := insertRecord(&PhysicsGroups{}, a.Reader)
+	err := a.insertRecord(&PhysicsGroups{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.physicsgroups.InsertPhysicsGroups")
 	}
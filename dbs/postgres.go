@@ -0,0 +1,134 @@
+package dbs
+
+// postgres module provides PostgreSQL backend support
+//
+// DBS SQL statements use ORACLE style bind variables, e.g. :name, which
+// PostgreSQL drivers do not understand. Instead of converting every
+// statement in DBS code we wrap PostgreSQL driver connections and rewrite
+// bind variables into PostgreSQL positional ones, e.g. $1, right before
+// statements are sent to the database.
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// IsPostgres returns true if DBS uses PostgreSQL backend
+func IsPostgres() bool {
+	return isPostgresDriver(DBTYPE)
+}
+
+// helper function to check if given database/sql driver name belongs to PostgreSQL
+func isPostgresDriver(dbtype string) bool {
+	return dbtype == "postgres" || dbtype == "pgx"
+}
+
+// OpenDB opens database for given database/sql driver name and uri.
+// For PostgreSQL drivers returned database rewrites ORACLE style bind
+// variables of DBS SQL statements into PostgreSQL positional ones.
+func OpenDB(dbtype, dburi string) (*sql.DB, error) {
+	db, err := sql.Open(dbtype, dburi)
+	if err != nil || !isPostgresDriver(dbtype) {
+		return db, err
+	}
+	drv := db.Driver()
+	db.Close()
+	return sql.OpenDB(&bindsConnector{driver: drv, dsn: dburi}), nil
+}
+
+// bindsConnector implements driver.Connector interface for PostgreSQL driver
+type bindsConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+// Connect implements driver.Connector interface
+func (c *bindsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &bindsConn{Conn: conn}, nil
+}
+
+// Driver implements driver.Connector interface
+func (c *bindsConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// bindsConn represents PostgreSQL driver connection which rewrites bind
+// variables of all statements
+type bindsConn struct {
+	driver.Conn
+}
+
+// Prepare implements driver.Conn interface
+func (c *bindsConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(utils.ReplacePostgresBinds(query))
+}
+
+// PrepareContext implements driver.ConnPrepareContext interface
+func (c *bindsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = utils.ReplacePostgresBinds(query)
+	if conn, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return conn.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx implements driver.ConnBeginTx interface
+func (c *bindsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if conn, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return conn.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// QueryContext implements driver.QueryerContext interface
+func (c *bindsConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue) (driver.Rows, error) {
+	if conn, ok := c.Conn.(driver.QueryerContext); ok {
+		return conn.QueryContext(ctx, utils.ReplacePostgresBinds(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// ExecContext implements driver.ExecerContext interface
+func (c *bindsConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue) (driver.Result, error) {
+	if conn, ok := c.Conn.(driver.ExecerContext); ok {
+		return conn.ExecContext(ctx, utils.ReplacePostgresBinds(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// ResetSession implements driver.SessionResetter interface
+func (c *bindsConn) ResetSession(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.SessionResetter); ok {
+		return conn.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator interface
+func (c *bindsConn) IsValid() bool {
+	if conn, ok := c.Conn.(driver.Validator); ok {
+		return conn.IsValid()
+	}
+	return true
+}
+
+// Ping implements driver.Pinger interface
+func (c *bindsConn) Ping(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.Pinger); ok {
+		return conn.Ping(ctx)
+	}
+	return nil
+}
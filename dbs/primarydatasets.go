@@ -189,7 +189,7 @@ func (a *API) InsertPrimaryDatasets() error {
 	}
 
 	// commit transaction
-	err = tx.Commit()
+	err = a.commit(tx, []byte(`[]`))
 	if err != nil {
 		log.Println("fail to insert primarydatasets", err)
 		return Error(err, CommitErrorCode, "", "dbs.primarydatasets.InsertPrimaryDatasets")
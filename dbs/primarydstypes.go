@@ -92,7 +92,7 @@ func (r *PrimaryDSTypes) Decode(reader io.Reader) error {
 
 // InsertPrimaryDSTypes DBS API
 func (a *API) InsertPrimaryDSTypes() error {
-	err := insertRecord(&PrimaryDSTypes{}, a.Reader)
+	err := a.insertRecord(&PrimaryDSTypes{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.primarydstypes.InsertPrimaryDSTypes")
 	}
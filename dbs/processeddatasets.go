@@ -101,7 +101,7 @@ func (r *ProcessedDatasets) Decode(reader io.Reader) error {
 
 // InsertProcessedDatasets DBS API
 func (a *API) InsertProcessedDatasets() error {
-	err := insertRecord(&ProcessedDatasets{}, a.Reader)
+	err := a.insertRecord(&ProcessedDatasets{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.processeddatasets.InsertProcessedDatasets")
 	}
@@ -130,7 +130,7 @@ func (r *ProcessingEras) Decode(reader io.Reader) error {
 
 // InsertProcessingEras DBS API
 func (a *API) InsertProcessingEras() error {
-	err := insertRecord(&ProcessingEras{CREATE_BY: a.CreateBy}, a.Reader)
+	err := a.insertRecord(&ProcessingEras{CREATE_BY: a.CreateBy}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.processingeras.InsertProcessingEras")
 	}
@@ -0,0 +1,287 @@
+package dbs
+
+// provenance module provides provenance graph of datasets and files
+//
+// The graph is built by walking DATASET_PARENTS or FILE_PARENTS tables
+// level by level either up (towards parents) or down (towards children)
+// of the root dataset or file. Every node is visited once, therefore the
+// walk always terminates, while cycles of parentage are reported
+// separately. The number of nodes is limited to handle very wide fan-out,
+// e.g. pile-up parents of files, in which case the graph is truncated.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// ProvenanceMaxNodes defines maximum number of nodes of provenance graph
+var ProvenanceMaxNodes = 10000
+
+// DotContentType defines content type of GraphViz DOT output
+const DotContentType = "text/vnd.graphviz"
+
+// ProvenanceNode represents dataset or file of provenance graph
+type ProvenanceNode struct {
+	Name  string `json:"name"`
+	Level int    `json:"level"` // distance from the root node
+}
+
+// ProvenanceEdge represents parentage relation of provenance graph
+type ProvenanceEdge struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+}
+
+// Provenance represents provenance graph of dataset or file
+type Provenance struct {
+	Root      string           `json:"root"`
+	Type      string           `json:"type"`
+	Direction string           `json:"direction"`
+	Depth     int              `json:"depth"`
+	Nodes     []ProvenanceNode `json:"nodes"`
+	Edges     []ProvenanceEdge `json:"edges"`
+	Cycles    []ProvenanceEdge `json:"cycles"`
+	Truncated bool             `json:"truncated"`
+}
+
+// Provenance DBS API provides provenance graph of dataset or file. It takes
+// the following parameters: dataset or logical_file_name, direction (up or
+// down), depth (0 means no limit), max_nodes and format (json or dot).
+//
+//gocyclo:ignore
+func (a *API) Provenance() error {
+	datasets := getValues(a.Params, "dataset")
+	lfns := getValues(a.Params, "logical_file_name")
+	if len(datasets)+len(lfns) != 1 {
+		msg := "provenance API requires either single dataset or logical_file_name parameter"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.provenance.Provenance")
+	}
+	graph := Provenance{Direction: "up", Nodes: []ProvenanceNode{}, Edges: []ProvenanceEdge{}, Cycles: []ProvenanceEdge{}}
+	var table, id, attr, tmplName string
+	if len(datasets) == 1 {
+		graph.Root, graph.Type = datasets[0], "dataset"
+		table, id, attr, tmplName = "DATASETS", "DATASET_ID", "DATASET", "provenance_datasets"
+	} else {
+		graph.Root, graph.Type = lfns[0], "file"
+		table, id, attr, tmplName = "FILES", "FILE_ID", "LOGICAL_FILE_NAME", "provenance_files"
+	}
+	if strings.Contains(graph.Root, "*") {
+		msg := "wild-card dataset or logical_file_name value is not allowed"
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.provenance.Provenance")
+	}
+	if v, err := getSingleValue(a.Params, "direction"); err == nil {
+		graph.Direction = v
+	}
+	if graph.Direction != "up" && graph.Direction != "down" {
+		msg := fmt.Sprintf("unsupported direction '%s', use up or down", graph.Direction)
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.provenance.Provenance")
+	}
+	depth, err := provenanceInt(a.Params, "depth", 0)
+	if err != nil {
+		return err
+	}
+	graph.Depth = depth
+	maxNodes, err := provenanceInt(a.Params, "max_nodes", ProvenanceMaxNodes)
+	if err != nil {
+		return err
+	}
+	if maxNodes == 0 || (ProvenanceMaxNodes > 0 && maxNodes > ProvenanceMaxNodes) {
+		maxNodes = ProvenanceMaxNodes
+	}
+	format := "json"
+	if v, err := getSingleValue(a.Params, "format"); err == nil {
+		format = v
+	}
+	if format != "json" && format != "dot" {
+		msg := fmt.Sprintf("unsupported format '%s', use json or dot", format)
+		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.provenance.Provenance")
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return Error(err, TransactionErrorCode, "", "dbs.provenance.Provenance")
+	}
+	defer tx.Rollback()
+	rootID, err := GetID(tx, table, id, attr, graph.Root)
+	if err != nil {
+		msg := fmt.Sprintf("unable to find %s %s", graph.Type, graph.Root)
+		return Error(err, QueryErrorCode, msg, "dbs.provenance.Provenance")
+	}
+
+	// walk parentage table level by level
+	names := map[int64]string{rootID: graph.Root}
+	graph.Nodes = append(graph.Nodes, ProvenanceNode{Name: graph.Root})
+	edges := make(map[[2]int64]bool)
+	tmpl := make(Record)
+	tmpl["Owner"] = DBOWNER
+	tmpl["Up"] = graph.Direction == "up"
+	tmpl["TokenCondition"] = TokenCondition()
+	stm, err := LoadTemplateSQL(tmplName, tmpl)
+	if err != nil {
+		return Error(err, LoadErrorCode, "", "dbs.provenance.Provenance")
+	}
+	frontier := []int64{rootID}
+	for level := 1; len(frontier) > 0 && (depth == 0 || level <= depth) && !graph.Truncated; level++ {
+		var ids []string
+		for _, fid := range frontier {
+			ids = append(ids, fmt.Sprintf("%d", fid))
+		}
+		token, binds := TokenGenerator(ids, 300, "ids_token")
+		query := CleanStatement(fmt.Sprintf("%s %s", token, stm))
+		var args []interface{}
+		for _, v := range binds {
+			args = append(args, v)
+		}
+		if utils.VERBOSE > 1 {
+			utils.PrintSQL(query, args, "execute")
+		}
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			log.Printf("unable to query statement: %v", query)
+			return Error(err, QueryErrorCode, "", "dbs.provenance.Provenance")
+		}
+		var next []int64
+		for rows.Next() {
+			var childID, parentID int64
+			var name string
+			if err := rows.Scan(&childID, &parentID, &name); err != nil {
+				rows.Close()
+				return Error(err, RowsScanErrorCode, "", "dbs.provenance.Provenance")
+			}
+			nodeID := parentID
+			if graph.Direction == "down" {
+				nodeID = childID
+			}
+			if _, ok := names[nodeID]; !ok {
+				if maxNodes > 0 && len(names) >= maxNodes {
+					graph.Truncated = true
+					break
+				}
+				names[nodeID] = name
+				graph.Nodes = append(graph.Nodes, ProvenanceNode{Name: name, Level: level})
+				next = append(next, nodeID)
+			}
+			edges[[2]int64{parentID, childID}] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return Error(err, RowsScanErrorCode, "", "dbs.provenance.Provenance")
+		}
+		frontier = next
+	}
+
+	// sort edges to provide stable output
+	var keys [][2]int64
+	for k := range edges {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		graph.Edges = append(graph.Edges, ProvenanceEdge{Parent: names[k[0]], Child: names[k[1]]})
+	}
+	for _, k := range provenanceCycles(rootID, keys, graph.Direction == "up") {
+		graph.Cycles = append(graph.Cycles, ProvenanceEdge{Parent: names[k[0]], Child: names[k[1]]})
+	}
+	if utils.VERBOSE > 0 {
+		log.Printf("provenance of %s %s: %d nodes, %d edges, %d cycles, truncated %v",
+			graph.Type, graph.Root, len(graph.Nodes), len(graph.Edges), len(graph.Cycles), graph.Truncated)
+	}
+
+	if a.Writer == nil {
+		return nil
+	}
+	if format == "dot" {
+		err = graph.WriteDot(a.Writer)
+	} else {
+		err = json.NewEncoder(a.Writer).Encode(graph)
+	}
+	if err != nil {
+		return Error(err, EncodeErrorCode, "", "dbs.provenance.Provenance")
+	}
+	return nil
+}
+
+// WriteDot writes GraphViz DOT rendering of provenance graph
+func (p *Provenance) WriteDot(w io.Writer) error {
+	cycles := make(map[ProvenanceEdge]bool)
+	for _, e := range p.Cycles {
+		cycles[e] = true
+	}
+	var b strings.Builder
+	b.WriteString("digraph provenance {\n")
+	fmt.Fprintf(&b, "  %q [shape=box, style=bold];\n", p.Root)
+	for _, n := range p.Nodes[1:] {
+		fmt.Fprintf(&b, "  %q;\n", n.Name)
+	}
+	for _, e := range p.Edges {
+		if cycles[e] {
+			fmt.Fprintf(&b, "  %q -> %q [color=red];\n", e.Parent, e.Child)
+		} else {
+			fmt.Fprintf(&b, "  %q -> %q;\n", e.Parent, e.Child)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// helper function to get integer parameter of provenance API
+func provenanceInt(params Record, key string, value int) (int, error) {
+	v, err := getSingleValue(params, key)
+	if err != nil {
+		return value, nil
+	}
+	val, err := strconv.Atoi(v)
+	if err != nil || val < 0 {
+		msg := fmt.Sprintf("invalid %s value '%s'", key, v)
+		return 0, Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.provenance.provenanceInt")
+	}
+	return val, nil
+}
+
+// helper function to find edges closing cycles of provenance graph, i.e.
+// back edges of depth-first walk from the root node in walk direction
+func provenanceCycles(root int64, edges [][2]int64, up bool) [][2]int64 {
+	adj := make(map[int64][]int64)
+	for _, e := range edges {
+		if up {
+			adj[e[1]] = append(adj[e[1]], e[0])
+		} else {
+			adj[e[0]] = append(adj[e[0]], e[1])
+		}
+	}
+	var cycles [][2]int64
+	// 1 means node is on the current path, 2 means node is done
+	state := make(map[int64]int)
+	var visit func(node int64)
+	visit = func(node int64) {
+		state[node] = 1
+		for _, next := range adj[node] {
+			switch state[next] {
+			case 0:
+				visit(next)
+			case 1:
+				if up {
+					cycles = append(cycles, [2]int64{next, node})
+				} else {
+					cycles = append(cycles, [2]int64{node, next})
+				}
+			}
+		}
+		state[node] = 2
+	}
+	visit(root)
+	return cycles
+}
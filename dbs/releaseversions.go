@@ -124,7 +124,7 @@ func (r *ReleaseVersions) Decode(reader io.Reader) error {
 
 // InsertReleaseVersions DBS API
 func (a *API) InsertReleaseVersions() error {
-	err := insertRecord(&ReleaseVersions{}, a.Reader)
+	err := a.insertRecord(&ReleaseVersions{}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.releaseversions.InsertReleaseVersions")
 	}
@@ -28,6 +28,17 @@ func (a *API) RunSummaries() error {
 		tmpl["Dataset"] = true
 		conds, args = AddParam("dataset", "DS.DATASET", a.Params, conds, args)
 	}
+
+	// lumi mask is joined with file lumis via temp table
+	mask, err := getLumiMask(a.Params)
+	if err != nil {
+		return Error(err, ParametersErrorCode, "", "dbs.runsummaries.RunSummaries")
+	}
+	maskTable := ""
+	if mask != nil {
+		maskTable = tempLumiMaskTable()
+		tmpl["LumiMask"] = maskTable
+	}
 	stm, err := LoadTemplateSQL("runsummaries", tmpl)
 	if err != nil {
 		return Error(err, LoadErrorCode, "", "dbs.runsummaries.RunSummaries")
@@ -44,14 +55,18 @@ func (a *API) RunSummaries() error {
 		}
 	} else if len(runs) == 1 {
 		conds, args = AddParam("run_num", "FL.RUN_NUM", a.Params, conds, args)
-	} else {
+	} else if mask == nil {
 		msg := fmt.Sprintf("No arguments for runsummaries API")
 		return Error(InvalidParamErr, ParametersErrorCode, msg, "dbs.runsummaries.RunSummaries")
 	}
 	stm = WhereClause(stm, conds)
 
 	// use generic query API to fetch the results from DB
-	err = executeAll(a.Writer, a.Separator, stm, args...)
+	if mask != nil {
+		err = executeLumiMask(a.Writer, a.Separator, stm, maskTable, mask, args...)
+	} else {
+		err = executeAll(a.Writer, a.Separator, stm, args...)
+	}
 	if err != nil {
 		return Error(err, QueryErrorCode, "", "dbs.runsummaries.RunSummaries")
 	}
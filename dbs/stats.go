@@ -52,6 +52,10 @@ func DBStats() (DBInfo, error) {
 
 	tmpl := make(Record)
 	tmpl["Owner"] = "CMS_DBS3%"
+	if IsPostgres() {
+		// PostgreSQL keeps DBS tables in owner schema
+		tmpl["Owner"] = DBOWNER
+	}
 
 	tx, err := DB.Begin()
 	if err != nil {
@@ -120,7 +120,7 @@ func (r *DataTiers) Decode(reader io.Reader) error {
 
 // InsertDataTiers DBS API
 func (a *API) InsertDataTiers() error {
-	err := insertRecord(&DataTiers{CREATE_BY: a.CreateBy}, a.Reader)
+	err := a.insertRecord(&DataTiers{CREATE_BY: a.CreateBy}, a.Reader)
 	if err != nil {
 		return Error(err, InsertErrorCode, "", "dbs.tiers.InsertDataTiers")
 	}
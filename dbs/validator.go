@@ -46,6 +46,7 @@ var intParameters = []string{
 	"max_ldate",
 	"datset_id",
 	"prep_id",
+	"as_of",
 }
 
 // DBS mix type parameters
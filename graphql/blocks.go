@@ -0,0 +1,205 @@
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/dmwm/dbs2go/dbs"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// BlockResolver provides block resolver
+type BlockResolver struct {
+	r     *Resolver
+	rec   dbs.Record // block record, may contain only block name
+	group *group     // sibling blocks
+}
+
+// helper function to get block resolver with details of given block
+func (r *Resolver) blockDetail(name string) (*BlockResolver, error) {
+	g := newGroup()
+	g.add(name)
+	b := &BlockResolver{r: r, rec: dbs.Record{"block_name": name}, group: g}
+	rec, err := b.detail()
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// helper function to get block name
+func (b *BlockResolver) name() string {
+	return keyOf(b.rec["block_name"])
+}
+
+// helper function to get block details, details of all sibling
+// blocks are loaded at once
+func (b *BlockResolver) detail() (dbs.Record, error) {
+	if _, ok := b.rec["block_id"]; ok {
+		return b.rec, nil
+	}
+	details, err := b.details()
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := details[b.name()]; ok {
+		return records[0], nil
+	}
+	return nil, nil
+}
+
+// helper function to load details of all sibling blocks
+func (b *BlockResolver) details() (map[string][]dbs.Record, error) {
+	return loadGroup(b.group, "detail", func(keys []string) (map[string][]dbs.Record, error) {
+		tmpl := dbs.Record{"Detail": true}
+		return b.r.fetch("blocks", tmpl, "B.BLOCK_NAME", keys, "block_name")
+	})
+}
+
+// helper function to get block detail record, it is empty for unknown block
+func (b *BlockResolver) values() dbs.Record {
+	rec, err := b.detail()
+	if err != nil || rec == nil {
+		return dbs.Record{}
+	}
+	return rec
+}
+
+// ID resolves the id field of block
+func (b *BlockResolver) ID() (graphql.ID, error) {
+	rec, err := b.detail()
+	if err != nil {
+		return "", err
+	}
+	if rec == nil {
+		return "", fmt.Errorf("unknown block %s", b.name())
+	}
+	return graphql.ID(keyOf(rec["block_id"])), nil
+}
+
+// Name resolves the name field of block
+func (b *BlockResolver) Name() string {
+	return b.name()
+}
+
+// OpenForWriting resolves the openForWriting field of block
+func (b *BlockResolver) OpenForWriting() *bool {
+	return recBool(b.values(), "open_for_writing")
+}
+
+// BlockSize resolves the blockSize field of block
+func (b *BlockResolver) BlockSize() *float64 {
+	return recFloat(b.values(), "block_size")
+}
+
+// FileCount resolves the fileCount field of block
+func (b *BlockResolver) FileCount() *int32 {
+	return recInt(b.values(), "file_count")
+}
+
+// OriginSiteName resolves the originSiteName field of block
+func (b *BlockResolver) OriginSiteName() *string {
+	return recString(b.values(), "origin_site_name")
+}
+
+// CreationDate resolves the creationDate field of block
+func (b *BlockResolver) CreationDate() *float64 {
+	return recFloat(b.values(), "creation_date")
+}
+
+// CreateBy resolves the createBy field of block
+func (b *BlockResolver) CreateBy() *string {
+	return recString(b.values(), "create_by")
+}
+
+// LastModificationDate resolves the lastModificationDate field of block
+func (b *BlockResolver) LastModificationDate() *float64 {
+	return recFloat(b.values(), "last_modification_date")
+}
+
+// LastModifiedBy resolves the lastModifiedBy field of block
+func (b *BlockResolver) LastModifiedBy() *string {
+	return recString(b.values(), "last_modified_by")
+}
+
+// Dataset resolves the dataset field of block
+func (b *BlockResolver) Dataset() (*DatasetResolver, error) {
+	datasets, err := loadGroup(b.group, "dataset", func([]string) (map[string]*DatasetResolver, error) {
+		details, err := b.details()
+		if err != nil {
+			return nil, err
+		}
+		return datasetsOf(b.r, details), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := datasets[b.name()]; ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("unknown block %s", b.name())
+}
+
+// Files resolves the files field of block
+func (b *BlockResolver) Files(args connArgs) (*connection[*FileResolver], error) {
+	field := fmt.Sprintf("files:%s", argsKey(args))
+	conns, err := loadGroup(b.group, field, func(keys []string) (map[string]*connection[*FileResolver], error) {
+		tmpl := dbs.Record{"Detail": true}
+		records, err := b.r.fetch("files", tmpl, "B.BLOCK_NAME", keys, "block_name", "F.IS_FILE_VALID <> -1")
+		if err != nil {
+			return nil, err
+		}
+		return connections(records, args, "logical_file_name", func(rec dbs.Record, g *group) *FileResolver {
+			return &FileResolver{r: b.r, rec: rec, group: g}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return connectionOf(conns, b.name()), nil
+}
+
+// Parents resolves the parents field of block
+func (b *BlockResolver) Parents() ([]*BlockResolver, error) {
+	parents, err := loadGroup(b.group, "parents", func(keys []string) (map[string][]*BlockResolver, error) {
+		records, err := b.r.fetch("blockparent", dbs.Record{}, "BC.BLOCK_NAME", keys, "this_block_name")
+		if err != nil {
+			return nil, err
+		}
+		return b.r.blockGroups(records, "parent_block_name"), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesOf(parents, b.name()), nil
+}
+
+// Children resolves the children field of block
+func (b *BlockResolver) Children() ([]*BlockResolver, error) {
+	children, err := loadGroup(b.group, "children", func(keys []string) (map[string][]*BlockResolver, error) {
+		records, err := b.r.fetch("blockparent", dbs.Record{}, "BP.BLOCK_NAME", keys, "parent_block_name")
+		if err != nil {
+			return nil, err
+		}
+		return b.r.blockGroups(records, "this_block_name"), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesOf(children, b.name()), nil
+}
+
+// helper function to convert grouped block records into block resolvers
+// which share the same group
+func (r *Resolver) blockGroups(records map[string][]dbs.Record, key string) map[string][]*BlockResolver {
+	g := newGroup()
+	out := make(map[string][]*BlockResolver)
+	for k, list := range records {
+		sortRecords(list, key)
+		for _, rec := range list {
+			name := keyOf(rec[key])
+			g.add(name)
+			out[k] = append(out[k], &BlockResolver{r: r, rec: dbs.Record{"block_name": name}, group: g})
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package graphql
+
+import (
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// OutputConfigResolver provides output module configuration resolver
+type OutputConfigResolver struct {
+	rec dbs.Record
+}
+
+// ReleaseVersion resolves the releaseVersion field of output config
+func (o *OutputConfigResolver) ReleaseVersion() *string {
+	return recString(o.rec, "release_version")
+}
+
+// PsetHash resolves the psetHash field of output config
+func (o *OutputConfigResolver) PsetHash() *string {
+	return recString(o.rec, "pset_hash")
+}
+
+// PsetName resolves the psetName field of output config
+func (o *OutputConfigResolver) PsetName() *string {
+	return recString(o.rec, "pset_name")
+}
+
+// AppName resolves the appName field of output config
+func (o *OutputConfigResolver) AppName() *string {
+	return recString(o.rec, "app_name")
+}
+
+// OutputModuleLabel resolves the outputModuleLabel field of output config
+func (o *OutputConfigResolver) OutputModuleLabel() *string {
+	return recString(o.rec, "output_module_label")
+}
+
+// GlobalTag resolves the globalTag field of output config
+func (o *OutputConfigResolver) GlobalTag() *string {
+	return recString(o.rec, "global_tag")
+}
+
+// CreationDate resolves the creationDate field of output config
+func (o *OutputConfigResolver) CreationDate() *float64 {
+	return recFloat(o.rec, "creation_date")
+}
+
+// CreateBy resolves the createBy field of output config
+func (o *OutputConfigResolver) CreateBy() *string {
+	return recString(o.rec, "create_by")
+}
@@ -1,20 +1,334 @@
 package graphql
 
 import (
-	"context"
-)
+	"fmt"
 
-// Dataset represents data model struct
-type Dataset struct {
-	Name string
-}
+	"github.com/dmwm/dbs2go/dbs"
+	graphql "github.com/graph-gophers/graphql-go"
+)
 
 // DatasetResolver provides dataset resolver
 type DatasetResolver struct {
-	d Dataset
+	r     *Resolver
+	rec   dbs.Record // dataset record, may contain only dataset name
+	group *group     // sibling datasets
+}
+
+// helper function to get dataset resolver with details of given dataset
+func (r *Resolver) datasetDetail(name string) (*DatasetResolver, error) {
+	g := newGroup()
+	g.add(name)
+	d := &DatasetResolver{r: r, rec: dbs.Record{"dataset": name}, group: g}
+	rec, err := d.detail()
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// helper function to get dataset name
+func (d *DatasetResolver) name() string {
+	return keyOf(d.rec["dataset"])
+}
+
+// helper function to get dataset details, details of all sibling
+// datasets are loaded at once
+func (d *DatasetResolver) detail() (dbs.Record, error) {
+	if _, ok := d.rec["dataset_id"]; ok {
+		return d.rec, nil
+	}
+	details, err := d.details()
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := details[d.name()]; ok {
+		return records[0], nil
+	}
+	return nil, nil
+}
+
+// helper function to load details of all sibling datasets
+func (d *DatasetResolver) details() (map[string][]dbs.Record, error) {
+	return loadGroup(d.group, "detail", func(keys []string) (map[string][]dbs.Record, error) {
+		tmpl := dbs.Record{"Detail": true}
+		return d.r.fetch("datasets", tmpl, "D.DATASET", keys, "dataset")
+	})
+}
+
+// helper function to get dataset detail record, it is empty for unknown dataset
+func (d *DatasetResolver) values() dbs.Record {
+	rec, err := d.detail()
+	if err != nil || rec == nil {
+		return dbs.Record{}
+	}
+	return rec
+}
+
+// ID resolves the id field of dataset
+func (d *DatasetResolver) ID() (graphql.ID, error) {
+	rec, err := d.detail()
+	if err != nil {
+		return "", err
+	}
+	if rec == nil {
+		return "", fmt.Errorf("unknown dataset %s", d.name())
+	}
+	return graphql.ID(keyOf(rec["dataset_id"])), nil
+}
+
+// Name resolves the name field of dataset
+func (d *DatasetResolver) Name() string {
+	return d.name()
+}
+
+// PrepId resolves the prepId field of dataset
+func (d *DatasetResolver) PrepId() *string {
+	return recString(d.values(), "prep_id")
+}
+
+// XtCrossSection resolves the xtCrossSection field of dataset
+func (d *DatasetResolver) XtCrossSection() *float64 {
+	return recFloat(d.values(), "xtcrosssection")
+}
+
+// PrimaryDataset resolves the primaryDataset field of dataset
+func (d *DatasetResolver) PrimaryDataset() *string {
+	return recString(d.values(), "primary_ds_name")
+}
+
+// PrimaryDatasetType resolves the primaryDatasetType field of dataset
+func (d *DatasetResolver) PrimaryDatasetType() *string {
+	return recString(d.values(), "primary_ds_type")
+}
+
+// ProcessedDataset resolves the processedDataset field of dataset
+func (d *DatasetResolver) ProcessedDataset() *string {
+	return recString(d.values(), "processed_ds_name")
+}
+
+// DataTier resolves the dataTier field of dataset
+func (d *DatasetResolver) DataTier() *string {
+	return recString(d.values(), "data_tier_name")
+}
+
+// AccessType resolves the accessType field of dataset
+func (d *DatasetResolver) AccessType() *string {
+	return recString(d.values(), "dataset_access_type")
+}
+
+// PhysicsGroup resolves the physicsGroup field of dataset
+func (d *DatasetResolver) PhysicsGroup() *string {
+	return recString(d.values(), "physics_group_name")
+}
+
+// CreationDate resolves the creationDate field of dataset
+func (d *DatasetResolver) CreationDate() *float64 {
+	return recFloat(d.values(), "creation_date")
+}
+
+// CreateBy resolves the createBy field of dataset
+func (d *DatasetResolver) CreateBy() *string {
+	return recString(d.values(), "create_by")
+}
+
+// LastModificationDate resolves the lastModificationDate field of dataset
+func (d *DatasetResolver) LastModificationDate() *float64 {
+	return recFloat(d.values(), "last_modification_date")
+}
+
+// LastModifiedBy resolves the lastModifiedBy field of dataset
+func (d *DatasetResolver) LastModifiedBy() *string {
+	return recString(d.values(), "last_modified_by")
+}
+
+// helper function to get detail values of all sibling datasets
+func (d *DatasetResolver) groupValues(key string) ([]string, error) {
+	var out []string
+	details, err := d.details()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, records := range details {
+		for _, rec := range records {
+			if v := rec[key]; v != nil && !seen[keyOf(v)] {
+				seen[keyOf(v)] = true
+				out = append(out, keyOf(v))
+			}
+		}
+	}
+	return out, nil
+}
+
+// AcquisitionEra resolves the acquisitionEra field of dataset
+func (d *DatasetResolver) AcquisitionEra() (*AcquisitionEraResolver, error) {
+	era := recString(d.values(), "acquisition_era_name")
+	if era == nil {
+		return nil, nil
+	}
+	eras, err := loadGroup(d.group, "acquisitionEra", func([]string) (map[string][]dbs.Record, error) {
+		names, err := d.groupValues("acquisition_era_name")
+		if err != nil {
+			return nil, err
+		}
+		return d.r.fetch("acquisitioneras", dbs.Record{}, "AE.ACQUISITION_ERA_NAME", names, "acquisition_era_name")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := eras[*era]; ok {
+		return &AcquisitionEraResolver{rec: records[0]}, nil
+	}
+	return nil, nil
+}
+
+// ProcessingEra resolves the processingEra field of dataset
+func (d *DatasetResolver) ProcessingEra() (*ProcessingEraResolver, error) {
+	version := recString(d.values(), "processing_version")
+	if version == nil {
+		return nil, nil
+	}
+	eras, err := loadGroup(d.group, "processingEra", func([]string) (map[string][]dbs.Record, error) {
+		versions, err := d.groupValues("processing_version")
+		if err != nil {
+			return nil, err
+		}
+		return d.r.fetch("processingeras", dbs.Record{}, "PE.PROCESSING_VERSION", versions, "processing_version")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := eras[*version]; ok {
+		return &ProcessingEraResolver{rec: records[0]}, nil
+	}
+	return nil, nil
+}
+
+// Blocks resolves the blocks field of dataset
+func (d *DatasetResolver) Blocks(args connArgs) (*connection[*BlockResolver], error) {
+	field := fmt.Sprintf("blocks:%s", argsKey(args))
+	conns, err := loadGroup(d.group, field, func(keys []string) (map[string]*connection[*BlockResolver], error) {
+		tmpl := dbs.Record{"Detail": true}
+		records, err := d.r.fetch("blocks", tmpl, "DS.DATASET", keys, "dataset")
+		if err != nil {
+			return nil, err
+		}
+		return connections(records, args, "block_name", func(rec dbs.Record, g *group) *BlockResolver {
+			return &BlockResolver{r: d.r, rec: rec, group: g}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return connectionOf(conns, d.name()), nil
+}
+
+// Parents resolves the parents field of dataset
+func (d *DatasetResolver) Parents() ([]*DatasetResolver, error) {
+	parents, err := loadGroup(d.group, "parents", func(keys []string) (map[string][]*DatasetResolver, error) {
+		records, err := d.r.fetch("datasetparent", dbs.Record{}, "D.DATASET", keys, "this_dataset")
+		if err != nil {
+			return nil, err
+		}
+		return d.r.datasetGroups(records, "parent_dataset"), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesOf(parents, d.name()), nil
+}
+
+// Children resolves the children field of dataset
+func (d *DatasetResolver) Children() ([]*DatasetResolver, error) {
+	children, err := loadGroup(d.group, "children", func(keys []string) (map[string][]*DatasetResolver, error) {
+		records, err := d.r.fetch("datasetchildren", dbs.Record{}, "D.DATASET", keys, "dataset")
+		if err != nil {
+			return nil, err
+		}
+		return d.r.datasetGroups(records, "child_dataset"), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesOf(children, d.name()), nil
+}
+
+// helper function to convert grouped dataset records into dataset resolvers
+// which share the same group
+func (r *Resolver) datasetGroups(records map[string][]dbs.Record, key string) map[string][]*DatasetResolver {
+	g := newGroup()
+	out := make(map[string][]*DatasetResolver)
+	for k, list := range records {
+		sortRecords(list, key)
+		for _, rec := range list {
+			name := keyOf(rec[key])
+			g.add(name)
+			out[k] = append(out[k], &DatasetResolver{r: r, rec: dbs.Record{"dataset": name}, group: g})
+		}
+	}
+	return out
+}
+
+// helper function to get dataset resolvers of given block or file details,
+// all datasets share the same group
+func datasetsOf(r *Resolver, details map[string][]dbs.Record) map[string]*DatasetResolver {
+	g := newGroup()
+	out := make(map[string]*DatasetResolver)
+	for key, records := range details {
+		name := keyOf(records[0]["dataset"])
+		g.add(name)
+		out[key] = &DatasetResolver{r: r, rec: dbs.Record{"dataset": name}, group: g}
+	}
+	return out
+}
+
+// Configs resolves the configs field of dataset
+func (d *DatasetResolver) Configs() ([]*OutputConfigResolver, error) {
+	configs, err := loadGroup(d.group, "configs", func(keys []string) (map[string][]dbs.Record, error) {
+		tmpl := dbs.Record{"Main": true, "Dataset": true, "DatasetKey": true}
+		return d.r.fetch("outputconfigs", tmpl, "DS.DATASET", keys, "dataset")
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := []*OutputConfigResolver{}
+	for _, rec := range configs[d.name()] {
+		out = append(out, &OutputConfigResolver{rec: rec})
+	}
+	return out, nil
+}
+
+// Runs resolves the runs field of dataset
+func (d *DatasetResolver) Runs() ([]*RunResolver, error) {
+	runs, err := loadGroup(d.group, "runs", func(keys []string) (map[string][]dbs.Record, error) {
+		tmpl := dbs.Record{"Dataset": true, "DatasetKey": true}
+		return d.r.fetch("runs", tmpl, "DATASETS.DATASET", keys, "dataset")
+	})
+	if err != nil {
+		return nil, err
+	}
+	records := runs[d.name()]
+	sortRuns(records)
+	out := []*RunResolver{}
+	for _, rec := range records {
+		out = append(out, &RunResolver{rec: rec})
+	}
+	return out, nil
+}
+
+// helper function to get key of connection arguments
+func argsKey(args connArgs) string {
+	after := "-"
+	if args.After != nil {
+		after = string(*args.After)
+	}
+	return fmt.Sprintf("%d:%s", args.First, after)
 }
 
-// Name resolves the Name field for Dataset
-func (dr *DatasetResolver) Name(ctx context.Context) *string {
-	return &dr.d.Name
+// helper function to get nodes of a given key or an empty list
+func nodesOf[T any](nodes map[string][]T, key string) []T {
+	if list, ok := nodes[key]; ok {
+		return list
+	}
+	return []T{}
 }
@@ -0,0 +1,65 @@
+package graphql
+
+import (
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// AcquisitionEraResolver provides acquisition era resolver
+type AcquisitionEraResolver struct {
+	rec dbs.Record
+}
+
+// Name resolves the name field of acquisition era
+func (a *AcquisitionEraResolver) Name() string {
+	return keyOf(a.rec["acquisition_era_name"])
+}
+
+// StartDate resolves the startDate field of acquisition era
+func (a *AcquisitionEraResolver) StartDate() *float64 {
+	return recFloat(a.rec, "start_date")
+}
+
+// EndDate resolves the endDate field of acquisition era
+func (a *AcquisitionEraResolver) EndDate() *float64 {
+	return recFloat(a.rec, "end_date")
+}
+
+// Description resolves the description field of acquisition era
+func (a *AcquisitionEraResolver) Description() *string {
+	return recString(a.rec, "description")
+}
+
+// CreationDate resolves the creationDate field of acquisition era
+func (a *AcquisitionEraResolver) CreationDate() *float64 {
+	return recFloat(a.rec, "creation_date")
+}
+
+// CreateBy resolves the createBy field of acquisition era
+func (a *AcquisitionEraResolver) CreateBy() *string {
+	return recString(a.rec, "create_by")
+}
+
+// ProcessingEraResolver provides processing era resolver
+type ProcessingEraResolver struct {
+	rec dbs.Record
+}
+
+// ProcessingVersion resolves the processingVersion field of processing era
+func (p *ProcessingEraResolver) ProcessingVersion() int32 {
+	return intValue(p.rec, "processing_version")
+}
+
+// Description resolves the description field of processing era
+func (p *ProcessingEraResolver) Description() *string {
+	return recString(p.rec, "description")
+}
+
+// CreationDate resolves the creationDate field of processing era
+func (p *ProcessingEraResolver) CreationDate() *float64 {
+	return recFloat(p.rec, "creation_date")
+}
+
+// CreateBy resolves the createBy field of processing era
+func (p *ProcessingEraResolver) CreateBy() *string {
+	return recString(p.rec, "create_by")
+}
@@ -0,0 +1,259 @@
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/dmwm/dbs2go/dbs"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// FileResolver provides file resolver
+type FileResolver struct {
+	r     *Resolver
+	rec   dbs.Record // file record, may contain only logical file name
+	group *group     // sibling files
+}
+
+// helper function to get file resolver with details of given file
+func (r *Resolver) fileDetail(lfn string) (*FileResolver, error) {
+	g := newGroup()
+	g.add(lfn)
+	f := &FileResolver{r: r, rec: dbs.Record{"logical_file_name": lfn}, group: g}
+	rec, err := f.detail()
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// helper function to get file name
+func (f *FileResolver) lfn() string {
+	return keyOf(f.rec["logical_file_name"])
+}
+
+// helper function to get file details, details of all sibling
+// files are loaded at once
+func (f *FileResolver) detail() (dbs.Record, error) {
+	if _, ok := f.rec["file_id"]; ok {
+		return f.rec, nil
+	}
+	details, err := f.details()
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := details[f.lfn()]; ok {
+		return records[0], nil
+	}
+	return nil, nil
+}
+
+// helper function to load details of all sibling files
+func (f *FileResolver) details() (map[string][]dbs.Record, error) {
+	return loadGroup(f.group, "detail", func(keys []string) (map[string][]dbs.Record, error) {
+		tmpl := dbs.Record{"Detail": true}
+		return f.r.fetch("files", tmpl, "F.LOGICAL_FILE_NAME", keys, "logical_file_name")
+	})
+}
+
+// helper function to get file detail record, it is empty for unknown file
+func (f *FileResolver) values() dbs.Record {
+	rec, err := f.detail()
+	if err != nil || rec == nil {
+		return dbs.Record{}
+	}
+	return rec
+}
+
+// ID resolves the id field of file
+func (f *FileResolver) ID() (graphql.ID, error) {
+	rec, err := f.detail()
+	if err != nil {
+		return "", err
+	}
+	if rec == nil {
+		return "", fmt.Errorf("unknown file %s", f.lfn())
+	}
+	return graphql.ID(keyOf(rec["file_id"])), nil
+}
+
+// Lfn resolves the lfn field of file
+func (f *FileResolver) Lfn() string {
+	return f.lfn()
+}
+
+// IsFileValid resolves the isFileValid field of file
+func (f *FileResolver) IsFileValid() *bool {
+	return recBool(f.values(), "is_file_valid")
+}
+
+// FileType resolves the fileType field of file
+func (f *FileResolver) FileType() *string {
+	return recString(f.values(), "file_type")
+}
+
+// CheckSum resolves the checkSum field of file
+func (f *FileResolver) CheckSum() *string {
+	return recString(f.values(), "check_sum")
+}
+
+// Adler32 resolves the adler32 field of file
+func (f *FileResolver) Adler32() *string {
+	return recString(f.values(), "adler32")
+}
+
+// Md5 resolves the md5 field of file
+func (f *FileResolver) Md5() *string {
+	return recString(f.values(), "md5")
+}
+
+// EventCount resolves the eventCount field of file
+func (f *FileResolver) EventCount() *float64 {
+	return recFloat(f.values(), "event_count")
+}
+
+// FileSize resolves the fileSize field of file
+func (f *FileResolver) FileSize() *float64 {
+	return recFloat(f.values(), "file_size")
+}
+
+// CreationDate resolves the creationDate field of file
+func (f *FileResolver) CreationDate() *float64 {
+	return recFloat(f.values(), "creation_date")
+}
+
+// CreateBy resolves the createBy field of file
+func (f *FileResolver) CreateBy() *string {
+	return recString(f.values(), "create_by")
+}
+
+// LastModificationDate resolves the lastModificationDate field of file
+func (f *FileResolver) LastModificationDate() *float64 {
+	return recFloat(f.values(), "last_modification_date")
+}
+
+// LastModifiedBy resolves the lastModifiedBy field of file
+func (f *FileResolver) LastModifiedBy() *string {
+	return recString(f.values(), "last_modified_by")
+}
+
+// Block resolves the block field of file
+func (f *FileResolver) Block() (*BlockResolver, error) {
+	blocks, err := loadGroup(f.group, "block", func([]string) (map[string]*BlockResolver, error) {
+		details, err := f.details()
+		if err != nil {
+			return nil, err
+		}
+		g := newGroup()
+		out := make(map[string]*BlockResolver)
+		for key, records := range details {
+			name := keyOf(records[0]["block_name"])
+			g.add(name)
+			out[key] = &BlockResolver{r: f.r, rec: dbs.Record{"block_name": name}, group: g}
+		}
+		return out, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := blocks[f.lfn()]; ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown file %s", f.lfn())
+}
+
+// Dataset resolves the dataset field of file
+func (f *FileResolver) Dataset() (*DatasetResolver, error) {
+	datasets, err := loadGroup(f.group, "dataset", func([]string) (map[string]*DatasetResolver, error) {
+		details, err := f.details()
+		if err != nil {
+			return nil, err
+		}
+		return datasetsOf(f.r, details), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := datasets[f.lfn()]; ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("unknown file %s", f.lfn())
+}
+
+// Lumis resolves the lumis field of file
+func (f *FileResolver) Lumis() ([]*LumiResolver, error) {
+	lumis, err := loadGroup(f.group, "lumis", func(keys []string) (map[string][]dbs.Record, error) {
+		tmpl := dbs.Record{"Lfn": true, "LfnList": true}
+		return f.r.fetch("filelumis", tmpl, "F.LOGICAL_FILE_NAME", keys, "logical_file_name")
+	})
+	if err != nil {
+		return nil, err
+	}
+	records := lumis[f.lfn()]
+	sortLumis(records)
+	out := []*LumiResolver{}
+	for _, rec := range records {
+		out = append(out, &LumiResolver{rec: rec})
+	}
+	return out, nil
+}
+
+// Parents resolves the parents field of file
+func (f *FileResolver) Parents() ([]*FileResolver, error) {
+	parents, err := loadGroup(f.group, "parents", func(keys []string) (map[string][]*FileResolver, error) {
+		records, err := f.r.fetch("fileparent", dbs.Record{}, "F.LOGICAL_FILE_NAME", keys, "logical_file_name")
+		if err != nil {
+			return nil, err
+		}
+		return f.r.fileGroups(records, "parent_logical_file_name"), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesOf(parents, f.lfn()), nil
+}
+
+// Children resolves the children field of file
+func (f *FileResolver) Children() ([]*FileResolver, error) {
+	children, err := loadGroup(f.group, "children", func(keys []string) (map[string][]*FileResolver, error) {
+		records, err := f.r.fetch("filechildren", dbs.Record{}, "F.LOGICAL_FILE_NAME", keys, "logical_file_name")
+		if err != nil {
+			return nil, err
+		}
+		return f.r.fileGroups(records, "child_logical_file_name"), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesOf(children, f.lfn()), nil
+}
+
+// Configs resolves the configs field of file
+func (f *FileResolver) Configs() ([]*OutputConfigResolver, error) {
+	configs, err := loadGroup(f.group, "configs", func(keys []string) (map[string][]dbs.Record, error) {
+		return f.r.fetch("outputconfigs", dbs.Record{}, "FS.LOGICAL_FILE_NAME", keys, "lfn")
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := []*OutputConfigResolver{}
+	for _, rec := range configs[f.lfn()] {
+		out = append(out, &OutputConfigResolver{rec: rec})
+	}
+	return out, nil
+}
+
+// helper function to convert grouped file records into file resolvers
+// which share the same group
+func (r *Resolver) fileGroups(records map[string][]dbs.Record, key string) map[string][]*FileResolver {
+	g := newGroup()
+	out := make(map[string][]*FileResolver)
+	for k, list := range records {
+		sortRecords(list, key)
+		for _, rec := range list {
+			lfn := keyOf(rec[key])
+			g.add(lfn)
+			out[k] = append(out[k], &FileResolver{r: r, rec: dbs.Record{"logical_file_name": lfn}, group: g})
+		}
+	}
+	return out
+}
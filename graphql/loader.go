@@ -0,0 +1,245 @@
+package graphql
+
+// loader module provides batched loading of nested GraphQL fields
+//
+// Every resolver belongs to a group of its siblings, e.g. all datasets
+// of the same page or all blocks of the datasets page. When a nested
+// field of any group member is resolved we fetch this field for all
+// group members with a single SQL query and share the results. This
+// avoids N+1 SQL queries when client traverses dataset->blocks->files.
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dmwm/dbs2go/dbs"
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// TokenLimit defines max number of keys per token generator bind
+var TokenLimit = 30
+
+// group represents set of sibling entities whose nested fields are loaded at once
+type group struct {
+	mu    sync.Mutex
+	keys  []string         // keys of group members
+	seen  map[string]bool  // keys lookup map
+	loads map[string]*load // loads of nested fields
+}
+
+// load represents single batched load of a nested field
+type load struct {
+	once sync.Once
+	data interface{}
+	err  error
+}
+
+// helper function to create new group
+func newGroup() *group {
+	return &group{seen: make(map[string]bool), loads: make(map[string]*load)}
+}
+
+// helper function to add given key to the group
+func (g *group) add(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.seen[key] {
+		g.seen[key] = true
+		g.keys = append(g.keys, key)
+	}
+}
+
+// helper function to set already known data of given field of all group members
+func (g *group) set(field string, data interface{}) {
+	l := &load{data: data}
+	l.once.Do(func() {})
+	g.mu.Lock()
+	g.loads[field] = l
+	g.mu.Unlock()
+}
+
+// helper function to load given field of all group members, the fetch
+// function is called only once per group and field
+func loadGroup[T any](g *group, field string, fetch func(keys []string) (T, error)) (T, error) {
+	g.mu.Lock()
+	l, ok := g.loads[field]
+	if !ok {
+		l = &load{}
+		g.loads[field] = l
+	}
+	keys := g.keys
+	g.mu.Unlock()
+	l.once.Do(func() {
+		l.data, l.err = fetch(keys)
+	})
+	var out T
+	if l.err != nil {
+		return out, l.err
+	}
+	return l.data.(T), nil
+}
+
+// helper function to normalize record value to a string key
+func keyOf(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// helper function to execute given SQL statement and return list of records
+func (r *Resolver) query(stm string, args ...interface{}) ([]dbs.Record, error) {
+	stm = dbs.CleanStatement(stm)
+	if dbs.DBOWNER == "sqlite" {
+		stm = utils.ReplaceBinds(stm)
+	}
+	if utils.VERBOSE > 1 {
+		utils.PrintSQL(stm, args, "graphql query")
+	}
+	rows, err := r.db.Query(stm, args...)
+	if err != nil {
+		log.Printf("unable to query statement: %v", stm)
+		return nil, dbs.Error(err, dbs.QueryErrorCode, "", "graphql.query")
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, dbs.Error(err, dbs.QueryErrorCode, "", "graphql.query")
+	}
+	var out []dbs.Record
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
+	for rows.Next() {
+		err := rows.Scan(valuePtrs...)
+		if err != nil {
+			return nil, dbs.Error(err, dbs.RowsScanErrorCode, "", "graphql.query")
+		}
+		rec := make(dbs.Record)
+		for i, col := range columns {
+			switch val := values[i].(type) {
+			case []byte:
+				rec[strings.ToLower(col)] = string(val)
+			case sql.RawBytes:
+				rec[strings.ToLower(col)] = string(val)
+			default:
+				rec[strings.ToLower(col)] = val
+			}
+		}
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbs.Error(err, dbs.RowsScanErrorCode, "", "graphql.query")
+	}
+	return out, nil
+}
+
+// helper function to fetch records of given SQL template for provided keys.
+// The keys are matched against given SQL column via token generator and
+// output records are grouped by value of the given output key.
+func (r *Resolver) fetch(
+	tmplName string,
+	tmpl dbs.Record,
+	column string,
+	keys []string,
+	outKey string,
+	conds ...string) (map[string][]dbs.Record, error) {
+
+	out := make(map[string][]dbs.Record)
+	if len(keys) == 0 {
+		return out, nil
+	}
+	tmpl["Owner"] = dbs.DBOWNER
+	tmpl["TokenGenerator"] = ""
+	stm, err := dbs.LoadTemplateSQL(tmplName, tmpl)
+	if err != nil {
+		return nil, err
+	}
+	token, binds := dbs.TokenGenerator(keys, TokenLimit, "key_token")
+	conds = append(conds, fmt.Sprintf("%s in %s", column, dbs.TokenCondition()))
+	stm = fmt.Sprintf("%s %s", token, dbs.WhereClause(stm, conds))
+	var args []interface{}
+	for _, v := range binds {
+		args = append(args, v)
+	}
+	records, err := r.query(stm, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		key := keyOf(rec[outKey])
+		out[key] = append(out[key], rec)
+	}
+	return out, nil
+}
+
+// helper function to sort records by given key
+func sortRecords(records []dbs.Record, key string) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return keyOf(records[i][key]) < keyOf(records[j][key])
+	})
+}
+
+// helper function to get string value of the record
+func recString(rec dbs.Record, key string) *string {
+	val, ok := rec[key]
+	if !ok || val == nil {
+		return nil
+	}
+	s := keyOf(val)
+	return &s
+}
+
+// helper function to get float value of the record
+func recFloat(rec dbs.Record, key string) *float64 {
+	val, ok := rec[key]
+	if !ok || val == nil {
+		return nil
+	}
+	var f float64
+	switch v := val.(type) {
+	case float64:
+		f = v
+	case int64:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	default:
+		n, err := strconv.ParseFloat(keyOf(v), 64)
+		if err != nil {
+			return nil
+		}
+		f = n
+	}
+	return &f
+}
+
+// helper function to get integer value of the record
+func recInt(rec dbs.Record, key string) *int32 {
+	if f := recFloat(rec, key); f != nil {
+		v := int32(*f)
+		return &v
+	}
+	return nil
+}
+
+// helper function to get boolean value of the record
+func recBool(rec dbs.Record, key string) *bool {
+	if f := recFloat(rec, key); f != nil {
+		v := *f == 1
+		return &v
+	}
+	return nil
+}
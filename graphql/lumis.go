@@ -0,0 +1,63 @@
+package graphql
+
+import (
+	"sort"
+
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// LumiResolver provides file lumi section resolver
+type LumiResolver struct {
+	rec dbs.Record
+}
+
+// RunNumber resolves the runNumber field of lumi
+func (l *LumiResolver) RunNumber() int32 {
+	return intValue(l.rec, "run_num")
+}
+
+// LumiSectionNumber resolves the lumiSectionNumber field of lumi
+func (l *LumiResolver) LumiSectionNumber() int32 {
+	return intValue(l.rec, "lumi_section_num")
+}
+
+// EventCount resolves the eventCount field of lumi
+func (l *LumiResolver) EventCount() *float64 {
+	return recFloat(l.rec, "event_count")
+}
+
+// RunResolver provides run resolver
+type RunResolver struct {
+	rec dbs.Record
+}
+
+// RunNumber resolves the runNumber field of run
+func (r *RunResolver) RunNumber() int32 {
+	return intValue(r.rec, "run_num")
+}
+
+// helper function to get integer value of the record or zero
+func intValue(rec dbs.Record, key string) int32 {
+	if v := recInt(rec, key); v != nil {
+		return *v
+	}
+	return 0
+}
+
+// helper function to sort lumi records by run and lumi section numbers
+func sortLumis(records []dbs.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		ri, rj := intValue(records[i], "run_num"), intValue(records[j], "run_num")
+		if ri != rj {
+			return ri < rj
+		}
+		return intValue(records[i], "lumi_section_num") < intValue(records[j], "lumi_section_num")
+	})
+}
+
+// helper function to sort run records by run number
+func sortRuns(records []dbs.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return intValue(records[i], "run_num") < intValue(records[j], "run_num")
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/dmwm/dbs2go/dbs"
 	graphql "github.com/graph-gophers/graphql-go"
 )
 
@@ -18,43 +19,281 @@ type Resolver struct {
 	db *sql.DB
 }
 
-// GetDataset resolves the getDataset query
-func (r *Resolver) GetDataset(ctx context.Context, args struct{ Name string }) (*DatasetResolver, error) {
+// connArgs represents relay connection arguments
+type connArgs struct {
+	First int32
+	After *graphql.ID
+}
+
+// Dataset resolves the dataset query
+func (r *Resolver) Dataset(ctx context.Context, args struct{ Name string }) (*DatasetResolver, error) {
+	return r.datasetDetail(args.Name)
+}
+
+// Datasets resolves the datasets query
+func (r *Resolver) Datasets(ctx context.Context, args struct {
+	Pattern    string
+	AccessType string
+	First      int32
+	After      *graphql.ID
+}) (*connection[*DatasetResolver], error) {
+	limit := int(args.First)
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid first argument %d", limit)
+	}
+	var conds []string
+	var vals []interface{}
+	op, val := dbs.OperatorValue(args.Pattern)
+	conds = append(conds, fmt.Sprintf("D.DATASET %s :dataset", op))
+	vals = append(vals, val)
+	if args.AccessType != "" {
+		op, val := dbs.OperatorValue(args.AccessType)
+		conds = append(conds, fmt.Sprintf("DP.DATASET_ACCESS_TYPE %s :dataset_access_type", op))
+		vals = append(vals, val)
+	}
+	tmpl := make(dbs.Record)
+	tmpl["Owner"] = dbs.DBOWNER
+	tmpl["TokenGenerator"] = ""
+	tmpl["Detail"] = true
+	stm, err := dbs.LoadTemplateSQL("datasets", tmpl)
+	if err != nil {
+		return nil, err
+	}
+	tmpl["Statement"] = dbs.WhereClause(stm, conds)
+	tmpl["OrderBy"] = "PAGE.DATASET"
+	// datasets are paginated by keyset, i.e. the page starts right after
+	// the dataset of the cursor
+	if args.After != nil {
+		last, err := decodeKeyCursor(string(*args.After))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %s", *args.After)
+		}
+		tmpl["Keyset"] = "PAGE.DATASET > :page_key"
+		vals = append(vals, last)
+	}
+	stm, err = dbs.LoadTemplateSQL("paginate", tmpl)
+	if err != nil {
+		return nil, err
+	}
+	// fetch one extra record to know if there is a next page
+	vals = append(vals, limit+1)
+	records, err := r.query(stm, vals...)
+	if err != nil {
+		return nil, err
+	}
+	more := len(records) > limit
+	if more {
+		records = records[:limit]
+	}
+	g := newGroup()
+	details := make(map[string][]dbs.Record)
+	conn := &connection[*DatasetResolver]{total: -1}
+	for _, rec := range records {
+		g.add(keyOf(rec["dataset"]))
+		details[keyOf(rec["dataset"])] = []dbs.Record{rec}
+		conn.edges = append(conn.edges, &edge[*DatasetResolver]{
+			cursor: encodeKeyCursor(keyOf(rec["dataset"])),
+			node:   &DatasetResolver{r: r, rec: rec, group: g},
+		})
+	}
+	g.set("detail", details)
+	conn.info = newPageInfo(conn.edges, args.After != nil, more)
+	return conn, nil
+}
+
+// Block resolves the block query
+func (r *Resolver) Block(ctx context.Context, args struct{ Name string }) (*BlockResolver, error) {
+	return r.blockDetail(args.Name)
+}
+
+// File resolves the file query
+func (r *Resolver) File(ctx context.Context, args struct{ Lfn string }) (*FileResolver, error) {
+	return r.fileDetail(args.Lfn)
+}
+
+// AcquisitionEras resolves the acquisitionEras query
+func (r *Resolver) AcquisitionEras(ctx context.Context, args struct{ Name string }) ([]*AcquisitionEraResolver, error) {
+	var conds []string
+	var vals []interface{}
+	if args.Name != "" && args.Name != "*" {
+		op, val := dbs.OperatorValue(args.Name)
+		conds = append(conds, fmt.Sprintf("AE.ACQUISITION_ERA_NAME %s :acquisition_era_name", op))
+		vals = append(vals, val)
+	}
+	tmpl := make(dbs.Record)
+	tmpl["Owner"] = dbs.DBOWNER
+	stm, err := dbs.LoadTemplateSQL("acquisitioneras", tmpl)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.query(dbs.WhereClause(stm, conds), vals...)
+	if err != nil {
+		return nil, err
+	}
+	sortRecords(records, "acquisition_era_name")
+	out := []*AcquisitionEraResolver{}
+	for _, rec := range records {
+		out = append(out, &AcquisitionEraResolver{rec: rec})
+	}
+	return out, nil
+}
+
+// ProcessingEras resolves the processingEras query
+func (r *Resolver) ProcessingEras(ctx context.Context) ([]*ProcessingEraResolver, error) {
+	tmpl := make(dbs.Record)
+	tmpl["Owner"] = dbs.DBOWNER
+	stm, err := dbs.LoadTemplateSQL("processingeras", tmpl)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.query(stm)
+	if err != nil {
+		return nil, err
+	}
+	out := []*ProcessingEraResolver{}
+	for _, rec := range records {
+		out = append(out, &ProcessingEraResolver{rec: rec})
+	}
+	return out, nil
+}
+
+// connection represents relay connection of given node resolvers
+type connection[T any] struct {
+	total int
+	edges []*edge[T]
+	info  *PageInfoResolver
+}
+
+// TotalCount resolves total number of nodes in connection
+func (c *connection[T]) TotalCount() int32 {
+	return int32(c.total)
+}
+
+// Edges resolves connection edges
+func (c *connection[T]) Edges() []*edge[T] {
+	if c.edges == nil {
+		return []*edge[T]{}
+	}
+	return c.edges
+}
+
+// PageInfo resolves connection page info
+func (c *connection[T]) PageInfo() *PageInfoResolver {
+	return c.info
+}
+
+// edge represents relay connection edge
+type edge[T any] struct {
+	cursor graphql.ID
+	node   T
+}
+
+// Cursor resolves edge cursor
+func (e *edge[T]) Cursor() graphql.ID {
+	return e.cursor
+}
+
+// Node resolves edge node
+func (e *edge[T]) Node() T {
+	return e.node
+}
 
-	// get dataset info, e.g. from underlying DB
-	dataset := Dataset{Name: "/a/b/RAW"}
-	//     var dataset Dataset
-	dr := DatasetResolver{
-		d: dataset,
+// PageInfoResolver provides relay page info
+type PageInfoResolver struct {
+	startCursor *graphql.ID
+	endCursor   *graphql.ID
+	hasNext     bool
+	hasPrev     bool
+}
+
+// helper function to create page info for given edges
+func newPageInfo[T any](edges []*edge[T], hasPrev, hasNext bool) *PageInfoResolver {
+	info := &PageInfoResolver{hasPrev: hasPrev, hasNext: hasNext}
+	if len(edges) > 0 {
+		info.startCursor = &edges[0].cursor
+		info.endCursor = &edges[len(edges)-1].cursor
 	}
+	return info
+}
+
+// StartCursor resolves cursor of the first edge
+func (p *PageInfoResolver) StartCursor() *graphql.ID {
+	return p.startCursor
+}
+
+// EndCursor resolves cursor of the last edge
+func (p *PageInfoResolver) EndCursor() *graphql.ID {
+	return p.endCursor
+}
 
-	return &dr, nil
+// HasNextPage resolves if there are more edges after this page
+func (p *PageInfoResolver) HasNextPage() bool {
+	return p.hasNext
 }
 
-// AddDataset implements addDataset of graphql schema
-func (r *Resolver) AddDataset(ctx context.Context, args struct{ Name string }) (*bool, error) {
-	// implement proper logic
-	status := true
-	return &status, nil
+// HasPreviousPage resolves if there are edges before this page
+func (p *PageInfoResolver) HasPreviousPage() bool {
+	return p.hasPrev
 }
 
-// UpdateDataset implements updateDataset of graphql schema
-func (r *Resolver) UpdateDataset(ctx context.Context, args struct{ Dataset datasetInput }) (*bool, error) {
-	// implement proper logic
-	status := true
-	return &status, nil
+// helper function to get start position and page size of connection arguments
+func pageArgs(args connArgs) (int, int, error) {
+	limit := int(args.First)
+	if limit < 0 {
+		return 0, 0, fmt.Errorf("invalid first argument %d", limit)
+	}
+	start := 0
+	if args.After != nil {
+		i, err := decodeCursor(string(*args.After))
+		if err != nil || i < 0 {
+			return 0, 0, fmt.Errorf("invalid cursor %s", *args.After)
+		}
+		start = i + 1
+	}
+	return start, limit, nil
 }
 
-// DeleteDataset implements deleteDataset of graphql schema
-func (r *Resolver) DeleteDataset(ctx context.Context, args struct{ Name string }) (*bool, error) {
-	// implement proper logic
-	status := true
-	return &status, nil
+// helper function to build connections of all group members for given
+// connection arguments, nodes of all connections share the same group
+func connections[T any](
+	records map[string][]dbs.Record,
+	args connArgs,
+	key string,
+	node func(rec dbs.Record, g *group) T) (map[string]*connection[T], error) {
+
+	start, limit, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	g := newGroup()
+	details := make(map[string][]dbs.Record)
+	out := make(map[string]*connection[T])
+	for k, list := range records {
+		sortRecords(list, key)
+		conn := &connection[T]{total: len(list)}
+		end := start + limit
+		if end > len(list) {
+			end = len(list)
+		}
+		for i := start; i < end; i++ {
+			g.add(keyOf(list[i][key]))
+			details[keyOf(list[i][key])] = []dbs.Record{list[i]}
+			conn.edges = append(conn.edges, &edge[T]{cursor: encodeCursor(i), node: node(list[i], g)})
+		}
+		conn.info = newPageInfo(conn.edges, start > 0, end < len(list))
+		out[k] = conn
+	}
+	// nodes are built from detail records, therefore their details are known
+	g.set("detail", details)
+	return out, nil
 }
 
-// datasetInput defines how client can post requests about dataset
-type datasetInput struct {
-	Name string
+// helper function to get connection of a given key or an empty connection
+func connectionOf[T any](conns map[string]*connection[T], key string) *connection[T] {
+	if conn, ok := conns[key]; ok {
+		return conn
+	}
+	return &connection[T]{info: &PageInfoResolver{}}
 }
 
 // encode cursor encodes the cursor position in base64
@@ -76,3 +315,20 @@ func decodeCursor(s string) (int, error) {
 
 	return i, nil
 }
+
+// encode key cursor encodes key of the last record of keyset pagination in base64
+func encodeKeyCursor(key string) graphql.ID {
+	return graphql.ID(base64.StdEncoding.EncodeToString([]byte("key:" + key)))
+}
+
+// decode key cursor decodes the base 64 encoded key cursor and returns the key
+func decodeKeyCursor(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(string(b), "key:") {
+		return "", fmt.Errorf("invalid key cursor %s", s)
+	}
+	return strings.TrimPrefix(string(b), "key:"), nil
+}
@@ -5,12 +5,15 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"runtime"
 	"time"
 
+	"github.com/dmwm/dbs2go/dbs"
 	"github.com/dmwm/dbs2go/web"
 )
 
@@ -24,7 +27,92 @@ func info() string {
 	return fmt.Sprintf("dbs2go git=%s go=%s date=%s", gitVersion, goVersion, tstamp)
 }
 
+// helper function to print report of export/import tools
+func printReport(report interface{}) {
+	data, err := json.MarshalIndent(report, "", "   ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+}
+
+// export tool writes blocks of given datasets in blockdump format
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var config string
+	fs.StringVar(&config, "config", "config.json", "dbs2go config file")
+	var dataset string
+	fs.StringVar(&dataset, "dataset", "", "dataset name or pattern, e.g. /a/b*/RAW")
+	var output string
+	fs.StringVar(&output, "output", "", "output directory")
+	var format string
+	fs.StringVar(&format, "format", "json", "output format: json (file per block) or ndjson")
+	var compress bool
+	fs.BoolVar(&compress, "compress", false, "gzip output files")
+	fs.Parse(args)
+	if dataset == "" || output == "" {
+		fmt.Println("usage: dbs2go export -config <config.json> -dataset <dataset> -output <dir>")
+		os.Exit(1)
+	}
+	closeDB, err := web.InitTool(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := dbs.ExportOptions{Dir: output, Format: format, Compress: compress}
+	report, err := dbs.ExportDatasets(dataset, opts)
+	closeDB()
+	printReport(report)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// import tool inserts blocks in blockdump format into DBS
+func imports(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var config string
+	fs.StringVar(&config, "config", "config.json", "dbs2go config file")
+	var input string
+	fs.StringVar(&input, "input", "", "input file or directory with block dumps")
+	var state string
+	fs.StringVar(&state, "state", "", "file with names of imported blocks (default <input>.imported)")
+	var user string
+	fs.StringVar(&user, "user", "dbs2go", "user name used for records without create_by")
+	fs.Parse(args)
+	if input == "" {
+		fmt.Println("usage: dbs2go import -config <config.json> -input <file|dir>")
+		os.Exit(1)
+	}
+	if state == "" {
+		state = fmt.Sprintf("%s.imported", input)
+	}
+	closeDB, err := web.InitTool(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := dbs.ImportOptions{StateFile: state, CreateBy: user}
+	report, err := dbs.ImportBlocks(input, opts)
+	closeDB()
+	printReport(report)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			export(os.Args[2:])
+			return
+		case "import":
+			imports(os.Args[2:])
+			return
+		}
+	}
 	var config string
 	flag.StringVar(&config, "config", "config.json", "dbs2go config file")
 	var version bool
@@ -308,6 +308,24 @@ CREATE SEQUENCE SEQ_MR
     CACHE 5000
     noorder;
 
+CREATE SEQUENCE SEQ_AT
+    START WITH 1
+    INCREMENT BY 1
+    NOMINVALUE
+    NOMAXVALUE
+    nocycle
+    CACHE 5000
+    noorder;
+
+CREATE SEQUENCE SEQ_PJ
+    START WITH 1
+    INCREMENT BY 1
+    NOMINVALUE
+    NOMAXVALUE
+    nocycle
+    CACHE 20
+    noorder;
+
 CREATE SEQUENCE SEQ_CS
     START WITH 1
     INCREMENT BY 1
@@ -585,6 +603,7 @@ CREATE TABLE MIGRATION_REQUESTS (
     LAST_MODIFICATION_DATE INTEGER,
     LAST_MODIFIED_BY VARCHAR2(500),
     RETRY_COUNT INTEGER,
+    MIGRATION_PRIORITY INTEGER DEFAULT 0,
     CONSTRAINT PK_MR PRIMARY KEY (MIGRATION_REQUEST_ID),
     CONSTRAINT TUC_MR_1 UNIQUE (MIGRATION_INPUT)
 );
@@ -592,6 +611,84 @@ GRANT SELECT ON MIGRATION_REQUESTS TO CMS_DBS3_READ_ROLE;
 GRANT INSERT, UPDATE, DELETE ON MIGRATION_REQUESTS TO CMS_DBS3_WRITE_ROLE;
 GRANT DELETE ON MIGRATION_REQUESTS TO CMS_DBS3_ADMIN_ROLE;
 
+/* ---------------------------------------------------------------------- */
+/* Add table "AUDIT_TRAIL"                                                */
+/* ---------------------------------------------------------------------- */
+
+CREATE TABLE AUDIT_TRAIL (
+    AUDIT_ID INTEGER CONSTRAINT NN_AT_AUDIT_ID NOT NULL,
+    API VARCHAR2(100) CONSTRAINT NN_AT_API NOT NULL,
+    METHOD VARCHAR2(10) CONSTRAINT NN_AT_METHOD NOT NULL,
+    DN VARCHAR2(700),
+    DATASET VARCHAR2(700),
+    BLOCK_NAME VARCHAR2(500),
+    LOGICAL_FILE_NAME VARCHAR2(500),
+    PARAMETERS CLOB,
+    OLD_VALUES CLOB,
+    NEW_VALUES CLOB,
+    CREATION_DATE INTEGER,
+    CREATE_BY VARCHAR2(500),
+    CONSTRAINT PK_AT PRIMARY KEY (AUDIT_ID)
+);
+GRANT SELECT ON AUDIT_TRAIL TO CMS_DBS3_READ_ROLE;
+GRANT INSERT ON AUDIT_TRAIL TO CMS_DBS3_WRITE_ROLE;
+GRANT DELETE ON AUDIT_TRAIL TO CMS_DBS3_ADMIN_ROLE;
+
+CREATE INDEX IDX_AT_1 ON AUDIT_TRAIL (DATASET);
+
+CREATE INDEX IDX_AT_2 ON AUDIT_TRAIL (BLOCK_NAME);
+
+CREATE INDEX IDX_AT_3 ON AUDIT_TRAIL (LOGICAL_FILE_NAME);
+
+CREATE INDEX IDX_AT_4 ON AUDIT_TRAIL (CREATE_BY);
+
+CREATE INDEX IDX_AT_5 ON AUDIT_TRAIL (CREATION_DATE);
+
+/* ---------------------------------------------------------------------- */
+/* Add table "IDEMPOTENCY_KEYS"                                           */
+/* ---------------------------------------------------------------------- */
+
+CREATE TABLE IDEMPOTENCY_KEYS (
+    IDEMPOTENCY_KEY VARCHAR2(255) CONSTRAINT NN_IK_IDEMPOTENCY_KEY NOT NULL,
+    API VARCHAR2(100) CONSTRAINT NN_IK_API NOT NULL,
+    REQUEST_HASH VARCHAR2(128) CONSTRAINT NN_IK_REQUEST_HASH NOT NULL,
+    STATUS VARCHAR2(10) CONSTRAINT NN_IK_STATUS NOT NULL,
+    RESPONSE CLOB,
+    CREATION_DATE INTEGER,
+    CREATE_BY VARCHAR2(500),
+    CONSTRAINT PK_IK PRIMARY KEY (IDEMPOTENCY_KEY)
+);
+GRANT SELECT ON IDEMPOTENCY_KEYS TO CMS_DBS3_READ_ROLE;
+GRANT INSERT, UPDATE, DELETE ON IDEMPOTENCY_KEYS TO CMS_DBS3_WRITE_ROLE;
+GRANT DELETE ON IDEMPOTENCY_KEYS TO CMS_DBS3_ADMIN_ROLE;
+
+CREATE INDEX IDX_IK_1 ON IDEMPOTENCY_KEYS (CREATION_DATE);
+
+/* ---------------------------------------------------------------------- */
+/* Add table "PARENTAGE_JOBS"                                             */
+/* ---------------------------------------------------------------------- */
+
+CREATE TABLE PARENTAGE_JOBS (
+    JOB_ID INTEGER CONSTRAINT NN_PJ_JOB_ID NOT NULL,
+    DATASET VARCHAR2(700) CONSTRAINT NN_PJ_DATASET NOT NULL,
+    PARENT_DATASETS CLOB,
+    STATUS VARCHAR2(10) CONSTRAINT NN_PJ_STATUS NOT NULL,
+    LAST_BLOCK_NAME VARCHAR2(500),
+    NBLOCKS INTEGER,
+    NBLOCKS_DONE INTEGER,
+    NFILE_PARENTS INTEGER,
+    ERROR_MESSAGE CLOB,
+    CREATION_DATE INTEGER,
+    LAST_MODIFICATION_DATE INTEGER,
+    CREATE_BY VARCHAR2(500),
+    CONSTRAINT PK_PJ PRIMARY KEY (JOB_ID)
+);
+GRANT SELECT ON PARENTAGE_JOBS TO CMS_DBS3_READ_ROLE;
+GRANT INSERT, UPDATE ON PARENTAGE_JOBS TO CMS_DBS3_WRITE_ROLE;
+GRANT DELETE ON PARENTAGE_JOBS TO CMS_DBS3_ADMIN_ROLE;
+
+CREATE INDEX IDX_PJ_1 ON PARENTAGE_JOBS (DATASET);
+
 /* ---------------------------------------------------------------------- */
 /* Add table "MIGRATION_BLOCKS"                                           */
 /* ---------------------------------------------------------------------- */
@@ -606,6 +703,12 @@ CREATE TABLE MIGRATION_BLOCKS (
     CREATE_BY VARCHAR2(500),
     LAST_MODIFICATION_DATE INTEGER,
     LAST_MODIFIED_BY VARCHAR2(500),
+    RETRY_COUNT INTEGER DEFAULT 0,
+    MIGRATION_ERROR VARCHAR2(4000),
+    MIGRATION_START_DATE INTEGER,
+    MIGRATION_END_DATE INTEGER,
+    BYTES_TRANSFERRED INTEGER DEFAULT 0,
+    FILES_TRANSFERRED INTEGER DEFAULT 0,
     CONSTRAINT PK_MB PRIMARY KEY (MIGRATION_BLOCK_ID),
     CONSTRAINT TUC_MB_1 UNIQUE (MIGRATION_BLOCK_NAME, MIGRATION_REQUEST_ID)
 );
@@ -1014,6 +1117,8 @@ GRANT SELECT ON SEQ_FP TO CMS_DBS3_READ_ROLE;
 GRANT SELECT ON SEQ_FT TO CMS_DBS3_READ_ROLE;
 GRANT SELECT ON SEQ_MB TO CMS_DBS3_READ_ROLE;
 GRANT SELECT ON SEQ_MR TO CMS_DBS3_READ_ROLE;
+GRANT SELECT ON SEQ_AT TO CMS_DBS3_READ_ROLE;
+GRANT SELECT ON SEQ_PJ TO CMS_DBS3_READ_ROLE;
 GRANT SELECT ON SEQ_OMC TO CMS_DBS3_READ_ROLE;
 GRANT SELECT ON SEQ_PDS TO CMS_DBS3_READ_ROLE;
 GRANT SELECT ON SEQ_PDT TO CMS_DBS3_READ_ROLE;
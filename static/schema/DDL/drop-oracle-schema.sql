@@ -325,6 +325,62 @@ ALTER TABLE MIGRATION_BLOCKS DROP CONSTRAINT TUC_MB_1;
 
 DROP TABLE MIGRATION_BLOCKS;
 
+/* ---------------------------------------------------------------------- */
+/* Drop table "AUDIT_TRAIL"                                               */
+/* ---------------------------------------------------------------------- */
+
+/* Drop constraints */
+
+ALTER TABLE AUDIT_TRAIL DROP CONSTRAINT NN_AT_AUDIT_ID;
+
+ALTER TABLE AUDIT_TRAIL DROP CONSTRAINT NN_AT_API;
+
+ALTER TABLE AUDIT_TRAIL DROP CONSTRAINT NN_AT_METHOD;
+
+ALTER TABLE AUDIT_TRAIL DROP CONSTRAINT PK_AT;
+
+/* Drop table */
+
+DROP TABLE AUDIT_TRAIL;
+
+/* ---------------------------------------------------------------------- */
+/* Drop table "IDEMPOTENCY_KEYS"                                          */
+/* ---------------------------------------------------------------------- */
+
+/* Drop constraints */
+
+ALTER TABLE IDEMPOTENCY_KEYS DROP CONSTRAINT NN_IK_IDEMPOTENCY_KEY;
+
+ALTER TABLE IDEMPOTENCY_KEYS DROP CONSTRAINT NN_IK_API;
+
+ALTER TABLE IDEMPOTENCY_KEYS DROP CONSTRAINT NN_IK_REQUEST_HASH;
+
+ALTER TABLE IDEMPOTENCY_KEYS DROP CONSTRAINT NN_IK_STATUS;
+
+ALTER TABLE IDEMPOTENCY_KEYS DROP CONSTRAINT PK_IK;
+
+/* Drop table */
+
+DROP TABLE IDEMPOTENCY_KEYS;
+
+/* ---------------------------------------------------------------------- */
+/* Drop table "PARENTAGE_JOBS"                                            */
+/* ---------------------------------------------------------------------- */
+
+/* Drop constraints */
+
+ALTER TABLE PARENTAGE_JOBS DROP CONSTRAINT NN_PJ_JOB_ID;
+
+ALTER TABLE PARENTAGE_JOBS DROP CONSTRAINT NN_PJ_DATASET;
+
+ALTER TABLE PARENTAGE_JOBS DROP CONSTRAINT NN_PJ_STATUS;
+
+ALTER TABLE PARENTAGE_JOBS DROP CONSTRAINT PK_PJ;
+
+/* Drop table */
+
+DROP TABLE PARENTAGE_JOBS;
+
 /* ---------------------------------------------------------------------- */
 /* Drop table "MIGRATION_REQUESTS"                                        */
 /* ---------------------------------------------------------------------- */
@@ -689,6 +745,10 @@ DROP SEQUENCE SEQ_MB;
 
 DROP SEQUENCE SEQ_MR;
 
+DROP SEQUENCE SEQ_AT;
+
+DROP SEQUENCE SEQ_PJ;
+
 DROP SEQUENCE SEQ_CS;
 
 DROP ROLE CMS_DBS3_READ_ROLE;
@@ -0,0 +1,130 @@
+/* ---------------------------------------------------------------------- */
+/* Script type:           Database upgrade script                         */
+/* Upgrades existing DBS schema created by create-oracle-schema.sql       */
+/* prior to audit trail, idempotency keys, parentage jobs, migration      */
+/* priorities and migration block details, the script should be run once */
+/* ---------------------------------------------------------------------- */
+
+/* ---------------------------------------------------------------------- */
+/* Sequences                                                              */
+/* ---------------------------------------------------------------------- */
+
+CREATE SEQUENCE SEQ_AT
+    START WITH 1
+    INCREMENT BY 1
+    NOMINVALUE
+    NOMAXVALUE
+    nocycle
+    CACHE 5000
+    noorder;
+
+CREATE SEQUENCE SEQ_PJ
+    START WITH 1
+    INCREMENT BY 1
+    NOMINVALUE
+    NOMAXVALUE
+    nocycle
+    CACHE 20
+    noorder;
+
+GRANT SELECT ON SEQ_AT TO CMS_DBS3_READ_ROLE;
+GRANT SELECT ON SEQ_PJ TO CMS_DBS3_READ_ROLE;
+
+/* ---------------------------------------------------------------------- */
+/* Alter table "MIGRATION_REQUESTS"                                       */
+/* ---------------------------------------------------------------------- */
+
+ALTER TABLE MIGRATION_REQUESTS ADD (
+    MIGRATION_PRIORITY INTEGER DEFAULT 0
+);
+
+/* ---------------------------------------------------------------------- */
+/* Alter table "MIGRATION_BLOCKS"                                         */
+/* ---------------------------------------------------------------------- */
+
+ALTER TABLE MIGRATION_BLOCKS ADD (
+    RETRY_COUNT INTEGER DEFAULT 0,
+    MIGRATION_ERROR VARCHAR2(4000),
+    MIGRATION_START_DATE INTEGER,
+    MIGRATION_END_DATE INTEGER,
+    BYTES_TRANSFERRED INTEGER DEFAULT 0,
+    FILES_TRANSFERRED INTEGER DEFAULT 0
+);
+
+/* ---------------------------------------------------------------------- */
+/* Add table "AUDIT_TRAIL"                                                */
+/* ---------------------------------------------------------------------- */
+
+CREATE TABLE AUDIT_TRAIL (
+    AUDIT_ID INTEGER CONSTRAINT NN_AT_AUDIT_ID NOT NULL,
+    API VARCHAR2(100) CONSTRAINT NN_AT_API NOT NULL,
+    METHOD VARCHAR2(10) CONSTRAINT NN_AT_METHOD NOT NULL,
+    DN VARCHAR2(700),
+    DATASET VARCHAR2(700),
+    BLOCK_NAME VARCHAR2(500),
+    LOGICAL_FILE_NAME VARCHAR2(500),
+    PARAMETERS CLOB,
+    OLD_VALUES CLOB,
+    NEW_VALUES CLOB,
+    CREATION_DATE INTEGER,
+    CREATE_BY VARCHAR2(500),
+    CONSTRAINT PK_AT PRIMARY KEY (AUDIT_ID)
+);
+GRANT SELECT ON AUDIT_TRAIL TO CMS_DBS3_READ_ROLE;
+GRANT INSERT ON AUDIT_TRAIL TO CMS_DBS3_WRITE_ROLE;
+GRANT DELETE ON AUDIT_TRAIL TO CMS_DBS3_ADMIN_ROLE;
+
+CREATE INDEX IDX_AT_1 ON AUDIT_TRAIL (DATASET);
+
+CREATE INDEX IDX_AT_2 ON AUDIT_TRAIL (BLOCK_NAME);
+
+CREATE INDEX IDX_AT_3 ON AUDIT_TRAIL (LOGICAL_FILE_NAME);
+
+CREATE INDEX IDX_AT_4 ON AUDIT_TRAIL (CREATE_BY);
+
+CREATE INDEX IDX_AT_5 ON AUDIT_TRAIL (CREATION_DATE);
+
+/* ---------------------------------------------------------------------- */
+/* Add table "IDEMPOTENCY_KEYS"                                           */
+/* ---------------------------------------------------------------------- */
+
+CREATE TABLE IDEMPOTENCY_KEYS (
+    IDEMPOTENCY_KEY VARCHAR2(255) CONSTRAINT NN_IK_IDEMPOTENCY_KEY NOT NULL,
+    API VARCHAR2(100) CONSTRAINT NN_IK_API NOT NULL,
+    REQUEST_HASH VARCHAR2(128) CONSTRAINT NN_IK_REQUEST_HASH NOT NULL,
+    STATUS VARCHAR2(10) CONSTRAINT NN_IK_STATUS NOT NULL,
+    RESPONSE CLOB,
+    CREATION_DATE INTEGER,
+    CREATE_BY VARCHAR2(500),
+    CONSTRAINT PK_IK PRIMARY KEY (IDEMPOTENCY_KEY)
+);
+GRANT SELECT ON IDEMPOTENCY_KEYS TO CMS_DBS3_READ_ROLE;
+GRANT INSERT, UPDATE, DELETE ON IDEMPOTENCY_KEYS TO CMS_DBS3_WRITE_ROLE;
+GRANT DELETE ON IDEMPOTENCY_KEYS TO CMS_DBS3_ADMIN_ROLE;
+
+CREATE INDEX IDX_IK_1 ON IDEMPOTENCY_KEYS (CREATION_DATE);
+
+/* ---------------------------------------------------------------------- */
+/* Add table "PARENTAGE_JOBS"                                             */
+/* ---------------------------------------------------------------------- */
+
+CREATE TABLE PARENTAGE_JOBS (
+    JOB_ID INTEGER CONSTRAINT NN_PJ_JOB_ID NOT NULL,
+    DATASET VARCHAR2(700) CONSTRAINT NN_PJ_DATASET NOT NULL,
+    PARENT_DATASETS CLOB,
+    STATUS VARCHAR2(10) CONSTRAINT NN_PJ_STATUS NOT NULL,
+    LAST_BLOCK_NAME VARCHAR2(500),
+    NBLOCKS INTEGER,
+    NBLOCKS_DONE INTEGER,
+    NFILE_PARENTS INTEGER,
+    ERROR_MESSAGE CLOB,
+    CREATION_DATE INTEGER,
+    LAST_MODIFICATION_DATE INTEGER,
+    CREATE_BY VARCHAR2(500),
+    CONSTRAINT PK_PJ PRIMARY KEY (JOB_ID)
+);
+GRANT SELECT ON PARENTAGE_JOBS TO CMS_DBS3_READ_ROLE;
+GRANT INSERT, UPDATE ON PARENTAGE_JOBS TO CMS_DBS3_WRITE_ROLE;
+GRANT DELETE ON PARENTAGE_JOBS TO CMS_DBS3_ADMIN_ROLE;
+
+CREATE INDEX IDX_PJ_1 ON PARENTAGE_JOBS (DATASET);
@@ -0,0 +1,130 @@
+--------------------------------------------------------
+--  Upgrade of existing DBS schema created by sqlite-schema.sql prior
+--  to audit trail, idempotency keys, parentage jobs, migration priorities
+--  and migration block details, the script should be run once
+--------------------------------------------------------
+
+--------------------------------------------------------
+--  DDL for Table MIGRATION_REQUESTS
+--------------------------------------------------------
+
+  ALTER TABLE "MIGRATION_REQUESTS" ADD COLUMN "MIGRATION_PRIORITY" INTEGER DEFAULT 0 ;
+--------------------------------------------------------
+--  DDL for Table MIGRATION_BLOCKS
+--------------------------------------------------------
+
+  ALTER TABLE "MIGRATION_BLOCKS" ADD COLUMN "RETRY_COUNT" INTEGER DEFAULT 0 ;
+  ALTER TABLE "MIGRATION_BLOCKS" ADD COLUMN "MIGRATION_ERROR" VARCHAR2(4000) ;
+  ALTER TABLE "MIGRATION_BLOCKS" ADD COLUMN "MIGRATION_START_DATE" INTEGER ;
+  ALTER TABLE "MIGRATION_BLOCKS" ADD COLUMN "MIGRATION_END_DATE" INTEGER ;
+  ALTER TABLE "MIGRATION_BLOCKS" ADD COLUMN "BYTES_TRANSFERRED" INTEGER DEFAULT 0 ;
+  ALTER TABLE "MIGRATION_BLOCKS" ADD COLUMN "FILES_TRANSFERRED" INTEGER DEFAULT 0 ;
+--------------------------------------------------------
+--  DDL for Table AUDIT_TRAIL
+--------------------------------------------------------
+
+  CREATE TABLE IF NOT EXISTS "AUDIT_TRAIL" 
+   (	"AUDIT_ID" INTEGER, 
+	"API" VARCHAR2(100), 
+	"METHOD" VARCHAR2(10), 
+	"DN" VARCHAR2(700), 
+	"DATASET" VARCHAR2(700), 
+	"BLOCK_NAME" VARCHAR2(500), 
+	"LOGICAL_FILE_NAME" VARCHAR2(500), 
+	"PARAMETERS" CLOB, 
+	"OLD_VALUES" CLOB, 
+	"NEW_VALUES" CLOB, 
+	"CREATION_DATE" INTEGER, 
+	"CREATE_BY" VARCHAR2(500)
+   ) ;
+--------------------------------------------------------
+--  DDL for Table IDEMPOTENCY_KEYS
+--------------------------------------------------------
+
+  CREATE TABLE IF NOT EXISTS "IDEMPOTENCY_KEYS" 
+   (	"IDEMPOTENCY_KEY" VARCHAR2(255), 
+	"API" VARCHAR2(100), 
+	"REQUEST_HASH" VARCHAR2(128), 
+	"STATUS" VARCHAR2(10), 
+	"RESPONSE" CLOB, 
+	"CREATION_DATE" INTEGER, 
+	"CREATE_BY" VARCHAR2(500)
+   ) ;
+--------------------------------------------------------
+--  DDL for Table PARENTAGE_JOBS
+--------------------------------------------------------
+
+  CREATE TABLE IF NOT EXISTS "PARENTAGE_JOBS" 
+   (	"JOB_ID" INTEGER, 
+	"DATASET" VARCHAR2(700), 
+	"PARENT_DATASETS" CLOB, 
+	"STATUS" VARCHAR2(10), 
+	"LAST_BLOCK_NAME" VARCHAR2(500), 
+	"NBLOCKS" INTEGER, 
+	"NBLOCKS_DONE" INTEGER, 
+	"NFILE_PARENTS" INTEGER, 
+	"ERROR_MESSAGE" CLOB, 
+	"CREATION_DATE" INTEGER, 
+	"LAST_MODIFICATION_DATE" INTEGER, 
+	"CREATE_BY" VARCHAR2(500)
+   ) ;
+--------------------------------------------------------
+--  DDL for Index PK_AT
+--------------------------------------------------------
+
+  CREATE UNIQUE INDEX IF NOT EXISTS "PK_AT" ON "AUDIT_TRAIL" ("AUDIT_ID") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_AT_1
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_AT_1" ON "AUDIT_TRAIL" ("DATASET") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_AT_2
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_AT_2" ON "AUDIT_TRAIL" ("BLOCK_NAME") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_AT_3
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_AT_3" ON "AUDIT_TRAIL" ("LOGICAL_FILE_NAME") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_AT_4
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_AT_4" ON "AUDIT_TRAIL" ("CREATE_BY") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_AT_5
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_AT_5" ON "AUDIT_TRAIL" ("CREATION_DATE") 
+  ;
+--------------------------------------------------------
+--  DDL for Index PK_IK
+--------------------------------------------------------
+
+  CREATE UNIQUE INDEX IF NOT EXISTS "PK_IK" ON "IDEMPOTENCY_KEYS" ("IDEMPOTENCY_KEY") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_IK_1
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_IK_1" ON "IDEMPOTENCY_KEYS" ("CREATION_DATE") 
+  ;
+--------------------------------------------------------
+--  DDL for Index PK_PJ
+--------------------------------------------------------
+
+  CREATE UNIQUE INDEX IF NOT EXISTS "PK_PJ" ON "PARENTAGE_JOBS" ("JOB_ID") 
+  ;
+--------------------------------------------------------
+--  DDL for Index IDX_PJ_1
+--------------------------------------------------------
+
+  CREATE INDEX IF NOT EXISTS "IDX_PJ_1" ON "PARENTAGE_JOBS" ("DATASET") 
+  ;
@@ -0,0 +1,5 @@
+SELECT A.AUDIT_ID, A.API, A.METHOD, A.DN,
+    A.DATASET, A.BLOCK_NAME, A.LOGICAL_FILE_NAME,
+    A.PARAMETERS, A.OLD_VALUES, A.NEW_VALUES,
+    A.CREATION_DATE, A.CREATE_BY
+FROM {{.Owner}}.AUDIT_TRAIL A
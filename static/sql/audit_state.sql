@@ -0,0 +1,34 @@
+{{if .Datasets}}
+SELECT D.DATASET, D.IS_DATASET_VALID,
+    DP.DATASET_ACCESS_TYPE, PG.PHYSICS_GROUP_NAME,
+    D.LAST_MODIFIED_BY, D.LAST_MODIFICATION_DATE
+FROM {{.Owner}}.DATASETS D
+LEFT OUTER JOIN {{.Owner}}.DATASET_ACCESS_TYPES DP ON DP.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
+LEFT OUTER JOIN {{.Owner}}.PHYSICS_GROUPS PG ON PG.PHYSICS_GROUP_ID = D.PHYSICS_GROUP_ID
+WHERE D.DATASET = :dataset
+{{end}}
+{{if .Blocks}}
+SELECT B.BLOCK_NAME, B.OPEN_FOR_WRITING, B.ORIGIN_SITE_NAME,
+    B.LAST_MODIFIED_BY, B.LAST_MODIFICATION_DATE
+FROM {{.Owner}}.BLOCKS B
+WHERE B.BLOCK_NAME = :block_name
+{{end}}
+{{if .Files}}
+SELECT D.DATASET, F.LOGICAL_FILE_NAME, F.IS_FILE_VALID,
+    F.LAST_MODIFIED_BY, F.LAST_MODIFICATION_DATE
+FROM {{.Owner}}.FILES F
+INNER JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = F.DATASET_ID
+WHERE F.LOGICAL_FILE_NAME = :logical_file_name
+{{end}}
+{{if .DatasetFiles}}
+SELECT D.DATASET, F.IS_FILE_VALID, COUNT(F.FILE_ID) AS NFILES
+FROM {{.Owner}}.FILES F
+INNER JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = F.DATASET_ID
+WHERE D.DATASET = :dataset
+GROUP BY D.DATASET, F.IS_FILE_VALID
+{{end}}
+{{if .AcquisitionEras}}
+SELECT AE.ACQUISITION_ERA_NAME, AE.START_DATE, AE.END_DATE, AE.DESCRIPTION
+FROM {{.Owner}}.ACQUISITION_ERAS AE
+WHERE AE.ACQUISITION_ERA_NAME = :acquisition_era_name
+{{end}}
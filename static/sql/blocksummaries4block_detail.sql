@@ -28,7 +28,7 @@ from
     {{.Owner}}.blocks b,
     (
         select bs.block_name as block_name,
-        NVL(sum(fs.event_count),0) as num_event
+        COALESCE(sum(fs.event_count),0) as num_event
         FROM {{.Owner}}.FILES FS
         JOIN {{.Owner}}.BLOCKS BS ON BS.BLOCK_ID=FS.BLOCK_ID
         WHERE BS.BLOCK_NAME IN {{.TokenCondition}}
@@ -23,7 +23,7 @@ where
 with t1 as(
      SELECT
          BS.BLOCK_NAME as BLOCK_NAME,
-         NVL(SUM(FS.EVENT_COUNT),0) as NUM_EVENT
+         COALESCE(SUM(FS.EVENT_COUNT),0) as NUM_EVENT
      FROM {{.Owner}}.FILES FS
      JOIN {{.Owner}}.BLOCKS BS ON BS.BLOCK_ID=FS.BLOCK_ID
      JOIN {{.Owner}}.DATASETS DS ON BS.DATASET_ID=DS.DATASET_ID
@@ -0,0 +1,7 @@
+UPDATE {{.Owner}}.PARENTAGE_JOBS
+    SET STATUS = :status,
+    ERROR_MESSAGE = :error_message,
+    LAST_MODIFICATION_DATE = :last_modification_date
+WHERE JOB_ID = :job_id
+AND STATUS != :done_status
+AND (STATUS != :running_status OR LAST_MODIFICATION_DATE < :stale_date)
@@ -0,0 +1,10 @@
+SELECT RUN_NUM, MIN(LUMI_SECTION_NUM) AS MIN_LUMI, MAX(LUMI_SECTION_NUM) AS MAX_LUMI
+FROM (
+    SELECT RUN_NUM, LUMI_SECTION_NUM,
+        LUMI_SECTION_NUM - ROW_NUMBER() OVER (PARTITION BY RUN_NUM ORDER BY LUMI_SECTION_NUM) AS LUMI_GROUP
+    FROM (
+        {{.Statement}}
+    ) LUMIS
+) RANGES
+GROUP BY RUN_NUM, LUMI_GROUP
+ORDER BY RUN_NUM, MIN_LUMI
@@ -0,0 +1,12 @@
+SELECT DISTINCT FL.RUN_NUM, FL.LUMI_SECTION_NUM
+FROM {{.Owner}}.FILE_LUMIS FL
+JOIN {{.Owner}}.FILES F ON F.FILE_ID = FL.FILE_ID
+{{if .BlockName}}
+JOIN {{.Owner}}.BLOCKS B ON B.BLOCK_ID = F.BLOCK_ID
+{{end}}
+{{if or .Dataset .ValidFileOnly}}
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = F.DATASET_ID
+{{end}}
+{{if .ValidFileOnly}}
+JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
+{{end}}
@@ -0,0 +1,2 @@
+DELETE FROM {{.Owner}}.IDEMPOTENCY_KEYS
+WHERE IDEMPOTENCY_KEY = :idempotency_key
@@ -0,0 +1,5 @@
+SELECT
+    D.DATASET,
+    B.BLOCK_NAME
+FROM {{.Owner}}.BLOCKS B
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = B.DATASET_ID
@@ -49,3 +49,7 @@ JOIN {{.Owner}}.BLOCKS B ON B.BLOCK_ID = F.BLOCK_ID
 {{end}} {{/* end of validFileOnly block */}}
 
 {{end}} {{/* end of Lfn block */}}
+{{if .LumiMask}}
+JOIN {{.LumiMask}} LM ON LM.RUN_NUM = FL.RUN_NUM
+AND FL.LUMI_SECTION_NUM BETWEEN LM.MIN_LUMI AND LM.MAX_LUMI
+{{end}}
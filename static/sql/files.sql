@@ -34,3 +34,7 @@ LEFT OUTER JOIN {{.Owner}}.RELEASE_VERSIONS RV ON RV.RELEASE_VERSION_ID = OMC.RE
 LEFT OUTER JOIN {{.Owner}}.PARAMETER_SET_HASHES PSH ON PSH.PARAMETER_SET_HASH_ID = OMC.PARAMETER_SET_HASH_ID
 LEFT OUTER JOIN {{.Owner}}.APPLICATION_EXECUTABLES AEX ON AEX.APP_EXEC_ID = OMC.APP_EXEC_ID
 {{end}}
+{{if .LumiMask}}
+JOIN {{.LumiMask}} LM ON LM.RUN_NUM = FL.RUN_NUM
+AND FL.LUMI_SECTION_NUM BETWEEN LM.MIN_LUMI AND LM.MAX_LUMI
+{{end}}
@@ -15,7 +15,7 @@ select
   where d.dataset=:dataset wheresql_isFileValid
  ) as max_ldate,
 
-(select median(f.creation_date)  from {{.Owner}}.files f
+(select {{if .PostgreSQL}}percentile_cont(0.5) within group (order by f.creation_date){{else}}median(f.creation_date){{end}}  from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -23,7 +23,7 @@ select
   where d.dataset=:dataset wheresql_isFileValid
  ) as median_cdate,
 
-(select median(f.last_modification_date)  from {{.Owner}}.files f
+(select {{if .PostgreSQL}}percentile_cont(0.5) within group (order by f.last_modification_date){{else}}median(f.last_modification_date){{end}}  from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -31,7 +31,7 @@ select
   where d.dataset=:dataset wheresql_isFileValid
  ) as median_ldate,
 
- nvl((select sum(f.event_count) event_count from {{.Owner}}.files f
+ coalesce((select sum(f.event_count) event_count from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -39,7 +39,7 @@ select
   where d.dataset=:dataset wheresql_isFileValid
  ),0) as num_event,
 
- (select nvl(sum(f.file_size),0) file_size from {{.Owner}}.files f
+ (select coalesce(sum(f.file_size),0) file_size from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -61,6 +61,8 @@ select
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
 {{end}}
- where d.dataset=:dataset wheresql_isFileValid)
+ where d.dataset=:dataset wheresql_isFileValid) lumis
 ) as num_lumi
+ {{if not .PostgreSQL}}
  from dual
+ {{end}}
\ No newline at end of file
@@ -17,7 +17,7 @@ select
   f.FILE_ID in (select fl.file_id from {{.Owner}}.file_lumis fl where whererun)
  ) as max_ldate,
 
- (select median(f.creation_date) from {{.Owner}}.files f
+ (select {{if .PostgreSQL}}percentile_cont(0.5) within group (order by f.creation_date){{else}}median(f.creation_date){{end}} from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -26,7 +26,7 @@ select
   f.FILE_ID in (select fl.file_id from {{.Owner}}.file_lumis fl where whererun)
  ) as median_cdate,
 
- (select median(f.last_modification_date) from {{.Owner}}.files f
+ (select {{if .PostgreSQL}}percentile_cont(0.5) within group (order by f.last_modification_date){{else}}median(f.last_modification_date){{end}} from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -35,7 +35,7 @@ select
   f.FILE_ID in (select fl.file_id from {{.Owner}}.file_lumis fl where whererun)
  ) as median_ldate,
 
- nvl((select sum(f.event_count) event_count from {{.Owner}}.files f
+ coalesce((select sum(f.event_count) event_count from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -44,7 +44,7 @@ select
   f.FILE_ID in (select fl.file_id from {{.Owner}}.file_lumis fl where whererun)
  ),0) as num_event,
 
- (select nvl(sum(f.file_size),0) file_size from {{.Owner}}.files f
+ (select coalesce(sum(f.file_size),0) file_size from {{.Owner}}.files f
   join {{.Owner}}.datasets d on d.DATASET_ID = f.dataset_id
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
@@ -69,6 +69,8 @@ select
 {{if .Valid}}
   JOIN {{.Owner}}.DATASET_ACCESS_TYPES DT ON  DT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
 {{end}}
- where d.dataset=:dataset wheresql_isFileValid and whererun )
+ where d.dataset=:dataset wheresql_isFileValid and whererun ) lumis
 ) as num_lumi
+ {{if not .PostgreSQL}}
  from dual
+ {{end}}
\ No newline at end of file
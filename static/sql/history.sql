@@ -0,0 +1,13 @@
+{{if .Datasets}}
+SELECT D.DATASET, DP.DATASET_ACCESS_TYPE, PG.PHYSICS_GROUP_NAME,
+    D.CREATION_DATE
+FROM {{.Owner}}.DATASETS D
+LEFT OUTER JOIN {{.Owner}}.DATASET_ACCESS_TYPES DP ON DP.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
+LEFT OUTER JOIN {{.Owner}}.PHYSICS_GROUPS PG ON PG.PHYSICS_GROUP_ID = D.PHYSICS_GROUP_ID
+{{end}}
+{{if .Blocks}}
+SELECT B.BLOCK_NAME, DS.DATASET, B.OPEN_FOR_WRITING, B.ORIGIN_SITE_NAME,
+    B.CREATION_DATE
+FROM {{.Owner}}.BLOCKS B
+INNER JOIN {{.Owner}}.DATASETS DS ON DS.DATASET_ID = B.DATASET_ID
+{{end}}
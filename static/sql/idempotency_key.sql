@@ -0,0 +1,4 @@
+SELECT I.IDEMPOTENCY_KEY, I.API, I.REQUEST_HASH, I.STATUS,
+    I.RESPONSE, I.CREATION_DATE, I.CREATE_BY
+FROM {{.Owner}}.IDEMPOTENCY_KEYS I
+WHERE I.IDEMPOTENCY_KEY = :idempotency_key
@@ -0,0 +1,6 @@
+INSERT INTO {{.Owner}}.AUDIT_TRAIL
+    (audit_id, api, method, dn, dataset, block_name, logical_file_name,
+     parameters, old_values, new_values, creation_date, create_by)
+    VALUES
+    (:audit_id, :api, :method, :dn, :dataset, :block_name, :logical_file_name,
+     :parameters, :old_values, :new_values, :creation_date, :create_by)
@@ -7,3 +7,6 @@ OR IGNORE
 INTO {{.Owner}}.file_lumis
 (run_num, lumi_section_num, file_id, event_count)
 VALUES (:run_num, :lumi_section_num, :file_id, :event_count)
+{{if .PostgreSQL}}
+ON CONFLICT DO NOTHING
+{{end}}
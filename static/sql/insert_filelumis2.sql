@@ -2,9 +2,14 @@ INSERT
 {{if eq .Owner "sqlite"}}
 OR IGNORE 
 INTO {{.Owner}}.file_lumis
+{{else if .PostgreSQL}}
+INTO {{.Owner}}.file_lumis
 {{else}}
 /*+ ignore_row_on_dupkey_index ( FL ( run_num,lumi_section_num,file_id ) ) */
 INTO {{.Owner}}.file_lumis FL
 {{end}}
 (run_num, lumi_section_num, file_id)
 VALUES (:run_num, :lumi_section_num, :file_id)
+{{if .PostgreSQL}}
+ON CONFLICT DO NOTHING
+{{end}}
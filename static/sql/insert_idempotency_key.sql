@@ -0,0 +1,6 @@
+INSERT INTO {{.Owner}}.IDEMPOTENCY_KEYS
+    (idempotency_key, api, request_hash, status,
+     response, creation_date, create_by)
+    VALUES
+    (:idempotency_key, :api, :request_hash, :status,
+     :response, :creation_date, :create_by)
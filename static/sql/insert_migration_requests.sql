@@ -8,7 +8,8 @@ INSERT INTO {{.Owner}}.MIGRATION_REQUESTS
     CREATE_BY,
     LAST_MODIFICATION_DATE,
     LAST_MODIFIED_BY,
-    RETRY_COUNT)
+    RETRY_COUNT,
+    MIGRATION_PRIORITY)
 VALUES
     (:migration_request_id,
     :migration_url,
@@ -19,4 +20,5 @@ VALUES
     :create_by,
     :last_modification_date,
     :last_modified_by,
-    :retry_count)
+    :retry_count,
+    :migration_priority)
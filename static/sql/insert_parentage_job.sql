@@ -0,0 +1,8 @@
+INSERT INTO {{.Owner}}.PARENTAGE_JOBS
+    (job_id, dataset, parent_datasets, status, last_block_name,
+     nblocks, nblocks_done, nfile_parents, error_message,
+     creation_date, last_modification_date, create_by)
+    VALUES
+    (:job_id, :dataset, :parent_datasets, :status, :last_block_name,
+     :nblocks, :nblocks_done, :nfile_parents, :error_message,
+     :creation_date, :last_modification_date, :create_by)
@@ -0,0 +1,6 @@
+UPDATE {{.Owner}}.DATASETS
+    SET LAST_MODIFIED_BY=:myuser,
+        LAST_MODIFICATION_DATE=:mydate,
+        DATASET_ACCESS_TYPE_ID = :dataset_access_type_id,
+        IS_DATASET_VALID = 0
+    WHERE DATASET_ID IN ({{.IDs}})
@@ -0,0 +1,5 @@
+UPDATE {{.Owner}}.FILES
+    SET LAST_MODIFIED_BY=:myuser,
+        LAST_MODIFICATION_DATE=:mydate,
+        IS_FILE_VALID = 0
+    WHERE FILE_ID IN ({{.IDs}})
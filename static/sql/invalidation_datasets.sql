@@ -0,0 +1,5 @@
+SELECT D.DATASET_ID, D.DATASET, DAT.DATASET_ACCESS_TYPE
+FROM {{.Owner}}.DATASETS D
+JOIN {{.Owner}}.DATASET_ACCESS_TYPES DAT ON DAT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
+WHERE D.DATASET_ID IN {{.TokenCondition}}
+ORDER BY D.DATASET
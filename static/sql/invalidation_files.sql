@@ -0,0 +1,10 @@
+SELECT F.FILE_ID, F.LOGICAL_FILE_NAME, D.DATASET
+FROM {{.Owner}}.FILES F
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = F.DATASET_ID
+{{if .FileIDs}}
+WHERE F.FILE_ID IN {{.TokenCondition}}
+{{else}}
+WHERE F.DATASET_ID IN {{.TokenCondition}}
+{{end}}
+AND F.IS_FILE_VALID = 1
+ORDER BY F.LOGICAL_FILE_NAME
@@ -0,0 +1,24 @@
+SELECT MAX(LM.LAST_MODIFICATION_DATE) AS LAST_MODIFICATION_DATE FROM (
+    SELECT D.LAST_MODIFICATION_DATE
+    FROM {{.Owner}}.DATASETS D
+    WHERE D.DATASET = :dataset
+    UNION ALL
+    SELECT B.LAST_MODIFICATION_DATE
+    FROM {{.Owner}}.BLOCKS B
+{{if .Block}}
+    WHERE B.BLOCK_NAME = :block_name
+{{else}}
+    INNER JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = B.DATASET_ID
+    WHERE D.DATASET = :dataset
+{{end}}
+    UNION ALL
+    SELECT MAX(F.LAST_MODIFICATION_DATE) AS LAST_MODIFICATION_DATE
+    FROM {{.Owner}}.FILES F
+{{if .Block}}
+    INNER JOIN {{.Owner}}.BLOCKS B ON B.BLOCK_ID = F.BLOCK_ID
+    WHERE B.BLOCK_NAME = :block_name
+{{else}}
+    INNER JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = F.DATASET_ID
+    WHERE D.DATASET = :dataset
+{{end}}
+) LM
@@ -0,0 +1,19 @@
+SELECT
+    MB.MIGRATION_BLOCK_ID,
+    MB.MIGRATION_REQUEST_ID,
+    MB.MIGRATION_BLOCK_NAME,
+    MB.MIGRATION_ORDER,
+    MB.MIGRATION_STATUS,
+    MB.RETRY_COUNT,
+    MB.MIGRATION_ERROR,
+    MB.MIGRATION_START_DATE,
+    MB.MIGRATION_END_DATE,
+    MB.BYTES_TRANSFERRED,
+    MB.FILES_TRANSFERRED,
+    MB.CREATE_BY,
+    MB.CREATION_DATE,
+    MB.LAST_MODIFIED_BY,
+    MB.LAST_MODIFICATION_DATE
+FROM {{.Owner}}.MIGRATION_BLOCKS MB
+WHERE MB.MIGRATION_REQUEST_ID = :migration_request_id
+ORDER BY MB.MIGRATION_ORDER, MB.MIGRATION_BLOCK_ID
@@ -0,0 +1,8 @@
+SELECT
+    MB.MIGRATION_BLOCK_ID,
+    MB.MIGRATION_BLOCK_NAME,
+    MB.MIGRATION_ORDER,
+    MB.MIGRATION_STATUS
+FROM {{.Owner}}.MIGRATION_BLOCKS MB
+WHERE MB.MIGRATION_REQUEST_ID = :migration_request_id
+ORDER BY MB.MIGRATION_ORDER, MB.MIGRATION_BLOCK_ID
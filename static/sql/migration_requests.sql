@@ -1,7 +1,8 @@
 SELECT MR.MIGRATION_REQUEST_ID, MR.MIGRATION_URL,
        MR.MIGRATION_INPUT, MR.MIGRATION_STATUS, MR.MIGRATION_SERVER,
        MR.CREATE_BY, MR.CREATION_DATE,
-       MR.LAST_MODIFIED_BY, MR.LAST_MODIFICATION_DATE, MR.RETRY_COUNT
+       MR.LAST_MODIFIED_BY, MR.LAST_MODIFICATION_DATE, MR.RETRY_COUNT,
+       MR.MIGRATION_PRIORITY
 FROM {{.Owner}}.MIGRATION_REQUESTS MR
 {{if .Blocks}}
 JOIN {{.Owner}}.MIGRATION_BLOCKS MB ON MB.MIGRATION_REQUEST_ID=MR.MIGRATION_REQUEST_ID
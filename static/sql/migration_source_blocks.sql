@@ -0,0 +1,10 @@
+SELECT B.BLOCK_NAME
+FROM {{.Owner}}.BLOCKS B
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = B.DATASET_ID
+{{if .Dataset}}
+WHERE D.DATASET = :dataset
+{{else}}
+WHERE B.BLOCK_NAME = :block_name
+{{end}}
+AND B.OPEN_FOR_WRITING = 0
+ORDER BY B.BLOCK_NAME
@@ -0,0 +1,4 @@
+SELECT DP.DATASET_ACCESS_TYPE
+FROM {{.Owner}}.DATASETS D
+JOIN {{.Owner}}.DATASET_ACCESS_TYPES DP ON DP.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
+WHERE D.DATASET = :dataset
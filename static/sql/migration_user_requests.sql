@@ -0,0 +1,4 @@
+SELECT MR.CREATE_BY, COUNT(*)
+FROM {{.Owner}}.MIGRATION_REQUESTS MR
+WHERE MR.MIGRATION_STATUS IN (0, 5)
+GROUP BY MR.CREATE_BY
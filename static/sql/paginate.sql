@@ -0,0 +1,16 @@
+SELECT * FROM (
+{{.Statement}}
+) PAGE
+{{if .Probe}}
+WHERE 1=0
+{{else}}
+{{if .Keyset}}
+WHERE {{.Keyset}}
+{{end}}
+ORDER BY {{.OrderBy}}
+{{if eq .Owner "sqlite"}}
+LIMIT :page_limit
+{{else}}
+FETCH FIRST :page_limit ROWS ONLY
+{{end}}
+{{end}}
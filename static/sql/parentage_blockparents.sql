@@ -0,0 +1,6 @@
+SELECT
+    BP.THIS_BLOCK_ID,
+    BP.PARENT_BLOCK_ID
+FROM {{.Owner}}.BLOCK_PARENTS BP
+JOIN {{.Owner}}.BLOCKS B ON B.BLOCK_ID = BP.THIS_BLOCK_ID
+WHERE B.DATASET_ID = :dataset_id
@@ -0,0 +1,6 @@
+SELECT
+    PD.DATASET_ID parent_dataset_id,
+    PD.DATASET parent_dataset
+FROM {{.Owner}}.DATASET_PARENTS DP
+JOIN {{.Owner}}.DATASETS PD ON PD.DATASET_ID = DP.PARENT_DATASET_ID
+WHERE DP.THIS_DATASET_ID = :dataset_id
@@ -0,0 +1,15 @@
+SELECT DISTINCT
+    TB.BLOCK_ID this_block_id,
+    TB.BLOCK_NAME this_block_name,
+    PB.BLOCK_ID parent_block_id,
+    PB.BLOCK_NAME parent_block_name,
+    PD.DATASET_ID parent_dataset_id,
+    PD.DATASET parent_dataset
+FROM {{.Owner}}.FILE_PARENTS FP
+JOIN {{.Owner}}.FILES TF ON TF.FILE_ID = FP.THIS_FILE_ID
+JOIN {{.Owner}}.BLOCKS TB ON TB.BLOCK_ID = TF.BLOCK_ID
+JOIN {{.Owner}}.FILES PF ON PF.FILE_ID = FP.PARENT_FILE_ID
+JOIN {{.Owner}}.BLOCKS PB ON PB.BLOCK_ID = PF.BLOCK_ID
+JOIN {{.Owner}}.DATASETS PD ON PD.DATASET_ID = PB.DATASET_ID
+WHERE TB.DATASET_ID = :dataset_id
+ORDER BY TB.BLOCK_NAME, PB.BLOCK_NAME
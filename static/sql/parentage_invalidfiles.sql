@@ -0,0 +1,11 @@
+SELECT
+    TF.LOGICAL_FILE_NAME this_logical_file_name,
+    PF.LOGICAL_FILE_NAME parent_logical_file_name
+FROM {{.Owner}}.FILE_PARENTS FP
+JOIN {{.Owner}}.FILES TF ON TF.FILE_ID = FP.THIS_FILE_ID
+JOIN {{.Owner}}.BLOCKS TB ON TB.BLOCK_ID = TF.BLOCK_ID
+JOIN {{.Owner}}.FILES PF ON PF.FILE_ID = FP.PARENT_FILE_ID
+WHERE TB.DATASET_ID = :dataset_id
+AND TF.IS_FILE_VALID = 1
+AND PF.IS_FILE_VALID = 0
+ORDER BY TF.LOGICAL_FILE_NAME, PF.LOGICAL_FILE_NAME
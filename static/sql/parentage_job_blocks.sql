@@ -0,0 +1,8 @@
+SELECT B.BLOCK_ID, B.BLOCK_NAME
+FROM {{.Owner}}.BLOCKS B
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = B.DATASET_ID
+WHERE D.DATASET = :dataset
+{{if .LastBlockName}}
+AND B.BLOCK_NAME > :last_block_name
+{{end}}
+ORDER BY B.BLOCK_NAME
@@ -0,0 +1,13 @@
+{{.TokenGenerator}}
+SELECT DISTINCT
+    CFL.FILE_ID this_file_id,
+    PFL.FILE_ID parent_file_id
+FROM {{.Owner}}.FILE_LUMIS CFL
+JOIN {{.Owner}}.FILES CF ON CF.FILE_ID = CFL.FILE_ID
+JOIN {{.Owner}}.FILE_LUMIS PFL
+    ON PFL.RUN_NUM = CFL.RUN_NUM
+    AND PFL.LUMI_SECTION_NUM = CFL.LUMI_SECTION_NUM
+JOIN {{.Owner}}.FILES PF ON PF.FILE_ID = PFL.FILE_ID
+WHERE CF.BLOCK_ID = :block_id
+AND PF.DATASET_ID IN {{.TokenCondition}}
+ORDER BY CFL.FILE_ID, PFL.FILE_ID
@@ -0,0 +1,4 @@
+SELECT J.JOB_ID, J.DATASET, J.PARENT_DATASETS, J.STATUS, J.LAST_BLOCK_NAME,
+    J.NBLOCKS, J.NBLOCKS_DONE, J.NFILE_PARENTS, J.ERROR_MESSAGE,
+    J.CREATION_DATE, J.LAST_MODIFICATION_DATE, J.CREATE_BY
+FROM {{.Owner}}.PARENTAGE_JOBS J
@@ -0,0 +1,9 @@
+SELECT DP.THIS_DATASET_ID AS CHILD_ID, DP.PARENT_DATASET_ID AS PARENT_ID, D.DATASET AS NAME
+FROM {{.Owner}}.DATASET_PARENTS DP
+{{if .Up}}
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = DP.PARENT_DATASET_ID
+WHERE DP.THIS_DATASET_ID IN {{.TokenCondition}}
+{{else}}
+JOIN {{.Owner}}.DATASETS D ON D.DATASET_ID = DP.THIS_DATASET_ID
+WHERE DP.PARENT_DATASET_ID IN {{.TokenCondition}}
+{{end}}
@@ -0,0 +1,9 @@
+SELECT FP.THIS_FILE_ID AS CHILD_ID, FP.PARENT_FILE_ID AS PARENT_ID, F.LOGICAL_FILE_NAME AS NAME
+FROM {{.Owner}}.FILE_PARENTS FP
+{{if .Up}}
+JOIN {{.Owner}}.FILES F ON F.FILE_ID = FP.PARENT_FILE_ID
+WHERE FP.THIS_FILE_ID IN {{.TokenCondition}}
+{{else}}
+JOIN {{.Owner}}.FILES F ON F.FILE_ID = FP.THIS_FILE_ID
+WHERE FP.PARENT_FILE_ID IN {{.TokenCondition}}
+{{end}}
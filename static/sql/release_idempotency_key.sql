@@ -0,0 +1,4 @@
+DELETE FROM {{.Owner}}.IDEMPOTENCY_KEYS
+WHERE IDEMPOTENCY_KEY = :idempotency_key
+    AND STATUS = :pending_status
+    AND CREATION_DATE = :creation_date
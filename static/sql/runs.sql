@@ -1,4 +1,4 @@
-SELECT DISTINCT FL.RUN_NUM FROM {{.Owner}}.FILE_LUMIS FL
+SELECT DISTINCT FL.RUN_NUM{{if .DatasetKey}}, DATASETS.DATASET{{end}} FROM {{.Owner}}.FILE_LUMIS FL
 {{if .Lfn}}
 inner join {{.Owner}}.FILES FILES on FILES.FILE_ID = FL.FILE_ID
 {{end}}
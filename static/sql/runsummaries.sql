@@ -3,3 +3,7 @@ SELECT MAX(LUMI_SECTION_NUM) AS MAX_LUMI FROM {{.Owner}}.FILE_LUMIS FL
 JOIN {{.Owner}}.FILES FS ON FS.FILE_ID=FL.FILE_ID
 JOIN {{.Owner}}.DATASETS DS ON FS.DATASET_ID=DS.DATASET_ID
 {{end}}
+{{if .LumiMask}}
+JOIN {{.LumiMask}} LM ON LM.RUN_NUM = FL.RUN_NUM
+AND FL.LUMI_SECTION_NUM BETWEEN LM.MIN_LUMI AND LM.MAX_LUMI
+{{end}}
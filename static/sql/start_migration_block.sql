@@ -0,0 +1,8 @@
+UPDATE {{.Owner}}.MIGRATION_BLOCKS
+    SET MIGRATION_STATUS = :migration_status,
+    RETRY_COUNT = CASE WHEN MIGRATION_STATUS = 3 THEN COALESCE(RETRY_COUNT, 0) + 1 ELSE COALESCE(RETRY_COUNT, 0) END,
+    MIGRATION_START_DATE = :migration_start_date,
+    MIGRATION_END_DATE = NULL,
+    LAST_MODIFICATION_DATE = :last_modification_date
+WHERE MIGRATION_REQUEST_ID = :migration_request_id
+AND MIGRATION_BLOCK_NAME = :migration_block_name
@@ -1,3 +1,9 @@
+{{if .PostgreSQL}}
+SELECT COALESCE(SUM(pg_relation_size(c.oid)), 0) AS db_index_size
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname ILIKE '{{.Owner}}%' AND c.relkind = 'i'
+{{else}}
 SELECT sum(bytes) AS db_index_size
 FROM dba_segments WHERE
 owner LIKE '{{.Owner}}%' and segment_type='INDEX'
+{{end}}
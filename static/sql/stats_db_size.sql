@@ -1,2 +1,8 @@
+{{if .PostgreSQL}}
+SELECT COALESCE(SUM(pg_relation_size(c.oid)), 0) AS db_size
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname ILIKE '{{.Owner}}%' AND c.relkind IN ('r', 'i', 't')
+{{else}}
 SELECT sum(bytes) AS db_size
 FROM dba_segments WHERE owner LIKE '{{.Owner}}%'
+{{end}}
@@ -1,3 +1,9 @@
+{{if .PostgreSQL}}
+SELECT n.nspname AS owner, SUM(pg_relation_size(c.oid)) AS schema_index_size
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname ILIKE '{{.Owner}}%' AND c.relkind = 'i' GROUP BY n.nspname
+{{else}}
 SELECT owner, sum(bytes) AS schema_index_size
 FROM dba_segments
 WHERE owner LIKE '{{.Owner}}%' AND segment_type='INDEX' GROUP BY owner
+{{end}}
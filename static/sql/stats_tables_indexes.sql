@@ -1,5 +1,15 @@
+{{if .PostgreSQL}}
+SELECT n.nspname AS owner, t.relname AS table_name,
+    x.relname AS index_name, pg_relation_size(x.oid) AS table_index_size
+FROM pg_index i
+    JOIN pg_class t ON t.oid = i.indrelid
+    JOIN pg_class x ON x.oid = i.indexrelid
+    JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE n.nspname ILIKE '{{.Owner}}%' ORDER BY 1, 4
+{{else}}
 SELECT t.owner AS owner, t.table_name AS table_name, 
     t.index_name AS index_name, s.bytes AS table_index_size
 FROM dba_segments s, dba_indexes t
 WHERE s.owner=t.owner AND  s.segment_name=t.index_name 
     AND s.owner LIKE '{{.Owner}}%' AND s.segment_type='INDEX' ORDER BY 1, 4
+{{end}}
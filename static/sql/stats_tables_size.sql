@@ -1,5 +1,12 @@
+{{if .PostgreSQL}}
+SELECT n.nspname AS owner, t.relname AS table_name,
+    t.reltuples AS nrows, pg_relation_size(t.oid) AS table_size
+FROM pg_class t JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE n.nspname ILIKE '{{.Owner}}%' AND t.relkind = 'r' ORDER BY 1, 3
+{{else}}
 SELECT t.owner AS owner, t.table_name AS table_name, 
     t.num_rows AS nrows, s.bytes AS table_size
 FROM dba_segments s, dba_tables t
 WHERE s.owner=t.owner AND s.segment_name=t.table_name 
     AND s.owner LIKE '{{.Owner}}%' AND s.segment_type='TABLE' ORDER BY 1, 3
+{{end}}
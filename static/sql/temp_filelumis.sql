@@ -1,3 +1,9 @@
+{{if .PostgreSQL}}
+CREATE TEMPORARY TABLE IF NOT EXISTS {{.TempTable}}
+(RUN_NUM BIGINT, LUMI_SECTION_NUM BIGINT, FILE_ID BIGINT, EVENT_COUNT BIGINT)
+ON COMMIT DROP
+{{else}}
 CREATE PRIVATE TEMPORARY TABLE {{.TempTable}}
 (RUN_NUM INTEGER, LUMI_SECTION_NUM INTEGER, FILE_ID INTEGER, EVENT_COUNT INTEGER)
 ON COMMIT DROP DEFINITION
+{{end}}
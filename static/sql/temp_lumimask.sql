@@ -0,0 +1,12 @@
+{{if .PostgreSQL}}
+CREATE TEMPORARY TABLE IF NOT EXISTS {{.TempTable}}
+(RUN_NUM BIGINT, MIN_LUMI BIGINT, MAX_LUMI BIGINT)
+ON COMMIT DROP
+{{else if eq .Owner "sqlite"}}
+CREATE TEMPORARY TABLE IF NOT EXISTS {{.TempTable}}
+(RUN_NUM INTEGER, MIN_LUMI INTEGER, MAX_LUMI INTEGER)
+{{else}}
+CREATE PRIVATE TEMPORARY TABLE {{.TempTable}}
+(RUN_NUM INTEGER, MIN_LUMI INTEGER, MAX_LUMI INTEGER)
+ON COMMIT DROP DEFINITION
+{{end}}
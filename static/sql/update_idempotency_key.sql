@@ -0,0 +1,6 @@
+UPDATE {{.Owner}}.IDEMPOTENCY_KEYS
+    SET STATUS = :status,
+    RESPONSE = :response
+WHERE IDEMPOTENCY_KEY = :idempotency_key
+    AND STATUS = :pending_status
+    AND CREATION_DATE = :creation_date
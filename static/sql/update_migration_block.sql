@@ -0,0 +1,9 @@
+UPDATE {{.Owner}}.MIGRATION_BLOCKS
+    SET MIGRATION_STATUS = :migration_status,
+    MIGRATION_ERROR = :migration_error,
+    MIGRATION_END_DATE = :migration_end_date,
+    BYTES_TRANSFERRED = :bytes_transferred,
+    FILES_TRANSFERRED = :files_transferred,
+    LAST_MODIFICATION_DATE = :last_modification_date
+WHERE MIGRATION_REQUEST_ID = :migration_request_id
+AND MIGRATION_BLOCK_NAME = :migration_block_name
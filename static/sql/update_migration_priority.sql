@@ -0,0 +1,6 @@
+UPDATE {{.Owner}}.MIGRATION_REQUESTS
+    SET MIGRATION_PRIORITY = :migration_priority,
+    LAST_MODIFIED_BY = :last_modified_by,
+    LAST_MODIFICATION_DATE = :last_modification_date
+WHERE MIGRATION_REQUEST_ID = :migration_request_id
+AND MIGRATION_STATUS IN (0, 1, 3, 5)
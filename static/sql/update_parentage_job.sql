@@ -0,0 +1,8 @@
+UPDATE {{.Owner}}.PARENTAGE_JOBS
+    SET STATUS = :status,
+    LAST_BLOCK_NAME = :last_block_name,
+    NBLOCKS_DONE = :nblocks_done,
+    NFILE_PARENTS = :nfile_parents,
+    ERROR_MESSAGE = :error_message,
+    LAST_MODIFICATION_DATE = :last_modification_date
+WHERE JOB_ID = :job_id
@@ -2,15 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dmwm/dbs2go/dbs"
+	dbsGraphQL "github.com/dmwm/dbs2go/graphql"
 	"github.com/dmwm/dbs2go/utils"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -172,3 +176,487 @@ func TestBulkBlocks(t *testing.T) {
 		t.Fatalf("Fail to process bulkblocks data %v\n", err)
 	}
 }
+
+// TestBulkBlocksGraphQL provides test of GraphQL queries over bulkblocks data
+func TestBulkBlocksGraphQL(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	schema := dbsGraphQL.InitSchema("../static/schema/schema.graphql", db)
+	query := `{
+  datasets(pattern: "/unittest_web_primary_ds_name_14144/*", accessType: "*", first: 1) {
+    edges {
+      node {
+        name
+        dataTier
+        acquisitionEra { name }
+        processingEra { processingVersion }
+        runs { runNumber }
+        blocks {
+          totalCount
+          edges {
+            node {
+              name
+              dataset { name }
+              files(first: 4) {
+                totalCount
+                pageInfo { hasNextPage endCursor }
+                edges { node { lfn parents { lfn } lumis { runNumber } } }
+              }
+            }
+          }
+        }
+      }
+    }
+    pageInfo { hasNextPage }
+  }
+}`
+	resp := schema.Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("GraphQL query failed: %v", resp.Errors)
+	}
+	var data struct {
+		Datasets struct {
+			Edges []struct {
+				Node struct {
+					Name           string
+					DataTier       string
+					AcquisitionEra struct{ Name string }
+					ProcessingEra  struct{ ProcessingVersion int }
+					Runs           []struct{ RunNumber int }
+					Blocks         struct {
+						TotalCount int
+						Edges      []struct {
+							Node struct {
+								Name    string
+								Dataset struct{ Name string }
+								Files   struct {
+									TotalCount int
+									PageInfo   struct {
+										HasNextPage bool
+										EndCursor   string
+									}
+									Edges []struct {
+										Node struct {
+											Lfn     string
+											Parents []struct{ Lfn string }
+											Lumis   []struct{ RunNumber int }
+										}
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	dataset := "/unittest_web_primary_ds_name_14144/Summer2011-pstr-v10/GEN-SIM-RAW"
+	if len(data.Datasets.Edges) != 1 {
+		t.Fatalf("wrong number of datasets: %s", string(resp.Data))
+	}
+	ds := data.Datasets.Edges[0].Node
+	if ds.Name != dataset || ds.DataTier != "GEN-SIM-RAW" {
+		t.Fatalf("wrong dataset %+v", ds)
+	}
+	if ds.AcquisitionEra.Name != "Summer2011" || ds.ProcessingEra.ProcessingVersion != 10 {
+		t.Fatalf("wrong dataset eras %+v", ds)
+	}
+	if len(ds.Runs) != 3 {
+		t.Fatalf("wrong dataset runs %+v", ds.Runs)
+	}
+	if ds.Blocks.TotalCount != 1 || len(ds.Blocks.Edges) != 1 {
+		t.Fatalf("wrong dataset blocks %+v", ds.Blocks)
+	}
+	blk := ds.Blocks.Edges[0].Node
+	if blk.Dataset.Name != dataset {
+		t.Fatalf("wrong block dataset %+v", blk)
+	}
+	if blk.Files.TotalCount != 12 || len(blk.Files.Edges) != 4 || !blk.Files.PageInfo.HasNextPage {
+		t.Fatalf("wrong block files %+v", blk.Files)
+	}
+	lfn := "/store/data/a/b/A/a/1/abcd0.root"
+	if blk.Files.Edges[0].Node.Lfn != lfn || len(blk.Files.Edges[0].Node.Lumis) != 3 {
+		t.Fatalf("wrong first file %+v", blk.Files.Edges[0])
+	}
+
+	// fetch next page of files of the block
+	query = fmt.Sprintf(`{ block(name: %q) { files(first: 10, after: %q) { edges { node { lfn parents { lfn } } } } } }`,
+		blk.Name, blk.Files.PageInfo.EndCursor)
+	resp = schema.Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("GraphQL query failed: %v", resp.Errors)
+	}
+	var page struct {
+		Block struct {
+			Files struct {
+				Edges []struct {
+					Node struct {
+						Lfn     string
+						Parents []struct{ Lfn string }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &page); err != nil {
+		t.Fatal(err)
+	}
+	edges := page.Block.Files.Edges
+	if len(edges) != 8 || edges[0].Node.Lfn != "/store/data/a/b/A/a/1/abcd4.root" {
+		t.Fatalf("wrong next page of files %s", string(resp.Data))
+	}
+	if len(edges[0].Node.Parents) != 1 || edges[0].Node.Parents[0].Lfn != "/store/data/a/b/A/a/1/parent/abcd3.root" {
+		t.Fatalf("wrong file parents %+v", edges[0].Node)
+	}
+
+	// page through all datasets, the pages should be disjoint
+	insertParentageDataset(t, "graphql", "a", nil, "")
+	insertParentageDataset(t, "graphql", "b", nil, "")
+	var names []string
+	after := ""
+	for {
+		arg := ""
+		if after != "" {
+			arg = fmt.Sprintf(", after: %q", after)
+		}
+		query = fmt.Sprintf(`{ datasets(pattern: "/*", accessType: "*", first: 1%s) { edges { node { name } } pageInfo { hasNextPage hasPreviousPage endCursor } } }`, arg)
+		resp = schema.Exec(context.Background(), query, "", nil)
+		if len(resp.Errors) > 0 {
+			t.Fatalf("GraphQL query failed: %v", resp.Errors)
+		}
+		var dsets struct {
+			Datasets struct {
+				Edges []struct {
+					Node struct{ Name string }
+				}
+				PageInfo struct {
+					HasNextPage     bool
+					HasPreviousPage bool
+					EndCursor       string
+				}
+			}
+		}
+		if err := json.Unmarshal(resp.Data, &dsets); err != nil {
+			t.Fatal(err)
+		}
+		info := dsets.Datasets.PageInfo
+		if len(dsets.Datasets.Edges) != 1 || info.HasPreviousPage != (after != "") {
+			t.Fatalf("wrong page of datasets %s", string(resp.Data))
+		}
+		name := dsets.Datasets.Edges[0].Node.Name
+		if len(names) > 0 && name <= names[len(names)-1] {
+			t.Fatalf("page of datasets %s repeats previous pages %v", name, names)
+		}
+		names = append(names, name)
+		if !info.HasNextPage {
+			break
+		}
+		after = info.EndCursor
+	}
+	if len(names) < 3 {
+		t.Errorf("wrong number of paged datasets %v", names)
+	}
+}
+
+// TestBulkBlocksStream provides test of bulkblocks insertion with streaming decoder
+func TestBulkBlocksStream(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// use small batches to insert files in several steps
+	batch, chunk := dbs.StreamFilesBatch, dbs.FileChunkSize
+	dbs.StreamFilesBatch = 3
+	dbs.FileChunkSize = 2
+	defer func() {
+		dbs.StreamFilesBatch, dbs.FileChunkSize = batch, chunk
+	}()
+
+	data, err := ioutil.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataset := "/unittest_stream/Summer2011-pstr-v10/GEN-SIM-RAW"
+	// helper function to create block with given name, its files have
+	// the block name as a prefix and optionally have parent files
+	newBlock := func(name string, parents bool) dbs.BulkBlocks {
+		var rec dbs.BulkBlocks
+		if err := json.Unmarshal(data, &rec); err != nil {
+			t.Fatal(err)
+		}
+		lfn := func(l string) string {
+			return strings.Replace(l, "/1/abcd", fmt.Sprintf("/1/%s_abcd", name), 1)
+		}
+		rec.Dataset.Dataset = dataset
+		rec.Block.BlockName = fmt.Sprintf("%s#%s", dataset, name)
+		var parentList []dbs.FileParentRecord
+		for i, f := range rec.Files {
+			if parents {
+				parentList = append(parentList, dbs.FileParentRecord{
+					ThisLogicalFileName:   lfn(f.LogicalFileName),
+					ParentLogicalFileName: strings.Replace(f.LogicalFileName, "/1/abcd", "/1/parent_abcd", 1),
+				})
+			}
+			rec.Files[i].LogicalFileName = lfn(f.LogicalFileName)
+		}
+		for i, f := range rec.FileConfigList {
+			rec.FileConfigList[i].LFN = lfn(f.LFN)
+		}
+		rec.FileParentList = parentList
+		return rec
+	}
+
+	// helper function to insert block via streaming API
+	insert := func(rec dbs.BulkBlocks) *dbs.API {
+		payload, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		api := &dbs.API{
+			Reader:   bytes.NewReader(payload),
+			Writer:   utils.StdoutWriter(""),
+			CreateBy: "tester",
+		}
+		if err := api.InsertBulkBlocksStream(); err != nil {
+			t.Fatalf("fail to insert block %s, error %v", rec.Block.BlockName, err)
+		}
+		return api
+	}
+
+	// helper function to count records of given block
+	count := func(stm, block string) int {
+		var n int
+		if err := db.QueryRow(stm, block).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	filesStm := "SELECT COUNT(*) FROM FILES F JOIN BLOCKS B ON F.BLOCK_ID = B.BLOCK_ID WHERE B.BLOCK_NAME = ?"
+	lumisStm := "SELECT COUNT(*) FROM FILE_LUMIS L JOIN FILES F ON L.FILE_ID = F.FILE_ID JOIN BLOCKS B ON F.BLOCK_ID = B.BLOCK_ID WHERE B.BLOCK_NAME = ?"
+	parentsStm := "SELECT COUNT(*) FROM FILE_PARENTS P JOIN FILES F ON P.THIS_FILE_ID = F.FILE_ID JOIN BLOCKS B ON F.BLOCK_ID = B.BLOCK_ID WHERE B.BLOCK_NAME = ?"
+
+	// insert parent block and its child with file parentage
+	parent := newBlock("parent", false)
+	api := insert(parent)
+	if api.Params["block_name"] != parent.Block.BlockName || api.Params["nfiles"] != len(parent.Files) {
+		t.Errorf("wrong API parameters %+v", api.Params)
+	}
+	child := newBlock("child", true)
+	insert(child)
+
+	var nlumis int
+	for _, f := range child.Files {
+		nlumis += len(f.FileLumiList)
+	}
+	block := child.Block.BlockName
+	if n := count(filesStm, block); n != len(child.Files) {
+		t.Errorf("wrong number of inserted files %d, expect %d", n, len(child.Files))
+	}
+	if n := count(lumisStm, block); n != nlumis {
+		t.Errorf("wrong number of inserted lumis %d, expect %d", n, nlumis)
+	}
+	if n := count(parentsStm, block); n != len(child.FileParentList) {
+		t.Errorf("wrong number of inserted file parents %d, expect %d", n, len(child.FileParentList))
+	}
+
+	// block with missing parent files should not be inserted
+	orphan := newBlock("orphan", true)
+	orphan.FileParentList[0].ParentLogicalFileName = "/store/data/a/b/A/a/1/missing.root"
+	payload, _ := json.Marshal(orphan)
+	api = &dbs.API{Reader: bytes.NewReader(payload), CreateBy: "tester"}
+	err = api.InsertBulkBlocksStream()
+	if err == nil || !strings.Contains(err.Error(), "missing.root") {
+		t.Errorf("block with missing parent files is inserted, error %v", err)
+	}
+	if n := count(filesStm, orphan.Block.BlockName); n != 0 {
+		t.Errorf("files of block with missing parent files are inserted")
+	}
+}
+
+// TestBulkBlocksBatch provides test of bulkblocks batch insertion
+func TestBulkBlocksBatch(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	chunk := dbs.FileChunkSize
+	dbs.FileChunkSize = 2
+	defer func() {
+		dbs.FileChunkSize = chunk
+	}()
+
+	data, err := ioutil.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataset := "/unittest_batch/Summer2011-pstr-v10/GEN-SIM-RAW"
+	// helper function to create block with given name, its files have
+	// the block name as a prefix
+	newBlock := func(name string) dbs.BulkBlocks {
+		var rec dbs.BulkBlocks
+		if err := json.Unmarshal(data, &rec); err != nil {
+			t.Fatal(err)
+		}
+		lfn := func(l string) string {
+			return strings.Replace(l, "/1/abcd", fmt.Sprintf("/1/%s_abcd", name), 1)
+		}
+		rec.Dataset.Dataset = dataset
+		rec.Block.BlockName = fmt.Sprintf("%s#%s", dataset, name)
+		for i, f := range rec.Files {
+			rec.Files[i].LogicalFileName = lfn(f.LogicalFileName)
+		}
+		for i, f := range rec.FileConfigList {
+			rec.FileConfigList[i].LFN = lfn(f.LFN)
+		}
+		rec.FileParentList = nil
+		return rec
+	}
+
+	// helper function to insert batch of blocks and return its report
+	insert := func(payload []byte, atomic bool) ([]dbs.BulkBlocksResult, *dbs.API) {
+		rr := httptest.NewRecorder()
+		api := &dbs.API{
+			Reader:   bytes.NewReader(payload),
+			Writer:   rr,
+			Params:   dbs.Record{"atomic": fmt.Sprintf("%v", atomic)},
+			CreateBy: "tester",
+		}
+		if err := api.InsertBulkBlocksBatch(); err != nil {
+			t.Fatalf("fail to insert batch, error %v", err)
+		}
+		var results []dbs.BulkBlocksResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		return results, api
+	}
+
+	// helper function to check statuses of the batch report
+	check := func(results []dbs.BulkBlocksResult, statuses ...string) {
+		if len(results) != len(statuses) {
+			t.Fatalf("wrong number of results %+v", results)
+		}
+		for i, r := range results {
+			if r.Status != statuses[i] {
+				t.Errorf("wrong status of block %s: %s, expect %s (%s)", r.Block, r.Status, statuses[i], r.Reason)
+			}
+		}
+	}
+
+	// helper function to count files of given block
+	count := func(block string) int {
+		var n int
+		stm := "SELECT COUNT(*) FROM FILES F JOIN BLOCKS B ON F.BLOCK_ID = B.BLOCK_ID WHERE B.BLOCK_NAME = ?"
+		if err := db.QueryRow(stm, block).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// insert NDJSON batch with per-block transactions where last block
+	// duplicates the first one
+	b1, b2 := newBlock("batch1"), newBlock("batch2")
+	var payload []byte
+	for _, rec := range []dbs.BulkBlocks{b1, b2, b1} {
+		d, _ := json.Marshal(rec)
+		payload = append(payload, d...)
+		payload = append(payload, '\n')
+	}
+	results, api := insert(payload, false)
+	check(results, dbs.BlockInserted, dbs.BlockInserted, dbs.BlockFailed)
+	if results[2].Code != dbs.BlockAlreadyExists {
+		t.Errorf("wrong error code of duplicate block %+v", results[2])
+	}
+	for _, rec := range []dbs.BulkBlocks{b1, b2} {
+		if n := count(rec.Block.BlockName); n != len(rec.Files) {
+			t.Errorf("wrong number of inserted files %d, expect %d", n, len(rec.Files))
+		}
+	}
+	if api.Params["nfiles"] != len(b1.Files)+len(b2.Files) {
+		t.Errorf("wrong API parameters %+v", api.Params)
+	}
+
+	// insert JSON array batch within single transaction where second block
+	// duplicates already inserted one, therefore nothing should be inserted
+	b3, b4 := newBlock("batch3"), newBlock("batch4")
+	payload, _ = json.Marshal([]dbs.BulkBlocks{b3, b2, b4})
+	results, _ = insert(payload, true)
+	check(results, dbs.BlockRolledBack, dbs.BlockFailed, dbs.BlockSkipped)
+	if n := count(b3.Block.BlockName); n != 0 {
+		t.Errorf("files of rolled back block are inserted")
+	}
+
+	// insert the same batch without duplicate block
+	payload, _ = json.Marshal([]dbs.BulkBlocks{b3, b4})
+	results, _ = insert(payload, true)
+	check(results, dbs.BlockInserted, dbs.BlockInserted)
+	for _, rec := range []dbs.BulkBlocks{b3, b4} {
+		if n := count(rec.Block.BlockName); n != len(rec.Files) {
+			t.Errorf("wrong number of inserted files %d, expect %d", n, len(rec.Files))
+		}
+	}
+
+	// dataset of rolled back atomic batch should not be inserted either
+	b5 := newBlock("batch5")
+	b5.Dataset.Dataset = "/unittest_batch/Summer2011-pstr-v10/GEN-SIM-RECO"
+	b5.Block.BlockName = b5.Dataset.Dataset + "#batch5"
+	payload, _ = json.Marshal([]dbs.BulkBlocks{b5, b2})
+	results, _ = insert(payload, true)
+	check(results, dbs.BlockRolledBack, dbs.BlockFailed)
+	var n int
+	stm := "SELECT COUNT(*) FROM DATASETS WHERE DATASET = ?"
+	if err := db.QueryRow(stm, b5.Dataset.Dataset).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("dataset %s of rolled back batch is inserted", b5.Dataset.Dataset)
+	}
+
+	// duplicate block name within atomic batch fails and it is not merged
+	// into the first block, even if its files are different
+	b7, dup := newBlock("batch7"), newBlock("batch7dup")
+	dup.Block.BlockName = b7.Block.BlockName
+	payload, _ = json.Marshal([]dbs.BulkBlocks{b7, dup})
+	results, _ = insert(payload, true)
+	check(results, dbs.BlockRolledBack, dbs.BlockFailed)
+	if results[1].Code != dbs.BlockAlreadyExists {
+		t.Errorf("wrong error code of duplicate block %+v", results[1])
+	}
+	if n := count(b7.Block.BlockName); n != 0 {
+		t.Errorf("files of rolled back block are inserted")
+	}
+
+	// malformed record of NDJSON batch is reported as failed while
+	// preceding block is inserted and reported
+	b6 := newBlock("batch6")
+	payload, _ = json.Marshal(b6)
+	payload = append(payload, []byte("\n{\"block\": \n")...)
+	results, api = insert(payload, false)
+	check(results, dbs.BlockInserted, dbs.BlockFailed)
+	if results[1].Code != dbs.UnmarshalErrorCode {
+		t.Errorf("wrong error code of malformed record %+v", results[1])
+	}
+	if n := count(b6.Block.BlockName); n != len(b6.Files) {
+		t.Errorf("wrong number of inserted files %d, expect %d", n, len(b6.Files))
+	}
+	if api.Params["nfiles"] != len(b6.Files) {
+		t.Errorf("wrong API parameters %+v", api.Params)
+	}
+}
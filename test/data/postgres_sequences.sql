@@ -0,0 +1,15 @@
+-- Restart DBS sequences from 1 without caching so that PostgreSQL assigns
+-- consecutive IDs in the same way as SQLite backend does, which is what
+-- integration test expectations are based on.
+DO $$
+DECLARE
+    s record;
+BEGIN
+    FOR s IN SELECT sequence_schema, sequence_name
+             FROM information_schema.sequences
+             WHERE sequence_schema = current_schema()
+    LOOP
+        EXECUTE format('ALTER SEQUENCE %I.%I RESTART WITH 1 CACHE 1',
+                       s.sequence_schema, s.sequence_name);
+    END LOOP;
+END $$;
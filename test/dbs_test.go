@@ -146,6 +146,37 @@ func TestDBSGetRecID(t *testing.T) {
 	}
 }
 
+// TestDBSLastInsertID
+func TestDBSLastInsertID(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unable to get DB transaction: %v\n", err)
+	}
+	defer tx.Rollback()
+
+	// sqlite IDs are based on nanoseconds and exceed float64 precision (2^53)
+	var id int64 = 1<<53 + 1
+	stm := fmt.Sprintf("INSERT INTO DATA_TIERS (DATA_TIER_ID, DATA_TIER_NAME, CREATION_DATE, CREATE_BY) VALUES (%d, 'RAW-TEST-ID', 1607536535, 'tester')", id)
+	if _, err := tx.Exec(stm); err != nil {
+		t.Fatal(err)
+	}
+	rid, err := dbs.LastInsertID(tx, "DATA_TIERS", "data_tier_id")
+	if err != nil {
+		t.Fatal("fail to execute LastInsertID", err)
+	}
+	if rid != id {
+		t.Errorf("fail to execute LastInsertID, found rid=%v need rid=%v", rid, id)
+	}
+}
+
 // TestDBSUtilGetChunks
 func TestDBSUtilGetChunks(t *testing.T) {
 	input := []string{"1", "2", "3", "4", "5"}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// helper function to read exported block dumps of given file
+func readExportFile(t *testing.T, fname string) []dbs.BulkBlocks {
+	file, err := os.Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(fname, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	var records []dbs.BulkBlocks
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec dbs.BulkBlocks
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// TestExportImport tests export of datasets and their import back to DBS
+func TestExportImport(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+	// import uses concurrent bulkblocks API which inserts files in chunks
+	chunk := dbs.FileChunkSize
+	dbs.FileChunkSize = 2
+	defer func() {
+		dbs.FileChunkSize = chunk
+	}()
+
+	// insert dataset z and its child b, the child goes first in
+	// alphabetical order but it should be exported after its parent
+	parent, _ := insertParentageDataset(t, "export", "z", nil, "")
+	child, _ := insertParentageDataset(t, "export", "b", []string{parent}, "z")
+	order := []string{parent + "#1", child + "#1"}
+
+	// export datasets as file per block
+	dir := t.TempDir()
+	jdir := filepath.Join(dir, "json")
+	report, err := dbs.ExportDatasets("/unittest_export_*", dbs.ExportOptions{Dir: jdir, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 2 || len(report.Output) != 2 || report.Files == 0 {
+		t.Fatalf("wrong export report %+v", report)
+	}
+	for i, fname := range report.Output {
+		if !strings.HasSuffix(fname, fmt.Sprintf("%06d.json.gz", i+1)) {
+			t.Errorf("wrong export file %s", fname)
+		}
+		records := readExportFile(t, fname)
+		if len(records) != 1 || records[0].Block.BlockName != order[i] {
+			t.Errorf("wrong block dump in %s, expect %s", fname, order[i])
+		}
+	}
+
+	// export datasets as single ndjson file
+	ndir := filepath.Join(dir, "ndjson")
+	report, err = dbs.ExportDatasets("/unittest_export_*", dbs.ExportOptions{Dir: ndir, Format: "ndjson"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 2 || len(report.Output) != 1 {
+		t.Fatalf("wrong export report %+v", report)
+	}
+	fname := report.Output[0]
+	records := readExportFile(t, fname)
+	if len(records) != 2 {
+		t.Fatalf("wrong number of block dumps in %s: %d", fname, len(records))
+	}
+	for i, rec := range records {
+		if rec.Block.BlockName != order[i] {
+			t.Errorf("wrong block dump %d in %s, expect %s", i, fname, order[i])
+		}
+	}
+	if !reflect.DeepEqual(records[1].DatasetParentList, []string{parent}) {
+		t.Errorf("wrong dataset parents %v", records[1].DatasetParentList)
+	}
+
+	// import exported blocks back, they already exist in DBS
+	state := filepath.Join(dir, "json.imported")
+	ireport, err := dbs.ImportBlocks(jdir, dbs.ImportOptions{StateFile: state, CreateBy: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ireport.Blocks != 2 || ireport.Existing != 2 || ireport.Failed != 0 {
+		t.Fatalf("wrong import report %+v", ireport)
+	}
+
+	// resumed import skips blocks listed in state file
+	ireport, err = dbs.ImportBlocks(fname, dbs.ImportOptions{StateFile: state, CreateBy: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ireport.Blocks != 2 || ireport.Skipped != 2 {
+		t.Fatalf("wrong import report %+v", ireport)
+	}
+
+	// import renamed datasets which do not exist in DBS
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.ReplaceAll(data, []byte("export_"), []byte("imported_"))
+	iname := filepath.Join(dir, "imported.ndjson")
+	if err := os.WriteFile(iname, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ireport, err = dbs.ImportBlocks(iname, dbs.ImportOptions{StateFile: iname + ".imported", CreateBy: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ireport.Blocks != 2 || ireport.Imported != 2 || ireport.Files != int64(report.Files) {
+		t.Fatalf("wrong import report %+v errors %v", ireport, ireport.Errors)
+	}
+	report, err = dbs.ExportDatasets("/unittest_imported_*", dbs.ExportOptions{Dir: filepath.Join(dir, "imported")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 2 || !reflect.DeepEqual(report.Datasets, []string{
+		strings.Replace(parent, "export_", "imported_", 1),
+		strings.Replace(child, "export_", "imported_", 1)}) {
+		t.Errorf("wrong export report of imported datasets %+v", report)
+	}
+}
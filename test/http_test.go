@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,8 +13,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+	"github.com/apache/arrow/go/v15/parquet/pqarrow"
 	"github.com/dmwm/dbs2go/dbs"
 	"github.com/dmwm/dbs2go/utils"
 	"github.com/dmwm/dbs2go/web"
@@ -232,3 +244,1698 @@ func TestHTTPPut(t *testing.T) {
 		t.Errorf("acquisition era is not found after GET request")
 	}
 }
+
+// TestHTTPPagination provides test of limit/cursor parameters of GET APIs
+func TestHTTPPagination(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// insert few data tiers which we will fetch page by page
+	insertTier := func(tier string) {
+		data := []byte(fmt.Sprintf(`{"data_tier_name":"%s","creation_date":1607536535,"create_by":"test"}`, tier))
+		api := dbs.API{
+			Reader:   bytes.NewReader(data),
+			Writer:   utils.StdoutWriter(""),
+			CreateBy: "test",
+		}
+		if err := api.InsertDataTiers(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tiers := []string{"PAGE-TIER-A", "PAGE-TIER-B", "PAGE-TIER-C"}
+	for _, tier := range tiers {
+		insertTier(tier)
+	}
+
+	// fetch all pages with limit=2
+	var found []string
+	rurl := "/dbs2go/datatiers?data_tier_name=PAGE-TIER-*&limit=2"
+	for pages := 0; pages < 3; pages++ {
+		rr, err := respRecorder("GET", rurl, nil, web.DatatiersHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []dbs.Record
+		err = json.Unmarshal(rr.Body.Bytes(), &records)
+		if err != nil {
+			t.Fatalf("unable to unmarshal received data '%s', error %v", rr.Body.String(), err)
+		}
+		if len(records) > 2 {
+			t.Errorf("page contains %d records while limit is 2", len(records))
+		}
+		for _, rec := range records {
+			found = append(found, fmt.Sprintf("%v", rec["data_tier_name"]))
+		}
+		cursor := rr.Result().Trailer.Get(dbs.NextCursorHeader)
+		if cursor == "" {
+			break
+		}
+		if pages == 0 {
+			// record inserted before the cursor should not shift next page
+			insertTier("PAGE-TIER-0")
+		}
+		rurl = fmt.Sprintf("/dbs2go/datatiers?data_tier_name=PAGE-TIER-*&cursor=%s", cursor)
+	}
+	if !utils.Equal(found, tiers) {
+		t.Errorf("wrong paginated results %v, expected %v", found, tiers)
+	}
+
+	// cursor should not be accepted with different API parameters
+	_, err := respRecorder("GET", "/dbs2go/datatiers?limit=1&cursor=bla", nil, web.DatatiersHandler)
+	if err == nil {
+		t.Error("invalid cursor is accepted")
+	}
+}
+
+// TestHTTPColumnar provides test of Arrow and Parquet output of GET APIs
+func TestHTTPColumnar(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// insert few data tiers which we will fetch in columnar format
+	tiers := []string{"COLUMNAR-TIER-A", "COLUMNAR-TIER-B"}
+	for _, tier := range tiers {
+		data := []byte(fmt.Sprintf(`{"data_tier_name":"%s","creation_date":1607536535,"create_by":"test"}`, tier))
+		api := dbs.API{
+			Reader:   bytes.NewReader(data),
+			Writer:   utils.StdoutWriter(""),
+			CreateBy: "test",
+		}
+		if err := api.InsertDataTiers(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, ctype := range []string{dbs.ArrowContentType, dbs.ParquetContentType} {
+		req, err := http.NewRequest("GET", "/dbs2go/datatiers?data_tier_name=COLUMNAR-TIER-*", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", ctype)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(web.DatatiersHandler).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("HTTP status %v, response %s", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Content-Type") != ctype {
+			t.Errorf("wrong content type %s, expected %s", rr.Header().Get("Content-Type"), ctype)
+		}
+
+		// read columnar data into arrow table
+		var table arrow.Table
+		if ctype == dbs.ArrowContentType {
+			reader, err := ipc.NewReader(bytes.NewReader(rr.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var records []arrow.Record
+			for reader.Next() {
+				rec := reader.Record()
+				rec.Retain()
+				records = append(records, rec)
+			}
+			table = array.NewTableFromRecords(reader.Schema(), records)
+			reader.Release()
+		} else {
+			table, err = pqarrow.ReadTable(
+				context.Background(), bytes.NewReader(rr.Body.Bytes()),
+				nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if table.NumRows() != int64(len(tiers)) {
+			t.Errorf("%s output contains %d rows, expected %d", ctype, table.NumRows(), len(tiers))
+		}
+		fields := table.Schema().FieldIndices("creation_date")
+		if len(fields) != 1 || table.Schema().Field(fields[0]).Type.ID() != arrow.INT64 {
+			t.Errorf("%s output has wrong creation_date column, schema %v", ctype, table.Schema())
+		}
+		fields = table.Schema().FieldIndices("data_tier_name")
+		if len(fields) != 1 || table.Schema().Field(fields[0]).Type.ID() != arrow.STRING {
+			t.Errorf("%s output has wrong data_tier_name column, schema %v", ctype, table.Schema())
+		}
+		table.Release()
+	}
+}
+
+// TestHTTPDelimited provides test of CSV and TSV output of GET APIs
+func TestHTTPDelimited(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// insert data tier which we will fetch in CSV/TSV format
+	data := []byte(`{"data_tier_name":"CSV-TIER-A","creation_date":1607536535,"create_by":"test"}`)
+	api := dbs.API{
+		Reader:   bytes.NewReader(data),
+		Writer:   utils.StdoutWriter(""),
+		CreateBy: "test",
+	}
+	if err := api.InsertDataTiers(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ctype := range []string{dbs.CSVContentType, dbs.TSVContentType} {
+		for _, encoding := range []string{"", "gzip"} {
+			req, err := http.NewRequest("GET", "/dbs2go/datatiers?data_tier_name=CSV-TIER-*", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", ctype)
+			if encoding != "" {
+				req.Header.Set("Accept-Encoding", encoding)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(web.DatatiersHandler).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("HTTP status %v, response %s", rr.Code, rr.Body.String())
+			}
+			if rr.Header().Get("Content-Type") != ctype {
+				t.Errorf("wrong content type %s, expected %s", rr.Header().Get("Content-Type"), ctype)
+			}
+			var reader io.Reader = rr.Body
+			if encoding == "gzip" {
+				reader, err = gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sep := ","
+			if ctype == dbs.TSVContentType {
+				sep = "\t"
+			}
+			lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("%s output should contain header and one row, got '%s'", ctype, string(body))
+			}
+			header := strings.Split(lines[0], sep)
+			row := strings.Split(lines[1], sep)
+			if len(header) != len(row) {
+				t.Errorf("%s header %v does not match row %v", ctype, header, row)
+			}
+			found := false
+			for i, col := range header {
+				if col == "data_tier_name" && row[i] == "CSV-TIER-A" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s output does not contain data tier, got '%s'", ctype, string(body))
+			}
+		}
+	}
+}
+
+// TestHTTPCache provides test of reader API response cache
+func TestHTTPCache(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	web.ResponseCache = web.NewCache(map[string]int{"datatiers": 300}, 10, 0)
+	defer func() { web.ResponseCache = nil }()
+
+	// helper function to insert data tier bypassing web handlers
+	insertTier := func(tier string) {
+		data := []byte(fmt.Sprintf(`{"data_tier_name":"%s","creation_date":1607536535,"create_by":"test"}`, tier))
+		api := dbs.API{
+			Reader:   bytes.NewReader(data),
+			Writer:   utils.StdoutWriter(""),
+			CreateBy: "test",
+		}
+		if err := api.InsertDataTiers(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// helper function to fetch data tiers via web handler
+	getTiers := func() []string {
+		rr, err := respRecorder("GET", "/dbs2go/datatiers?data_tier_name=CACHE-TIER-*", nil, web.DatatiersHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []dbs.Record
+		if err := json.NewDecoder(rr.Body).Decode(&records); err != nil {
+			t.Fatal(err)
+		}
+		var tiers []string
+		for _, rec := range records {
+			tiers = append(tiers, fmt.Sprintf("%v", rec["data_tier_name"]))
+		}
+		return tiers
+	}
+
+	insertTier("CACHE-TIER-A")
+	hits, misses := web.CacheHits, web.CacheMisses
+	if tiers := getTiers(); len(tiers) != 1 {
+		t.Fatalf("wrong data tiers %v", tiers)
+	}
+	if web.CacheMisses != misses+1 {
+		t.Errorf("first request should miss the cache")
+	}
+
+	// new tier inserted directly into DB is not visible until cache entry expires
+	insertTier("CACHE-TIER-B")
+	if tiers := getTiers(); len(tiers) != 1 {
+		t.Errorf("request should be served from the cache, got %v", tiers)
+	}
+	if web.CacheHits != hits+1 {
+		t.Errorf("second request should hit the cache")
+	}
+
+	// insertion via writer API invalidates cached entries
+	data := []byte(`{"data_tier_name":"CACHE-TIER-C","creation_date":1607536535,"create_by":"test"}`)
+	if _, err := respRecorder("POST", "/dbs2go/datatiers", bytes.NewBuffer(data), web.DatatiersHandler); err != nil {
+		t.Fatal(err)
+	}
+	if web.ResponseCache.Len() != 0 {
+		t.Errorf("cache should be invalidated by writer API")
+	}
+	if tiers := getTiers(); len(tiers) != 3 {
+		t.Errorf("wrong data tiers after cache invalidation %v", tiers)
+	}
+
+	// response larger than max cache size is served but not recorded
+	web.ResponseCache.Invalidate(nil, "")
+	web.Config.CacheMaxSize = 64
+	defer func() { web.Config.CacheMaxSize = 0 }()
+	if tiers := getTiers(); len(tiers) != 3 {
+		t.Errorf("wrong data tiers of large response %v", tiers)
+	}
+	if web.ResponseCache.Len() != 0 {
+		t.Errorf("large response should not be cached")
+	}
+
+	// response built before matching invalidation is not cached, while
+	// responses of other APIs and datasets are cached
+	cache := web.NewCache(map[string]int{"datatiers": 300, "blocks": 300}, 10, 0)
+	gen := cache.Generation()
+	cache.Invalidate([]string{"datatiers"}, "/a/b/c")
+	cache.Set("tiers", "datatiers", "", []byte("[]"), gen)
+	cache.Set("blocks", "blocks", "/a/b/c", []byte("[]"), gen)
+	cache.Set("tiers-d", "datatiers", "/d/e/f", []byte("[]"), gen)
+	if _, ok := cache.Get("tiers"); ok {
+		t.Errorf("stale response should not be cached")
+	}
+	if _, ok := cache.Get("blocks"); !ok {
+		t.Errorf("response of not invalidated API should be cached")
+	}
+	if _, ok := cache.Get("tiers-d"); !ok {
+		t.Errorf("response of not invalidated dataset should be cached")
+	}
+	cache.Set("tiers", "datatiers", "", []byte("[]"), cache.Generation())
+	if _, ok := cache.Get("tiers"); !ok {
+		t.Errorf("response built after invalidation should be cached")
+	}
+}
+
+// TestHTTPConditional provides test of conditional GET requests
+func TestHTTPConditional(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	web.Config.ContentEtag = true
+	web.Config.LastModified = true
+	defer func() {
+		web.Config.ContentEtag = false
+		web.Config.LastModified = false
+	}()
+
+	// helper function to make GET request with given headers
+	get := func(rurl string, hdlr func(http.ResponseWriter, *http.Request), headers map[string]string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", rurl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(hdlr).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// content ETag of unchanged response should lead to 304
+	for _, encoding := range []string{"", "gzip"} {
+		headers := map[string]string{"Accept-Encoding": encoding}
+		rr := get("/dbs2go/datatiers", web.DatatiersHandler, headers)
+		etag := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || etag == "" {
+			t.Fatalf("response should have ETag, status %v headers %v", rr.Code, rr.Header())
+		}
+		headers["If-None-Match"] = etag
+		rr = get("/dbs2go/datatiers", web.DatatiersHandler, headers)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("request with matching ETag should get 304, got %v body '%s'", rr.Code, rr.Body.String())
+		}
+		headers["If-None-Match"] = `"another-etag"`
+		rr = get("/dbs2go/datatiers", web.DatatiersHandler, headers)
+		if rr.Code != http.StatusOK || rr.Body.Len() == 0 {
+			t.Errorf("request with different ETag should get the data, got %v", rr.Code)
+		}
+	}
+
+	// response larger than etag max size is streamed without ETag
+	web.Config.EtagMaxSize = 16
+	rr := get("/dbs2go/datatiers", web.DatatiersHandler, nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != "" || rr.Body.Len() <= 16 {
+		t.Errorf("large response should not have ETag, status %v headers %v", rr.Code, rr.Header())
+	}
+	web.Config.EtagMaxSize = 0
+
+	// Last-Modified of single dataset is defined by dataset, its blocks and files
+	dataset := "/LastModified/Test-v1/RAW"
+	if _, err := db.Exec("INSERT INTO DATASETS (DATASET_ID, DATASET, LAST_MODIFICATION_DATE) VALUES (1000, ?, 1607536535)", dataset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO BLOCKS (BLOCK_ID, BLOCK_NAME, DATASET_ID, LAST_MODIFICATION_DATE) VALUES (1000, ?, 1000, 1607536600)", dataset+"#1"); err != nil {
+		t.Fatal(err)
+	}
+	lmd, err := dbs.LastModified(dataset, "")
+	if err != nil || lmd != 1607536600 {
+		t.Fatalf("wrong last modification date %v, error %v", lmd, err)
+	}
+	rurl := fmt.Sprintf("/dbs2go/datasets?dataset=%s", dataset)
+	rr = get(rurl, web.DatasetsHandler, nil)
+	mtime := rr.Header().Get("Last-Modified")
+	if mtime != time.Unix(lmd, 0).UTC().Format(http.TimeFormat) {
+		t.Fatalf("wrong Last-Modified header '%s'", mtime)
+	}
+	rr = get(rurl, web.DatasetsHandler, map[string]string{"If-Modified-Since": mtime})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("request of unmodified dataset should get 304, got %v", rr.Code)
+	}
+	since := time.Unix(lmd-60, 0).UTC().Format(http.TimeFormat)
+	rr = get(rurl, web.DatasetsHandler, map[string]string{"If-Modified-Since": since})
+	if rr.Code != http.StatusOK {
+		t.Errorf("request of modified dataset should get 200, got %v", rr.Code)
+	}
+
+	// parents of the dataset may be modified without dataset modification
+	rurl = fmt.Sprintf("/dbs2go/datasetparents?dataset=%s", dataset)
+	rr = get(rurl, web.DatasetParentsHandler, map[string]string{"If-Modified-Since": mtime})
+	if rr.Code != http.StatusOK || rr.Header().Get("Last-Modified") != "" {
+		t.Errorf("datasetparents should not use Last-Modified, status %v headers %v", rr.Code, rr.Header())
+	}
+}
+
+// TestHTTPAudit provides test of audit trail of write APIs
+func TestHTTPAudit(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	web.Config.Audit = true
+	defer func() {
+		web.Config.Audit = false
+	}()
+
+	// insert new acquisition era via POST API
+	era := "AUDIT-ERA"
+	startDate := 1607536535
+	data := []byte(fmt.Sprintf(`{"acquisition_era_name":"%s","start_date":%d}`, era, startDate))
+	_, err := respRecorder("POST", "/dbs2go/acquisitioneras", bytes.NewReader(data), web.AcquisitionErasHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// update its end date via PUT API
+	endDate := 1616109166
+	rurl := fmt.Sprintf("/dbs2go/acquisitioneras?end_date=%d&acquisition_era_name=%s", endDate, era)
+	_, err = respRecorder("PUT", rurl, nil, web.AcquisitionErasHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reader POST APIs should not be audited
+	data = []byte(`{"dataset":["/a/b/c"]}`)
+	_, err = respRecorder("POST", "/dbs2go/datasetlist", bytes.NewReader(data), web.DatasetListHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fetch audit trail of acquisition eras
+	rr, err := respRecorder("GET", "/dbs2go/audit?audit_api=acquisitioneras", nil, web.AuditHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []dbs.Record
+	err = json.Unmarshal(rr.Body.Bytes(), &records)
+	if err != nil {
+		t.Fatalf("unable to unmarshal audit records '%s', error %v", rr.Body.String(), err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("wrong number of audit records %d, expected 2: %+v", len(records), records)
+	}
+	if records[0]["method"] != "POST" || !strings.Contains(fmt.Sprintf("%v", records[0]["new_values"]), era) {
+		t.Errorf("wrong audit record of POST API %+v", records[0])
+	}
+	rec := records[1]
+	if rec["method"] != "PUT" {
+		t.Errorf("wrong audit record of PUT API %+v", rec)
+	}
+	oldValues := fmt.Sprintf("%v", rec["old_values"])
+	newValues := fmt.Sprintf("%v", rec["new_values"])
+	if strings.Contains(oldValues, fmt.Sprintf("%d", endDate)) || !strings.Contains(newValues, fmt.Sprintf("%d", endDate)) {
+		t.Errorf("audit record does not reflect end_date update, old values %s new values %s", oldValues, newValues)
+	}
+
+	// the datasetlist API should not be recorded
+	rr, err = respRecorder("GET", "/dbs2go/audit?audit_api=datasetlist", nil, web.AuditHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("reader POST API should not be audited, got %s", rr.Body.String())
+	}
+
+	// failed insert of audit record should fail the write and be counted
+	if _, err := db.Exec("ALTER TABLE AUDIT_TRAIL RENAME TO AUDIT_TRAIL_SAVED"); err != nil {
+		t.Fatal(err)
+	}
+	failures := web.AuditFailures
+	data = []byte(`{"acquisition_era_name":"AUDIT-ERA-LOST","start_date":1607536535}`)
+	_, err = respRecorder("POST", "/dbs2go/acquisitioneras", bytes.NewReader(data), web.AcquisitionErasHandler)
+	rurl = fmt.Sprintf("/dbs2go/acquisitioneras?end_date=%d&acquisition_era_name=%s", endDate+1, era)
+	_, perr := respRecorder("PUT", rurl, nil, web.AcquisitionErasHandler)
+	if _, e := db.Exec("ALTER TABLE AUDIT_TRAIL_SAVED RENAME TO AUDIT_TRAIL"); e != nil {
+		t.Fatal(e)
+	}
+	if err == nil || perr == nil {
+		t.Fatalf("write without audit trail record should fail, POST error %v PUT error %v", err, perr)
+	}
+	if web.AuditFailures != failures+2 {
+		t.Errorf("audit failures are not counted")
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ACQUISITION_ERAS WHERE ACQUISITION_ERA_NAME = ?", "AUDIT-ERA-LOST").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	var end int
+	if err := db.QueryRow("SELECT END_DATE FROM ACQUISITION_ERAS WHERE ACQUISITION_ERA_NAME = ?", era).Scan(&end); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 || end != endDate {
+		t.Errorf("write without audit trail record is committed, new eras %d end date %d", count, end)
+	}
+}
+
+// TestHTTPHistory provides test of as_of parameter of datasets and blocks APIs
+func TestHTTPHistory(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	web.Config.Audit = true
+	defer func() {
+		web.Config.Audit = false
+	}()
+
+	// create dataset and its block
+	cdate := 1607536535
+	dataset := "/History/Test-v1/RAW"
+	block := dataset + "#1"
+	stmts := []string{
+		"INSERT INTO DATASET_ACCESS_TYPES (DATASET_ACCESS_TYPE_ID, DATASET_ACCESS_TYPE) VALUES (2000, 'PRODUCTION')",
+		"INSERT INTO DATASET_ACCESS_TYPES (DATASET_ACCESS_TYPE_ID, DATASET_ACCESS_TYPE) VALUES (2001, 'DEPRECATED')",
+		fmt.Sprintf("INSERT INTO DATASETS (DATASET_ID, DATASET, DATASET_ACCESS_TYPE_ID, CREATION_DATE) VALUES (2000, '%s', 2000, %d)", dataset, cdate),
+		fmt.Sprintf("INSERT INTO BLOCKS (BLOCK_ID, BLOCK_NAME, DATASET_ID, OPEN_FOR_WRITING, ORIGIN_SITE_NAME, CREATION_DATE) VALUES (2000, '%s', 2000, 1, 'T1_US_FNAL', %d)", block, cdate),
+	}
+	for _, stm := range stmts {
+		if _, err := db.Exec(stm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asOf := time.Now().Unix() - 10
+
+	// update dataset and block
+	rurl := fmt.Sprintf("/dbs2go/datasets?dataset=%s&dataset_access_type=DEPRECATED", dataset)
+	if _, err := respRecorder("PUT", rurl, strings.NewReader("{}"), web.DatasetsHandler); err != nil {
+		t.Fatal(err)
+	}
+	rurl = fmt.Sprintf("/dbs2go/blocks?block_name=%s&open_for_writing=0", strings.Replace(block, "#", "%23", 1))
+	if _, err := respRecorder("PUT", rurl, nil, web.BlocksHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	// helper function to get records of given API
+	get := func(rurl string, hdlr func(http.ResponseWriter, *http.Request)) []dbs.Record {
+		rr, err := respRecorder("GET", rurl, nil, hdlr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []dbs.Record
+		if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		return records
+	}
+
+	// dataset state before and after the update
+	rurl = fmt.Sprintf("/dbs2go/datasets?dataset=%s&as_of=%d", dataset, asOf)
+	records := get(rurl, web.DatasetsHandler)
+	if len(records) != 1 || records[0]["dataset_access_type"] != "PRODUCTION" {
+		t.Errorf("wrong dataset state before the update %+v", records)
+	}
+	rurl = fmt.Sprintf("/dbs2go/datasets?dataset=%s&as_of=%d", dataset, time.Now().Unix()+10)
+	records = get(rurl, web.DatasetsHandler)
+	if len(records) != 1 || records[0]["dataset_access_type"] != "DEPRECATED" {
+		t.Errorf("wrong dataset state after the update %+v", records)
+	}
+	rurl = fmt.Sprintf("/dbs2go/datasets?dataset=%s&as_of=%d", dataset, cdate-10)
+	records = get(rurl, web.DatasetsHandler)
+	if len(records) != 0 {
+		t.Errorf("dataset should not exist before its creation %+v", records)
+	}
+
+	// block state before and after the update
+	rurl = fmt.Sprintf("/dbs2go/blocks?dataset=%s&as_of=%d", dataset, asOf)
+	records = get(rurl, web.BlocksHandler)
+	if len(records) != 1 || fmt.Sprintf("%v", records[0]["open_for_writing"]) != "1" ||
+		records[0]["origin_site_name"] != "T1_US_FNAL" {
+		t.Errorf("wrong block state before the update %+v", records)
+	}
+	rurl = fmt.Sprintf("/dbs2go/blocks?dataset=%s&as_of=%d", dataset, time.Now().Unix()+10)
+	records = get(rurl, web.BlocksHandler)
+	if len(records) != 1 || fmt.Sprintf("%v", records[0]["open_for_writing"]) != "0" {
+		t.Errorf("wrong block state after the update %+v", records)
+	}
+
+	// parameters which are not supported by as_of queries are rejected
+	for _, params := range []string{"data_tier_name=RAW", "detail=true", "limit=1"} {
+		rurl = fmt.Sprintf("/dbs2go/datasets?dataset=%s&as_of=%d&%s", dataset, asOf, params)
+		if _, err := respRecorder("GET", rurl, nil, web.DatasetsHandler); err == nil {
+			t.Errorf("as_of request with %s should be rejected", params)
+		}
+	}
+}
+
+// TestHTTPEvents provides test of change events of writer APIs
+func TestHTTPEvents(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// webhook server which receives change events
+	hookEvents := make(chan dbs.Event, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e dbs.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err == nil {
+			hookEvents <- e
+		}
+	}))
+	defer hook.Close()
+
+	web.Config.Events = true
+	web.Config.Webhooks = []web.Webhook{
+		{URL: hook.URL, EventFilter: web.EventFilter{EventTypes: []string{dbs.BlockClosedEvent}}},
+	}
+	web.InitEvents()
+	defer func() {
+		web.Config.Events = false
+		web.Config.Webhooks = nil
+		web.Events = nil
+		dbs.EventPublisher = nil
+	}()
+
+	// create dataset and its block
+	dataset := "/Events/Test-v1/RAW"
+	block := dataset + "#1"
+	stmts := []string{
+		fmt.Sprintf("INSERT INTO DATASETS (DATASET_ID, DATASET, CREATION_DATE) VALUES (3000, '%s', 1607536535)", dataset),
+		fmt.Sprintf("INSERT INTO BLOCKS (BLOCK_ID, BLOCK_NAME, DATASET_ID, OPEN_FOR_WRITING, CREATION_DATE) VALUES (3000, '%s', 3000, 1, 1607536535)", block),
+	}
+	for _, stm := range stmts {
+		if _, err := db.Exec(stm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// subscribe to block events of our dataset
+	server := httptest.NewServer(http.HandlerFunc(web.EventsHandler))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rurl := fmt.Sprintf("%s/dbs2go/events?dataset=/Events/*&event_type=block_closed,block_updated", server.URL)
+	req, err := http.NewRequestWithContext(ctx, "GET", rurl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ctype := resp.Header.Get("Content-Type"); ctype != "text/event-stream" {
+		t.Fatalf("wrong content type of events stream %s", ctype)
+	}
+
+	// unknown event types should be rejected
+	rr := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/dbs2go/events?event_type=unknown", nil)
+	web.EventsHandler(rr, r)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown event type should lead to 400, got %v", rr.Code)
+	}
+
+	// close the block
+	rurl = fmt.Sprintf("/dbs2go/blocks?block_name=%s&open_for_writing=0", strings.Replace(block, "#", "%23", 1))
+	if _, err := respRecorder("PUT", rurl, nil, web.BlocksHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	// read event from SSE stream
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	var data string
+	timeout := time.After(5 * time.Second)
+	for data == "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("events stream is closed")
+			}
+			if strings.HasPrefix(line, "event: ") && line != "event: block_closed" {
+				t.Errorf("wrong event type %s", line)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		case <-timeout:
+			t.Fatal("no event received from events stream")
+		}
+	}
+	var e dbs.Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatalf("unable to unmarshal event %s, error %v", data, err)
+	}
+	if e.Type != dbs.BlockClosedEvent || e.Block != block || e.Dataset != dataset {
+		t.Errorf("wrong event %+v", e)
+	}
+
+	// the same event should be delivered to webhook
+	select {
+	case he := <-hookEvents:
+		if he.ID != e.ID || he.Type != dbs.BlockClosedEvent {
+			t.Errorf("wrong webhook event %+v", he)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no event received by webhook")
+	}
+
+	// client reconnecting with event ID unknown to this server should get events gap event
+	gctx, gcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer gcancel()
+	req, err = http.NewRequestWithContext(gctx, "GET", server.URL+"/dbs2go/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+	gresp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gresp.Body.Close()
+	// replayed events may precede the gap event
+	scanner := bufio.NewScanner(gresp.Body)
+	var gap string
+	for gap == "" && scanner.Scan() {
+		if scanner.Text() == "event: "+dbs.EventsGapEvent && scanner.Scan() {
+			gap = scanner.Text()
+		}
+	}
+	if !strings.Contains(gap, `"last_event_id":1`) {
+		t.Errorf("wrong events gap event %s", gap)
+	}
+}
+
+// TestHTTPBulkBlocksDryRun provides test of bulkblocks dry-run mode
+func TestHTTPBulkBlocksDryRun(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	data, err := os.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec dbs.BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	// use new dataset and files
+	rec.Dataset.Dataset = "/unittest_dryrun/Summer2011-pstr-v10/GEN-SIM-RAW"
+	rec.Block.BlockName = rec.Dataset.Dataset + "#1"
+	for i := range rec.Files {
+		rec.Files[i].LogicalFileName = strings.Replace(rec.Files[i].LogicalFileName, "/store/data/", "/store/data/dryrun/", 1)
+	}
+	for i := range rec.FileConfigList {
+		rec.FileConfigList[i].LFN = strings.Replace(rec.FileConfigList[i].LFN, "/store/data/", "/store/data/dryrun/", 1)
+	}
+	rec.FileParentList = nil
+	chunk := dbs.FileChunkSize
+	dbs.FileChunkSize = 2
+	defer func() {
+		dbs.FileChunkSize = chunk
+	}()
+
+	dryRun := func(rec dbs.BulkBlocks) dbs.BulkBlocksReport {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr, err := respRecorder("POST", "/dbs2go/bulkblocks?dry_run=true", bytes.NewReader(data), web.BulkBlocksHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report dbs.BulkBlocksReport
+		if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		return report
+	}
+
+	// valid payload is inserted and rolled back
+	report := dryRun(rec)
+	if !report.Valid {
+		t.Errorf("valid payload is reported as invalid %+v", report)
+	}
+	if !utils.InList(fmt.Sprintf("DATASETS dataset=%s", rec.Dataset.Dataset), report.NewRecords) {
+		t.Errorf("new dataset is not reported, new records %+v", report.NewRecords)
+	}
+
+	// the insertion of invalid payload fails on missing dataset parent
+	rec.DatasetParentList = []string{"/DryRun/Missing-v1/RAW"}
+	report = dryRun(rec)
+	if report.Valid {
+		t.Errorf("invalid payload is reported as valid %+v", report)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Code != dbs.DatasetParentDoesNotExist {
+		t.Errorf("missing dataset parent is not reported, problems %+v", report.Problems)
+	}
+
+	// all independent problems of the payload are reported
+	rec.FileParentList = []dbs.FileParentRecord{{
+		ThisLogicalFileName:   rec.Files[0].LogicalFileName,
+		ParentLogicalFileName: "/store/data/dryrun/missing/parent.root",
+	}}
+	report = dryRun(rec)
+	codes := make(map[int]int)
+	for _, p := range report.Problems {
+		codes[p.Code]++
+	}
+	if report.Valid || codes[dbs.DatasetParentDoesNotExist] != 1 || codes[dbs.FileParentDoesNotExist] != 1 {
+		t.Errorf("missing dataset parent and parent file are not reported, problems %+v", report.Problems)
+	}
+	rec.FileParentList = nil
+
+	// dry-run should not insert anything
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM DATASETS WHERE DATASET = ?", rec.Dataset.Dataset).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("dry-run inserted dataset %s", rec.Dataset.Dataset)
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM FILES WHERE LOGICAL_FILE_NAME = ?", rec.Files[0].LogicalFileName).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("dry-run inserted file %s", rec.Files[0].LogicalFileName)
+	}
+}
+
+// TestHTTPIdempotency provides test of POST API requests with idempotency key
+func TestHTTPIdempotency(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	data, err := os.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec dbs.BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.Dataset.Dataset = "/unittest_idempotency/Summer2011-pstr-v10/GEN-SIM-RAW"
+	rec.Block.BlockName = rec.Dataset.Dataset + "#1"
+	for i, f := range rec.Files {
+		rec.Files[i].LogicalFileName = strings.Replace(f.LogicalFileName, "/1/abcd", "/1/idempotency_abcd", 1)
+	}
+	for i, f := range rec.FileConfigList {
+		rec.FileConfigList[i].LFN = strings.Replace(f.LFN, "/1/abcd", "/1/idempotency_abcd", 1)
+	}
+	rec.FileParentList = nil
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// helper function to post bulkblocks payload with given idempotency key
+	post := func(data []byte, key string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/dbs2go/bulkblocks", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(web.IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(web.BulkBlocksHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	key := "idempotency-test-key"
+	rr := post(payload, key)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("fail to insert block, status %d response %s", rr.Code, rr.Body.String())
+	}
+	response := rr.Body.String()
+
+	// the replay of the request returns the original response
+	rr = post(payload, key)
+	if rr.Code != http.StatusOK || rr.Header().Get(web.IdempotentReplayedHeader) != "true" {
+		t.Errorf("request is not replayed, status %d response %s", rr.Code, rr.Body.String())
+	}
+	if rr.Body.String() != response {
+		t.Errorf("wrong replayed response %s, expect %s", rr.Body.String(), response)
+	}
+
+	// the same key with different payload is rejected
+	rec.Block.BlockName = rec.Dataset.Dataset + "#2"
+	data, _ = json.Marshal(rec)
+	rr = post(data, key)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "already used") {
+		t.Errorf("request with used idempotency key is not rejected, status %d response %s", rr.Code, rr.Body.String())
+	}
+
+	// the key of failed request is released
+	rr = post([]byte(`{"block":`), "failed-request-key")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("malformed payload is accepted, status %d response %s", rr.Code, rr.Body.String())
+	}
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM IDEMPOTENCY_KEYS WHERE IDEMPOTENCY_KEY = ?", "failed-request-key").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("idempotency key of failed request is not released")
+	}
+
+	// the pending key of request in progress is not taken over, while the
+	// stale one, e.g. of crashed server, is taken over by retry
+	rec.Block.BlockName = rec.Dataset.Dataset + "#3"
+	data, _ = json.Marshal(rec)
+	stm := "INSERT INTO IDEMPOTENCY_KEYS (IDEMPOTENCY_KEY, API, REQUEST_HASH, STATUS, CREATION_DATE, CREATE_BY) VALUES (?, ?, ?, ?, ?, ?)"
+	now := time.Now().Unix()
+	if _, err := db.Exec(stm, "pending-key", "bulkblocks", "hash", dbs.IdempotencyPending, now, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	rr = post(data, "pending-key")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("request with pending idempotency key is not rejected, status %d response %s", rr.Code, rr.Body.String())
+	}
+	if _, err := db.Exec(stm, "stale-key", "bulkblocks", "hash", dbs.IdempotencyPending, now-2*dbs.IdempotencyLease, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	rr = post(data, "stale-key")
+	if rr.Code != http.StatusOK {
+		t.Errorf("stale idempotency key is not taken over, status %d response %s", rr.Code, rr.Body.String())
+	}
+
+	// the key is completed within transaction of the request, i.e. failure
+	// to complete the key rolls back the inserted block
+	rec.Block.BlockName = rec.Dataset.Dataset + "#4"
+	data, _ = json.Marshal(rec)
+	trigger := "CREATE TRIGGER IDEMPOTENCY_TEST BEFORE UPDATE ON IDEMPOTENCY_KEYS BEGIN SELECT RAISE(ABORT, 'idempotency test'); END"
+	if _, err := db.Exec(trigger); err != nil {
+		t.Fatal(err)
+	}
+	rr = post(data, "rollback-key")
+	if _, err := db.Exec("DROP TRIGGER IDEMPOTENCY_TEST"); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code == http.StatusOK {
+		t.Errorf("request with not completed idempotency key should fail, response %s", rr.Body.String())
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM BLOCKS WHERE BLOCK_NAME = ?", rec.Block.BlockName).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("block of request with not completed idempotency key is committed")
+	}
+	rr = post(data, "rollback-key")
+	if rr.Code != http.StatusOK || rr.Header().Get(web.IdempotentReplayedHeader) != "" {
+		t.Errorf("retry of failed request is not executed, status %d response %s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestHTTPLumiMask provides test of POST APIs filtered by lumi mask
+func TestHTTPLumiMask(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	data, err := os.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec dbs.BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	// every file of the block has single lumi of run 1000
+	rec.Dataset.Dataset = "/unittest_lumimask/Summer2011-pstr-v10/GEN-SIM-RAW"
+	rec.Block.BlockName = rec.Dataset.Dataset + "#1"
+	var lfns []string
+	for i, f := range rec.Files {
+		rec.Files[i].LogicalFileName = strings.Replace(f.LogicalFileName, "/1/abcd", "/1/lumimask_abcd", 1)
+		rec.Files[i].FileLumiList = []dbs.FileLumi{{RunNumber: 1000, LumiSectionNumber: int64(i + 1)}}
+		lfns = append(lfns, rec.Files[i].LogicalFileName)
+	}
+	for i, f := range rec.FileConfigList {
+		rec.FileConfigList[i].LFN = strings.Replace(f.LFN, "/1/abcd", "/1/lumimask_abcd", 1)
+	}
+	rec.FileParentList = nil
+	data, err = json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := respRecorder("POST", "/dbs2go/bulkblocks", bytes.NewReader(data), web.BulkBlocksHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	mask := `{"1000": [[2, 3], [8, 8]], "1001": [[1, 100]]}`
+	expect := []string{lfns[1], lfns[2], lfns[7]}
+
+	// files matching lumi mask
+	payload := fmt.Sprintf(`{"dataset": "%s", "lumi_mask": %s}`, rec.Dataset.Dataset, mask)
+	rr, err := respRecorder("POST", "/dbs2go/fileArray", strings.NewReader(payload), web.FileArrayHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []dbs.Record
+	if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+		t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+	}
+	var files []string
+	for _, r := range records {
+		files = append(files, fmt.Sprintf("%v", r["logical_file_name"]))
+	}
+	if len(files) != len(expect) {
+		t.Errorf("wrong files %v, expect %v", files, expect)
+	}
+	for _, lfn := range expect {
+		if !utils.InList(lfn, files) {
+			t.Errorf("file %s is not found in %v", lfn, files)
+		}
+	}
+
+	// file lumis matching lumi mask
+	payload = fmt.Sprintf(`{"block_name": "%s", "lumi_mask": %s}`, rec.Block.BlockName, mask)
+	rr, err = respRecorder("POST", "/dbs2go/filelumis", strings.NewReader(payload), web.FileLumisHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = nil
+	if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+		t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+	}
+	if len(records) != len(expect) {
+		t.Errorf("wrong file lumis %v, expect lumis of %v", records, expect)
+	}
+
+	// run summaries within lumi mask
+	payload = fmt.Sprintf(`{"dataset": "%s", "lumi_mask": %s}`, rec.Dataset.Dataset, mask)
+	rr, err = respRecorder("POST", "/dbs2go/runsummaries", strings.NewReader(payload), web.RunSummariesHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = nil
+	if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+		t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+	}
+	if len(records) != 1 || fmt.Sprintf("%v", records[0]["max_lumi"]) != "8" {
+		t.Errorf("wrong run summaries %v", records)
+	}
+
+	// invalid lumi mask is rejected
+	payload = fmt.Sprintf(`{"dataset": "%s", "lumi_mask": {"1000": [[3, 2]]}}`, rec.Dataset.Dataset)
+	if _, err := respRecorder("POST", "/dbs2go/fileArray", strings.NewReader(payload), web.FileArrayHandler); err == nil {
+		t.Errorf("invalid lumi mask is accepted")
+	}
+}
+
+// TestHTTPDatasetLumiMask provides test of datasetlumimask API
+func TestHTTPDatasetLumiMask(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	data, err := os.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec dbs.BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	// files cover lumis 1-5 and 8-12 of run 2000 and lumi 1 of run 2001,
+	// while the first file is invalid
+	rec.Dataset.Dataset = "/unittest_datasetlumimask/Summer2011-pstr-v10/GEN-SIM-RAW"
+	rec.Block.BlockName = rec.Dataset.Dataset + "#1"
+	for i, f := range rec.Files {
+		rec.Files[i].LogicalFileName = strings.Replace(f.LogicalFileName, "/1/abcd", "/1/datasetlumimask_abcd", 1)
+		lumi := int64(i + 1)
+		if i >= 5 {
+			lumi = int64(i + 3)
+		}
+		rec.Files[i].FileLumiList = []dbs.FileLumi{{RunNumber: 2000, LumiSectionNumber: lumi}}
+		rec.Files[i].IsFileValid = 1
+	}
+	rec.Files[0].FileLumiList = append(rec.Files[0].FileLumiList, dbs.FileLumi{RunNumber: 2001, LumiSectionNumber: 1})
+	rec.Files[0].IsFileValid = 0
+	for i, f := range rec.FileConfigList {
+		rec.FileConfigList[i].LFN = strings.Replace(f.LFN, "/1/abcd", "/1/datasetlumimask_abcd", 1)
+	}
+	rec.FileParentList = nil
+	data, err = json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := respRecorder("POST", "/dbs2go/bulkblocks", bytes.NewReader(data), web.BulkBlocksHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	// helper function to check lumi mask of the response
+	check := func(rr *httptest.ResponseRecorder, expect string) {
+		var mask, emask dbs.LumiMask
+		if err := json.Unmarshal(rr.Body.Bytes(), &mask); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		json.Unmarshal([]byte(expect), &emask)
+		m1, _ := json.Marshal(mask)
+		m2, _ := json.Marshal(emask)
+		if string(m1) != string(m2) {
+			t.Errorf("wrong lumi mask %s, expect %s", m1, m2)
+		}
+	}
+
+	rurl := fmt.Sprintf("/dbs2go/datasetlumimask?dataset=%s", rec.Dataset.Dataset)
+	rr, err := respRecorder("GET", rurl, nil, web.DatasetLumiMaskHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(rr, `{"2000": [[1, 5], [8, 12]], "2001": [[1, 1]]}`)
+
+	rurl = fmt.Sprintf("/dbs2go/datasetlumimask?block_name=%s&validFileOnly=1", strings.Replace(rec.Block.BlockName, "#", "%23", 1))
+	rr, err = respRecorder("GET", rurl, nil, web.DatasetLumiMaskHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(rr, `{"2000": [[2, 5], [8, 12]]}`)
+
+	mask := `{"2000": [[3, 9]], "2002": [[1, 10]]}`
+	payload := fmt.Sprintf(`{"dataset": "%s", "lumi_mask": %s}`, rec.Dataset.Dataset, mask)
+	rr, err = respRecorder("POST", "/dbs2go/datasetlumimask", strings.NewReader(payload), web.DatasetLumiMaskHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(rr, `{"2000": [[3, 5], [8, 9]]}`)
+
+	payload = fmt.Sprintf(`{"dataset": "%s", "lumi_mask": %s, "operation": "difference"}`, rec.Dataset.Dataset, mask)
+	rr, err = respRecorder("POST", "/dbs2go/datasetlumimask", strings.NewReader(payload), web.DatasetLumiMaskHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(rr, `{"2000": [[1, 2], [10, 12]], "2001": [[1, 1]]}`)
+}
+
+// helper function to insert dataset with given name, dataset parents and
+// dataset whose files are parents of dataset files, it returns dataset name
+// and its files
+func insertParentageDataset(t *testing.T, prefix, name string, parents []string, parent string) (string, []string) {
+	rec, lfns := parentageBulkBlocks(t, prefix, name, parents, parent)
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := respRecorder("POST", "/dbs2go/bulkblocks", bytes.NewReader(payload), web.BulkBlocksHandler); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Dataset.Dataset, lfns
+}
+
+// helper function to create bulkblocks record of dataset with given dataset
+// and file parents, it returns the record along with its file names
+func parentageBulkBlocks(t *testing.T, prefix, name string, parents []string, parent string) (dbs.BulkBlocks, []string) {
+	data, err := os.ReadFile("data/bulkblocks0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec dbs.BulkBlocks
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.Dataset.Dataset = fmt.Sprintf("/unittest_%s_%s/Summer2011-pstr-v10/GEN-SIM-RAW", prefix, name)
+	rec.Block.BlockName = rec.Dataset.Dataset + "#1"
+	rec.DatasetParentList = parents
+	rec.FileParentList = nil
+	var lfns []string
+	lfnPrefix := fmt.Sprintf("/1/%s_%s_abcd", prefix, name)
+	for i, f := range rec.Files {
+		rec.Files[i].LogicalFileName = strings.Replace(f.LogicalFileName, "/1/abcd", lfnPrefix, 1)
+		rec.Files[i].IsFileValid = 1
+		lfns = append(lfns, rec.Files[i].LogicalFileName)
+		if parent != "" {
+			plfn := strings.Replace(f.LogicalFileName, "/1/abcd", fmt.Sprintf("/1/%s_%s_abcd", prefix, parent), 1)
+			rec.FileParentList = append(rec.FileParentList,
+				dbs.FileParentRecord{ThisLogicalFileName: rec.Files[i].LogicalFileName, ParentLogicalFileName: plfn})
+		}
+	}
+	for i, f := range rec.FileConfigList {
+		rec.FileConfigList[i].LFN = strings.Replace(f.LFN, "/1/abcd", lfnPrefix, 1)
+	}
+	return rec, lfns
+}
+
+// TestHTTPProvenance provides test of provenance API
+func TestHTTPProvenance(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// helper function to insert dataset with given dataset and file parents
+	insert := func(name string, parents []string, parent string) (string, []string) {
+		return insertParentageDataset(t, "provenance", name, parents, parent)
+	}
+	// dataset a is parent of b, b is parent of c, while d has both a and b parents
+	a, lfnsA := insert("a", nil, "")
+	b, lfnsB := insert("b", []string{a}, "a")
+	c, _ := insert("c", []string{b}, "")
+	d, _ := insert("d", []string{b}, "")
+	// bulkblocks API keeps single dataset parent, therefore add another one directly
+	stm := `INSERT INTO DATASET_PARENTS (THIS_DATASET_ID, PARENT_DATASET_ID)
+	SELECT T.DATASET_ID, P.DATASET_ID FROM DATASETS T, DATASETS P WHERE T.DATASET = ? AND P.DATASET = ?`
+	if _, err := db.Exec(stm, d, a); err != nil {
+		t.Fatal(err)
+	}
+
+	// helper function to get provenance graph for given query
+	provenance := func(query string) dbs.Provenance {
+		var graph dbs.Provenance
+		rr, err := respRecorder("GET", "/dbs2go/provenance?"+query, nil, web.ProvenanceHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &graph); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		return graph
+	}
+
+	graph := provenance("dataset=" + d)
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 3 || len(graph.Cycles) != 0 || graph.Truncated {
+		t.Errorf("wrong provenance graph of %s: %+v", d, graph)
+	}
+	graph = provenance("dataset=" + d + "&depth=1")
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 2 {
+		t.Errorf("wrong provenance graph of %s with depth=1: %+v", d, graph)
+	}
+	graph = provenance("dataset=" + a + "&direction=down")
+	if len(graph.Nodes) != 4 || len(graph.Edges) != 4 {
+		t.Errorf("wrong provenance graph of %s children: %+v", a, graph)
+	}
+	graph = provenance("dataset=" + a + "&direction=down&max_nodes=2")
+	if len(graph.Nodes) != 2 || !graph.Truncated {
+		t.Errorf("provenance graph of %s is not truncated: %+v", a, graph)
+	}
+	graph = provenance("logical_file_name=" + lfnsB[0])
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 || graph.Edges[0].Parent != lfnsA[0] {
+		t.Errorf("wrong provenance graph of %s: %+v", lfnsB[0], graph)
+	}
+
+	// GraphViz DOT rendering
+	rr, err := respRecorder("GET", "/dbs2go/provenance?format=dot&dataset="+c, nil, web.ProvenanceHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Content-Type") != dbs.DotContentType {
+		t.Errorf("wrong content type %s", rr.Header().Get("Content-Type"))
+	}
+	edge := fmt.Sprintf("%q -> %q;", b, c)
+	if !strings.HasPrefix(rr.Body.String(), "digraph provenance {") || !strings.Contains(rr.Body.String(), edge) {
+		t.Errorf("wrong DOT output %s", rr.Body.String())
+	}
+
+	// make dataset c parent of dataset a to introduce the cycle
+	if _, err := db.Exec(stm, a, c); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM DATASET_PARENTS WHERE PARENT_DATASET_ID = (SELECT DATASET_ID FROM DATASETS WHERE DATASET = ?)", c)
+	graph = provenance("dataset=" + a + "&direction=down")
+	if len(graph.Nodes) != 4 || len(graph.Cycles) != 1 || graph.Cycles[0].Parent != c || graph.Cycles[0].Child != a {
+		t.Errorf("cycle of provenance graph of %s is not detected: %+v", a, graph)
+	}
+}
+
+// TestHTTPParentageCheck provides test of parentagecheck API and its repair
+func TestHTTPParentageCheck(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	// dataset a is parent of b, while c has no file parents
+	a, lfnsA := insertParentageDataset(t, "parentage", "a", nil, "")
+	b, _ := insertParentageDataset(t, "parentage", "b", []string{a}, "a")
+	c, lfnsC := insertParentageDataset(t, "parentage", "c", nil, "")
+
+	// helper function to get parentage report of given dataset
+	check := func(dataset string) dbs.ParentageCheck {
+		var rec dbs.ParentageCheck
+		rr, err := respRecorder("GET", "/dbs2go/parentagecheck?dataset="+dataset, nil, web.ParentageCheckHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &rec); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		return rec
+	}
+	// helper function to repair parentage with given payload
+	repair := func(payload string) dbs.ParentageRepair {
+		var rec dbs.ParentageRepair
+		rr, err := respRecorder("POST", "/dbs2go/parentagecheck", strings.NewReader(payload), web.ParentageCheckHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &rec); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		return rec
+	}
+
+	report := check(b)
+	if !report.Consistent {
+		t.Errorf("parentage of %s is not consistent: %+v", b, report)
+	}
+
+	// break parentage of dataset b: remove its block and dataset parents,
+	// add dataset c as parent without file parents and invalidate parent file
+	for _, stm := range []string{
+		"DELETE FROM BLOCK_PARENTS WHERE THIS_BLOCK_ID = (SELECT BLOCK_ID FROM BLOCKS WHERE BLOCK_NAME = ?)",
+		"DELETE FROM DATASET_PARENTS WHERE THIS_DATASET_ID = (SELECT DATASET_ID FROM DATASETS WHERE DATASET = ?)",
+	} {
+		if _, err := db.Exec(stm, b+"#1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(stm, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stm := `INSERT INTO DATASET_PARENTS (THIS_DATASET_ID, PARENT_DATASET_ID)
+	SELECT T.DATASET_ID, P.DATASET_ID FROM DATASETS T, DATASETS P WHERE T.DATASET = ? AND P.DATASET = ?`
+	if _, err := db.Exec(stm, b, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE FILES SET IS_FILE_VALID = 0 WHERE LOGICAL_FILE_NAME = ?", lfnsA[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	report = check(b)
+	if report.Consistent ||
+		!reflect.DeepEqual(report.MissingDatasetParents, []string{a}) ||
+		!reflect.DeepEqual(report.DatasetParentsWithoutFiles, []string{c}) ||
+		!reflect.DeepEqual(report.MissingBlockParents, []dbs.BlockParent{{ThisBlockName: b + "#1", ParentBlockName: a + "#1"}}) ||
+		len(report.InvalidFileParents) != 1 || report.InvalidFileParents[0].ParentLogicalFileName != lfnsA[0] {
+		t.Errorf("wrong parentage report of %s: %+v", b, report)
+	}
+
+	// repair block and dataset parents derived from file parents
+	rec := repair(fmt.Sprintf(`{"dataset": "%s"}`, b))
+	if len(rec.BlockParents) != 1 || !reflect.DeepEqual(rec.DatasetParents, []string{a}) {
+		t.Errorf("wrong parentage repair of %s: %+v", b, rec)
+	}
+	report = check(b)
+	if len(report.MissingDatasetParents) != 0 || len(report.MissingBlockParents) != 0 {
+		t.Errorf("parentage of %s is not repaired: %+v", b, report)
+	}
+	rec = repair(fmt.Sprintf(`{"dataset": "%s"}`, b))
+	if len(rec.BlockParents) != 0 || len(rec.DatasetParents) != 0 {
+		t.Errorf("repeated parentage repair of %s inserts parents: %+v", b, rec)
+	}
+
+	// repair of dataset c along with insertion of its file parents
+	var pairs [][]int64
+	for i, lfn := range lfnsC {
+		var fid, pid int64
+		if err := db.QueryRow("SELECT FILE_ID FROM FILES WHERE LOGICAL_FILE_NAME = ?", lfn).Scan(&fid); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.QueryRow("SELECT FILE_ID FROM FILES WHERE LOGICAL_FILE_NAME = ?", lfnsA[i]).Scan(&pid); err != nil {
+			t.Fatal(err)
+		}
+		pairs = append(pairs, []int64{fid, pid})
+	}
+	payload, err := json.Marshal(dbs.ParentageRepairRecord{
+		FileParentBlockRecord: dbs.FileParentBlockRecord{BlockName: c + "#1", ChildParentIDList: pairs},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = repair(string(payload))
+	if rec.Dataset != c {
+		t.Errorf("wrong parentage repair of %s: %+v", c, rec)
+	}
+	report = check(c)
+	if len(report.MissingDatasetParents) != 0 || len(report.MissingBlockParents) != 0 {
+		t.Errorf("parentage of %s is not repaired: %+v", c, report)
+	}
+}
+
+// TestHTTPParentageJobs provides test of parentagejobs API
+func TestHTTPParentageJobs(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+	defer func(size int) { dbs.ParentageChunkSize = size }(dbs.ParentageChunkSize)
+	dbs.ParentageChunkSize = 30
+
+	// every file of the parent dataset shares lumis with every child file
+	parent, _ := insertParentageDataset(t, "parentagejob", "p", nil, "")
+	child, lfns := insertParentageDataset(t, "parentagejob", "c", nil, "")
+	resumed, _ := insertParentageDataset(t, "parentagejob", "r", nil, "")
+
+	// helper function to submit parentage job and wait for its completion
+	submit := func(payload string) dbs.ParentageJobRecord {
+		var job dbs.ParentageJobRecord
+		rr, err := respRecorder("POST", "/dbs2go/parentagejobs", strings.NewReader(payload), web.ParentageJobsHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		for i := 0; i < 100; i++ {
+			var jobs []dbs.ParentageJobRecord
+			url := fmt.Sprintf("/dbs2go/parentagejobs?job_id=%d", job.JOB_ID)
+			rr, err := respRecorder("GET", url, nil, web.ParentageJobsHandler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &jobs); err != nil || len(jobs) != 1 {
+				t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+			}
+			if jobs[0].STATUS != dbs.ParentageJobRunning {
+				return jobs[0]
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("parentage job %d is not completed", job.JOB_ID)
+		return job
+	}
+
+	job := submit(fmt.Sprintf(`{"dataset": "%s", "parent_datasets": ["%s"]}`, child, parent))
+	if job.STATUS != dbs.ParentageJobDone || job.NBLOCKS != 1 || job.NBLOCKS_DONE != 1 ||
+		job.NFILE_PARENTS != int64(len(lfns)*len(lfns)) || job.LAST_BLOCK_NAME != child+"#1" {
+		t.Errorf("wrong parentage job %+v", job)
+	}
+	var nparents int
+	stm := `SELECT COUNT(*) FROM FILE_PARENTS FP JOIN FILES F ON F.FILE_ID = FP.THIS_FILE_ID WHERE F.LOGICAL_FILE_NAME = ?`
+	if err := db.QueryRow(stm, lfns[0]).Scan(&nparents); err != nil {
+		t.Fatal(err)
+	}
+	if nparents != len(lfns) {
+		t.Errorf("wrong number of file parents %d of %s", nparents, lfns[0])
+	}
+	rr, err := respRecorder("GET", "/dbs2go/parentagecheck?dataset="+child, nil, web.ParentageCheckHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report dbs.ParentageCheck
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent {
+		t.Errorf("parentage of %s derived by parentage job is not consistent: %+v", child, report)
+	}
+
+	// completed job can not be resumed
+	payload := fmt.Sprintf(`{"job_id": %d}`, job.JOB_ID)
+	if _, err := respRecorder("POST", "/dbs2go/parentagejobs", strings.NewReader(payload), web.ParentageJobsHandler); err == nil {
+		t.Errorf("completed parentage job %d is resumed", job.JOB_ID)
+	}
+
+	// failed job is resumed from its last processed block, i.e. no file
+	// parents are inserted for already processed blocks
+	stm = `INSERT INTO PARENTAGE_JOBS (JOB_ID, DATASET, PARENT_DATASETS, STATUS, LAST_BLOCK_NAME,
+	NBLOCKS, NBLOCKS_DONE, NFILE_PARENTS, ERROR_MESSAGE, CREATION_DATE, LAST_MODIFICATION_DATE, CREATE_BY)
+	VALUES (?, ?, ?, 'failed', ?, 1, 1, 0, 'interrupted', 0, 0, 'tester')`
+	if _, err := db.Exec(stm, job.JOB_ID+1, resumed, parent, resumed+"#1"); err != nil {
+		t.Fatal(err)
+	}
+	job = submit(fmt.Sprintf(`{"job_id": %d}`, job.JOB_ID+1))
+	if job.STATUS != dbs.ParentageJobDone || job.NFILE_PARENTS != 0 || job.ERROR_MESSAGE != "" {
+		t.Errorf("wrong resumed parentage job %+v", job)
+	}
+
+	// job running elsewhere can not be resumed until its lease is expired
+	stm = `INSERT INTO PARENTAGE_JOBS (JOB_ID, DATASET, PARENT_DATASETS, STATUS, LAST_BLOCK_NAME,
+	NBLOCKS, NBLOCKS_DONE, NFILE_PARENTS, ERROR_MESSAGE, CREATION_DATE, LAST_MODIFICATION_DATE, CREATE_BY)
+	VALUES (?, ?, ?, 'running', ?, 1, 1, 0, '', 0, ?, 'tester')`
+	if _, err := db.Exec(stm, job.JOB_ID+1, resumed, parent, resumed+"#1", time.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+	payload = fmt.Sprintf(`{"job_id": %d}`, job.JOB_ID+1)
+	if _, err := respRecorder("POST", "/dbs2go/parentagejobs", strings.NewReader(payload), web.ParentageJobsHandler); err == nil {
+		t.Errorf("running parentage job %d is resumed", job.JOB_ID+1)
+	}
+	stale := time.Now().Unix() - 2*dbs.ParentageJobLease
+	if _, err := db.Exec("UPDATE PARENTAGE_JOBS SET LAST_MODIFICATION_DATE = ? WHERE JOB_ID = ?", stale, job.JOB_ID+1); err != nil {
+		t.Fatal(err)
+	}
+	job = submit(fmt.Sprintf(`{"job_id": %d}`, job.JOB_ID+1))
+	if job.STATUS != dbs.ParentageJobDone {
+		t.Errorf("interrupted parentage job is not resumed %+v", job)
+	}
+}
+
+// TestHTTPInvalidateDataset provides test of dataset invalidation API
+func TestHTTPInvalidateDataset(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+
+	stm := `INSERT INTO DATASET_ACCESS_TYPES (DATASET_ACCESS_TYPE_ID, DATASET_ACCESS_TYPE)
+	SELECT COALESCE(MAX(DATASET_ACCESS_TYPE_ID), 0) + 1, 'INVALID' FROM DATASET_ACCESS_TYPES
+	WHERE NOT EXISTS (SELECT 1 FROM DATASET_ACCESS_TYPES WHERE DATASET_ACCESS_TYPE = 'INVALID')`
+	if _, err := db.Exec(stm); err != nil {
+		t.Fatal(err)
+	}
+
+	// dataset a is parent of b, while c is not related to them
+	a, lfnsA := insertParentageDataset(t, "invalidate", "a", nil, "")
+	b, lfnsB := insertParentageDataset(t, "invalidate", "b", []string{a}, "a")
+	c, _ := insertParentageDataset(t, "invalidate", "c", nil, "")
+
+	// helper function to invalidate dataset with given payload
+	invalidate := func(rurl, payload string) dbs.InvalidationReport {
+		var rec dbs.InvalidationReport
+		rr, err := respRecorder("POST", rurl, strings.NewReader(payload), web.InvalidateDatasetHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &rec); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		return rec
+	}
+	// helper function to get access type and number of valid files of dataset
+	status := func(dataset string) (string, int) {
+		var accessType string
+		var nfiles int
+		stm := `SELECT DAT.DATASET_ACCESS_TYPE,
+		(SELECT COUNT(*) FROM FILES F WHERE F.DATASET_ID = D.DATASET_ID AND F.IS_FILE_VALID = 1)
+		FROM DATASETS D JOIN DATASET_ACCESS_TYPES DAT ON DAT.DATASET_ACCESS_TYPE_ID = D.DATASET_ACCESS_TYPE_ID
+		WHERE D.DATASET = ?`
+		if err := db.QueryRow(stm, dataset).Scan(&accessType, &nfiles); err != nil {
+			t.Fatal(err)
+		}
+		return accessType, nfiles
+	}
+
+	// invalidation requires reason
+	payload := fmt.Sprintf(`{"dataset": "%s", "files": true, "children": true}`, a)
+	if _, err := respRecorder("POST", "/dbs2go/datasets/invalidate", strings.NewReader(payload), web.InvalidateDatasetHandler); err == nil {
+		t.Error("dataset invalidation without reason should fail")
+	}
+
+	// dry-run reports all changes without modifying DBS
+	payload = fmt.Sprintf(`{"dataset": "%s", "reason": "wrong conditions", "files": true, "children": true}`, a)
+	rec := invalidate("/dbs2go/datasets/invalidate?dry_run=true", payload)
+	expect := []dbs.InvalidatedDataset{
+		{Dataset: a, DatasetAccessType: "PRODUCTION", Files: len(lfnsA)},
+		{Dataset: b, DatasetAccessType: "PRODUCTION", Files: len(lfnsB)},
+	}
+	lfns := append(append([]string{}, lfnsA...), lfnsB...)
+	sort.Strings(lfns)
+	if !rec.DryRun || !reflect.DeepEqual(rec.Datasets, expect) || !reflect.DeepEqual(rec.Files, lfns) {
+		t.Errorf("wrong dry-run invalidation report %+v", rec)
+	}
+	for _, dataset := range []string{a, b} {
+		if accessType, nfiles := status(dataset); accessType != "PRODUCTION" || nfiles != len(lfnsA) {
+			t.Errorf("dry-run modifies dataset %s: %s, %d valid files", dataset, accessType, nfiles)
+		}
+	}
+
+	// invalidation cascades to child dataset and files, the datasets and
+	// files are updated in chunks
+	chunk := dbs.InvalidationChunkSize
+	dbs.InvalidationChunkSize = 2
+	defer func() {
+		dbs.InvalidationChunkSize = chunk
+	}()
+	asOf := time.Now().Unix() - 10
+	rec = invalidate("/dbs2go/datasets/invalidate", payload)
+	if rec.DryRun || !reflect.DeepEqual(rec.Datasets, expect) || !reflect.DeepEqual(rec.Files, lfns) {
+		t.Errorf("wrong invalidation report %+v", rec)
+	}
+	for _, dataset := range []string{a, b} {
+		if accessType, nfiles := status(dataset); accessType != "INVALID" || nfiles != 0 {
+			t.Errorf("dataset %s is not invalidated: %s, %d valid files", dataset, accessType, nfiles)
+		}
+	}
+	if accessType, _ := status(c); accessType != "PRODUCTION" {
+		t.Errorf("unrelated dataset %s is invalidated: %s", c, accessType)
+	}
+
+	// every invalidated dataset is recorded in audit trail with the reason
+	rr, err := respRecorder("GET", "/dbs2go/audit?audit_api=invalidatedataset", nil, web.AuditHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []dbs.Record
+	if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+		t.Fatalf("unable to unmarshal audit records '%s', error %v", rr.Body.String(), err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("wrong number of audit records %d, expected 2: %+v", len(records), records)
+	}
+	for _, r := range records {
+		if !strings.Contains(fmt.Sprintf("%v", r["parameters"]), "wrong conditions") ||
+			!strings.Contains(fmt.Sprintf("%v", r["new_values"]), "INVALID") {
+			t.Errorf("wrong audit record of dataset invalidation %+v", r)
+		}
+	}
+
+	// as_of queries take invalidation into account
+	for _, ts := range []int64{asOf, time.Now().Unix() + 10} {
+		expect := "PRODUCTION"
+		if ts > asOf {
+			expect = "INVALID"
+		}
+		rurl := fmt.Sprintf("/dbs2go/datasets?dataset=%s&as_of=%d", a, ts)
+		rr, err := respRecorder("GET", rurl, nil, web.DatasetsHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []dbs.Record
+		if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+			t.Fatalf("unable to unmarshal '%s', error %v", rr.Body.String(), err)
+		}
+		if len(records) != 1 || records[0]["dataset_access_type"] != expect {
+			t.Errorf("wrong state of dataset %s as of %d: %+v, expect %s", a, ts, records, expect)
+		}
+	}
+
+	// repeated invalidation does not change anything
+	rec = invalidate("/dbs2go/datasets/invalidate", payload)
+	if len(rec.Files) != 0 || len(rec.Datasets) != 2 || rec.Datasets[0].DatasetAccessType != "INVALID" {
+		t.Errorf("wrong repeated invalidation report %+v", rec)
+	}
+}
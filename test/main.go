@@ -16,6 +16,7 @@ import (
 	"github.com/dmwm/dbs2go/utils"
 	"github.com/dmwm/dbs2go/web"
 	validator "github.com/go-playground/validator/v10"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	diff "github.com/r3labs/diff/v3"
 	limiter "github.com/ulule/limiter/v3"
@@ -47,8 +48,14 @@ func initDB(dryRun bool, dburi string) *sql.DB {
 	utils.VERBOSE = 1
 	dbtype := "sqlite3"
 	dbowner := "sqlite"
+	// tests can run against other backends, e.g. PostgreSQL, in this case
+	// DBS_DB_FILE should provide DB uri and DB owner should be the schema name
+	if v := os.Getenv("DBS_DB_TYPE"); v != "" {
+		dbtype = v
+		dbowner = os.Getenv("DBS_DB_OWNER")
+	}
 
-	db, err := sql.Open(dbtype, dburi)
+	db, err := dbs.OpenDB(dbtype, dburi)
 	if err != nil {
 		log.Fatal("unable to open db file", err)
 	}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dmwm/dbs2go/dbs"
 	"github.com/dmwm/dbs2go/utils"
@@ -385,6 +392,487 @@ func TestMigrateRemove(t *testing.T) {
 	}
 }
 
+// TestMigrateSchedule tests fair-share scheduling of migration requests
+func TestMigrateSchedule(t *testing.T) {
+	defer func(q dbs.MigrationQuota) { dbs.MigrationUserQuota = q }(dbs.MigrationUserQuota)
+	dbs.MigrationUserQuota = dbs.MigrationQuota{}
+
+	// user a submits many blocks before users b and c
+	var records []dbs.MigrationRequest
+	add := func(mid int64, user string, status, priority int64) {
+		records = append(records, dbs.MigrationRequest{
+			MIGRATION_REQUEST_ID: mid,
+			CREATE_BY:            user,
+			MIGRATION_STATUS:     status,
+			MIGRATION_PRIORITY:   priority,
+		})
+	}
+	for i := int64(1); i <= 4; i++ {
+		add(i, "a", dbs.PENDING, 0)
+	}
+	add(5, "b", dbs.PENDING, 0)
+	add(6, "b", dbs.PENDING, 0)
+	add(7, "c", dbs.PENDING, 0)
+	add(8, "c", dbs.PENDING, 5)
+	schedule := func() []int64 {
+		var ids []int64
+		for _, r := range dbs.MigrationSchedule(records) {
+			ids = append(ids, r.MIGRATION_REQUEST_ID)
+		}
+		return ids
+	}
+	// request of user c with higher priority goes first and counts in its share
+	expect := []int64{8, 1, 5, 2, 6, 7, 3, 4}
+	if ids := schedule(); !reflect.DeepEqual(ids, expect) {
+		t.Errorf("wrong schedule of migration requests %v, expect %v", ids, expect)
+	}
+
+	// requests in progress are always continued while queued, pending and
+	// failed requests of user above concurrent quota are not started
+	records[0].MIGRATION_STATUS = dbs.IN_PROGRESS
+	records[2].MIGRATION_STATUS = dbs.QUEUED
+	records[3].MIGRATION_STATUS = dbs.FAILED
+	dbs.MigrationUserQuota = dbs.MigrationQuota{MaxConcurrent: 2}
+	expect = []int64{8, 1, 5, 2, 6, 7}
+	if ids := schedule(); !reflect.DeepEqual(ids, expect) {
+		t.Errorf("wrong schedule of migration requests with quota %v, expect %v", ids, expect)
+	}
+}
+
+// TestMigratePriority tests priority API and queued quota of migration requests
+func TestMigratePriority(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+	defer func(q dbs.MigrationQuota, admins []string) {
+		dbs.MigrationUserQuota = q
+		dbs.MigrationAdmins = admins
+	}(dbs.MigrationUserQuota, dbs.MigrationAdmins)
+
+	// insert pending and completed migration requests of default user
+	user := "DBS-workflow"
+	tstamp := time.Now().Unix()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mids []int64
+	for i, status := range []int64{dbs.PENDING, dbs.COMPLETED} {
+		rec := dbs.MigrationRequest{
+			MIGRATION_URL:          "http://localhost:8989/dbs",
+			MIGRATION_INPUT:        fmt.Sprintf("/priority/test-v%d/RAW#1", i),
+			MIGRATION_STATUS:       status,
+			CREATE_BY:              user,
+			CREATION_DATE:          tstamp,
+			LAST_MODIFIED_BY:       user,
+			LAST_MODIFICATION_DATE: tstamp,
+		}
+		if err := rec.Insert(tx); err != nil {
+			t.Fatal(err)
+		}
+		mids = append(mids, rec.MIGRATION_REQUEST_ID)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// helper function to change priority of migration request
+	priority := func(mid, value int64) error {
+		data := fmt.Sprintf(`{"migration_rqst_id": %d, "migration_priority": %d}`, mid, value)
+		_, err := respRecorder("POST", "/dbs2go/priority", bytes.NewReader([]byte(data)), web.MigrationPriorityHandler)
+		return err
+	}
+	// nobody is allowed to change priority without migration admins
+	dbs.MigrationAdmins = nil
+	if err := priority(mids[0], 10); err == nil {
+		t.Error("priority of migration request should not be changed without admins")
+	}
+	dbs.MigrationAdmins = []string{user}
+	if err := priority(mids[0], 10); err != nil {
+		t.Fatal(err)
+	}
+	var value int64
+	stm := "SELECT MIGRATION_PRIORITY FROM MIGRATION_REQUESTS WHERE MIGRATION_REQUEST_ID = ?"
+	if err := db.QueryRow(stm, mids[0]).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if value != 10 {
+		t.Errorf("wrong priority %d of migration request %d, expect 10", value, mids[0])
+	}
+	if err := priority(mids[1], 10); err == nil {
+		t.Error("priority of completed migration request should not be changed")
+	}
+	dbs.MigrationAdmins = []string{"admin"}
+	if err := priority(mids[0], -1); err == nil {
+		t.Error("priority of migration request should be changed only by admin")
+	}
+
+	// user with pending request exceeds its queued quota
+	dbs.MigrationUserQuota = dbs.MigrationQuota{MaxQueued: 1}
+	data := `{"migration_url": "http://localhost:8989/dbs", "migration_input": "/priority/test-v2/RAW#1"}`
+	if _, err := respRecorder("POST", "/dbs2go/submit", bytes.NewReader([]byte(data)), web.MigrationSubmitHandler); err == nil {
+		t.Error("migration request above queued quota should be rejected")
+	}
+}
+
+// TestMigrateBlocksConcurrently tests parallel migration of blocks of
+// migration request which preserves their parentage
+func TestMigrateBlocksConcurrently(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+	defer func(workers, timeout int) {
+		dbs.MigrationWorkers = workers
+		dbs.MigrationProcessTimeout = timeout
+	}(dbs.MigrationWorkers, dbs.MigrationProcessTimeout)
+	dbs.MigrationWorkers = 2
+	dbs.MigrationProcessTimeout = 60
+
+	// remote DBS provides block dumps and block parents of datasets
+	// where a is parent of b, b is parent of c, e has no parents and
+	// block dump of f is broken
+	dumps := make(map[string][]byte)
+	parents := make(map[string]string)
+	add := func(name string, dsParents []string, parent string) string {
+		rec, _ := parentageBulkBlocks(t, "engine", name, dsParents, parent)
+		data, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumps[rec.Block.BlockName] = data
+		if len(dsParents) > 0 {
+			parents[rec.Block.BlockName] = dsParents[0] + "#1"
+		}
+		return rec.Block.BlockName
+	}
+	a := add("a", nil, "")
+	b := add("b", []string{strings.Split(a, "#")[0]}, "a")
+	c := add("c", []string{strings.Split(b, "#")[0]}, "b")
+	e := add("e", nil, "")
+	f := add("f", nil, "")
+	g := add("g", []string{strings.Split(f, "#")[0]}, "f")
+	dumps[f] = []byte("{")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blk := r.URL.Query().Get("block_name")
+		if strings.HasSuffix(r.URL.Path, "/blockparents") {
+			var recs []map[string]string
+			if p, ok := parents[blk]; ok {
+				recs = append(recs, map[string]string{"this_block_name": blk, "parent_block_name": p})
+			}
+			data, _ := json.Marshal(recs)
+			w.Write(data)
+			return
+		}
+		w.Write(dumps[blk])
+	}))
+	defer server.Close()
+
+	insert := func(blocks []string) int64 {
+		return insertMigration(t, db, server.URL, blocks)
+	}
+	process := func(mid int64) (string, map[string]dbs.MigrationBlockStatus) {
+		return processMigration(t, mid)
+	}
+
+	// helper function to get migration details of blocks of migration request
+	type detail struct {
+		Block  string `json:"migration_block_name"`
+		Status int64  `json:"migration_status"`
+		Retry  int64  `json:"retry_count"`
+		Error  string `json:"migration_error"`
+		Start  int64  `json:"migration_start_date"`
+		End    int64  `json:"migration_end_date"`
+		Bytes  int64  `json:"bytes_transferred"`
+		Files  int64  `json:"files_transferred"`
+	}
+	details := func(mid int64) map[string]detail {
+		rurl := fmt.Sprintf("/dbs2go/migration/detail?migration_request_id=%d", mid)
+		rr, err := respRecorder("GET", rurl, nil, web.MigrationDetailHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []detail
+		if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+			t.Fatalf("unable to parse migration details %s, error %v", rr.Body.String(), err)
+		}
+		out := make(map[string]detail)
+		for _, r := range records {
+			out[r.Block] = r
+		}
+		return out
+	}
+
+	// all blocks are migrated and their parents are migrated before them
+	mid := insert([]string{a, e, b, c})
+	status, blocks := process(mid)
+	if status != "COMPLETED" {
+		t.Errorf("wrong status %s of migration request, expect COMPLETED", status)
+	}
+	for _, blk := range []string{a, b, c, e} {
+		if blocks[blk].Status != "COMPLETED" {
+			t.Errorf("wrong status of block %+v, expect COMPLETED", blocks[blk])
+		}
+	}
+	var nparents int
+	stm := `SELECT COUNT(*) FROM FILE_PARENTS FP
+	JOIN FILES F ON F.FILE_ID = FP.THIS_FILE_ID
+	JOIN BLOCKS B ON B.BLOCK_ID = F.BLOCK_ID
+	WHERE B.BLOCK_NAME = ?`
+	if err := db.QueryRow(stm, c).Scan(&nparents); err != nil {
+		t.Fatal(err)
+	}
+	if nparents == 0 {
+		t.Errorf("file parents of migrated block %s are not found", c)
+	}
+	for blk, d := range details(mid) {
+		if d.Status != dbs.COMPLETED || d.Files == 0 || d.Bytes == 0 || d.Start == 0 || d.End < d.Start {
+			t.Errorf("wrong migration details of block %s: %+v", blk, d)
+		}
+	}
+
+	// failed block fails migration request and its children are not migrated
+	mid = insert([]string{f, g})
+	status, blocks = process(mid)
+	if status != "FAILED" {
+		t.Errorf("wrong status %s of migration request, expect FAILED", status)
+	}
+	if blocks[f].Status != "FAILED" || blocks[f].Error == "" {
+		t.Errorf("wrong status of block %+v, expect FAILED with error", blocks[f])
+	}
+	if blocks[g].Status != "PENDING" {
+		t.Errorf("wrong status of block %+v, expect PENDING", blocks[g])
+	}
+	if d := details(mid)[f]; d.Error == "" || d.Retry != 0 || d.Files != 0 {
+		t.Errorf("wrong migration details of failed block %+v", d)
+	}
+
+	// retry of migration request increases retry count of failed block and
+	// keeps its last error, while the same block of other migration request
+	// is not changed
+	other := insert([]string{f})
+	process(mid)
+	if d := details(other)[f]; d.Status != dbs.PENDING || d.Retry != 0 || d.Error != "" {
+		t.Errorf("wrong migration details of block of other migration request %+v", d)
+	}
+	d := details(mid)
+	if d[f].Status != dbs.FAILED || d[f].Retry != 1 || d[f].Error == "" {
+		t.Errorf("wrong migration details of retried block %+v", d[f])
+	}
+	if d[g].Status != dbs.PENDING || d[g].Retry != 0 {
+		t.Errorf("wrong migration details of pending block %+v", d[g])
+	}
+}
+
+// helper function to insert migration request of given migration url with
+// given blocks, the last block is used as migration input
+func insertMigration(t *testing.T, db *sql.DB, rurl string, blocks []string) int64 {
+	user := "DBS-workflow"
+	tstamp := time.Now().Unix()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rec := dbs.MigrationRequest{
+		MIGRATION_URL:          rurl,
+		MIGRATION_INPUT:        blocks[len(blocks)-1],
+		MIGRATION_STATUS:       dbs.PENDING,
+		CREATE_BY:              user,
+		CREATION_DATE:          tstamp,
+		LAST_MODIFIED_BY:       user,
+		LAST_MODIFICATION_DATE: tstamp,
+	}
+	if err := rec.Insert(tx); err != nil {
+		t.Fatal(err)
+	}
+	for idx, blk := range blocks {
+		brec := dbs.MigrationBlocks{
+			MIGRATION_REQUEST_ID:   rec.MIGRATION_REQUEST_ID,
+			MIGRATION_BLOCK_NAME:   blk,
+			MIGRATION_ORDER:        int64(idx),
+			MIGRATION_STATUS:       dbs.PENDING,
+			CREATE_BY:              user,
+			CREATION_DATE:          tstamp,
+			LAST_MODIFIED_BY:       user,
+			LAST_MODIFICATION_DATE: tstamp,
+		}
+		if err := brec.Insert(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return rec.MIGRATION_REQUEST_ID
+}
+
+// helper function to process migration request and return its status along
+// with status of its blocks
+func processMigration(t *testing.T, mid int64) (string, map[string]dbs.MigrationBlockStatus) {
+	type report struct {
+		Status string                     `json:"status"`
+		Blocks []dbs.MigrationBlockStatus `json:"migration_blocks"`
+	}
+	data := fmt.Sprintf(`{"migration_rqst_id": %d}`, mid)
+	rr, err := respRecorder("POST", "/dbs2go/process", bytes.NewReader([]byte(data)), web.MigrationProcessHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []report
+	if err := json.Unmarshal(rr.Body.Bytes(), &reports); err != nil || len(reports) != 1 {
+		t.Fatalf("unable to parse process report %s, error %v", rr.Body.String(), err)
+	}
+	blocks := make(map[string]dbs.MigrationBlockStatus)
+	for _, b := range reports[0].Blocks {
+		blocks[b.Block] = b
+	}
+	return reports[0].Status, blocks
+}
+
+// TestMigrateSources tests migration from directory of block dumps and from
+// local database
+func TestMigrateSources(t *testing.T) {
+	// initialize DB for testing
+	dburi := os.Getenv("DBS_DB_FILE")
+	if dburi == "" {
+		log.Fatal("DBS_DB_FILE not defined")
+	}
+	db := initDB(false, dburi)
+	defer db.Close()
+	defer func(timeout int) { dbs.MigrationProcessTimeout = timeout }(dbs.MigrationProcessTimeout)
+	dbs.MigrationProcessTimeout = 60
+
+	// write block dumps of dataset a and its child b, the latter is gzip'ed
+	dir := t.TempDir()
+	var blocks, datasets []string
+	for i, name := range []string{"a", "b"} {
+		var parents []string
+		parent := ""
+		if i > 0 {
+			parents = []string{datasets[0]}
+			parent = "a"
+		}
+		rec, _ := parentageBulkBlocks(t, "source", name, parents, parent)
+		rec.Block.OpenForWriting = 0
+		rec.Dataset.DatasetAccessType = "VALID"
+		if i > 0 {
+			rec.BlockParentList = []dbs.BlockParent{{ParentBlockName: blocks[0], ThisBlockName: rec.Block.BlockName}}
+		}
+		data, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		fname := fmt.Sprintf("%s/%s.json", dir, name)
+		if i > 0 {
+			fname += ".gz"
+			gz := gzip.NewWriter(&buf)
+			gz.Write(data)
+			gz.Close()
+			data = buf.Bytes()
+		}
+		if err := os.WriteFile(fname, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, rec.Block.BlockName)
+		datasets = append(datasets, rec.Dataset.Dataset)
+	}
+	// unreadable block dumps are skipped
+	if err := os.WriteFile(dir+"/bad.json", []byte("{not a block dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// helper function to check look-up of blocks and parents of given source
+	check := func(rurl string) {
+		src, err := dbs.NewMigrationSource(rurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blks, err := src.Blocks(datasets[1]); err != nil || !reflect.DeepEqual(blks, blocks[1:]) {
+			t.Errorf("%s: wrong blocks %v of %s, error %v", rurl, blks, datasets[1], err)
+		}
+		if blks, err := src.Parents(blocks[1]); err != nil || !reflect.DeepEqual(blks, blocks[:1]) {
+			t.Errorf("%s: wrong parents %v of %s, error %v", rurl, blks, blocks[1], err)
+		}
+		if dsets, err := src.Parents(datasets[1]); err != nil || !reflect.DeepEqual(dsets, datasets[:1]) {
+			t.Errorf("%s: wrong parents %v of %s, error %v", rurl, dsets, datasets[1], err)
+		}
+		if dtype, err := src.DatasetAccessType(datasets[0]); err != nil || dtype != "VALID" {
+			t.Errorf("%s: wrong access type %s of %s, error %v", rurl, dtype, datasets[0], err)
+		}
+		data, err := src.BlockDump(blocks[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec dbs.BulkBlocks
+		if err := json.Unmarshal(data, &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Block.BlockName != blocks[1] || len(rec.Files) == 0 {
+			t.Errorf("%s: wrong block dump of %s: %s", rurl, blocks[1], string(data))
+		}
+	}
+
+	// migrate blocks from directory of block dumps, only registered
+	// directories are allowed
+	defer func(dirs map[string]string) { dbs.MigrationSourceDirs = dirs }(dbs.MigrationSourceDirs)
+	dbs.MigrationSourceDirs = map[string]string{"dumps": dir}
+	if _, err := dbs.NewMigrationSource("file://" + dir); err == nil {
+		t.Error("unregistered migration source directory should not be accepted")
+	}
+	check("file://dumps")
+	mid := insertMigration(t, db, "file://dumps", blocks)
+	if status, _ := processMigration(t, mid); status != "COMPLETED" {
+		t.Errorf("wrong status %s of migration request from block dumps, expect COMPLETED", status)
+	}
+
+	// block dump overwritten in place is re-read, i.e. re-opened block is
+	// not provided by migration source anymore
+	rec, _ := parentageBulkBlocks(t, "source", "a", nil, "")
+	rec.Block.OpenForWriting = 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := dir + "/a.json"
+	if err := os.WriteFile(fname, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fname, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	src, err := dbs.NewMigrationSource("file://dumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blks, err := src.Blocks(datasets[0]); err != nil || len(blks) != 0 {
+		t.Errorf("re-opened block should not be provided by migration source, got %v, error %v", blks, err)
+	}
+
+	// migrated blocks are available via local database migration source,
+	// its SQL statements use its own driver and owner rather than ones of
+	// DBS server
+	defer delete(dbs.MigrationSourceDBs, "local")
+	dbs.MigrationSourceDBs["local"] = dbs.NewMigrationSourceDB(db, "sqlite3", "sqlite")
+	func(dbtype, dbowner string) {
+		defer func() { dbs.DBTYPE, dbs.DBOWNER = dbtype, dbowner }()
+		dbs.DBTYPE, dbs.DBOWNER = "pgx", "cms_dbs"
+		check("db://local")
+	}(dbs.DBTYPE, dbs.DBOWNER)
+	if _, err := dbs.NewMigrationSource("db://unknown"); err == nil {
+		t.Error("unknown migration source database should not be accepted")
+	}
+}
+
 // MigrationRequest is the struct for migration request POST body
 type MigrationRequest struct {
 	MigrationURL   string `json:"migration_url"`
@@ -402,4 +890,5 @@ type MigrationStatus struct {
 	MigrationStatus      int    `json:"migration_status"`
 	MigrationURL         string `json:"migration_url"`
 	RetryCount           int    `json:"retry_count"`
+	MigrationPriority    int    `json:"migration_priority"`
 }
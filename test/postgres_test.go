@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dmwm/dbs2go/dbs"
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// pgFakeDriver represents database/sql driver which records statements
+// sent to the database, it is registered as pgx driver such that DBS treats
+// it as PostgreSQL backend
+type pgFakeDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (d *pgFakeDriver) record(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, query)
+}
+
+func (d *pgFakeDriver) Open(name string) (driver.Conn, error) {
+	return &pgFakeConn{driver: d}, nil
+}
+
+type pgFakeConn struct {
+	driver *pgFakeDriver
+}
+
+func (c *pgFakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.record(query)
+	return &pgFakeStmt{}, nil
+}
+
+func (c *pgFakeConn) Close() error {
+	return nil
+}
+
+func (c *pgFakeConn) Begin() (driver.Tx, error) {
+	return &pgFakeTx{}, nil
+}
+
+func (c *pgFakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *pgFakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.record(query)
+	return &pgFakeRows{}, nil
+}
+
+type pgFakeStmt struct{}
+
+func (s *pgFakeStmt) Close() error  { return nil }
+func (s *pgFakeStmt) NumInput() int { return -1 }
+func (s *pgFakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s *pgFakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &pgFakeRows{}, nil
+}
+
+type pgFakeTx struct{}
+
+func (t *pgFakeTx) Commit() error   { return nil }
+func (t *pgFakeTx) Rollback() error { return nil }
+
+type pgFakeRows struct{}
+
+func (r *pgFakeRows) Columns() []string              { return []string{"val"} }
+func (r *pgFakeRows) Close() error                   { return nil }
+func (r *pgFakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+var pgDriver = &pgFakeDriver{}
+
+func init() {
+	sql.Register("pgx", pgDriver)
+}
+
+// TestDBSPostgresBinds tests that PostgreSQL connections rewrite bind
+// variables of all statements
+func TestDBSPostgresBinds(t *testing.T) {
+	db, err := dbs.OpenDB("pgx", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stm := "UPDATE T SET A = :a WHERE B = :b AND C = ':c'"
+	expect := "UPDATE T SET A = $1 WHERE B = $2 AND C = ':c'"
+	if _, err := db.Exec(stm, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(stm, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pstm, err := tx.Prepare(stm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pstm.Exec(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	pstm.Close()
+	tx.Rollback()
+	if len(pgDriver.queries) != 3 {
+		t.Fatalf("wrong number of statements %v", pgDriver.queries)
+	}
+	for _, q := range pgDriver.queries {
+		if q != expect {
+			t.Errorf("bind variables are not replaced in %s", q)
+		}
+	}
+}
+
+// TestDBSPostgresSQL tests PostgreSQL specific SQL statements
+func TestDBSPostgresSQL(t *testing.T) {
+	defer func(dbtype, owner, sdir string) {
+		dbs.DBTYPE, dbs.DBOWNER, utils.STATICDIR = dbtype, owner, sdir
+	}(dbs.DBTYPE, dbs.DBOWNER, utils.STATICDIR)
+	dbs.DBTYPE = "pgx"
+	dbs.DBOWNER = "cms_dbs3"
+	// SQL templates are loaded from static area of the repository
+	utils.STATICDIR = "../static"
+
+	// token generator casts integer tokens
+	stm, vals := dbs.TokenGenerator([]string{"1", "2"}, 100, "run_num")
+	if !strings.Contains(stm, "CAST(T.TOKEN AS BIGINT)") || !strings.Contains(stm, "STRING_TO_ARRAY(:run_num, ',')") {
+		t.Errorf("wrong token generator %s", stm)
+	}
+	if len(vals) != 1 || vals[0] != "1,2" {
+		t.Errorf("wrong token generator values %v", vals)
+	}
+	stm, _ = dbs.TokenGenerator([]string{"/a/b.root"}, 100, "lfn")
+	if strings.Contains(stm, "CAST") {
+		t.Errorf("token generator casts non integer tokens %s", stm)
+	}
+
+	// PostgreSQL does not allow ORACLE hints and aliases of inserted table
+	stm, err := dbs.LoadTemplateSQL("insert_filelumis2", dbs.Record{"Owner": dbs.DBOWNER})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stm, "file_lumis FL") || !strings.Contains(stm, "ON CONFLICT DO NOTHING") {
+		t.Errorf("wrong PostgreSQL statement %s", stm)
+	}
+}
+
+// TestDBSPostgresLive tests rewrite of bind variables against real
+// PostgreSQL database, it runs only if DBS_PG_TEST_URI provides its DSN, e.g.
+// postgres://postgres@localhost:5432/dbs?sslmode=disable
+func TestDBSPostgresLive(t *testing.T) {
+	dsn := os.Getenv("DBS_PG_TEST_URI")
+	if dsn == "" {
+		t.Skip("DBS_PG_TEST_URI is not set")
+	}
+	db, err := dbs.OpenDB("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// temporary table lives within connection of the transaction
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("CREATE TEMPORARY TABLE DBS_BINDS (ID INTEGER, NAME VARCHAR(100))"); err != nil {
+		t.Fatal(err)
+	}
+	// statement executed directly and prepared one
+	stm := "INSERT INTO DBS_BINDS (ID, NAME) VALUES (:id, :name)"
+	if _, err := tx.Exec(stm, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	pstm, err := tx.Prepare(stm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"b", ":c"} {
+		if _, err := pstm.Exec(i+2, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pstm.Close()
+
+	// bind variables are not replaced within string literals
+	var names []string
+	stm = "SELECT NAME FROM DBS_BINDS WHERE ID = :id OR NAME = ':c' ORDER BY ID"
+	rows, err := tx.Query(stm, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if strings.Join(names, ",") != "a,:c" {
+		t.Errorf("wrong names %v, expect [a :c]", names)
+	}
+
+	// rows affected by update are reported
+	res, err := tx.Exec("UPDATE DBS_BINDS SET NAME = :name WHERE ID = :id", "z", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		t.Errorf("wrong number of updated rows %d, error %v", n, err)
+	}
+}
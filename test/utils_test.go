@@ -79,6 +79,28 @@ func TestUtilsReplaceBinds(t *testing.T) {
 	}
 }
 
+// TestUtilsReplacePostgresBinds
+func TestUtilsReplacePostgresBinds(t *testing.T) {
+	str := `
+    -- select :comment
+    SELECT F.FILE_ID, ':literal', F.FILE_SIZE::bigint
+    FROM cms_dbs3.FILES F /* :comment */
+    WHERE F.LOGICAL_FILE_NAME = :logical_file_name
+    OR F.LOGICAL_FILE_NAME = :logical_file_name AND F.IS_FILE_VALID = :is_file_valid
+	 `
+	nstr := utils.ReplacePostgresBinds(str)
+	expect := `
+    -- select :comment
+    SELECT F.FILE_ID, ':literal', F.FILE_SIZE::bigint
+    FROM cms_dbs3.FILES F /* :comment */
+    WHERE F.LOGICAL_FILE_NAME = $1
+    OR F.LOGICAL_FILE_NAME = $2 AND F.IS_FILE_VALID = $3
+	 `
+	if nstr != expect {
+		t.Errorf("unable to replace binds, got\n%s", nstr)
+	}
+}
+
 // TestUtilsInsert
 func TestUtilsInsert(t *testing.T) {
 	var arr []interface{}
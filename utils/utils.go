@@ -266,6 +266,63 @@ func ReplaceBinds(stm string) string {
 	return match
 }
 
+// ReplacePostgresBinds replaces ORACLE style bind variables, e.g. :name,
+// with PostgreSQL positional ones, e.g. $1. Every bind variable gets its own
+// position in order of appearance, while string literals, quoted identifiers,
+// comments and type casts, e.g. ::bigint, are left intact.
+func ReplacePostgresBinds(stm string) string {
+	var out strings.Builder
+	idx := 0
+	for i := 0; i < len(stm); i++ {
+		c := stm[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(stm[i+1:], c)
+			if end < 0 {
+				out.WriteString(stm[i:])
+				return out.String()
+			}
+			out.WriteString(stm[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(stm[i:], "--"):
+			end := strings.IndexByte(stm[i:], '\n')
+			if end < 0 {
+				out.WriteString(stm[i:])
+				return out.String()
+			}
+			out.WriteString(stm[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(stm[i:], "/*"):
+			end := strings.Index(stm[i+2:], "*/")
+			if end < 0 {
+				out.WriteString(stm[i:])
+				return out.String()
+			}
+			out.WriteString(stm[i : i+end+4])
+			i += end + 3
+		case c == ':' && i+1 < len(stm) && stm[i+1] == ':':
+			out.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(stm) && isBindChar(stm[i+1]):
+			j := i + 1
+			for j < len(stm) && isBindChar(stm[j]) {
+				j++
+			}
+			idx++
+			out.WriteString(fmt.Sprintf("$%d", idx))
+			i = j - 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// helper function to check if given character belongs to bind variable name
+func isBindChar(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
 // ConvertFloat converts string representation of float scientific number to string int
 func ConvertFloat(val string) string {
 	if strings.Contains(val, "e+") || strings.Contains(val, "E+") {
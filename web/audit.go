@@ -0,0 +1,187 @@
+package web
+
+// audit module records audit trail of DBS write APIs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// AuditFailures counts total number of write API calls failed since their
+// audit trail record was not inserted
+var AuditFailures uint64
+
+// auditSkipApis lists POST APIs which do not modify DBS data
+var auditSkipApis = []string{"datasetlist", "fileArray", "filelumis", "runsummaries", "datasetlumimask", "blockparents"}
+
+// auditSelfApis lists write APIs which record their own audit trail
+var auditSelfApis = []string{"invalidatedataset"}
+
+// helper function to check if given write API should be audited
+func auditable(method, api string) bool {
+	if !Config.Audit {
+		return false
+	}
+	if method == "POST" && inList(api, auditSkipApis) {
+		return false
+	}
+	if inList(api, auditSelfApis) {
+		return false
+	}
+	return true
+}
+
+// helper function to get string value of API parameter
+func paramValue(params dbs.Record, key string) string {
+	switch v := params[key].(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) == 1 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// helper function to get JSON representation of state of records affected
+// by given update API within given transaction
+func auditState(tx *sql.Tx, api string, params dbs.Record) (string, error) {
+	records, err := dbs.AuditState(tx, api, params)
+	if err != nil {
+		log.Printf("unable to get audit state of API=%s params=%+v, error %v", api, params, err)
+		return "", err
+	}
+	if records == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return "", dbs.Error(err, dbs.MarshalErrorCode, "", "web.auditState")
+	}
+	return string(data), nil
+}
+
+// writeHook implements dbs.TxHook interface to record audit trail of write
+// API and response of request with idempotency key within API transaction,
+// therefore the write fails if they can't be recorded. The failure of audit
+// trail is logged along with the entire record and counted by AuditFailures
+// metric to alert operators.
+type writeHook struct {
+	r         *http.Request
+	api       *dbs.API
+	audit     bool                   // record audit trail of the API
+	payload   *limitBuffer           // copy of payload of POST API
+	oldValues string                 // state of records before update API
+	idem      *dbs.IdempotencyRecord // idempotency key of the request
+}
+
+// Update implements dbs.TxHook interface, it keeps state of records before
+// the update for the audit trail
+func (h *writeHook) Update(tx *sql.Tx) error {
+	if !h.audit {
+		return nil
+	}
+	values, err := auditState(tx, h.api.Api, h.api.Params)
+	if err != nil {
+		return err
+	}
+	h.oldValues = values
+	return nil
+}
+
+// Commit implements dbs.TxHook interface, it inserts audit trail record of
+// the API and completes idempotency key of the request with API response
+func (h *writeHook) Commit(tx *sql.Tx, response []byte) error {
+	if h.audit {
+		if err := h.insertAudit(tx); err != nil {
+			return err
+		}
+	}
+	if h.idem != nil {
+		if err := dbs.CompleteIdempotencyKey(tx, h.idem, string(response)); err != nil {
+			log.Printf("unable to store response of idempotency key '%s', error %v", h.idem.IDEMPOTENCY_KEY, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function to insert audit trail record of the API
+func (h *writeHook) insertAudit(tx *sql.Tx) error {
+	var rec *dbs.AuditRecord
+	var err error
+	if h.r.Method == "PUT" {
+		rec, err = h.auditPut(tx)
+	} else {
+		rec = h.auditPost()
+	}
+	if err == nil {
+		rec.METHOD = h.r.Method
+		rec.DN = h.r.Header.Get("Cms-Authn-Dn")
+		rec.CREATE_BY = createBy(h.r)
+		err = rec.Insert(tx)
+	}
+	if err != nil {
+		atomic.AddUint64(&AuditFailures, 1)
+		data, _ := json.Marshal(rec)
+		log.Printf("ERROR: unable to record audit trail, API=%s method=%s record=%s, error %v", h.api.Api, h.r.Method, string(data), err)
+		return err
+	}
+	return nil
+}
+
+// helper function to get audit trail record of update (PUT) API, the new
+// values are obtained within API transaction after the update
+func (h *writeHook) auditPut(tx *sql.Tx) (*dbs.AuditRecord, error) {
+	params := h.api.Params
+	data, _ := json.Marshal(params)
+	newValues, err := auditState(tx, h.api.Api, params)
+	if err != nil {
+		return nil, err
+	}
+	rec := &dbs.AuditRecord{
+		API:               h.api.Api,
+		DATASET:           paramValue(params, "dataset"),
+		BLOCK_NAME:        paramValue(params, "block_name"),
+		LOGICAL_FILE_NAME: paramValue(params, "logical_file_name"),
+		PARAMETERS:        string(data),
+		OLD_VALUES:        h.oldValues,
+		NEW_VALUES:        newValues,
+	}
+	// file updates may not specify dataset, we'll take it from file record
+	if rec.DATASET == "" && rec.LOGICAL_FILE_NAME != "" {
+		var records []dbs.Record
+		if err := json.Unmarshal([]byte(rec.NEW_VALUES), &records); err == nil && len(records) > 0 {
+			if dataset, ok := records[0]["dataset"].(string); ok {
+				rec.DATASET = dataset
+			}
+		}
+	}
+	return rec, nil
+}
+
+// helper function to get audit trail record of insert (POST) API
+func (h *writeHook) auditPost() *dbs.AuditRecord {
+	data := h.payload.Bytes()
+	if h.api.Params != nil {
+		// payload of these APIs is already parsed into API parameters
+		data, _ = json.Marshal(h.api.Params)
+	} else if h.payload.overflow {
+		log.Printf("payload of %s API exceeds %d bytes, it is not recorded in audit trail", h.api.Api, h.payload.limit)
+	}
+	dataset, block, lfn, values := dbs.AuditPayload(data)
+	return &dbs.AuditRecord{
+		API:               h.api.Api,
+		DATASET:           dataset,
+		BLOCK_NAME:        block,
+		LOGICAL_FILE_NAME: lfn,
+		PARAMETERS:        h.r.URL.RawQuery,
+		NEW_VALUES:        values,
+	}
+}
@@ -0,0 +1,431 @@
+package web
+
+// cache module provides read-through cache of DBS reader API responses
+//
+// The cache is keyed on API name and normalized set of its parameters and
+// holds already formatted (but not compressed) output of the API. Each
+// reader API has its own TTL, the APIs without TTL are not cached. The cache
+// is bounded by number of entries and total size of cached responses, least
+// recently used entries are evicted first. Writer APIs invalidate cached
+// entries of reader APIs which may be affected by the write.
+//
+// A reader API may build its response before the write is committed and
+// put it into the cache after the write invalidated the cache. Therefore
+// every invalidation increments cache generation, the reader API captures
+// the generation before it runs and its response is not cached if a
+// matching invalidation happened since then.
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// CacheHits counts total number of reader API requests served from the cache
+var CacheHits uint64
+
+// CacheMisses counts total number of cacheable reader API requests not found in the cache
+var CacheMisses uint64
+
+// CacheEvictions counts total number of cache entries evicted due to cache limits
+var CacheEvictions uint64
+
+// CacheInvalidations counts total number of cache entries invalidated by writer APIs
+var CacheInvalidations uint64
+
+// ResponseCache represents cache of reader API responses
+var ResponseCache *Cache
+
+// cacheInvalidations defines which reader APIs are affected by writer APIs,
+// nil list means that writer API may affect all reader APIs
+var cacheInvalidations = map[string][]string{
+	"bulkblocks":      nil,
+	"bulkblocksbatch": nil,
+	// invalidation may cascade to child datasets and their files
+	"invalidatedataset": nil,
+	"datasets": {
+		"datasets", "datasetparents", "datasetchildren", "blocks", "blocksummaries",
+		"files", "filesummaries", "runs", "runsummaries", "datasetlumimask", "provenance", "blockdump", "parentDSTrio"},
+	"blocks": {
+		"blocks", "blocksummaries", "blockorigin", "blockdump"},
+	"files": {
+		"files", "filesummaries", "filelumis", "fileparents", "filechildren",
+		"blocksummaries", "runs", "runsummaries", "datasetlumimask", "parentagecheck", "blockdump", "blockTrio", "parentDSTrio"},
+	"fileparents": {
+		"fileparents", "filechildren", "blockparents", "blockchildren",
+		"datasetparents", "datasetchildren", "provenance", "parentagecheck", "blockdump", "parentDSTrio"},
+	"fileparentsbylumi": {
+		"fileparents", "filechildren", "provenance", "parentagecheck", "blockdump", "parentDSTrio"},
+	"parentagecheck": {
+		"fileparents", "filechildren", "blockparents", "blockchildren",
+		"datasetparents", "datasetchildren", "provenance", "parentagecheck", "blockdump", "parentDSTrio"},
+	"datatiers":          {"datatiers"},
+	"datasetaccesstypes": {"datasetaccesstypes"},
+	"physicsgroups":      {"physicsgroups"},
+	"outputconfigs":      {"outputconfigs", "releaseversions"},
+	"primarydatasets":    {"primarydatasets", "primarydstypes"},
+	"acquisitioneras":    {"acquisitioneras", "acquisitioneras_ci"},
+	"processingeras":     {"processingeras"},
+}
+
+// MaxCacheInvalidations defines number of recent invalidations kept by the
+// cache to check responses of reader APIs started before them
+var MaxCacheInvalidations = 1000
+
+// cacheInvalidation represents invalidation of cache entries
+type cacheInvalidation struct {
+	generation uint64   // cache generation of the invalidation
+	apis       []string // invalidated reader APIs, empty list means all APIs
+	dataset    string   // invalidated dataset, empty means all datasets
+}
+
+// CacheEntry represents single cached response of reader API
+type CacheEntry struct {
+	Key     string    // cache key
+	Api     string    // reader API name
+	Dataset string    // dataset (pattern) the response belongs to, empty if unknown
+	Data    []byte    // response body
+	Expire  time.Time // expiration time of the entry
+}
+
+// Cache represents LRU cache of reader API responses
+type Cache struct {
+	TTL        map[string]time.Duration // TTL of reader APIs
+	MaxEntries int                      // max number of entries in the cache
+	MaxSize    int64                    // max total size of cached responses
+	size       int64
+	entries    map[string]*list.Element
+	lru        *list.List
+	mutex      sync.Mutex
+	generation uint64              // number of invalidations so far
+	recent     []cacheInvalidation // recent invalidations in generation order
+}
+
+// NewCache creates new response cache with given per API TTLs (in seconds)
+// and size limits
+func NewCache(ttl map[string]int, maxEntries int, maxSize int64) *Cache {
+	c := &Cache{
+		TTL:        make(map[string]time.Duration),
+		MaxEntries: maxEntries,
+		MaxSize:    maxSize,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+	for api, sec := range ttl {
+		if sec > 0 {
+			c.TTL[api] = time.Duration(sec) * time.Second
+		}
+	}
+	return c
+}
+
+// Cacheable checks if responses of given API should be cached
+func (c *Cache) Cacheable(api string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.TTL[api]
+	return ok
+}
+
+// Get returns cached entry for given key
+func (c *Cache) Get(key string) (*CacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*CacheEntry)
+	if time.Now().After(entry.Expire) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// Generation returns current cache generation which should be captured
+// before reader API builds the response passed to Set
+func (c *Cache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// Set adds response of given API to the cache, the response is dropped if
+// it is affected by invalidation which happened after given generation
+func (c *Cache) Set(key, api, dataset string, data []byte, generation uint64) {
+	size := int64(len(data))
+	if c.MaxSize > 0 && size > c.MaxSize {
+		return
+	}
+	entry := &CacheEntry{
+		Key:     key,
+		Api:     api,
+		Dataset: dataset,
+		Data:    data,
+		Expire:  time.Now().Add(c.TTL[api]),
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.invalidated(api, dataset, generation) {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+	for c.lru.Len() > 0 &&
+		((c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries) || (c.MaxSize > 0 && c.size > c.MaxSize)) {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&CacheEvictions, 1)
+	}
+}
+
+// Invalidate removes cached entries of given reader APIs which belong to
+// given dataset. Empty list of APIs invalidates entries of all APIs, while
+// empty dataset invalidates all entries of given APIs.
+func (c *Cache) Invalidate(apis []string, dataset string) int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.recent = append(c.recent, cacheInvalidation{generation: c.generation, apis: apis, dataset: dataset})
+	if len(c.recent) > MaxCacheInvalidations {
+		c.recent = c.recent[len(c.recent)-MaxCacheInvalidations:]
+	}
+	var count int
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*CacheEntry)
+		if (len(apis) == 0 || inList(entry.Api, apis)) && datasetMatch(entry.Dataset, dataset) {
+			c.remove(elem)
+			count++
+		}
+		elem = next
+	}
+	atomic.AddUint64(&CacheInvalidations, uint64(count))
+	return count
+}
+
+// Len returns number of entries in the cache
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns total size of cached responses
+func (c *Cache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// helper function to check if response of given API and dataset built since
+// given generation is affected by later invalidation, should be called with
+// acquired lock
+func (c *Cache) invalidated(api, dataset string, generation uint64) bool {
+	if generation >= c.generation {
+		return false
+	}
+	// invalidations which are not kept anymore may affect the response
+	if len(c.recent) == 0 || c.recent[0].generation > generation+1 {
+		return true
+	}
+	for _, inv := range c.recent {
+		if inv.generation <= generation {
+			continue
+		}
+		if (len(inv.apis) == 0 || inList(api, inv.apis)) && datasetMatch(dataset, inv.dataset) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to remove cache element, should be called with acquired lock
+func (c *Cache) remove(elem *list.Element) {
+	entry := elem.Value.(*CacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.Key)
+	c.size -= int64(len(entry.Data))
+}
+
+// helper function to check if given string is in a list
+func inList(a string, list []string) bool {
+	for _, b := range list {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to check if dataset (pattern) of cached entry matches
+// dataset of writer API, unknown dataset on either side matches anything
+func datasetMatch(pattern, dataset string) bool {
+	if pattern == "" || dataset == "" || pattern == dataset {
+		return true
+	}
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+	pat := strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+	matched, err := regexp.MatchString(fmt.Sprintf("^%s$", pat), dataset)
+	return err != nil || matched
+}
+
+// helper function to build cache key from API name, output format and
+// normalized API parameters
+func cacheKey(api, sep, ctype string, params dbs.Record) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		var vals []string
+		switch v := params[k].(type) {
+		case []string:
+			vals = append(vals, v...)
+		default:
+			vals = append(vals, fmt.Sprintf("%v", v))
+		}
+		sort.Strings(vals)
+		parts = append(parts, fmt.Sprintf("%s=%s", strings.ToLower(k), strings.Join(vals, ",")))
+	}
+	return fmt.Sprintf("%s|%s|%s|%s", api, sep, ctype, strings.Join(parts, "&"))
+}
+
+// helper function to get dataset of API parameters, it is either dataset
+// itself or dataset part of the block name
+func paramsDataset(params dbs.Record) string {
+	for _, key := range []string{"dataset", "block_name"} {
+		var val string
+		switch v := params[key].(type) {
+		case string:
+			val = v
+		case []string:
+			if len(v) == 1 {
+				val = v[0]
+			}
+		}
+		if val != "" {
+			return strings.Split(val, "#")[0]
+		}
+	}
+	return ""
+}
+
+// helper function to get dataset name of bulkblocks payload
+func bulkblocksDataset(data []byte) string {
+	var rec struct {
+		Dataset struct {
+			Dataset string `json:"dataset"`
+		} `json:"dataset"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return ""
+	}
+	return rec.Dataset.Dataset
+}
+
+// helper function to invalidate cached entries affected by given writer API
+func invalidateCache(api, dataset string) {
+	if ResponseCache == nil {
+		return
+	}
+	if apis, ok := cacheInvalidations[api]; ok {
+		ResponseCache.Invalidate(apis, dataset)
+	}
+}
+
+// recordWriter records output of reader API written to http.ResponseWriter,
+// the buffered output is not passed to underlying writer until API completes.
+// The recording stops once the output exceeds the limit, then the buffered
+// output is passed to underlying writer and the record is dropped.
+type recordWriter struct {
+	http.ResponseWriter
+	buf      bytes.Buffer
+	buffered bool
+	limit    int64 // max size of recorded output, 0 means no limit
+	overflow bool  // output exceeds the limit and it is not recorded
+}
+
+// Write implements Write API of http.ResponseWriter interface
+func (c *recordWriter) Write(b []byte) (int, error) {
+	if c.overflow {
+		return c.ResponseWriter.Write(b)
+	}
+	if c.limit > 0 && int64(c.buf.Len()+len(b)) > c.limit {
+		c.overflow = true
+		if c.buffered && c.buf.Len() > 0 {
+			if _, err := c.ResponseWriter.Write(c.buf.Bytes()); err != nil {
+				return 0, err
+			}
+		}
+		c.buf = bytes.Buffer{}
+		return c.ResponseWriter.Write(b)
+	}
+	c.buf.Write(b)
+	if c.buffered {
+		return len(b), nil
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// limitBuffer keeps copy of data written to it, e.g. HTTP request payload,
+// the copy is dropped once data exceeds the limit
+type limitBuffer struct {
+	bytes.Buffer
+	limit    int64 // max size of the copy, 0 means no limit
+	overflow bool  // data exceeds the limit and it is not kept
+}
+
+// Write implements io.Writer interface, it never fails such that it can be
+// used by io.TeeReader
+func (b *limitBuffer) Write(data []byte) (int, error) {
+	if b.overflow {
+		return len(data), nil
+	}
+	if b.limit > 0 && int64(b.Len()+len(data)) > b.limit {
+		b.overflow = true
+		b.Buffer = bytes.Buffer{}
+		return len(data), nil
+	}
+	return b.Buffer.Write(data)
+}
+
+// InitCache initializes response cache from server configuration
+func InitCache() {
+	if len(Config.CacheTTL) == 0 {
+		ResponseCache = nil
+		return
+	}
+	ResponseCache = NewCache(Config.CacheTTL, Config.CacheMaxEntries, Config.CacheMaxSize)
+}
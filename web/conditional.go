@@ -0,0 +1,131 @@
+package web
+
+// conditional module provides support of conditional GET requests
+//
+// The reader API responses may carry strong ETag computed from their content
+// and Last-Modified date of requested dataset or block. The requests with
+// matching If-None-Match or If-Modified-Since headers are answered with
+// 304 (Not Modified) status without response body. The ETag is computed
+// only for responses which fit into the cache or etag max size, therefore
+// content ETag also enables Last-Modified date used by larger responses.
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// lastModifiedSkipApis lists reader APIs whose output depends on other
+// datasets or blocks than requested ones, e.g. parents or children of the
+// dataset, or on other tables, e.g. parentage jobs
+var lastModifiedSkipApis = []string{
+	"datasetchildren", "blockchildren", "filechildren", "parentDSTrio", "status", "total",
+	"datasetparents", "blockparents", "fileparents", "provenance", "parentagecheck", "parentagejobs",
+}
+
+// helper function to compute strong ETag of response content, the gzip'ed
+// response is different representation and therefore gets different ETag
+func contentEtag(data []byte, gzip bool) string {
+	hash := sha256.Sum256(data)
+	if gzip {
+		return fmt.Sprintf("\"%s-gzip\"", hex.EncodeToString(hash[:]))
+	}
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(hash[:]))
+}
+
+// helper function to check if If-None-Match header matches given ETag,
+// according to RFC 7232 weak comparison is used for If-None-Match
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to write 304 (Not Modified) response
+func notModified(w http.ResponseWriter, gw *gzip.Writer) {
+	if gw != nil {
+		// nothing should be written to the client, including gzip headers
+		gw.Reset(io.Discard)
+	}
+	w.Header().Del("Content-Type")
+	w.Header().Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// helper function to write reader API response to given writer. If etag
+// flag is set the response gets strong ETag of its content and request with
+// matching If-None-Match header gets 304 (Not Modified) response.
+func writeResponse(w http.ResponseWriter, r *http.Request, out io.Writer, gw *gzip.Writer, data []byte, etag bool) {
+	if etag {
+		tag := contentEtag(data, gw != nil)
+		w.Header().Set("ETag", tag)
+		if etagMatch(r.Header.Get("If-None-Match"), tag) {
+			notModified(w, gw)
+			return
+		}
+	}
+	out.Write(data)
+}
+
+// helper function to get single dataset or block name from API parameters,
+// the wildcard patterns and lists of values are ignored
+func paramsScope(params dbs.Record) (string, string) {
+	value := func(key string) string {
+		if vals, ok := params[key].([]string); ok && len(vals) == 1 && !strings.Contains(vals[0], "*") {
+			return vals[0]
+		}
+		return ""
+	}
+	return value("dataset"), value("block_name")
+}
+
+// helper function to set Last-Modified header of reader API request for single
+// dataset or block and check If-Modified-Since condition of the request. It
+// returns true if request is answered with 304 (Not Modified) response.
+func notModifiedSince(w http.ResponseWriter, r *http.Request, api string, params dbs.Record) bool {
+	if !(Config.LastModified || Config.ContentEtag) || inList(api, lastModifiedSkipApis) {
+		return false
+	}
+	dataset, block := paramsScope(params)
+	if dataset == "" && block == "" {
+		return false
+	}
+	lmd, err := dbs.LastModified(dataset, block)
+	if err != nil || lmd == 0 {
+		return false
+	}
+	mtime := time.Unix(lmd, 0).UTC()
+	w.Header().Set("Last-Modified", mtime.Format(http.TimeFormat))
+	// If-Modified-Since is ignored when request contains If-None-Match, see RFC 7232
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") == "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		log.Printf("unable to parse If-Modified-Since header '%s', error %v", r.Header.Get("If-Modified-Since"), err)
+		return false
+	}
+	if mtime.After(since) {
+		return false
+	}
+	notModified(w, nil)
+	return true
+}
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+
+	"github.com/dmwm/dbs2go/dbs"
 )
 
 // Configuration stores dbs configuration parameters
@@ -30,6 +32,9 @@ type Configuration struct {
 	ServerType      string   `json:"server_type"`       // DBS server type to start: DBSReader, DBSWriter, DBSMigrate, DBSMigration
 	Etag            string   `json:"etag"`              // etag value to use for ETag generation
 	CacheControl    string   `json:"cache_control"`     // Cache-Control value, e.g. max-age=300
+	ContentEtag     bool     `json:"content_etag"`      // compute strong ETag of reader API responses from their content
+	EtagMaxSize     int64    `json:"etag_max_size"`     // max size of response buffered to compute its content ETag
+	LastModified    bool     `json:"last_modified"`     // provide Last-Modified date of reader API responses for single dataset or block
 	CMSRole         []string `json:"cms_role"`          // cms role for write access
 	CMSGroup        []string `json:"cms_group"`         // cms group for write access
 
@@ -41,6 +46,17 @@ type Configuration struct {
 	MigrationCleanupOffset   int64  `json:"migration_cleanup_offset"`   // migration cleanup offset
 	MigrationRetries         int64  `json:"migration_retries"`          // migration retries
 	MigrationAsyncTimeout    int    `json:"migration_async_timeout"`    // timeout for aysnc migration request
+	MigrationWorkers         int    `json:"migration_workers"`          // number of blocks migrated concurrently within migration request
+
+	// migration scheduler settings
+	MigrationQuota      dbs.MigrationQuota            `json:"migration_quota"`       // default quota of migration requests per user
+	MigrationUserQuotas map[string]dbs.MigrationQuota `json:"migration_user_quotas"` // quotas of migration requests of specific users
+	MigrationGroups     []dbs.MigrationGroup          `json:"migration_groups"`      // groups of users sharing quota of migration requests
+	MigrationAdmins     []string                      `json:"migration_admins"`      // users allowed to change priority of migration requests
+
+	// migration sources
+	MigrationSourceDBs  map[string]string `json:"migration_source_dbs"`  // dbfiles of databases used as db://<name> migration sources
+	MigrationSourceDirs map[string]string `json:"migration_source_dirs"` // directories of block dumps used as file://<name> migration sources
 
 	// db related configuration
 	DBFile               string `json:"dbfile"`                  // dbs db file with secrets
@@ -54,6 +70,24 @@ type Configuration struct {
 	FileLumiMaxSize      int    `json:"file_lumi_max_size"`      // max size for []FileLumi insertion
 	FileLumiInsertMethod string `json:"file_lumi_insert_method"` // insert method for FileLumi list
 	ConcurrentBulkBlocks bool   `json:"concurrent_bulkblocks"`   // use concurrent BulkBlocks API
+	StreamBulkBlocks     bool   `json:"stream_bulkblocks"`       // use streaming decoder of BulkBlocks API payload
+	StreamFilesBatch     int    `json:"stream_files_batch"`      // number of files inserted at once by streaming BulkBlocks API
+	Audit                bool   `json:"audit"`                   // record audit trail of DBS write APIs
+	IdempotencyKeyTTL    int64  `json:"idempotency_key_ttl"`     // how long (in seconds) idempotency keys of POST APIs are kept
+	IdempotencyLease     int64  `json:"idempotency_lease"`       // how long (in seconds) idempotency keys of POST APIs in progress are reserved
+	ProvenanceMaxNodes   int    `json:"provenance_max_nodes"`    // maximum number of nodes of provenance graph
+	ParentageChunkSize   int    `json:"parentage_chunk_size"`    // number of file parents inserted at once by parentage jobs
+	ParentageJobLease    int64  `json:"parentage_job_lease"`     // how long (in seconds) running parentage job is claimed without progress
+
+	// reader API response cache
+	CacheTTL        map[string]int `json:"cache_ttl"`         // cache TTL in seconds per reader API, e.g. {"datasets": 300}
+	CacheMaxEntries int            `json:"cache_max_entries"` // max number of cached responses
+	CacheMaxSize    int64          `json:"cache_max_size"`    // max total size of cached responses in bytes
+
+	// change events of writer APIs
+	Events         bool      `json:"events"`          // provide change events via /events server-sent events API
+	Webhooks       []Webhook `json:"webhooks"`        // webhooks receiving change events
+	WebhookRetries int       `json:"webhook_retries"` // number of retries of webhook requests
 
 	// server static parts
 	Templates string `json:"templates"` // location of server templates
@@ -73,6 +107,13 @@ type Configuration struct {
 	GraphQLSchema string `json:"graphqlSchema"` // graph ql schema file name
 }
 
+// Webhook represents webhook receiving change events of DBS writer APIs
+type Webhook struct {
+	URL         string `json:"url"`     // webhook URL
+	Timeout     int    `json:"timeout"` // webhook request timeout in seconds
+	EventFilter        // filter of change events sent to the webhook
+}
+
 // Config represents global configuration object
 var Config Configuration
 
@@ -147,6 +188,15 @@ func ParseConfig(configFile string) error {
 	if Config.MigrationRetries == 0 {
 		Config.MigrationRetries = 3
 	}
+	if Config.CacheMaxEntries == 0 {
+		Config.CacheMaxEntries = 10000
+	}
+	if Config.CacheMaxSize == 0 {
+		Config.CacheMaxSize = 256 * 1024 * 1024 // 256MB
+	}
+	if Config.EtagMaxSize == 0 {
+		Config.EtagMaxSize = 10 * 1024 * 1024 // 10MB
+	}
 	if Config.TlsRefreshInterval == 0 {
 		Config.TlsRefreshInterval = 4 * 60 * 60 // 4 hours
 	}
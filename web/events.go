@@ -0,0 +1,382 @@
+package web
+
+// events module provides change notifications of DBS writer APIs
+//
+// The change events published by writer APIs are delivered to clients
+// subscribed via /events server-sent events (SSE) API and to configured
+// webhooks. The SSE clients and webhooks may filter events by their type
+// and dataset pattern. The webhooks receive events as JSON documents via
+// HTTP POST requests which are retried with exponential backoff.
+//
+// The delivery of events is best-effort and per server instance: events are
+// kept in memory only, every server has its own sequence of event IDs and
+// events are dropped for subscribers which do not keep up with them. The
+// subscribers which may have missed events get explicit events_gap event.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmwm/dbs2go/dbs"
+)
+
+// EventsPublished counts total number of published change events
+var EventsPublished uint64
+
+// EventsDropped counts total number of change events dropped for slow subscribers
+var EventsDropped uint64
+
+// WebhookFailures counts total number of change events not delivered to webhooks
+var WebhookFailures uint64
+
+// EventBufferSize defines number of change events buffered per subscriber
+var EventBufferSize = 1000
+
+// EventHistorySize defines number of recent change events replayed to
+// SSE clients reconnecting with Last-Event-ID header
+var EventHistorySize = 1000
+
+// EventHeartbeat defines interval of keep-alive comments of SSE stream
+var EventHeartbeat = 30 * time.Second
+
+// Events represents change events broker of DBS server
+var Events *EventBroker
+
+// EventFilter represents filter of change events
+type EventFilter struct {
+	EventTypes []string `json:"event_types"` // list of event types, empty list means all types
+	Dataset    string   `json:"dataset"`     // dataset pattern, e.g. /a/b/*
+}
+
+// Match checks if given event matches the filter
+func (f EventFilter) Match(e dbs.Event) bool {
+	if len(f.EventTypes) > 0 && !inList(e.Type, f.EventTypes) {
+		return false
+	}
+	if f.Dataset != "" && !datasetMatch(f.Dataset, e.Dataset) {
+		return false
+	}
+	return true
+}
+
+// helper function to validate event filter
+func (f EventFilter) validate() error {
+	for _, etype := range f.EventTypes {
+		if !inList(etype, dbs.EventTypes) {
+			msg := fmt.Sprintf("unknown event type %s, supported types %v", etype, dbs.EventTypes)
+			return dbs.Error(dbs.InvalidParamErr, dbs.ParametersErrorCode, msg, "web.events.validate")
+		}
+	}
+	return nil
+}
+
+// eventSubscriber represents SSE client subscribed to change events
+type eventSubscriber struct {
+	filter EventFilter
+	events chan dbs.Event
+	gap    chan dbs.Event
+}
+
+// webhook represents webhook receiving change events
+type webhook struct {
+	config Webhook
+	events chan dbs.Event
+	gap    chan dbs.Event
+	client *http.Client
+}
+
+// EventBroker dispatches change events to subscribers and webhooks
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+	history     []dbs.Event
+	webhooks    []*webhook
+	startID     uint64 // last event ID before broker start
+}
+
+// NewEventBroker creates new change events broker and starts delivery of
+// events to given webhooks
+func NewEventBroker(hooks []Webhook) *EventBroker {
+	b := &EventBroker{
+		subscribers: make(map[*eventSubscriber]struct{}),
+		startID:     dbs.LastEventID(),
+	}
+	for _, h := range hooks {
+		timeout := h.Timeout
+		if timeout == 0 {
+			timeout = 10
+		}
+		wh := &webhook{
+			config: h,
+			events: make(chan dbs.Event, EventBufferSize),
+			gap:    make(chan dbs.Event, 1),
+			client: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		}
+		b.webhooks = append(b.webhooks, wh)
+		go wh.run()
+	}
+	return b
+}
+
+// helper function to create events gap event, the lastID is ID of last
+// event delivered to subscriber, if known
+func gapEvent(lastID uint64, reason string) dbs.Event {
+	values := dbs.Record{"reason": reason}
+	if lastID > 0 {
+		values["last_event_id"] = lastID
+	}
+	return dbs.Event{Type: dbs.EventsGapEvent, Values: values, Timestamp: time.Now().Unix()}
+}
+
+// helper function to signal events gap to subscriber or webhook, pending
+// gap event is kept if there is one already
+func signalGap(gap chan dbs.Event, e dbs.Event) {
+	select {
+	case gap <- e:
+	default:
+	}
+}
+
+// Publish delivers change event to subscribers and webhooks, events are
+// dropped for subscribers which do not keep up with them and they get
+// events gap event instead
+func (b *EventBroker) Publish(e dbs.Event) {
+	atomic.AddUint64(&EventsPublished, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history = append(b.history, e)
+	if len(b.history) > EventHistorySize {
+		b.history = b.history[len(b.history)-EventHistorySize:]
+	}
+	for s := range b.subscribers {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			atomic.AddUint64(&EventsDropped, 1)
+			signalGap(s.gap, gapEvent(0, "events buffer overflow"))
+		}
+	}
+	for _, wh := range b.webhooks {
+		if !wh.config.Match(e) {
+			continue
+		}
+		select {
+		case wh.events <- e:
+		default:
+			atomic.AddUint64(&EventsDropped, 1)
+			log.Printf("drop event %d for webhook %s", e.ID, wh.config.URL)
+			signalGap(wh.gap, gapEvent(0, "events buffer overflow"))
+		}
+	}
+}
+
+// Subscribe creates new subscriber of change events matching given filter,
+// the recent events with ID greater than lastID are replayed to subscriber.
+// The subscriber gets events gap event if events following lastID are not
+// in the history of this broker, e.g. they were published before server
+// restart or by another server instance.
+func (b *EventBroker) Subscribe(filter EventFilter, lastID uint64) *eventSubscriber {
+	s := &eventSubscriber{
+		filter: filter,
+		events: make(chan dbs.Event, EventBufferSize),
+		gap:    make(chan dbs.Event, 1),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if lastID > 0 {
+		if !b.replayable(lastID) {
+			signalGap(s.gap, gapEvent(lastID, "events history does not contain events following last event id"))
+		}
+		for _, e := range b.history {
+			if e.ID > lastID && filter.Match(e) {
+				select {
+				case s.events <- e:
+				default:
+					signalGap(s.gap, gapEvent(lastID, "events buffer overflow"))
+				}
+			}
+		}
+	}
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// helper function to check if all events published after given event ID
+// are kept in the history of the broker, must be called with locked mutex
+func (b *EventBroker) replayable(lastID uint64) bool {
+	if lastID < b.startID || lastID > dbs.LastEventID() {
+		// event is published before broker start or by another server
+		return false
+	}
+	if len(b.history) > 0 && b.history[0].ID > lastID+1 {
+		// events following lastID are evicted from the history
+		return false
+	}
+	return true
+}
+
+// Unsubscribe removes given subscriber of change events
+func (b *EventBroker) Unsubscribe(s *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, s)
+}
+
+// Subscribers returns number of subscribers of change events
+func (b *EventBroker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// helper function to deliver change events to webhook
+func (wh *webhook) run() {
+	for {
+		var e dbs.Event
+		select {
+		case e = <-wh.events:
+		case e = <-wh.gap:
+		}
+		if err := wh.deliver(e); err != nil {
+			atomic.AddUint64(&WebhookFailures, 1)
+			log.Printf("unable to deliver event %d to webhook %s, error %v", e.ID, wh.config.URL, err)
+		}
+	}
+}
+
+// helper function to deliver single change event to webhook with retries
+func (wh *webhook) deliver(e dbs.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	retries := Config.WebhookRetries
+	if retries == 0 {
+		retries = 3
+	}
+	for attempt := 0; ; attempt++ {
+		err = wh.post(data, e)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		time.Sleep(time.Duration(1<<attempt) * time.Second)
+	}
+}
+
+// helper function to make single webhook HTTP POST request
+func (wh *webhook) post(data []byte, e dbs.Event) error {
+	req, err := http.NewRequest("POST", wh.config.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DBS-Event", e.Type)
+	if e.ID > 0 {
+		req.Header.Set("X-DBS-Event-Id", fmt.Sprintf("%d", e.ID))
+	}
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// InitEvents initializes change events broker of DBS server
+func InitEvents() {
+	if !Config.Events && len(Config.Webhooks) == 0 {
+		return
+	}
+	for _, h := range Config.Webhooks {
+		if h.URL == "" {
+			log.Fatal("webhook configuration without url")
+		}
+		if err := h.validate(); err != nil {
+			log.Fatalf("invalid webhook %s configuration, error %v", h.URL, err)
+		}
+	}
+	Events = NewEventBroker(Config.Webhooks)
+	dbs.EventPublisher = Events.Publish
+}
+
+// EventsHandler provides server-sent events stream of change events.
+// Takes the following arguments: event_type, dataset
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if Events == nil || !Config.Events {
+		err := errors.New("change events are not enabled on this server")
+		responseMsg(w, r, err, http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err := errors.New("streaming is not supported")
+		responseMsg(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	filter := EventFilter{Dataset: r.URL.Query().Get("dataset")}
+	for _, v := range r.URL.Query()["event_type"] {
+		for _, etype := range strings.Split(v, ",") {
+			filter.EventTypes = append(filter.EventTypes, strings.TrimSpace(etype))
+		}
+	}
+	if err := filter.validate(); err != nil {
+		responseMsg(w, r, err, http.StatusBadRequest)
+		return
+	}
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, _ = strconv.ParseUint(v, 10, 64)
+	}
+
+	s := Events.Subscribe(filter, lastID)
+	defer Events.Unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(EventHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprintf(w, ": keep-alive\n\n")
+		case e := <-s.gap:
+			// gap event has no id and therefore does not change Last-Event-ID of client
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Println("unable to marshal event", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case e := <-s.events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Println("unable to marshal event", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -357,6 +358,10 @@ func parsePayload(r *http.Request) (dbs.Record, error) {
 		log.Println("HTTP POST payload\n", params)
 	}
 	for k, v := range params {
+		if strings.ToLower(k) == "lumi_mask" {
+			// lumi mask is a map of runs and their lumi ranges, we keep it as is
+			continue
+		}
 		s := fmt.Sprintf("%v", v)
 		if strings.ToLower(k) == "run_num" && strings.Contains(s, "[") {
 			params["runList"] = true
@@ -433,6 +438,12 @@ func DBSPutHandler(w http.ResponseWriter, r *http.Request, a string) {
 		dn, _ := r.Header["Cms-Authn-Dn"]
 		log.Printf("DBSPutHandler: API=%s, dn=%s, uri=%s", a, dn, requestURI(r))
 	}
+	// audit trail is recorded within transaction of the API
+	var hook *writeHook
+	if auditable(r.Method, a) {
+		hook = &writeHook{r: r, api: api, audit: true}
+		api.Hook = hook
+	}
 	if a == "acquisitioneras" {
 		err = api.UpdateAcquisitionEras()
 	} else if a == "datasets" {
@@ -446,6 +457,13 @@ func DBSPutHandler(w http.ResponseWriter, r *http.Request, a string) {
 		responseMsg(w, r, err, http.StatusBadRequest)
 		return
 	}
+	if hook != nil && !api.HookCommitted() {
+		if err := api.CommitHook(nil); err != nil {
+			responseMsg(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	invalidateCache(a, paramsDataset(params))
 }
 
 // DBSPostHandler is a generic Post Handler to call DBS Post APIs
@@ -468,7 +486,9 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 	}
 
 	headerContentType := r.Header.Get("Content-Type")
-	if headerContentType != "application/json" {
+	// bulkblocks batch API also accepts NDJSON stream of blocks
+	ndjson := a == "bulkblocksbatch" && headerContentType == "application/ndjson"
+	if headerContentType != "application/json" && !ndjson {
 		msg := fmt.Sprintf("unsupported Content-Type: '%s'", headerContentType)
 		e := dbs.Error(dbs.ContentTypeErr, dbs.ContentTypeErrorCode, msg, "web.DBSPostHandler")
 		responseMsg(w, r, e, http.StatusUnsupportedMediaType)
@@ -496,6 +516,31 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 		}
 		body = utils.GzipReader{reader, r.Body}
 	}
+	// keep copy of the payload to know which cached responses it affects
+	// and to record it in the audit trail, the copy of large payload is
+	// dropped and then all cached responses of affected APIs are invalidated
+	payload := limitBuffer{limit: Config.CacheMaxSize}
+	// bulkblocks dry-run only validates the payload and dataset invalidation
+	// dry-run only reports changes, both do not modify DBS
+	dryRun := (a == "bulkblocks" || a == "invalidatedataset") && r.URL.Query().Get("dry_run") == "true"
+	audit := auditable(r.Method, a) && !dryRun
+	// streaming and batch bulkblocks APIs do not keep their payload in
+	// memory, instead they provide inserted blocks via API parameters
+	stream := (a == "bulkblocks" && dbs.StreamBulkBlocks && !dryRun) || a == "bulkblocksbatch"
+	// requests with idempotency key are executed only once, the replay of
+	// completed request returns its original response
+	var idem *dbs.IdempotencyRecord
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" && !dryRun && !inList(a, auditSkipApis) {
+		var ok bool
+		idem, body, ok = reserveIdempotencyKey(w, r, a, key, cby, body)
+		if !ok {
+			return
+		}
+		defer body.Close()
+	}
+	if ((a == "bulkblocks" && ResponseCache != nil && !dryRun) || audit) && !stream {
+		body = io.NopCloser(io.TeeReader(body, &payload))
+	}
 	api := &dbs.API{
 		Reader:    body,
 		Writer:    w,
@@ -510,7 +555,26 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 		defer gw.Close()
 		api.Writer = utils.GzipWriter{GzipWriter: gw, Writer: w}
 	}
-	if a == "fileArray" || a == "datasetlist" || a == "fileparentsbylumi" || a == "filelumis" || a == "blockparents" || a == "process" {
+	// audit trail and response of request with idempotency key are recorded
+	// within transaction of the API, the response of the API is sent once
+	// its transaction is committed along with them
+	var hook *writeHook
+	var response *recordWriter
+	if audit || idem != nil {
+		hook = &writeHook{r: r, api: api, audit: audit, payload: &payload, idem: idem}
+		api.Hook = hook
+		response = &recordWriter{ResponseWriter: api.Writer, buffered: true}
+		api.Writer = response
+	}
+	if idem != nil {
+		defer func() {
+			// the key is released unless request is completed
+			if !api.HookCommitted() {
+				releaseIdempotencyKey(idem)
+			}
+		}()
+	}
+	if a == "fileArray" || a == "datasetlist" || a == "fileparentsbylumi" || a == "filelumis" || a == "runsummaries" || a == "datasetlumimask" || a == "blockparents" || a == "process" {
 		params, err = parsePayload(r)
 		if err != nil {
 			responseMsg(w, r, err, http.StatusInternalServerError)
@@ -518,10 +582,20 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 		}
 		api.Params = params
 	}
+	if a == "bulkblocksbatch" {
+		params = make(dbs.Record)
+		for k, v := range r.URL.Query() {
+			// url query parameters are passed as list, we take first element only
+			params[k] = v[0]
+		}
+		api.Params = params
+	}
 	if utils.VERBOSE > 0 {
 		log.Println(api.String())
 	}
-	if a == "datatiers" {
+	if dryRun && a == "bulkblocks" {
+		err = api.DryRunBulkBlocks()
+	} else if a == "datatiers" {
 		err = api.InsertDataTiers()
 	} else if a == "datasetaccesstypes" {
 		err = api.InsertDatasetAccessTypes()
@@ -540,15 +614,25 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 	} else if a == "blocks" {
 		err = api.InsertBlocks()
 	} else if a == "bulkblocks" {
-		if dbs.ConcurrentBulkBlocks {
+		if dbs.StreamBulkBlocks {
+			err = api.InsertBulkBlocksStream()
+		} else if dbs.ConcurrentBulkBlocks {
 			err = api.InsertBulkBlocksConcurrently()
 		} else {
 			err = api.InsertBulkBlocks()
 		}
+	} else if a == "bulkblocksbatch" {
+		err = api.InsertBulkBlocksBatch()
 	} else if a == "files" {
 		err = api.InsertFiles()
 	} else if a == "fileparents" {
 		err = api.InsertFileParents()
+	} else if a == "parentagecheck" {
+		err = api.RepairParentage()
+	} else if a == "parentagejobs" {
+		err = api.SubmitParentageJob()
+	} else if a == "invalidatedataset" {
+		err = api.InvalidateDataset(dryRun)
 	} else if a == "datasetlist" {
 		err = api.DatasetList()
 	} else if a == "fileArray" {
@@ -557,6 +641,10 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 		err = api.FileParentsByLumi()
 	} else if a == "filelumis" {
 		err = api.FileLumis()
+	} else if a == "runsummaries" {
+		err = api.RunSummaries()
+	} else if a == "datasetlumimask" {
+		err = api.DatasetLumiMask()
 	} else if a == "blockparents" {
 		err = api.BlockParents()
 	} else if a == "submit" {
@@ -567,11 +655,32 @@ func DBSPostHandler(w http.ResponseWriter, r *http.Request, a string) {
 		err = api.ProcessMigrationCtx(dbs.MigrationProcessTimeout)
 	} else if a == "remove" {
 		err = api.RemoveMigration()
+	} else if a == "priority" {
+		err = api.MigrationPriority()
 	}
 	if err != nil {
 		responseMsg(w, r, err, http.StatusBadRequest)
 		return
 	}
+	if dryRun {
+		return
+	}
+	if hook != nil {
+		// write APIs which do not use single transaction do not commit
+		// the hook, it is committed within its own transaction
+		if !api.HookCommitted() {
+			if err := api.CommitHook(response.buf.Bytes()); err != nil {
+				responseMsg(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+		response.ResponseWriter.Write(response.buf.Bytes())
+	}
+	if a == "bulkblocks" && !stream {
+		invalidateCache(a, bulkblocksDataset(payload.Bytes()))
+	} else {
+		invalidateCache(a, paramsDataset(api.Params))
+	}
 }
 
 // DBSGetHandler is a generic Get handler to call DBS Get APIs.
@@ -593,7 +702,19 @@ func DBSGetHandler(w http.ResponseWriter, r *http.Request, a string) {
 	if r.Header.Get("Accept") == "application/ndjson" {
 		sep = ""
 	}
-	if sep != "" {
+	// client may ask for columnar output of the results
+	ctype := dbs.ColumnarContentType(r.Header.Get("Accept"))
+	if ctype != "" && (a == "blockdump" || a == "datasetlumimask" || a == "provenance" || a == "parentagecheck") {
+		msg := fmt.Sprintf("%s API does not support '%s' output", a, ctype)
+		e := dbs.Error(dbs.ContentTypeErr, dbs.ContentTypeErrorCode, msg, "web.DBSGetHandler")
+		responseMsg(w, r, e, http.StatusNotAcceptable)
+		return
+	}
+	if ctype != "" {
+		w.Header().Add("Content-Type", ctype)
+	} else if a == "provenance" && r.URL.Query().Get("format") == "dot" {
+		w.Header().Add("Content-Type", dbs.DotContentType)
+	} else if sep != "" {
 		w.Header().Add("Content-Type", "application/json")
 	} else {
 		w.Header().Add("Content-Type", "application/ndjson")
@@ -608,18 +729,69 @@ func DBSGetHandler(w http.ResponseWriter, r *http.Request, a string) {
 		dn, _ := r.Header["Cms-Authn-Dn"]
 		log.Printf("DBSGetHandler: API=%s, dn=%s, uri=%+v, params: %+v", a, dn, requestURI(r), params)
 	}
+	// parse limit and cursor parameters of paginated request
+	page, err := dbs.NewPagination(a, params)
+	if err != nil {
+		responseMsg(w, r, err, http.StatusBadRequest)
+		return
+	}
 	api := &dbs.API{
 		Writer:    w,
 		Params:    params,
 		Separator: sep,
 		Api:       a,
 	}
+	// answer conditional request based on last modification date of
+	// requested dataset or block without running the API
+	if notModifiedSince(w, r, a, params) {
+		return
+	}
+	var gw *gzip.Writer
 	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 		w.Header().Set("Content-Encoding", "gzip")
-		gw := gzip.NewWriter(w)
+		gw = gzip.NewWriter(w)
 		defer gw.Close()
 		api.Writer = utils.GzipWriter{GzipWriter: gw, Writer: w}
 	}
+	// the content ETag is known only when we have the entire API output,
+	// therefore we buffer the output of cacheable APIs up to cache max size
+	// and output of other APIs up to etag max size, the larger output is
+	// streamed to the client without ETag and relies on Last-Modified date
+	etag := Config.ContentEtag && page == nil
+	// serve cacheable requests from the response cache, otherwise record
+	// the API output to put it into the cache or compute its ETag
+	var rw *recordWriter
+	var ckey, dataset string
+	var generation uint64
+	if page == nil && ResponseCache.Cacheable(a) {
+		// capture cache generation before the response is built
+		generation = ResponseCache.Generation()
+		ckey = cacheKey(a, sep, ctype, params)
+		if entry, ok := ResponseCache.Get(ckey); ok {
+			atomic.AddUint64(&CacheHits, 1)
+			writeResponse(w, r, api.Writer, gw, entry.Data, etag)
+			return
+		}
+		atomic.AddUint64(&CacheMisses, 1)
+		dataset = paramsDataset(params)
+	}
+	if etag || ckey != "" {
+		limit := Config.CacheMaxSize
+		if ckey == "" {
+			limit = Config.EtagMaxSize
+		}
+		rw = &recordWriter{ResponseWriter: api.Writer, buffered: etag, limit: limit}
+		api.Writer = rw
+	}
+	if ctype != "" {
+		api.Writer = &dbs.ColumnarWriter{ResponseWriter: api.Writer, ContentType: ctype}
+	}
+	if page != nil {
+		// next cursor is known only after we stream the results,
+		// therefore we announce it as HTTP trailer
+		w.Header().Set("Trailer", dbs.NextCursorHeader)
+		api.Writer = &dbs.PageWriter{ResponseWriter: api.Writer, Page: page}
+	}
 	if utils.VERBOSE > 0 {
 		log.Println(api.String())
 	}
@@ -663,6 +835,14 @@ func DBSGetHandler(w http.ResponseWriter, r *http.Request, a string) {
 		err = api.FileLumis()
 	} else if a == "datasetparents" {
 		err = api.DatasetParents()
+	} else if a == "datasetlumimask" {
+		err = api.DatasetLumiMask()
+	} else if a == "provenance" {
+		err = api.Provenance()
+	} else if a == "parentagecheck" {
+		err = api.ParentageCheck()
+	} else if a == "parentagejobs" {
+		err = api.ParentageJobs()
 	} else if a == "datatypes" {
 		err = api.DataTypes()
 	} else if a == "processingeras" {
@@ -681,10 +861,14 @@ func DBSGetHandler(w http.ResponseWriter, r *http.Request, a string) {
 		err = api.ParentDatasetFileLumiIds()
 	} else if a == "datasetaccesstypes" {
 		err = api.DatasetAccessTypes()
+	} else if a == "audit" {
+		err = api.Audit()
 	} else if a == "status" {
 		err = api.StatusMigration()
 	} else if a == "total" {
 		err = api.TotalMigration()
+	} else if a == "migrationdetail" {
+		err = api.MigrationDetail()
 	} else {
 		err = dbs.NotImplementedApiErr
 	}
@@ -692,6 +876,15 @@ func DBSGetHandler(w http.ResponseWriter, r *http.Request, a string) {
 		responseMsg(w, r, err, http.StatusBadRequest)
 		return
 	}
+	// the output which exceeds the recording limit is already written
+	if rw != nil && !rw.overflow {
+		if ckey != "" {
+			ResponseCache.Set(ckey, a, dataset, rw.buf.Bytes(), generation)
+		}
+		if etag {
+			writeResponse(w, r, rw.ResponseWriter, gw, rw.buf.Bytes(), etag)
+		}
+	}
 }
 
 // NotImplementedHandler returns server status error
@@ -723,6 +916,12 @@ func DatasetsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// AuditHandler provides access to Audit DBS API.
+// Takes the following arguments: dataset, block_name, logical_file_name, create_by, dn, audit_api, min_cdate, max_cdate
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	DBSGetHandler(w, r, "audit")
+}
+
 // ParentDSTrioHandler provides access to ParentDSTrio DBS API.
 // Takes the following arguments: dataset
 func ParentDSTrioHandler(w http.ResponseWriter, r *http.Request) {
@@ -746,6 +945,53 @@ func BlockDumpHandler(w http.ResponseWriter, r *http.Request) {
 	DBSGetHandler(w, r, "blockdump")
 }
 
+// DatasetLumiMaskHandler provides access to DatasetLumiMask DBS API
+// GET API takes the following arguments: dataset, block_name, validFileOnly
+// POST API takes no argument, the payload should be supplied as JSON
+func DatasetLumiMaskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		DBSPostHandler(w, r, "datasetlumimask")
+	} else {
+		DBSGetHandler(w, r, "datasetlumimask")
+	}
+}
+
+// ProvenanceHandler provides access to Provenance DBS API.
+// Takes the following arguments: dataset, logical_file_name, direction, depth, max_nodes, format
+func ProvenanceHandler(w http.ResponseWriter, r *http.Request) {
+	DBSGetHandler(w, r, "provenance")
+}
+
+// ParentageCheckHandler provides access to ParentageCheck DBS API
+// GET API takes the following arguments: dataset
+// POST API repairs parentage of dataset, the payload should be supplied as JSON
+func ParentageCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		DBSPostHandler(w, r, "parentagecheck")
+	} else {
+		DBSGetHandler(w, r, "parentagecheck")
+	}
+}
+
+// ParentageJobsHandler provides access to ParentageJobs DBS API
+// GET API takes the following arguments: job_id, dataset, status
+// POST API submits or resumes parentage job, the payload should be supplied as JSON
+func ParentageJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		DBSPostHandler(w, r, "parentagejobs")
+	} else {
+		DBSGetHandler(w, r, "parentagejobs")
+	}
+}
+
+// InvalidateDatasetHandler provides access to InvalidateDataset DBS API
+// POST API invalidates dataset and optionally its files and children, the
+// payload should be supplied as JSON, dry_run=true query parameter only
+// reports changes
+func InvalidateDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	DBSPostHandler(w, r, "invalidatedataset")
+}
+
 // BlockChildrenHandler provides access to BlockChildren DBS API.
 // Takes the following arguments: block_name
 func BlockChildrenHandler(w http.ResponseWriter, r *http.Request) {
@@ -811,9 +1057,14 @@ func RunsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // RunSummariesHandler provides access to RunSummaries DBS API.
-// Takes the following arguments: dataset, run_num
+// GET API takes the following arguments: dataset, run_num
+// POST API takes no argument, the payload should be supplied as JSON
 func RunSummariesHandler(w http.ResponseWriter, r *http.Request) {
-	DBSGetHandler(w, r, "runsummaries")
+	if r.Method == "POST" {
+		DBSPostHandler(w, r, "runsummaries")
+	} else {
+		DBSGetHandler(w, r, "runsummaries")
+	}
 }
 
 // ProcessingErasHandler provices access to ProcessingEras DBS API.
@@ -963,6 +1214,13 @@ func BulkBlocksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// BulkBlocksBatchHandler provides access to BulkBlocks batch DBS API
+// POST API takes optional atomic argument, the payload should be supplied
+// as JSON array or NDJSON stream of bulk blocks
+func BulkBlocksBatchHandler(w http.ResponseWriter, r *http.Request) {
+	DBSPostHandler(w, r, "bulkblocksbatch")
+}
+
 // Migration server handlers
 
 // MigrationSubmitHandler provides access to SubmitMigration DBS API
@@ -989,11 +1247,22 @@ func MigrationCancelHandler(w http.ResponseWriter, r *http.Request) {
 	DBSPostHandler(w, r, "cancel")
 }
 
+// MigrationPriorityHandler provides access to MigrationPriority DBS API
+// POST API takes no argument, the payload should be supplied as JSON
+func MigrationPriorityHandler(w http.ResponseWriter, r *http.Request) {
+	DBSPostHandler(w, r, "priority")
+}
+
 // MigrationStatusHandler provides access to StatusMigration DBS API
 func MigrationStatusHandler(w http.ResponseWriter, r *http.Request) {
 	DBSGetHandler(w, r, "status")
 }
 
+// MigrationDetailHandler provides access to MigrationDetail DBS API
+func MigrationDetailHandler(w http.ResponseWriter, r *http.Request) {
+	DBSGetHandler(w, r, "migrationdetail")
+}
+
 // MigrationTotalHandler provides access to TotalMigration DBS API
 func MigrationTotalHandler(w http.ResponseWriter, r *http.Request) {
 	DBSGetHandler(w, r, "total")
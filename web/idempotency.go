@@ -0,0 +1,95 @@
+package web
+
+// idempotency module provides idempotent execution of DBS POST APIs via
+// Idempotency-Key HTTP header
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/dmwm/dbs2go/dbs"
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// IdempotencyKeyHeader defines HTTP header with idempotency key of POST request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader defines HTTP header set in response of replayed request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// spooledPayload represents payload of POST request spooled into temporary
+// file, the file is removed when payload is closed
+type spooledPayload struct {
+	*os.File
+}
+
+// Close implementation of spooledPayload
+func (p spooledPayload) Close() error {
+	p.File.Close()
+	return os.Remove(p.Name())
+}
+
+// helper function to reserve idempotency key of POST request. It returns
+// reserved key record along with payload of the request, or false if the
+// response is already written, i.e. response of already completed request
+// or an error. The payload is spooled into temporary file while its hash is
+// computed, the caller should close it.
+func reserveIdempotencyKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	api, key, createBy string,
+	body io.Reader) (*dbs.IdempotencyRecord, io.ReadCloser, bool) {
+	fname, hash, err := dbs.SpoolPayload(body)
+	if err != nil {
+		msg := "unable to read HTTP POST payload"
+		e := dbs.Error(err, dbs.ReaderErrorCode, msg, "web.reserveIdempotencyKey")
+		responseMsg(w, r, e, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	file, err := os.Open(fname)
+	if err != nil {
+		os.Remove(fname)
+		msg := "unable to read HTTP POST payload"
+		e := dbs.Error(err, dbs.ReaderErrorCode, msg, "web.reserveIdempotencyKey")
+		responseMsg(w, r, e, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	payload := spooledPayload{file}
+	rec := &dbs.IdempotencyRecord{
+		IDEMPOTENCY_KEY: key,
+		API:             api,
+		REQUEST_HASH:    hash,
+		CREATE_BY:       createBy,
+	}
+	done, err := dbs.ReserveIdempotencyKey(rec)
+	if err != nil {
+		payload.Close()
+		status := http.StatusInternalServerError
+		var dbsError *dbs.DBSError
+		if errors.As(err, &dbsError) && dbsError.Code == dbs.IdempotencyConflict {
+			status = http.StatusConflict
+		}
+		responseMsg(w, r, err, status)
+		return nil, nil, false
+	}
+	if done != nil {
+		payload.Close()
+		if utils.VERBOSE > 0 {
+			log.Printf("replay %s request with idempotency key '%s'", api, key)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.Write([]byte(done.RESPONSE))
+		return nil, nil, false
+	}
+	return rec, payload, true
+}
+
+// helper function to release idempotency key of failed request
+func releaseIdempotencyKey(rec *dbs.IdempotencyRecord) {
+	if err := dbs.ReleaseIdempotencyKey(rec); err != nil {
+		log.Printf("unable to release idempotency key '%s', error %v", rec.IDEMPOTENCY_KEY, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/dmwm/dbs2go/dbs"
@@ -116,6 +117,23 @@ type Metrics struct {
 	MaxDBConnections   uint64                  `json:"maxDBConnections"`   // max number of DB connections
 	MaxIdleConnections uint64                  `json:"maxIdleConnections"` // max number of idle DB connections
 
+	// reader API response cache metrics
+	CacheHits          uint64 `json:"cacheHits"`          // total number of requests served from the cache
+	CacheMisses        uint64 `json:"cacheMisses"`        // total number of cacheable requests not found in the cache
+	CacheEvictions     uint64 `json:"cacheEvictions"`     // total number of evicted cache entries
+	CacheInvalidations uint64 `json:"cacheInvalidations"` // total number of cache entries invalidated by writer APIs
+	CacheEntries       uint64 `json:"cacheEntries"`       // number of entries in the cache
+	CacheSize          uint64 `json:"cacheSize"`          // total size of cached responses in bytes
+
+	// change events metrics
+	EventsPublished  uint64 `json:"eventsPublished"`  // total number of published change events
+	EventsDropped    uint64 `json:"eventsDropped"`    // total number of change events dropped for slow subscribers
+	EventSubscribers uint64 `json:"eventSubscribers"` // number of subscribers of change events
+	WebhookFailures  uint64 `json:"webhookFailures"`  // total number of change events not delivered to webhooks
+
+	// audit trail metrics
+	AuditFailures uint64 `json:"auditFailures"` // total number of write API calls whose audit record was not inserted
+
 	// Migration server metrics
 	MigrationRequests   uint64 `json:"migrationRequests"`   // total number of migration requests across all services
 	MigrationPending    uint64 `json:"migrationPending"`    // total number of pending migration requests across all services
@@ -185,6 +203,21 @@ func metrics() Metrics {
 	metrics.RPSLogical = float64(rstat.NumLogicalCores-NumLogicalCores) / lapse
 	metrics.RPSPhysical = float64(rstat.NumPhysicalCores-NumPhysicalCores) / lapse
 
+	// response cache metrics
+	metrics.CacheHits = atomic.LoadUint64(&CacheHits)
+	metrics.CacheMisses = atomic.LoadUint64(&CacheMisses)
+	metrics.CacheEvictions = atomic.LoadUint64(&CacheEvictions)
+	metrics.CacheInvalidations = atomic.LoadUint64(&CacheInvalidations)
+	metrics.CacheEntries = uint64(ResponseCache.Len())
+	metrics.CacheSize = uint64(ResponseCache.Size())
+	metrics.EventsPublished = atomic.LoadUint64(&EventsPublished)
+	metrics.EventsDropped = atomic.LoadUint64(&EventsDropped)
+	metrics.WebhookFailures = atomic.LoadUint64(&WebhookFailures)
+	metrics.AuditFailures = atomic.LoadUint64(&AuditFailures)
+	if Events != nil {
+		metrics.EventSubscribers = uint64(Events.Subscribers())
+	}
+
 	// migration server metrics
 	metrics.MigrationRequests = dbs.TotalMigrationRequests
 	metrics.MigrationPending = dbs.TotalPending
@@ -408,6 +441,53 @@ func promMetrics(prefix string) string {
 	out += fmt.Sprintf("# TYPE %s_max_lifetime_closed counter\n", prefix)
 	out += fmt.Sprintf("%s_max_lifetime_closed %v\n", prefix, data.DBStats.MaxLifetimeClosed)
 
+	// response cache metrics
+	out += fmt.Sprintf("# HELP %s_cache_hits reports total number of requests served from the cache\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_cache_hits counter\n", prefix)
+	out += fmt.Sprintf("%s_cache_hits %v\n", prefix, data.CacheHits)
+
+	out += fmt.Sprintf("# HELP %s_cache_misses reports total number of cacheable requests not found in the cache\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_cache_misses counter\n", prefix)
+	out += fmt.Sprintf("%s_cache_misses %v\n", prefix, data.CacheMisses)
+
+	out += fmt.Sprintf("# HELP %s_cache_evictions reports total number of cache entries evicted due to cache limits\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_cache_evictions counter\n", prefix)
+	out += fmt.Sprintf("%s_cache_evictions %v\n", prefix, data.CacheEvictions)
+
+	out += fmt.Sprintf("# HELP %s_cache_invalidations reports total number of cache entries invalidated by writer APIs\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_cache_invalidations counter\n", prefix)
+	out += fmt.Sprintf("%s_cache_invalidations %v\n", prefix, data.CacheInvalidations)
+
+	out += fmt.Sprintf("# HELP %s_cache_entries reports number of entries in the cache\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_cache_entries gauge\n", prefix)
+	out += fmt.Sprintf("%s_cache_entries %v\n", prefix, data.CacheEntries)
+
+	out += fmt.Sprintf("# HELP %s_cache_size reports total size of cached responses in bytes\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_cache_size gauge\n", prefix)
+	out += fmt.Sprintf("%s_cache_size %v\n", prefix, data.CacheSize)
+
+	// change events metrics
+	out += fmt.Sprintf("# HELP %s_events_published reports total number of published change events\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_events_published counter\n", prefix)
+	out += fmt.Sprintf("%s_events_published %v\n", prefix, data.EventsPublished)
+
+	out += fmt.Sprintf("# HELP %s_events_dropped reports total number of change events dropped for slow subscribers\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_events_dropped counter\n", prefix)
+	out += fmt.Sprintf("%s_events_dropped %v\n", prefix, data.EventsDropped)
+
+	out += fmt.Sprintf("# HELP %s_event_subscribers reports number of subscribers of change events\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_event_subscribers gauge\n", prefix)
+	out += fmt.Sprintf("%s_event_subscribers %v\n", prefix, data.EventSubscribers)
+
+	out += fmt.Sprintf("# HELP %s_webhook_failures reports total number of change events not delivered to webhooks\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_webhook_failures counter\n", prefix)
+	out += fmt.Sprintf("%s_webhook_failures %v\n", prefix, data.WebhookFailures)
+
+	// audit trail metrics
+	out += fmt.Sprintf("# HELP %s_audit_failures reports total number of write API calls whose audit record was not inserted\n", prefix)
+	out += fmt.Sprintf("# TYPE %s_audit_failures counter\n", prefix)
+	out += fmt.Sprintf("%s_audit_failures %v\n", prefix, data.AuditFailures)
+
 	// migration server metrics
 	out += fmt.Sprintf("# HELP %s_requests reports total number of migration requests\n", prefix)
 	out += fmt.Sprintf("# TYPE %s_requests counter\n", prefix)
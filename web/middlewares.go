@@ -14,6 +14,7 @@ import (
 	limiter "github.com/ulule/limiter/v3"
 	stdlib "github.com/ulule/limiter/v3/drivers/middleware/stdlib"
 	memory "github.com/ulule/limiter/v3/drivers/store/memory"
+	"github.com/vkuznet/auth-proxy-server/logging"
 )
 
 // LimiterMiddleware provides limiter middleware pointer
@@ -125,6 +126,19 @@ func Etag(str string, weak bool) string {
 	return tag
 }
 
+// logging middleware logs all requests except server-sent events streams
+// since logging response writer does not support flushing of the response
+func loggingMiddleware(next http.Handler) http.Handler {
+	logged := logging.LoggingMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath("/events") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logged.ServeHTTP(w, r)
+	})
+}
+
 // response header middleware
 func headerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
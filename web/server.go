@@ -58,6 +58,8 @@ import (
 	// imports for supported DB drivers
 	// go-oci8 oracle driver
 	_ "github.com/mattn/go-oci8"
+	// PostgreSQL driver
+	_ "github.com/lib/pq"
 	// go-sqlite driver
 	_ "github.com/mattn/go-sqlite3"
 	// ora oracle driver
@@ -104,8 +106,10 @@ func Handlers() *mux.Router {
 		router.HandleFunc(basePath("/process"), MigrationProcessHandler).Methods("POST")
 		router.HandleFunc(basePath("/cancel"), MigrationCancelHandler).Methods("POST")
 		router.HandleFunc(basePath("/remove"), MigrationRemoveHandler).Methods("POST")
+		router.HandleFunc(basePath("/priority"), MigrationPriorityHandler).Methods("POST")
 		router.HandleFunc(basePath("/status"), MigrationStatusHandler).Methods("GET")
 		router.HandleFunc(basePath("/total"), MigrationTotalHandler).Methods("GET")
+		router.HandleFunc(basePath("/migration/detail"), MigrationDetailHandler).Methods("GET")
 		router.HandleFunc(basePath("/blocks"), BlocksHandler).Methods("GET")
 		router.HandleFunc(basePath("/bulkblocks"), BulkBlocksHandler).Methods("POST")
 		router.HandleFunc(basePath("/blockparents"), BlocksHandler).Methods("GET")
@@ -143,11 +147,18 @@ func Handlers() *mux.Router {
 		router.HandleFunc(basePath("/filelumis"), FileLumisHandler).Methods("GET")
 		router.HandleFunc(basePath("/datasetchildren"), DatasetChildrenHandler).Methods("GET")
 		router.HandleFunc(basePath("/datasetparents"), DatasetParentsHandler).Methods("GET")
+		router.HandleFunc(basePath("/datasetlumimask"), DatasetLumiMaskHandler).Methods("GET")
+		router.HandleFunc(basePath("/provenance"), ProvenanceHandler).Methods("GET")
+		router.HandleFunc(basePath("/parentagecheck"), ParentageCheckHandler).Methods("GET")
+		router.HandleFunc(basePath("/parentagejobs"), ParentageJobsHandler).Methods("GET")
 		router.HandleFunc(basePath("/acquisitioneras_ci"), AcquisitionErasCiHandler).Methods("GET")
+		router.HandleFunc(basePath("/audit"), AuditHandler).Methods("GET")
 
 		router.HandleFunc(basePath("/blockparents"), BlockParentsHandler).Methods("POST")
 		router.HandleFunc(basePath("/fileArray"), FileArrayHandler).Methods("POST")
 		router.HandleFunc(basePath("/filelumis"), FileLumisHandler).Methods("POST")
+		router.HandleFunc(basePath("/runsummaries"), RunSummariesHandler).Methods("POST")
+		router.HandleFunc(basePath("/datasetlumimask"), DatasetLumiMaskHandler).Methods("POST")
 		router.HandleFunc(basePath("/datasetlist"), DatasetListHandler).Methods("POST")
 		router.HandleFunc(basePath("/fileparentsbylumi"), FileParentsByLumiHandler).Methods("POST")
 
@@ -175,6 +186,8 @@ func Handlers() *mux.Router {
 		router.HandleFunc(basePath("/datasets"), DatasetsHandler).Methods("POST", "PUT", "GET")
 		router.HandleFunc(basePath("/blocks"), BlocksHandler).Methods("POST", "PUT", "GET")
 		router.HandleFunc(basePath("/bulkblocks"), BulkBlocksHandler).Methods("POST")
+		router.HandleFunc(basePath("/bulkblocks/batch"), BulkBlocksBatchHandler).Methods("POST")
+		router.HandleFunc(basePath("/datasets/invalidate"), InvalidateDatasetHandler).Methods("POST")
 		router.HandleFunc(basePath("/files"), FilesHandler).Methods("POST", "PUT", "GET")
 		router.HandleFunc(basePath("/physicsgroups"), PhysicsGroupsHandler).Methods("POST")
 		router.HandleFunc(basePath("/datasetaccesstypes"), DatasetAccessTypesHandler).Methods("POST", "GET")
@@ -184,8 +197,11 @@ func Handlers() *mux.Router {
 		router.HandleFunc(basePath("/outputconfigs"), OutputConfigsHandler).Methods("POST", "GET")
 		router.HandleFunc(basePath("/fileparents"), FileParentsHandler).Methods("POST", "GET")
 		router.HandleFunc(basePath("/fileparentsbylumi"), FileParentsByLumiHandler).Methods("POST", "GET")
+		router.HandleFunc(basePath("/parentagecheck"), ParentageCheckHandler).Methods("POST", "GET")
+		router.HandleFunc(basePath("/parentagejobs"), ParentageJobsHandler).Methods("POST", "GET")
 		router.HandleFunc(basePath("/blockparents"), BlockParentsHandler).Methods("GET")
 		router.HandleFunc(basePath("/datasetparents"), DatasetParentsHandler).Methods("GET")
+		router.HandleFunc(basePath("/events"), EventsHandler).Methods("GET")
 	}
 
 	// aux APIs used by all DBS servers
@@ -204,7 +220,7 @@ func Handlers() *mux.Router {
 	// for all requests
 	router.Use(headerMiddleware)
 	// for all requests
-	router.Use(logging.LoggingMiddleware)
+	router.Use(loggingMiddleware)
 	// for all requests perform first auth/authz action
 	router.Use(authMiddleware)
 	// validate all input parameters
@@ -252,7 +268,7 @@ func dbInit(dbtype, dburi string) (*sql.DB, error) {
 	//     if pdb != nil {
 	//         pdb.Close()
 	//     }
-	db, dberr := sql.Open(dbtype, dburi)
+	db, dberr := dbs.OpenDB(dbtype, dburi)
 	if dberr != nil {
 		log.Printf("unable to open %s, error %v", dbtype, dburi)
 		return nil, dberr
@@ -298,6 +314,132 @@ func dbMonitor(dbtype, dburi string, interval int) {
 	}
 }
 
+// helper function to initialize DBS layer from configuration, i.e. its
+// settings, database connections, Lexicon patterns and SQL statements, it
+// is shared by DBS server and command line tools and returns function which
+// closes database connections
+//
+//gocyclo:ignore
+func initDBS() (func(), error) {
+	var dbList []*sql.DB
+	closeDBS := func() {
+		for _, db := range dbList {
+			db.Close()
+		}
+	}
+
+	// initialize record validator
+	dbs.RecordValidator = validator.New()
+
+	// set configuration for []FileLumi insertion
+	dbs.FileChunkSize = Config.FileChunkSize
+	dbs.FileLumiChunkSize = Config.FileLumiChunkSize
+	dbs.FileLumiMaxSize = Config.FileLumiMaxSize
+	dbs.FileLumiInsertMethod = Config.FileLumiInsertMethod
+	dbs.ApiParametersFile = Config.ApiParametersFile
+	dbs.TlsRefreshInterval = Config.TlsRefreshInterval
+
+	// set database connection once
+	log.Println("parse Config.DBFile:", Config.DBFile)
+	dbtype, dburi, dbowner := dbs.ParseDBFile(Config.DBFile)
+	// for oci driver we know it is oracle backend
+	if strings.HasPrefix(dbtype, "oci") {
+		utils.ORACLE = true
+	}
+	db, dberr := dbInit(dbtype, dburi)
+	if dberr != nil {
+		return nil, dberr
+	}
+	dbs.DB = db
+	dbs.DBTYPE = dbtype
+	dbList = append(dbList, db)
+
+	// setup MigrationDB access
+	if Config.ServerType == "DBSMigration" || Config.ServerType == "DBSMigrate" {
+		log.Println("parse Config.MigrationDBFile:", Config.MigrationDBFile)
+		dbtype, dburi, dbowner := dbs.ParseDBFile(Config.MigrationDBFile)
+		db, dberr := dbInit(dbtype, dburi)
+		if dberr != nil {
+			closeDBS()
+			return nil, dberr
+		}
+		log.Printf("obtain MigrationDB dburi for %s and %s", dbtype, dbowner)
+		dbs.MigrationDB = db
+		dbList = append(dbList, db)
+
+		// setup databases used as migration sources
+		for name, dbfile := range Config.MigrationSourceDBs {
+			dbtype, dburi, dbowner := dbs.ParseDBFile(dbfile)
+			db, dberr := dbInit(dbtype, dburi)
+			if dberr != nil {
+				closeDBS()
+				return nil, dberr
+			}
+			log.Printf("obtain migration source %s dburi for %s and %s", name, dbtype, dbowner)
+			dbs.MigrationSourceDBs[name] = dbs.NewMigrationSourceDB(db, dbtype, dbowner)
+			dbList = append(dbList, db)
+		}
+	}
+
+	// load Lexicon patterns
+	lexPatterns, err := dbs.LoadPatterns(Config.LexiconFile)
+	if err != nil {
+		closeDBS()
+		return nil, err
+	}
+	dbs.LexiconPatterns = lexPatterns
+
+	// load DBS SQL statements
+	dbsql := dbs.LoadSQL(dbowner)
+	dbs.DBSQL = dbsql
+	dbs.DBOWNER = dbowner
+
+	// migration settings
+	dbs.MigrationAsyncTimeout = Config.MigrationAsyncTimeout
+	dbs.MigrationProcessTimeout = Config.MigrationProcessTimeout
+	dbs.MigrationServerInterval = Config.MigrationServerInterval
+	dbs.MigrationCleanupInterval = Config.MigrationCleanupInterval
+	dbs.MigrationCleanupOffset = Config.MigrationCleanupOffset
+	dbs.MigrationRetries = Config.MigrationRetries
+	dbs.MigrationUserQuota = Config.MigrationQuota
+	dbs.MigrationUserQuotas = Config.MigrationUserQuotas
+	dbs.MigrationGroups = Config.MigrationGroups
+	dbs.MigrationAdmins = Config.MigrationAdmins
+	dbs.MigrationSourceDirs = Config.MigrationSourceDirs
+	if Config.MigrationWorkers > 0 {
+		dbs.MigrationWorkers = Config.MigrationWorkers
+	}
+
+	// DBS bulkblocks API
+	dbs.ConcurrentBulkBlocks = Config.ConcurrentBulkBlocks
+	dbs.StreamBulkBlocks = Config.StreamBulkBlocks
+	if Config.StreamFilesBatch > 0 {
+		dbs.StreamFilesBatch = Config.StreamFilesBatch
+	}
+
+	// provenance API
+	if Config.ProvenanceMaxNodes > 0 {
+		dbs.ProvenanceMaxNodes = Config.ProvenanceMaxNodes
+	}
+
+	// parentage jobs
+	if Config.ParentageChunkSize > 0 {
+		dbs.ParentageChunkSize = Config.ParentageChunkSize
+	}
+	if Config.ParentageJobLease > 0 {
+		dbs.ParentageJobLease = Config.ParentageJobLease
+	}
+
+	// idempotency keys of DBS POST APIs
+	if Config.IdempotencyKeyTTL > 0 {
+		dbs.IdempotencyKeyTTL = Config.IdempotencyKeyTTL
+	}
+	if Config.IdempotencyLease > 0 {
+		dbs.IdempotencyLease = Config.IdempotencyLease
+	}
+	return closeDBS, nil
+}
+
 // Server represents main web server for DBS service
 //
 //gocyclo:ignore
@@ -356,17 +498,6 @@ func Server(configFile string) {
 	// initialize limiter
 	initLimiter(Config.LimiterPeriod)
 
-	// initialize record validator
-	dbs.RecordValidator = validator.New()
-
-	// set configuration for []FileLumi insertion
-	dbs.FileChunkSize = Config.FileChunkSize
-	dbs.FileLumiChunkSize = Config.FileLumiChunkSize
-	dbs.FileLumiMaxSize = Config.FileLumiMaxSize
-	dbs.FileLumiInsertMethod = Config.FileLumiInsertMethod
-	dbs.ApiParametersFile = Config.ApiParametersFile
-	dbs.TlsRefreshInterval = Config.TlsRefreshInterval
-
 	// initialize templates
 	tmplData := make(map[string]interface{})
 	tmplData["Time"] = time.Now()
@@ -381,56 +512,18 @@ func Server(configFile string) {
 		http.Handle(m, http.StripPrefix(m, http.FileServer(http.Dir(d))))
 	}
 
-	// set database connection once
-	log.Println("parse Config.DBFile:", Config.DBFile)
-	dbtype, dburi, dbowner := dbs.ParseDBFile(Config.DBFile)
-	// for oci driver we know it is oracle backend
-	if strings.HasPrefix(dbtype, "oci") {
-		utils.ORACLE = true
-	}
-	db, dberr := dbInit(dbtype, dburi)
-	if dberr != nil {
-		log.Fatal(dberr)
-	}
-	dbs.DB = db
-	dbs.DBTYPE = dbtype
-	defer dbs.DB.Close()
-
-	// setup MigrationDB access
-	if Config.ServerType == "DBSMigration" || Config.ServerType == "DBSMigrate" {
-		log.Println("parse Config.MigrationDBFile:", Config.MigrationDBFile)
-		dbtype, dburi, dbowner := dbs.ParseDBFile(Config.MigrationDBFile)
-		db, dberr := dbInit(dbtype, dburi)
-		if dberr != nil {
-			log.Fatal(dberr)
-		}
-		log.Printf("obtain MigrationDB dburi for %s and %s", dbtype, dbowner)
-		dbs.MigrationDB = db
-		defer dbs.MigrationDB.Close()
-	}
-
-	// load Lexicon patterns
-	lexPatterns, err := dbs.LoadPatterns(Config.LexiconFile)
+	// initialize DBS layer
+	closeDBS, err := initDBS()
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbs.LexiconPatterns = lexPatterns
-
-	// load DBS SQL statements
-	dbsql := dbs.LoadSQL(dbowner)
-	dbs.DBSQL = dbsql
-	dbs.DBOWNER = dbowner
+	defer closeDBS()
 
-	// migration settings
-	dbs.MigrationAsyncTimeout = Config.MigrationAsyncTimeout
-	dbs.MigrationProcessTimeout = Config.MigrationProcessTimeout
-	dbs.MigrationServerInterval = Config.MigrationServerInterval
-	dbs.MigrationCleanupInterval = Config.MigrationCleanupInterval
-	dbs.MigrationCleanupOffset = Config.MigrationCleanupOffset
-	dbs.MigrationRetries = Config.MigrationRetries
+	// reader API response cache
+	InitCache()
 
-	// DBS bulkblocks API
-	dbs.ConcurrentBulkBlocks = Config.ConcurrentBulkBlocks
+	// change events of writer APIs
+	InitEvents()
 
 	// init graphql
 	if Config.GraphQLSchema != "" {
@@ -505,6 +598,7 @@ func Server(configFile string) {
 
 	// star db monitoring goroutine
 	if Config.DBMonitoringInterval > 0 {
+		dbtype, dburi, _ := dbs.ParseDBFile(Config.DBFile)
 		go dbMonitor(dbtype, dburi, Config.DBMonitoringInterval)
 	}
 
@@ -0,0 +1,29 @@
+package web
+
+// tools module provides initialization of DBS layer used by dbs2go
+// command line tools, e.g. export and import of datasets, which access
+// DBS database directly without running the server
+
+import (
+	"log"
+
+	"github.com/dmwm/dbs2go/utils"
+)
+
+// InitTool initializes DBS layer from given configuration file, it returns
+// function which should be called to release DB connections
+func InitTool(configFile string) (func(), error) {
+	err := ParseConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	utils.VERBOSE = Config.Verbose
+	utils.STATICDIR = Config.StaticDir
+	log.SetFlags(0)
+	if Config.Verbose > 0 {
+		log.SetFlags(log.Lshortfile)
+	}
+
+	// initialize DBS layer in the same way as DBS server
+	return initDBS()
+}